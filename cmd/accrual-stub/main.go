@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"github.com/llaxzi/gophermart/internal/accrual"
+	"github.com/llaxzi/gophermart/internal/accrual/stub"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// accrual-stub - заглушка системы начислений для локальной разработки.
+//
+//	go run ./cmd/accrual-stub -a :8080
+//	go run ./cmd/accrual-stub -a :8080 -burst-every 20 -burst-length 5 -error-rate 0.1 -latency 200ms
+//	go run ./cmd/gophermart -r http://localhost:8080 ...
+func main() {
+	config := stub.DefaultConfig()
+
+	runAddr := flag.String("a", ":8080", "run address")
+	statuses := flag.String("statuses", "REGISTERED,PROCESSING,PROCESSED", "status progression, one step per poll")
+	flag.Float64Var(&config.InvalidRate, "invalid-rate", 0, "share of orders that end up INVALID")
+	flag.Float64Var(&config.MinAccrual, "min", config.MinAccrual, "min accrual for PROCESSED orders")
+	flag.Float64Var(&config.MaxAccrual, "max", config.MaxAccrual, "max accrual for PROCESSED orders")
+	flag.BoolVar(&config.AutoRegister, "auto", true, "register unknown orders on first poll, otherwise answer 204")
+	flag.IntVar(&config.BurstEvery, "burst-every", 0, "answer 429 after every N requests, 0 disables")
+	flag.IntVar(&config.BurstLength, "burst-length", 1, "number of 429 responses in a burst")
+	flag.DurationVar(&config.RetryAfter, "retry-after", config.RetryAfter, "Retry-After of 429 responses")
+	flag.Float64Var(&config.ErrorRate, "error-rate", 0, "share of 500 responses")
+	flag.DurationVar(&config.Latency, "latency", 0, "delay of every response")
+	flag.DurationVar(&config.Jitter, "jitter", 0, "random extra delay up to this value")
+	flag.Int64Var(&config.Seed, "seed", 0, "random seed, 0 - random")
+	flag.Parse()
+
+	config.Statuses = nil
+	for _, status := range strings.Split(*statuses, ",") {
+		switch s := accrual.Status(strings.TrimSpace(status)); s {
+		case accrual.StatusRegistered, accrual.StatusInvalid, accrual.StatusProcessing, accrual.StatusProcessed:
+			config.Statuses = append(config.Statuses, s)
+		default:
+			log.Fatalf("Unknown status %q", status)
+		}
+	}
+	if envRunAddr := os.Getenv("RUN_ADDRESS"); envRunAddr != "" {
+		*runAddr = envRunAddr
+	}
+
+	log.Printf("Accrual stub listening on %s", *runAddr)
+	if err := http.ListenAndServe(*runAddr, stub.NewStub(config)); err != nil {
+		log.Fatalf("Accrual stub stopped: %v", err)
+	}
+}
@@ -3,17 +3,34 @@ package main
 import (
 	"context"
 	"errors"
+	"expvar"
+	"fmt"
 	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/accrual"
 	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/breaker"
+	"github.com/llaxzi/gophermart/internal/cookieauth"
+	"github.com/llaxzi/gophermart/internal/events"
 	"github.com/llaxzi/gophermart/internal/handler"
+	"github.com/llaxzi/gophermart/internal/keyring"
+	"github.com/llaxzi/gophermart/internal/lockout"
+	"github.com/llaxzi/gophermart/internal/mfa"
 	"github.com/llaxzi/gophermart/internal/middleware"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/gophermart/internal/oidc"
 	"github.com/llaxzi/gophermart/internal/orders"
+	"github.com/llaxzi/gophermart/internal/passwords"
 	"github.com/llaxzi/gophermart/internal/repository"
+	"github.com/llaxzi/gophermart/internal/revocation"
 	"github.com/llaxzi/gophermart/internal/tokens"
+	"github.com/llaxzi/gophermart/internal/validation"
+	"github.com/llaxzi/gophermart/internal/webhooks"
 	"github.com/llaxzi/retryables/v2"
 	"log"
+	"math"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -42,35 +59,161 @@ func main() {
 	})
 
 	// Запуск миграции из сервиса, при необходимости
-	err = repo.Bootstrap(databaseDSN, 1)
+	err = repo.Bootstrap(databaseDSN, 0)
 	if err != nil {
 		log.Fatalf("Failed to bootstrap repository: %v", err)
 		return
 	}
 
-	tokenB := tokens.NewTokenBuilder([]byte("key"), time.Hour*3)
+	keys, err := loadKeys()
+	if err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+		return
+	}
+
+	tokenB := tokens.NewTokenBuilder(keys, time.Minute*15, time.Hour*24*30)
 
-	mid := middleware.NewMiddleware([]byte("key"))
+	revoker := revocation.NewChecker(repo, time.Second*30)
 
-	userHandler := handler.NewUserHandler(repo, tokenB, retryer)
+	cookieConfig := cookieauth.DefaultConfig()
+	cookieConfig.Enabled = authCookie
+	cookieConfig.Domain = cookieDomain
+	cookies := cookieauth.NewManager(cookieConfig)
+
+	mid := middleware.NewMiddleware(keys, revoker, repo, cookies)
+
+	limiter := lockout.NewLimiter(repo, lockout.Config{
+		LoginAttempts: 5,
+		IPAttempts:    20,
+		TOTPAttempts:  5,
+		BaseDelay:     time.Second * 2,
+		MaxDelay:      time.Minute * 15,
+		Window:        time.Hour,
+	})
+
+	validationConfig, err := loadValidationConfig()
+	if err != nil {
+		log.Fatalf("Failed to configure password policy: %v", err)
+		return
+	}
+	validator := validation.NewValidator(validationConfig)
+
+	// Параметры проверяет NewHasher, здесь только диапазоны типов Config
+	if argon2Time > math.MaxUint32 || argon2Memory > math.MaxUint32 || argon2Threads > math.MaxUint8 {
+		log.Fatalf("Invalid argon2id parameters: time %d, memory %d, threads %d", argon2Time, argon2Memory, argon2Threads)
+	}
+	hashConfig := passwords.DefaultConfig()
+	hashConfig.Algorithm = passwordHash
+	hashConfig.BcryptCost = bcryptCost
+	hashConfig.Argon2Time = uint32(argon2Time)
+	hashConfig.Argon2Memory = uint32(argon2Memory)
+	hashConfig.Argon2Threads = uint8(argon2Threads)
+	hasher, err := passwords.NewHasher(hashConfig)
+	if err != nil {
+		log.Fatalf("Failed to create password hasher: %v", err)
+	}
+
+	mfaConfig := mfa.DefaultConfig()
+	mfaConfig.WithdrawThreshold = withdrawTOTPThreshold
+	mfaAuth := mfa.NewAuthenticator(repo, mfaConfig)
+
+	// Вход через OIDC провайдер включается заданием issuer
+	var oidcProvider oidc.Provider
+	if oidcIssuer != "" {
+		oidcConfig := oidc.DefaultConfig()
+		oidcConfig.Issuer = oidcIssuer
+		oidcConfig.ClientID = oidcClientID
+		oidcConfig.ClientSecret = oidcClientSecret
+		oidcConfig.RedirectURL = oidcRedirectURL
+		oidcProvider = oidc.NewProvider(oidcConfig)
+	}
+
+	// События заказов для SSE, между инстансами передаются через LISTEN/NOTIFY
+	broker := events.NewBroker(16)
+	bridge, err := events.NewBridge(broker, repo, databaseDSN)
+	if err != nil {
+		log.Fatalf("Failed to create order events bridge: %v", err)
+	}
+
+	userHandler := handler.NewUserHandler(repo, tokenB, retryer, revoker, limiter, validator, hasher, mfaAuth, cookies, oidcProvider)
+	keysHandler := handler.NewKeysHandler(keys)
+	apiKeyHandler := handler.NewAPIKeyHandler(repo, retryer)
+	adminHandler := handler.NewAdminHandler(repo, retryer, revoker)
+	mfaHandler := handler.NewMFAHandler(mfaAuth, retryer, limiter, revoker)
+	sessionHandler := handler.NewSessionHandler(repo, retryer, revoker)
+	accountHandler := handler.NewAccountHandler(repo, retryer, hasher, revoker)
+	eventsHandler := handler.NewEventsHandler(broker, time.Second*30)
+	webhookHandler := handler.NewWebhookHandler(repo, retryer)
 
 	e := echo.New()
+	// IP для блокировки входа берём из соединения, X-Forwarded-For подделывается клиентом
+	e.IPExtractor = echo.ExtractIPDirect()
 
+	e.GET("/.well-known/jwks.json", keysHandler.JWKS)
 	e.POST("/api/user/register", userHandler.Register)
 	e.POST("/api/user/login", userHandler.Login)
+	e.POST("/api/user/login/2fa", userHandler.LoginMFA)
+	e.POST("/api/user/token/refresh", userHandler.RefreshToken)
+	if oidcProvider != nil {
+		e.GET("/api/user/oidc/login", userHandler.OIDCLogin)
+		e.GET("/api/user/oidc/callback", userHandler.OIDCCallback)
+	}
 
 	auth := e.Group("", mid.Auth)
 	gzip := auth.Group("", mid.Gzip)
+	// Управление аккаунтом и ключами только по JWT
+	account := auth.Group("", mid.RequireJWT)
+
+	account.DELETE("/api/user", accountHandler.Delete)
+	account.GET("/api/user/export", accountHandler.Export)
+	account.POST("/api/user/logout", userHandler.Logout)
+	account.POST("/api/user/logout/all", userHandler.LogoutAll)
+	account.POST("/api/user/password", userHandler.ChangePassword)
+	account.PUT("/api/user/login", userHandler.ChangeLogin)
+	account.POST("/api/user/api-keys", apiKeyHandler.Create)
+	account.GET("/api/user/api-keys", apiKeyHandler.List)
+	account.DELETE("/api/user/api-keys/:id", apiKeyHandler.Revoke)
+	account.POST("/api/user/2fa/setup", mfaHandler.Setup)
+	account.POST("/api/user/2fa/enable", mfaHandler.Enable)
+	account.POST("/api/user/2fa/disable", mfaHandler.Disable)
+	account.GET("/api/user/sessions", sessionHandler.List)
+	account.DELETE("/api/user/sessions/:id", sessionHandler.Delete)
+	account.POST("/api/user/webhooks", webhookHandler.Create)
+	account.GET("/api/user/webhooks", webhookHandler.List)
+	account.DELETE("/api/user/webhooks/:id", webhookHandler.Delete)
+	account.GET("/api/user/webhooks/:id/deliveries", webhookHandler.Deliveries)
+	auth.POST("/api/user/orders", userHandler.AddOrder, mid.RequireScope(models.ScopeOrdersWrite))
+	auth.POST("/api/user/orders/batch", userHandler.AddOrdersBatch, mid.RequireScope(models.ScopeOrdersWrite))
+	gzip.GET("/api/user/orders", userHandler.GetOrders, mid.RequireScope(models.ScopeOrdersRead))
+	auth.GET("/api/user/orders/events", eventsHandler.OrderEvents, mid.RequireScope(models.ScopeOrdersRead))
+	auth.GET("/api/user/orders/:number", userHandler.GetOrder, mid.RequireScope(models.ScopeOrdersRead))
+	auth.GET("/api/user/balance", userHandler.GetBalance, mid.RequireScope(models.ScopeBalanceRead))
+	auth.POST("/api/user/balance/withdraw", userHandler.Withdraw, mid.RequireScope(models.ScopeBalanceWrite))
+	gzip.GET("/api/user/withdrawals", userHandler.GetWithdrawals, mid.RequireScope(models.ScopeBalanceRead))
 
-	auth.POST("/api/user/orders", userHandler.AddOrder)
-	gzip.GET("/api/user/orders", userHandler.GetOrders)
-	auth.GET("/api/user/balance", userHandler.GetBalance)
-	auth.POST("/api/user/balance/withdraw", userHandler.Withdraw)
-	gzip.GET("/api/user/withdrawals", userHandler.GetWithdrawals)
+	admin := account.Group("/api/admin", mid.RequireRole(models.RoleSupport, models.RoleAdmin))
+	admin.GET("/users/:login/orders", adminHandler.GetUserOrders)
+	admin.GET("/users/:login/balance", adminHandler.GetUserBalance)
+	admin.GET("/users/:login/sessions", adminHandler.GetUserSessions)
+	admin.PUT("/users/:login/role", adminHandler.SetRole, mid.RequireRole(models.RoleAdmin))
+	// expvar: состояние circuit breaker'ов и runtime, cmdline может содержать DSN, поэтому только для админов
+	admin.GET("/metrics", echo.WrapHandler(expvar.Handler()), mid.RequireRole(models.RoleAdmin))
 
-	processor := orders.NewProcessor(repo, retryer, accrualAddr, 1*time.Second, 5)
+	if accrualBreakerThreshold < 1 || accrualBreakerCoolDown <= 0 {
+		log.Fatalf("Invalid accrual breaker settings: threshold %d, cool-down %v", accrualBreakerThreshold, accrualBreakerCoolDown)
+	}
+	accrualBreaker := breaker.NewBreaker("accrual", breaker.Config{FailureThreshold: accrualBreakerThreshold, CoolDown: accrualBreakerCoolDown})
+	processor := orders.NewProcessor(repo, retryer, accrual.NewClient(accrualAddr), accrualBreaker, 1*time.Second, 5, bridge)
 	ctx, cancel := context.WithCancel(context.Background())
 	go processor.ProcessOrders(ctx)
+	go bridge.Listen(ctx)
+
+	// Вебхуки доставляются из очереди в БД, таймаут задаётся конфигом диспетчера
+	dispatcher := webhooks.NewDispatcher(repo, webhooks.NewClient(), webhooks.DefaultConfig())
+	go dispatcher.Run(ctx)
+
+	// Истёкшие токены и старые счётчики входа больше не нужны для проверок, чистим их раз в час
+	go cleanup(ctx, repo, limiter, time.Hour)
 
 	// Запускаем сервер
 	go func() {
@@ -80,6 +223,19 @@ func main() {
 		}
 	}()
 
+	// SIGHUP перечитывает ключи подписи без перезапуска
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	go func() {
+		for range hupCh {
+			if err := keys.Reload(); err != nil {
+				log.Printf("Failed to reload JWT keys, keeping previous: %v", err)
+				continue
+			}
+			log.Println("JWT keys reloaded")
+		}
+	}()
+
 	// Перехватываем сигнал Ctrl+C
 	signalCh := make(chan os.Signal, 1)
 	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
@@ -87,3 +243,71 @@ func main() {
 	<-signalCh
 	cancel()
 }
+
+// cleanup периодически удаляет из БД записи, срок которых вышел
+func cleanup(ctx context.Context, repo repository.Repository, limiter lockout.Limiter, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := repo.DeleteExpiredTokens(ctx, time.Now()); err != nil {
+				log.Printf("Failed to delete expired tokens: %v", err)
+			}
+			if err := limiter.Prune(ctx); err != nil {
+				log.Printf("Failed to prune login attempts: %v", err)
+			}
+		}
+	}
+}
+
+// loadKeys - ключи из файла (-k / JWT_KEYS_FILE) или из env JWT_KEYS.
+// Без конфигурации используется ключ для локальной разработки.
+func loadKeys() (keyring.Keyring, error) {
+	if jwtKeysFile != "" {
+		return keyring.NewKeyring(keyring.FileSource(jwtKeysFile))
+	}
+	if os.Getenv("JWT_KEYS") != "" {
+		return keyring.NewKeyring(keyring.EnvSource("JWT_KEYS"))
+	}
+	log.Println("JWT keys are not configured, using development key")
+	return keyring.NewStatic(keyring.Key{ID: "dev", Secret: []byte("key")}), nil
+}
+
+// loadValidationConfig - политика паролей по умолчанию с настройками из флагов и env.
+// Словарь из файла дополняет встроенный, а не заменяет его.
+func loadValidationConfig() (validation.Config, error) {
+	config := validation.DefaultConfig()
+	if passwordMinLength < 1 || passwordMinLength > config.MaxPasswordLength {
+		return config, fmt.Errorf("password min length must be between 1 and %d", config.MaxPasswordLength)
+	}
+	config.MinPasswordLength = passwordMinLength
+
+	for _, class := range strings.Split(passwordClasses, ",") {
+		switch strings.TrimSpace(class) {
+		case "":
+		case "lower":
+			config.RequireLower = true
+		case "upper":
+			config.RequireUpper = true
+		case "digit":
+			config.RequireDigit = true
+		case "symbol":
+			config.RequireSymbol = true
+		default:
+			return config, fmt.Errorf("unknown password character class %q", class)
+		}
+	}
+
+	if passwordDenylistFile != "" {
+		data, err := os.ReadFile(passwordDenylistFile)
+		if err != nil {
+			return config, err
+		}
+		config.Denylist = append(config.Denylist, strings.Fields(string(data))...)
+	}
+	return config, nil
+}
@@ -2,14 +2,62 @@ package main
 
 import (
 	"flag"
+	"github.com/llaxzi/gophermart/internal/breaker"
+	"github.com/llaxzi/gophermart/internal/passwords"
+	"log"
 	"os"
+	"strconv"
+	"time"
 )
 
 var runAddr string
 var databaseDSN string
 var accrualAddr string
+var accrualBreakerThreshold int
+var accrualBreakerCoolDown time.Duration
+var jwtKeysFile string
+var passwordHash string
+var bcryptCost int
+var argon2Time uint
+var argon2Memory uint
+var argon2Threads uint
+var passwordMinLength int
+var passwordClasses string
+var passwordDenylistFile string
+var withdrawTOTPThreshold float64
+var authCookie bool
+var cookieDomain string
+var oidcIssuer string
+var oidcClientID string
+var oidcClientSecret string
+var oidcRedirectURL string
 
+// parseVars - env переменные имеют приоритет над флагами
 func parseVars() {
+	flag.StringVar(&runAddr, "a", "", "run address")
+	flag.StringVar(&databaseDSN, "d", "", "database dsn")
+	flag.StringVar(&accrualAddr, "r", "", "accrual system address")
+	breakerDefaults := breaker.DefaultConfig()
+	flag.IntVar(&accrualBreakerThreshold, "accrual-breaker-threshold", breakerDefaults.FailureThreshold, "consecutive accrual failures that open the circuit breaker")
+	flag.DurationVar(&accrualBreakerCoolDown, "accrual-breaker-cooldown", breakerDefaults.CoolDown, "how long the accrual circuit breaker stays open")
+	flag.StringVar(&jwtKeysFile, "k", "", "JWT signing keys file")
+	flag.StringVar(&passwordHash, "p", "bcrypt", "password hash algorithm: bcrypt or argon2id")
+	hashDefaults := passwords.DefaultConfig()
+	flag.IntVar(&bcryptCost, "bcrypt-cost", hashDefaults.BcryptCost, "bcrypt cost of new password hashes")
+	flag.UintVar(&argon2Time, "argon2-time", uint(hashDefaults.Argon2Time), "argon2id iterations")
+	flag.UintVar(&argon2Memory, "argon2-memory", uint(hashDefaults.Argon2Memory), "argon2id memory in KiB")
+	flag.UintVar(&argon2Threads, "argon2-threads", uint(hashDefaults.Argon2Threads), "argon2id parallelism")
+	flag.IntVar(&passwordMinLength, "password-min-length", 8, "minimum password length")
+	flag.StringVar(&passwordClasses, "password-classes", "", "required password character classes, comma separated: lower,upper,digit,symbol")
+	flag.StringVar(&passwordDenylistFile, "password-denylist", "", "file with additional forbidden passwords, one per line")
+	flag.Float64Var(&withdrawTOTPThreshold, "t", 1000, "withdrawals above this sum require a TOTP code")
+	flag.BoolVar(&authCookie, "c", false, "also issue tokens in HttpOnly cookies for browser clients")
+	flag.StringVar(&cookieDomain, "cookie-domain", "", "domain attribute of auth cookies")
+	flag.StringVar(&oidcIssuer, "oidc-issuer", "", "OpenID Connect issuer URL, enables login via the provider")
+	flag.StringVar(&oidcClientID, "oidc-client-id", "", "OpenID Connect client id")
+	flag.StringVar(&oidcRedirectURL, "oidc-redirect-url", "", "OpenID Connect redirect URL (/api/user/oidc/callback)")
+	flag.Parse()
+
 	if envRunAddr := os.Getenv("RUN_ADDRESS"); envRunAddr != "" {
 		runAddr = envRunAddr
 	}
@@ -19,17 +67,89 @@ func parseVars() {
 	if envAccrualAddr := os.Getenv("ACCRUAL_SYSTEM_ADDRESS"); envAccrualAddr != "" {
 		accrualAddr = envAccrualAddr
 	}
-
-	flagRunAddr := flag.String("a", "", "run address")
-	if *flagRunAddr != "" {
-		runAddr = *flagRunAddr
+	if envThreshold := os.Getenv("ACCRUAL_BREAKER_THRESHOLD"); envThreshold != "" {
+		threshold, err := strconv.Atoi(envThreshold)
+		if err != nil {
+			log.Fatalf("Invalid ACCRUAL_BREAKER_THRESHOLD: %v", err)
+		}
+		accrualBreakerThreshold = threshold
+	}
+	if envCoolDown := os.Getenv("ACCRUAL_BREAKER_COOLDOWN"); envCoolDown != "" {
+		coolDown, err := time.ParseDuration(envCoolDown)
+		if err != nil {
+			log.Fatalf("Invalid ACCRUAL_BREAKER_COOLDOWN: %v", err)
+		}
+		accrualBreakerCoolDown = coolDown
+	}
+	if envJWTKeysFile := os.Getenv("JWT_KEYS_FILE"); envJWTKeysFile != "" {
+		jwtKeysFile = envJWTKeysFile
+	}
+	if envPasswordHash := os.Getenv("PASSWORD_HASH"); envPasswordHash != "" {
+		passwordHash = envPasswordHash
+	}
+	if envBcryptCost := os.Getenv("BCRYPT_COST"); envBcryptCost != "" {
+		cost, err := strconv.Atoi(envBcryptCost)
+		if err != nil {
+			log.Fatalf("Invalid BCRYPT_COST: %v", err)
+		}
+		bcryptCost = cost
+	}
+	if envArgon2Time := os.Getenv("ARGON2_TIME"); envArgon2Time != "" {
+		argon2Time = parseUintEnv("ARGON2_TIME", envArgon2Time, 32)
+	}
+	if envArgon2Memory := os.Getenv("ARGON2_MEMORY"); envArgon2Memory != "" {
+		argon2Memory = parseUintEnv("ARGON2_MEMORY", envArgon2Memory, 32)
+	}
+	if envArgon2Threads := os.Getenv("ARGON2_THREADS"); envArgon2Threads != "" {
+		argon2Threads = parseUintEnv("ARGON2_THREADS", envArgon2Threads, 8)
+	}
+	if envMinLength := os.Getenv("PASSWORD_MIN_LENGTH"); envMinLength != "" {
+		minLength, err := strconv.Atoi(envMinLength)
+		if err != nil {
+			log.Fatalf("Invalid PASSWORD_MIN_LENGTH: %v", err)
+		}
+		passwordMinLength = minLength
 	}
-	flagDatabaseDSN := flag.String("d", "", "database dsn")
-	if *flagDatabaseDSN != "" {
-		runAddr = *flagDatabaseDSN
+	if envClasses := os.Getenv("PASSWORD_CLASSES"); envClasses != "" {
+		passwordClasses = envClasses
 	}
-	flagAccrualAddr := flag.String("r", "", "accrual system address")
-	if *flagAccrualAddr != "" {
-		runAddr = *flagAccrualAddr
+	if envDenylistFile := os.Getenv("PASSWORD_DENYLIST_FILE"); envDenylistFile != "" {
+		passwordDenylistFile = envDenylistFile
+	}
+	if envThreshold := os.Getenv("WITHDRAW_TOTP_THRESHOLD"); envThreshold != "" {
+		threshold, err := strconv.ParseFloat(envThreshold, 64)
+		if err != nil {
+			log.Fatalf("Invalid WITHDRAW_TOTP_THRESHOLD: %v", err)
+		}
+		withdrawTOTPThreshold = threshold
+	}
+	if envAuthCookie := os.Getenv("AUTH_COOKIE"); envAuthCookie != "" {
+		enabled, err := strconv.ParseBool(envAuthCookie)
+		if err != nil {
+			log.Fatalf("Invalid AUTH_COOKIE: %v", err)
+		}
+		authCookie = enabled
+	}
+	if envCookieDomain := os.Getenv("COOKIE_DOMAIN"); envCookieDomain != "" {
+		cookieDomain = envCookieDomain
+	}
+	if envOIDCIssuer := os.Getenv("OIDC_ISSUER"); envOIDCIssuer != "" {
+		oidcIssuer = envOIDCIssuer
+	}
+	if envOIDCClientID := os.Getenv("OIDC_CLIENT_ID"); envOIDCClientID != "" {
+		oidcClientID = envOIDCClientID
+	}
+	// Секрет клиента только из env, чтобы не попадал в список процессов
+	oidcClientSecret = os.Getenv("OIDC_CLIENT_SECRET")
+	if envOIDCRedirectURL := os.Getenv("OIDC_REDIRECT_URL"); envOIDCRedirectURL != "" {
+		oidcRedirectURL = envOIDCRedirectURL
+	}
+}
+
+func parseUintEnv(name string, value string, bitSize int) uint {
+	n, err := strconv.ParseUint(value, 10, bitSize)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", name, err)
 	}
+	return uint(n)
 }
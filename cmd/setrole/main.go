@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/llaxzi/gophermart/internal/repository"
+	"github.com/llaxzi/gophermart/internal/revocation"
+	"log"
+	"os"
+	"time"
+)
+
+// setrole назначает роль пользователю, например первого администратора.
+//
+//	go run ./cmd/setrole -d "$DATABASE_URI" -l alice -role admin
+func main() {
+	databaseDSN := flag.String("d", os.Getenv("DATABASE_URI"), "database dsn")
+	login := flag.String("l", "", "login")
+	role := flag.String("role", "", "role: user, support or admin")
+	flag.Parse()
+
+	if *login == "" || *role == "" {
+		log.Fatal("login (-l) and role (-role) are required")
+	}
+
+	repo, err := repository.NewRepository(*databaseDSN)
+	if err != nil {
+		log.Fatalf("Failed to initialize repository: %v", err)
+	}
+
+	ctx := context.Background()
+	userID, err := repo.SelectUserID(ctx, *login)
+	if err != nil {
+		log.Fatalf("Failed to find user: %v", err)
+	}
+	if err = repo.UpdateUserRole(ctx, userID, *role); err != nil {
+		log.Fatalf("Failed to set role: %v", err)
+	}
+	// Токены со старой ролью больше не принимаются
+	if err = revocation.NewChecker(repo, time.Minute).RevokeAll(ctx, userID); err != nil {
+		log.Fatalf("Failed to revoke tokens: %v", err)
+	}
+	log.Println("Role updated")
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/llaxzi/gophermart/internal/lockout"
+	"github.com/llaxzi/gophermart/internal/repository"
+	"log"
+	"os"
+)
+
+// unlock снимает блокировку входа, выставленную защитой от перебора паролей.
+//
+//	go run ./cmd/unlock -d "$DATABASE_URI" -l alice
+//	go run ./cmd/unlock -d "$DATABASE_URI" -ip 203.0.113.7
+func main() {
+	databaseDSN := flag.String("d", os.Getenv("DATABASE_URI"), "database dsn")
+	login := flag.String("l", "", "login to unlock")
+	ip := flag.String("ip", "", "client IP to unlock")
+	flag.Parse()
+
+	if *login == "" && *ip == "" {
+		log.Fatal("login (-l) or ip (-ip) is required")
+	}
+
+	repo, err := repository.NewRepository(*databaseDSN)
+	if err != nil {
+		log.Fatalf("Failed to initialize repository: %v", err)
+	}
+
+	limiter := lockout.NewLimiter(repo, lockout.Config{})
+	if err = limiter.Reset(context.Background(), *login, *ip); err != nil {
+		log.Fatalf("Failed to unlock: %v", err)
+	}
+	log.Println("Unlocked")
+}
@@ -0,0 +1,129 @@
+package accrual
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type Status string
+
+// Статусы расчёта в системе начислений
+const (
+	StatusRegistered Status = "REGISTERED"
+	StatusInvalid    Status = "INVALID"
+	StatusProcessing Status = "PROCESSING"
+	StatusProcessed  Status = "PROCESSED"
+)
+
+// Final - расчёт завершён, статус больше не изменится
+func (s Status) Final() bool {
+	return s == StatusInvalid || s == StatusProcessed
+}
+
+type Response struct {
+	Order   string   `json:"order"`
+	Status  Status   `json:"status"`
+	Accrual *float64 `json:"accrual,omitempty"`
+}
+
+// RateLimitError - ответ 429, RetryAfter == 0, если сервер не указал Retry-After
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", apperrors.ErrAccrualRateLimited, e.RetryAfter)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return apperrors.ErrAccrualRateLimited
+}
+
+// Client - запрос расчёта начислений по заказу.
+// Ошибки: apperrors.ErrOrderNotRegistered (204), *RateLimitError (429), apperrors.ErrAccrualServer (5xx),
+// apperrors.ErrAccrualUnavailable (нет ответа).
+type Client interface {
+	GetOrder(ctx context.Context, number string) (Response, error)
+}
+
+// NewClient - клиент HTTP API системы начислений, 500 и 503 повторяются с паузами 1, 3 и 5 секунд
+func NewClient(addr string) Client {
+	rc := resty.New().SetBaseURL(addr)
+	// Настройка retry
+	rc.SetRetryCount(3)
+	rc.SetRetryAfter(func(client *resty.Client, response *resty.Response) (time.Duration, error) {
+		retryCount := response.Request.Attempt
+		switch retryCount {
+		case 1:
+			return 1 * time.Second, nil
+		case 2:
+			return 3 * time.Second, nil
+		case 3:
+			return 5 * time.Second, nil
+		default:
+			return 0, nil
+		}
+	})
+	rc.AddRetryCondition(func(response *resty.Response, err error) bool {
+		if response.StatusCode() == http.StatusServiceUnavailable || response.StatusCode() == http.StatusInternalServerError {
+			return true
+		}
+		return false
+	}) // retry только в случае, если сервер недоступен (maintenance или перегрузка) или внут. ошибка
+
+	return &client{rc}
+}
+
+type client struct {
+	rc *resty.Client
+}
+
+func (c *client) GetOrder(ctx context.Context, number string) (Response, error) {
+	resp, err := c.rc.R().SetContext(ctx).SetPathParam("number", number).Get("/api/orders/{number}")
+	if err != nil {
+		return Response{}, fmt.Errorf("%w: %v", apperrors.ErrAccrualUnavailable, err)
+	}
+
+	switch code := resp.StatusCode(); {
+	case code == http.StatusOK:
+	case code == http.StatusNoContent:
+		return Response{}, apperrors.ErrOrderNotRegistered
+	case code == http.StatusTooManyRequests:
+		return Response{}, &RateLimitError{RetryAfter: parseRetryAfter(resp.Header().Get("Retry-After"))}
+	case code >= http.StatusInternalServerError:
+		return Response{}, fmt.Errorf("%w: %s", apperrors.ErrAccrualServer, resp.Status())
+	default:
+		return Response{}, fmt.Errorf("unexpected accrual response: %s", resp.Status())
+	}
+
+	// Content-Type не проверяем: тело разбираем как JSON в любом случае
+	var result Response
+	if err = json.Unmarshal(resp.Body(), &result); err != nil {
+		return Response{}, fmt.Errorf("failed to decode accrual response: %w", err)
+	}
+	switch result.Status {
+	case StatusRegistered, StatusInvalid, StatusProcessing, StatusProcessed:
+	default:
+		return Response{}, fmt.Errorf("unknown accrual status %q", result.Status)
+	}
+	return result, nil
+}
+
+// internal
+
+// parseRetryAfter - Retry-After в секундах или HTTP-датой
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && time.Until(at) > 0 {
+		return time.Until(at)
+	}
+	return 0
+}
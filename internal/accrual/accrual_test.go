@@ -0,0 +1,101 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClient_GetOrder(t *testing.T) {
+	// Accrual mock
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		number := r.URL.Path[len("/api/orders/"):]
+		switch number {
+		case "too_many_requests":
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "no_content":
+			w.WriteHeader(http.StatusNoContent)
+		case "error":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "bad_request":
+			w.WriteHeader(http.StatusBadRequest)
+		case "unknown_status":
+			fmt.Fprintf(w, `{"order":"%s","status":"LOST"}`, number)
+		case "registered":
+			fmt.Fprintf(w, `{"order":"%s","status":"REGISTERED"}`, number)
+		default:
+			// Content-Type намеренно не выставлен
+			fmt.Fprintf(w, `{"order":"%s","status":"PROCESSED","accrual":500}`, number)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL).(*client)
+	c.rc.SetRetryCount(0)
+
+	accrual := 500.0
+	tests := []struct {
+		name          string
+		number        string
+		expected      Response
+		expectedError error
+	}{
+		{"Processed", "12345", Response{Order: "12345", Status: StatusProcessed, Accrual: &accrual}, nil},
+		{"Registered", "registered", Response{Order: "registered", Status: StatusRegistered}, nil},
+		{"Not registered", "no_content", Response{}, apperrors.ErrOrderNotRegistered},
+		{"Rate limited", "too_many_requests", Response{}, apperrors.ErrAccrualRateLimited},
+		{"Server error", "error", Response{}, apperrors.ErrAccrualServer},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := c.GetOrder(context.Background(), test.number)
+
+			assert.ErrorIs(t, err, test.expectedError)
+			assert.Equal(t, test.expected, resp)
+		})
+	}
+
+	t.Run("Retry-After value", func(t *testing.T) {
+		_, err := c.GetOrder(context.Background(), "too_many_requests")
+
+		var rateLimit *RateLimitError
+		assert.True(t, errors.As(err, &rateLimit))
+		assert.Equal(t, 2*time.Second, rateLimit.RetryAfter)
+	})
+
+	for _, number := range []string{"bad_request", "unknown_status"} {
+		t.Run("Unexpected response "+number, func(t *testing.T) {
+			_, err := c.GetOrder(context.Background(), number)
+
+			assert.Error(t, err)
+			assert.False(t, errors.Is(err, apperrors.ErrAccrualServer))
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 60*time.Second, parseRetryAfter("60"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon"))
+	assert.InDelta(t, float64(time.Minute), float64(parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))), float64(2*time.Second))
+}
+
+func TestClient_Unavailable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	c := NewClient(server.URL).(*client)
+	c.rc.SetRetryCount(0)
+
+	_, err := c.GetOrder(context.Background(), "12345")
+
+	assert.ErrorIs(t, err, apperrors.ErrAccrualUnavailable)
+}
@@ -0,0 +1,219 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/llaxzi/gophermart/internal/accrual"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Stub - заглушка системы начислений для локальной разработки и тестов.
+// Отвечает на GET /api/orders/{number} как настоящая система, поведение задаётся Config.
+type Stub interface {
+	http.Handler
+	// Register регистрирует заказ со сценарием статусов, без statuses - сценарий из Config
+	Register(number string, statuses ...accrual.Status)
+	// Requests - число запросов GET /api/orders/{number}
+	Requests() int
+}
+
+type Config struct {
+	// Statuses - сценарий статусов: каждый опрос заказа переходит к следующему, последний повторяется
+	Statuses    []accrual.Status
+	InvalidRate float64 // доля автоматически зарегистрированных заказов со сценарием REGISTERED -> INVALID
+	MinAccrual  float64 // начисление для PROCESSED выбирается случайно из [MinAccrual, MaxAccrual]
+	MaxAccrual  float64
+	// AutoRegister - неизвестный заказ регистрируется при первом запросе, иначе на него отвечаем 204
+	AutoRegister bool
+
+	// После каждых BurstEvery запросов следующие BurstLength получают 429 с Retry-After, 0 - без 429
+	BurstEvery  int
+	BurstLength int
+	RetryAfter  time.Duration
+
+	ErrorRate float64       // доля ответов 500
+	Latency   time.Duration // задержка каждого ответа
+	Jitter    time.Duration // к задержке добавляется случайное значение из [0, Jitter)
+	Seed      int64         // 0 - случайное зерно
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Statuses:     []accrual.Status{accrual.StatusRegistered, accrual.StatusProcessing, accrual.StatusProcessed},
+		MinAccrual:   10,
+		MaxAccrual:   1000,
+		AutoRegister: true,
+		RetryAfter:   time.Minute,
+	}
+}
+
+func NewStub(config Config) Stub {
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	s := &stub{
+		config: config,
+		rnd:    rand.New(rand.NewSource(seed)),
+		orders: make(map[string]*order),
+		mux:    http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET /api/orders/{number}", s.getOrder)
+	s.mux.HandleFunc("POST /api/orders", s.registerOrder)
+	return s
+}
+
+// NewTestServer запускает заглушку в процессе, сервер нужно закрыть после теста
+func NewTestServer(config Config) (*httptest.Server, Stub) {
+	s := NewStub(config)
+	return httptest.NewServer(s), s
+}
+
+type stub struct {
+	config   Config
+	mu       sync.Mutex
+	rnd      *rand.Rand
+	orders   map[string]*order
+	requests int
+	mux      *http.ServeMux
+}
+
+type order struct {
+	statuses []accrual.Status
+	step     int
+	accrual  *float64
+}
+
+func (s *stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *stub) Register(number string, statuses ...accrual.Status) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(statuses) == 0 {
+		statuses = s.config.Statuses
+	}
+	s.orders[number] = &order{statuses: statuses}
+}
+
+func (s *stub) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *stub) getOrder(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	n := s.requests
+	delay := s.config.Latency
+	if s.config.Jitter > 0 {
+		delay += time.Duration(s.rnd.Int63n(int64(s.config.Jitter)))
+	}
+	failed := s.config.ErrorRate > 0 && s.rnd.Float64() < s.config.ErrorRate
+	s.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if s.limited(n) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(s.config.RetryAfter.Seconds()))))
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprintf(w, "No more than %d requests per burst allowed", s.config.BurstEvery)
+		return
+	}
+	if failed {
+		http.Error(w, "injected failure", http.StatusInternalServerError)
+		return
+	}
+
+	resp, ok := s.poll(r.PathValue("number"))
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// registerOrder - POST /api/orders {"order": "..."}, как регистрация заказа в настоящей системе
+func (s *stub) registerOrder(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Order string `json:"order"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Order == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	_, exists := s.orders[req.Order]
+	s.mu.Unlock()
+	if exists {
+		http.Error(w, "order already registered", http.StatusConflict)
+		return
+	}
+
+	s.Register(req.Order)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// internal
+
+// limited - попадает ли n-й запрос в серию 429
+func (s *stub) limited(n int) bool {
+	if s.config.BurstEvery <= 0 || s.config.BurstLength <= 0 {
+		return false
+	}
+	return (n-1)%(s.config.BurstEvery+s.config.BurstLength) >= s.config.BurstEvery
+}
+
+// poll возвращает текущий статус заказа и переводит его на следующий шаг сценария
+func (s *stub) poll(number string) (accrual.Response, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[number]
+	if !ok {
+		if !s.config.AutoRegister {
+			return accrual.Response{}, false
+		}
+		statuses := s.config.Statuses
+		if s.config.InvalidRate > 0 && s.rnd.Float64() < s.config.InvalidRate {
+			statuses = []accrual.Status{accrual.StatusRegistered, accrual.StatusInvalid}
+		}
+		o = &order{statuses: statuses}
+		s.orders[number] = o
+	}
+
+	resp := accrual.Response{Order: number, Status: accrual.StatusRegistered}
+	if len(o.statuses) > 0 {
+		resp.Status = o.statuses[min(o.step, len(o.statuses)-1)]
+	}
+	o.step++
+
+	if resp.Status == accrual.StatusProcessed {
+		if o.accrual == nil {
+			sum := s.config.MinAccrual + s.rnd.Float64()*(s.config.MaxAccrual-s.config.MinAccrual)
+			sum = math.Round(sum*100) / 100
+			o.accrual = &sum
+		}
+		resp.Accrual = o.accrual
+	}
+	return resp, true
+}
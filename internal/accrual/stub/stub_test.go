@@ -0,0 +1,104 @@
+package stub
+
+import (
+	"context"
+	"errors"
+	"github.com/llaxzi/gophermart/internal/accrual"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStub_Progression(t *testing.T) {
+	config := DefaultConfig()
+	config.MinAccrual, config.MaxAccrual = 500, 500
+	server, _ := NewTestServer(config)
+	defer server.Close()
+
+	client := accrual.NewClient(server.URL)
+	accrualSum := 500.0
+
+	for _, expected := range []accrual.Response{
+		{Order: "12345", Status: accrual.StatusRegistered},
+		{Order: "12345", Status: accrual.StatusProcessing},
+		{Order: "12345", Status: accrual.StatusProcessed, Accrual: &accrualSum},
+		{Order: "12345", Status: accrual.StatusProcessed, Accrual: &accrualSum},
+	} {
+		resp, err := client.GetOrder(context.Background(), "12345")
+		require.NoError(t, err)
+		assert.Equal(t, expected, resp)
+	}
+}
+
+func TestStub_Register(t *testing.T) {
+	config := DefaultConfig()
+	config.AutoRegister = false
+	server, s := NewTestServer(config)
+	defer server.Close()
+
+	client := accrual.NewClient(server.URL)
+
+	_, err := client.GetOrder(context.Background(), "12345")
+	assert.ErrorIs(t, err, apperrors.ErrOrderNotRegistered)
+
+	s.Register("12345", accrual.StatusInvalid)
+	resp, err := client.GetOrder(context.Background(), "12345")
+	require.NoError(t, err)
+	assert.Equal(t, accrual.StatusInvalid, resp.Status)
+
+	// Регистрация через API, как в настоящей системе
+	for _, expectedStatus := range []int{http.StatusAccepted, http.StatusConflict} {
+		httpResp, err := http.Post(server.URL+"/api/orders", "application/json", strings.NewReader(`{"order":"67890"}`))
+		require.NoError(t, err)
+		httpResp.Body.Close()
+		assert.Equal(t, expectedStatus, httpResp.StatusCode)
+	}
+	resp, err = client.GetOrder(context.Background(), "67890")
+	require.NoError(t, err)
+	assert.Equal(t, accrual.StatusRegistered, resp.Status)
+	assert.Equal(t, 3, s.Requests())
+}
+
+func TestStub_Bursts(t *testing.T) {
+	config := DefaultConfig()
+	config.BurstEvery = 2
+	config.BurstLength = 1
+	config.RetryAfter = time.Second * 3
+	server, _ := NewTestServer(config)
+	defer server.Close()
+
+	client := accrual.NewClient(server.URL)
+
+	limited := make([]bool, 6)
+	for i := range limited {
+		_, err := client.GetOrder(context.Background(), "12345")
+		var rateLimit *accrual.RateLimitError
+		if errors.As(err, &rateLimit) {
+			limited[i] = true
+			assert.Equal(t, time.Second*3, rateLimit.RetryAfter)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+	assert.Equal(t, []bool{false, false, true, false, false, true}, limited)
+}
+
+func TestStub_Faults(t *testing.T) {
+	config := DefaultConfig()
+	config.ErrorRate = 1
+	config.Latency = time.Millisecond * 50
+	server, _ := NewTestServer(config)
+	defer server.Close()
+
+	start := time.Now()
+	resp, err := http.Get(server.URL + "/api/orders/12345")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.GreaterOrEqual(t, time.Since(start), config.Latency)
+}
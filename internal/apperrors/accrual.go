@@ -0,0 +1,10 @@
+package apperrors
+
+import "errors"
+
+var (
+	ErrOrderNotRegistered = errors.New("order is not registered in accrual system")
+	ErrAccrualRateLimited = errors.New("accrual system rate limit exceeded")
+	ErrAccrualServer      = errors.New("accrual system error")
+	ErrAccrualUnavailable = errors.New("accrual system is unavailable")
+)
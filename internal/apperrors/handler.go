@@ -7,4 +7,22 @@ var (
 	ErrInvalidJSON  = errors.New("invalid JSON")
 	ErrNoData       = errors.New("no data")
 	ErrInvalidOrder = errors.New("invalid order number")
+	ErrEmptyBatch   = errors.New("no order numbers")
+	ErrBatchTooBig  = errors.New("too many order numbers")
+	ErrWrongPass    = errors.New("wrong password")
+	ErrReauthNeeded = errors.New("recent login required")
+	ErrTooManyLogin = errors.New("too many login attempts")
+	ErrValidation   = errors.New("validation failed")
+	ErrInvalidScope = errors.New("unknown scope")
+	ErrNoScope      = errors.New("insufficient scope")
+	ErrJWTRequired  = errors.New("API keys are not allowed here")
+	ErrNoRole       = errors.New("insufficient role")
+	ErrInvalidRole  = errors.New("unknown role")
+	ErrOwnRole      = errors.New("you cannot change your own role")
+	ErrTOTPRequired = errors.New("TOTP code required")
+	ErrTooManyTOTP  = errors.New("too many invalid TOTP codes")
+	ErrCSRF         = errors.New("invalid CSRF token")
+	ErrOIDCFailed   = errors.New("identity provider login failed")
+	ErrInvalidHook  = errors.New("invalid webhook")
+	ErrInvalidEvent = errors.New("unknown event")
 )
@@ -8,5 +8,19 @@ var (
 	ErrInvalidLP          = errors.New("wrong login or password")
 	ErrOrderInserted      = errors.New("you already loaded this order")
 	ErrOrderInsertedLogin = errors.New("someone else already loaded this order")
+	ErrOrderNotFound      = errors.New("order not found")
 	ErrNotEnoughFunds     = errors.New("not enough funds")
+	ErrInvalidRefresh     = errors.New("invalid refresh token")
+	ErrRefreshReused      = errors.New("refresh token already used")
+	ErrAPIKeyNameTaken    = errors.New("api key name is already taken")
+	ErrAPIKeyNotFound     = errors.New("api key not found")
+	ErrInvalidAPIKey      = errors.New("invalid api key")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrTOTPEnabled        = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrInvalidTOTP        = errors.New("invalid TOTP code")
+	ErrInvalidMFAToken    = errors.New("invalid or expired mfa token")
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrInvalidOIDCState   = errors.New("invalid or expired login state")
+	ErrWebhookNotFound    = errors.New("webhook not found")
 )
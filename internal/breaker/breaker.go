@@ -0,0 +1,174 @@
+package breaker
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	Closed   State = iota // запросы идут как обычно
+	Open                  // запросы не выполняются до конца CoolDown
+	HalfOpen              // пропускается один пробный запрос, его результат закрывает или снова открывает breaker
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// metrics - состояние всех breaker'ов в expvar: breakers.<name>.state, failures, opened_total
+var metrics = expvar.NewMap("breakers")
+
+// Breaker - circuit breaker вокруг вызовов внешней системы.
+// После каждого разрешённого запроса нужно вызвать ровно один из Success или Failure.
+type Breaker interface {
+	// Wait блокируется, пока запрос не будет разрешён, или до отмены ctx
+	Wait(ctx context.Context) error
+	Success()
+	Failure()
+	State() State
+}
+
+type Config struct {
+	FailureThreshold int           // ошибок подряд до открытия
+	CoolDown         time.Duration // сколько breaker открыт до пробного запроса
+}
+
+func DefaultConfig() Config {
+	return Config{
+		FailureThreshold: 5,
+		CoolDown:         time.Second * 30,
+	}
+}
+
+func NewBreaker(name string, config Config) Breaker {
+	b := &breaker{
+		name:     name,
+		config:   config,
+		changed:  make(chan struct{}),
+		state:    new(expvar.String),
+		failures: new(expvar.Int),
+		opened:   new(expvar.Int),
+	}
+	b.state.Set(Closed.String())
+
+	m := new(expvar.Map)
+	m.Set("state", b.state)
+	m.Set("failures", b.failures)
+	m.Set("opened_total", b.opened)
+	metrics.Set(name, m)
+	return b
+}
+
+type breaker struct {
+	name        string
+	config      Config
+	mu          sync.Mutex
+	current     State
+	consecutive int
+	openedAt    time.Time
+	probing     bool          // пробный запрос в half-open уже выполняется
+	changed     chan struct{} // закрывается при каждой смене состояния, будит Wait
+
+	state    *expvar.String
+	failures *expvar.Int
+	opened   *expvar.Int
+}
+
+func (b *breaker) Wait(ctx context.Context) error {
+	for {
+		retryIn, changed, ok := b.acquire()
+		if ok {
+			return nil
+		}
+
+		timer := time.NewTimer(retryIn)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+func (b *breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.consecutive = 0
+	b.failures.Set(0)
+	b.probing = false
+	if b.current != Closed {
+		b.setState(Closed)
+	}
+}
+
+func (b *breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.consecutive++
+	b.failures.Set(int64(b.consecutive))
+	b.probing = false
+	// Неудачный пробный запрос сразу открывает breaker снова
+	if b.current == HalfOpen || (b.current == Closed && b.consecutive >= b.config.FailureThreshold) {
+		b.openedAt = time.Now()
+		b.opened.Add(1)
+		b.setState(Open)
+	}
+}
+
+func (b *breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.current
+}
+
+// internal
+
+// acquire разрешает запрос или возвращает, сколько ждать и канал смены состояния
+func (b *breaker) acquire() (time.Duration, <-chan struct{}, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.current == Open {
+		remaining := b.config.CoolDown - time.Since(b.openedAt)
+		if remaining > 0 {
+			return remaining, b.changed, false
+		}
+		b.setState(HalfOpen)
+	}
+	if b.current == HalfOpen {
+		if b.probing {
+			// Ждём результата пробного запроса, CoolDown - на случай, если его не сообщат
+			return b.config.CoolDown, b.changed, false
+		}
+		b.probing = true
+	}
+	return 0, nil, true
+}
+
+// setState вызывается под b.mu
+func (b *breaker) setState(state State) {
+	log.Printf("Circuit breaker %s: %s -> %s", b.name, b.current, state)
+	b.current = state
+	b.state.Set(state.String())
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
@@ -0,0 +1,87 @@
+package breaker
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestBreaker_Transitions(t *testing.T) {
+	b := NewBreaker("transitions", Config{FailureThreshold: 3, CoolDown: time.Millisecond * 50})
+	ctx := context.Background()
+
+	// Успех сбрасывает счётчик ошибок подряд
+	b.Failure()
+	b.Failure()
+	b.Success()
+	b.Failure()
+	b.Failure()
+	assert.Equal(t, Closed, b.State())
+
+	b.Failure()
+	assert.Equal(t, Open, b.State())
+
+	// До конца cool-down запрос не разрешается
+	waitCtx, cancel := context.WithTimeout(ctx, time.Millisecond*20)
+	assert.ErrorIs(t, b.Wait(waitCtx), context.DeadlineExceeded)
+	cancel()
+
+	require.NoError(t, b.Wait(ctx))
+	assert.Equal(t, HalfOpen, b.State())
+
+	// Неудачный пробный запрос сразу открывает breaker
+	b.Failure()
+	assert.Equal(t, Open, b.State())
+
+	require.NoError(t, b.Wait(ctx))
+	b.Success()
+	assert.Equal(t, Closed, b.State())
+}
+
+func TestBreaker_SingleProbe(t *testing.T) {
+	b := NewBreaker("probe", Config{FailureThreshold: 1, CoolDown: time.Millisecond * 10})
+	b.Failure()
+
+	require.NoError(t, b.Wait(context.Background()))
+
+	// Пока пробный запрос выполняется, остальные ждут его результата
+	released := make(chan error, 1)
+	go func() {
+		released <- b.Wait(context.Background())
+	}()
+
+	select {
+	case <-released:
+		t.Fatalf("Second request allowed while probe is in flight")
+	case <-time.After(time.Millisecond * 5):
+	}
+
+	b.Success()
+	select {
+	case err := <-released:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatalf("Waiting request was not released after successful probe")
+	}
+}
+
+func TestBreaker_Metrics(t *testing.T) {
+	b := NewBreaker("metrics", Config{FailureThreshold: 2, CoolDown: time.Minute})
+	b.Failure()
+	b.Failure()
+
+	var m struct {
+		State       string `json:"state"`
+		Failures    int    `json:"failures"`
+		OpenedTotal int    `json:"opened_total"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(expvar.Get("breakers").(*expvar.Map).Get("metrics").String()), &m))
+
+	assert.Equal(t, "open", m.State)
+	assert.Equal(t, 2, m.Failures)
+	assert.Equal(t, 1, m.OpenedTotal)
+}
@@ -0,0 +1,158 @@
+package cookieauth
+
+import (
+	"crypto/subtle"
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/tokens"
+	"net/http"
+	"time"
+)
+
+// Имена cookie и заголовка, которым браузерный клиент возвращает CSRF токен
+const (
+	AccessCookie  = "gophermart_access"
+	RefreshCookie = "gophermart_refresh"
+	CSRFCookie    = "gophermart_csrf"
+	CSRFHeader    = "X-CSRF-Token"
+	OIDCCookie    = "gophermart_oidc_state"
+)
+
+// refreshPath - refresh cookie отправляется браузером только на обновление токенов
+const refreshPath = "/api/user/token/refresh"
+
+// oidcPath - state cookie нужен только callback OIDC входа
+const oidcPath = "/api/user/oidc/callback"
+
+// Manager выставляет и читает cookie для браузерных клиентов.
+// Пока режим выключен, токены передаются только в заголовке и теле ответа.
+type Manager interface {
+	Enabled() bool
+	// SetTokens выставляет HttpOnly cookie с токенами и новый CSRF токен
+	SetTokens(ctx echo.Context, accessToken string, accessExp time.Duration, refreshToken string, refreshExpiresAt time.Time) error
+	Clear(ctx echo.Context)
+	AccessToken(ctx echo.Context) string
+	RefreshToken(ctx echo.Context) string
+	// ValidCSRF - double submit: заголовок X-CSRF-Token совпадает с CSRF cookie
+	ValidCSRF(ctx echo.Context) bool
+
+	// SetOIDCState привязывает OIDC вход к браузеру, который его начал. Выставляется и без режима cookie:
+	// вход через провайдера всегда идёт через браузер.
+	SetOIDCState(ctx echo.Context, state string, ttl time.Duration)
+	// ValidOIDCState - state из callback совпадает с cookie. Cookie одноразовый и удаляется.
+	ValidOIDCState(ctx echo.Context, state string) bool
+}
+
+type Config struct {
+	Enabled  bool
+	Domain   string
+	SameSite http.SameSite
+}
+
+func DefaultConfig() Config {
+	return Config{
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+func NewManager(config Config) Manager {
+	if config.SameSite == 0 {
+		config.SameSite = http.SameSiteStrictMode
+	}
+	return &manager{config}
+}
+
+type manager struct {
+	config Config
+}
+
+func (m *manager) Enabled() bool {
+	return m.config.Enabled
+}
+
+func (m *manager) SetTokens(ctx echo.Context, accessToken string, accessExp time.Duration, refreshToken string, refreshExpiresAt time.Time) error {
+	if !m.config.Enabled {
+		return nil
+	}
+
+	csrfToken, err := tokens.NewID()
+	if err != nil {
+		return err
+	}
+
+	refreshMaxAge := int(time.Until(refreshExpiresAt).Seconds())
+	ctx.SetCookie(m.cookie(AccessCookie, accessToken, "/", int(accessExp.Seconds()), true))
+	ctx.SetCookie(m.cookie(RefreshCookie, refreshToken, refreshPath, refreshMaxAge, true))
+	// CSRF cookie читает JS клиента, поэтому без HttpOnly. Живёт столько же, сколько refresh токен.
+	ctx.SetCookie(m.cookie(CSRFCookie, csrfToken, "/", refreshMaxAge, false))
+	return nil
+}
+
+func (m *manager) Clear(ctx echo.Context) {
+	if !m.config.Enabled {
+		return
+	}
+	ctx.SetCookie(m.cookie(AccessCookie, "", "/", -1, true))
+	ctx.SetCookie(m.cookie(RefreshCookie, "", refreshPath, -1, true))
+	ctx.SetCookie(m.cookie(CSRFCookie, "", "/", -1, false))
+}
+
+func (m *manager) AccessToken(ctx echo.Context) string {
+	return m.value(ctx, AccessCookie)
+}
+
+func (m *manager) RefreshToken(ctx echo.Context) string {
+	return m.value(ctx, RefreshCookie)
+}
+
+func (m *manager) ValidCSRF(ctx echo.Context) bool {
+	cookie := m.value(ctx, CSRFCookie)
+	header := ctx.Request().Header.Get(CSRFHeader)
+	if cookie == "" || header == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
+
+func (m *manager) SetOIDCState(ctx echo.Context, state string, ttl time.Duration) {
+	cookie := m.cookie(OIDCCookie, state, oidcPath, int(ttl.Seconds()), true)
+	// Callback приходит редиректом с сайта провайдера, со Strict браузер cookie не отправит
+	cookie.SameSite = http.SameSiteLaxMode
+	ctx.SetCookie(cookie)
+}
+
+func (m *manager) ValidOIDCState(ctx echo.Context, state string) bool {
+	cookie, err := ctx.Cookie(OIDCCookie)
+	if err != nil || cookie.Value == "" || state == "" {
+		return false
+	}
+	expired := m.cookie(OIDCCookie, "", oidcPath, -1, true)
+	expired.SameSite = http.SameSiteLaxMode
+	ctx.SetCookie(expired)
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) == 1
+}
+
+// internal
+
+func (m *manager) value(ctx echo.Context, name string) string {
+	if !m.config.Enabled {
+		return ""
+	}
+	cookie, err := ctx.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+func (m *manager) cookie(name string, value string, path string, maxAge int, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   m.config.Domain,
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: httpOnly,
+		SameSite: m.config.SameSite,
+	}
+}
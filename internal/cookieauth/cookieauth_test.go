@@ -0,0 +1,137 @@
+package cookieauth
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestManager_SetTokens(t *testing.T) {
+	e := echo.New()
+
+	t.Run("Cookies are set in cookie mode", func(t *testing.T) {
+		m := NewManager(Config{Enabled: true})
+		rec := httptest.NewRecorder()
+		ctx := e.NewContext(httptest.NewRequest(http.MethodPost, "/api/user/login", nil), rec)
+
+		require.NoError(t, m.SetTokens(ctx, "access", time.Minute, "refresh", time.Now().Add(time.Hour)))
+
+		cookies := map[string]*http.Cookie{}
+		for _, cookie := range rec.Result().Cookies() {
+			cookies[cookie.Name] = cookie
+		}
+		require.Len(t, cookies, 3)
+
+		access := cookies[AccessCookie]
+		assert.Equal(t, "access", access.Value)
+		assert.True(t, access.HttpOnly)
+		assert.True(t, access.Secure)
+		assert.Equal(t, http.SameSiteStrictMode, access.SameSite)
+		assert.Equal(t, 60, access.MaxAge)
+
+		refresh := cookies[RefreshCookie]
+		assert.Equal(t, "refresh", refresh.Value)
+		assert.True(t, refresh.HttpOnly)
+		assert.Equal(t, refreshPath, refresh.Path)
+
+		csrf := cookies[CSRFCookie]
+		assert.NotEmpty(t, csrf.Value)
+		assert.False(t, csrf.HttpOnly)
+		assert.True(t, csrf.Secure)
+	})
+
+	t.Run("Nothing is set when disabled", func(t *testing.T) {
+		m := NewManager(Config{})
+		rec := httptest.NewRecorder()
+		ctx := e.NewContext(httptest.NewRequest(http.MethodPost, "/api/user/login", nil), rec)
+
+		require.NoError(t, m.SetTokens(ctx, "access", time.Minute, "refresh", time.Now().Add(time.Hour)))
+		assert.Empty(t, rec.Result().Cookies())
+	})
+}
+
+func TestManager_ValidCSRF(t *testing.T) {
+	e := echo.New()
+	m := NewManager(Config{Enabled: true})
+
+	tests := []struct {
+		name     string
+		cookie   string
+		header   string
+		expected bool
+	}{
+		{name: "Matching token", cookie: "token", header: "token", expected: true},
+		{name: "Mismatched token", cookie: "token", header: "other", expected: false},
+		{name: "Missing header", cookie: "token", expected: false},
+		{name: "Missing cookie", header: "token", expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if test.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: test.cookie})
+			}
+			if test.header != "" {
+				req.Header.Set(CSRFHeader, test.header)
+			}
+			ctx := e.NewContext(req, httptest.NewRecorder())
+
+			assert.Equal(t, test.expected, m.ValidCSRF(ctx))
+		})
+	}
+}
+
+func TestManager_OIDCState(t *testing.T) {
+	e := echo.New()
+	// Режим cookie выключен: state cookie выставляется всё равно
+	m := NewManager(Config{})
+
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/user/oidc/login", nil), rec)
+	m.SetOIDCState(ctx, "state", time.Minute*10)
+
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	state := cookies[0]
+	assert.Equal(t, OIDCCookie, state.Name)
+	assert.Equal(t, "state", state.Value)
+	assert.Equal(t, oidcPath, state.Path)
+	assert.Equal(t, 600, state.MaxAge)
+	assert.True(t, state.HttpOnly)
+	assert.True(t, state.Secure)
+	assert.Equal(t, http.SameSiteLaxMode, state.SameSite)
+
+	tests := []struct {
+		name     string
+		cookie   string
+		state    string
+		expected bool
+	}{
+		{name: "Matching state", cookie: "state", state: "state", expected: true},
+		{name: "Foreign state", cookie: "state", state: "attacker", expected: false},
+		{name: "Missing cookie", state: "state", expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, oidcPath, nil)
+			if test.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: OIDCCookie, Value: test.cookie})
+			}
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+
+			assert.Equal(t, test.expected, m.ValidOIDCState(ctx, test.state))
+			// Проверенный cookie удаляется
+			if test.cookie != "" {
+				require.Len(t, rec.Result().Cookies(), 1)
+				assert.Equal(t, -1, rec.Result().Cookies()[0].MaxAge)
+			}
+		})
+	}
+}
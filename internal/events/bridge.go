@@ -0,0 +1,100 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/lib/pq"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/gophermart/internal/repository"
+	"github.com/llaxzi/gophermart/internal/tokens"
+	"log"
+	"time"
+)
+
+// Channel - канал LISTEN/NOTIFY, через который инстансы обмениваются событиями заказов
+const Channel = "gophermart_order_events"
+
+// Bridge доставляет событие подписчикам этого инстанса сразу, а остальным через Postgres NOTIFY
+type Bridge interface {
+	Publisher
+	// Listen получает события других инстансов, пока не отменён ctx
+	Listen(ctx context.Context)
+}
+
+func NewBridge(broker Broker, repo repository.Repository, databaseDSN string) (Bridge, error) {
+	// origin отличает свои уведомления, они уже доставлены локально
+	origin, err := tokens.NewID()
+	if err != nil {
+		return nil, err
+	}
+	return &bridge{broker: broker, repo: repo, databaseDSN: databaseDSN, origin: origin}, nil
+}
+
+type bridge struct {
+	broker      Broker
+	repo        repository.Repository
+	databaseDSN string
+	origin      string
+}
+
+type notification struct {
+	Origin string            `json:"origin"`
+	UserID int64             `json:"user_id"`
+	Event  models.OrderEvent `json:"event"`
+}
+
+func (b *bridge) Publish(ctx context.Context, event models.OrderEvent) {
+	b.broker.Publish(ctx, event)
+
+	payload, err := json.Marshal(notification{Origin: b.origin, UserID: event.UserID, Event: event})
+	if err != nil {
+		log.Printf("Failed to encode order event: %v", err)
+		return
+	}
+	// Событие не критично: клиент, пропустивший его, увидит статус при следующем запросе заказа
+	if err = b.repo.Notify(ctx, Channel, string(payload)); err != nil {
+		log.Printf("Failed to notify order event: %v", err)
+	}
+}
+
+func (b *bridge) Listen(ctx context.Context) {
+	listener := pq.NewListener(b.databaseDSN, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Order events listener: %v", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(Channel); err != nil {
+		log.Printf("Failed to listen for order events: %v", err)
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-listener.Notify:
+			// nil приходит после переподключения, пропущенные за это время события теряются
+			if n != nil {
+				b.handle(ctx, n.Extra)
+			}
+		case <-time.After(time.Minute):
+			// Проверяем соединение, обрыв без трафика иначе не заметить
+			go listener.Ping()
+		}
+	}
+}
+
+func (b *bridge) handle(ctx context.Context, payload string) {
+	var n notification
+	if err := json.Unmarshal([]byte(payload), &n); err != nil {
+		log.Printf("Failed to decode order event: %v", err)
+		return
+	}
+	if n.Origin == b.origin {
+		return
+	}
+	n.Event.UserID = n.UserID
+	b.broker.Publish(ctx, n.Event)
+}
@@ -0,0 +1,68 @@
+package events
+
+import (
+	"context"
+	"github.com/llaxzi/gophermart/internal/models"
+	"log"
+	"sync"
+)
+
+// Publisher - куда processor отправляет изменения заказов
+type Publisher interface {
+	Publish(ctx context.Context, event models.OrderEvent)
+}
+
+// Broker раздаёт события заказов подписчикам этого инстанса
+type Broker interface {
+	Publisher
+	// Subscribe возвращает канал событий пользователя и функцию отписки, которая закрывает канал
+	Subscribe(userID int64) (<-chan models.OrderEvent, func())
+}
+
+// NewBroker - buffer задаёт, сколько событий ждёт медленного подписчика, дальше события ему не доставляются
+func NewBroker(buffer int) Broker {
+	return &broker{buffer: buffer, subscribers: make(map[int64]map[chan models.OrderEvent]struct{})}
+}
+
+type broker struct {
+	buffer      int
+	mu          sync.RWMutex
+	subscribers map[int64]map[chan models.OrderEvent]struct{} // user id -> каналы открытых потоков
+}
+
+func (b *broker) Publish(_ context.Context, event models.OrderEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch := range b.subscribers[event.UserID] {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Dropped order event %v for slow subscriber of user %v", event.Number, event.UserID)
+		}
+	}
+}
+
+func (b *broker) Subscribe(userID int64) (<-chan models.OrderEvent, func()) {
+	ch := make(chan models.OrderEvent, b.buffer)
+
+	b.mu.Lock()
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = make(map[chan models.OrderEvent]struct{})
+	}
+	b.subscribers[userID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subscribers[userID], ch)
+			if len(b.subscribers[userID]) == 0 {
+				delete(b.subscribers, userID)
+			}
+			close(ch)
+		})
+	}
+}
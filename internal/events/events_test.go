@@ -0,0 +1,86 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"github.com/llaxzi/gophermart/internal/mocks"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestBroker(t *testing.T) {
+	b := NewBroker(1)
+
+	alice, unsubscribeAlice := b.Subscribe(1)
+	bob, unsubscribeBob := b.Subscribe(2)
+	defer unsubscribeBob()
+
+	event := models.OrderEvent{UserID: 1, Number: "79927398713", Status: "PROCESSED"}
+	b.Publish(context.Background(), event)
+	// Буфер подписчика полон, второе событие отбрасывается, а не блокирует публикацию
+	b.Publish(context.Background(), event)
+
+	assert.Equal(t, event, <-alice)
+	assert.Len(t, alice, 0)
+	assert.Len(t, bob, 0)
+
+	unsubscribeAlice()
+	unsubscribeAlice()
+	_, open := <-alice
+	assert.False(t, open)
+
+	// Публикация без подписчиков не паникует
+	b.Publish(context.Background(), event)
+}
+
+func TestBridge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	broker := NewBroker(10)
+	b, err := NewBridge(broker, repo, "")
+	require.NoError(t, err)
+	br := b.(*bridge)
+
+	events, unsubscribe := broker.Subscribe(1)
+	defer unsubscribe()
+
+	accrual := 500.0
+	event := models.OrderEvent{UserID: 1, Number: "79927398713", Status: "PROCESSED", Accrual: &accrual}
+
+	t.Run("Publish delivers locally and notifies other instances", func(t *testing.T) {
+		var payload string
+		repo.EXPECT().Notify(gomock.Any(), Channel, gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ string, p string) error {
+				payload = p
+				return nil
+			})
+
+		b.Publish(context.Background(), event)
+
+		assert.Equal(t, event, <-events)
+
+		// Своё уведомление, вернувшееся через LISTEN, повторно не доставляется
+		br.handle(context.Background(), payload)
+		assert.Len(t, events, 0)
+	})
+
+	t.Run("Notification from another instance", func(t *testing.T) {
+		payload, err := json.Marshal(notification{Origin: "other", UserID: 1, Event: event})
+		require.NoError(t, err)
+
+		br.handle(context.Background(), string(payload))
+
+		assert.Equal(t, event, <-events)
+	})
+
+	t.Run("Malformed notification", func(t *testing.T) {
+		br.handle(context.Background(), "not json")
+
+		assert.Len(t, events, 0)
+	})
+}
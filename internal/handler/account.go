@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/gophermart/internal/passwords"
+	"github.com/llaxzi/gophermart/internal/repository"
+	"github.com/llaxzi/gophermart/internal/revocation"
+	"github.com/llaxzi/retryables/v2"
+	"log"
+	"net/http"
+	"time"
+)
+
+type AccountHandler interface {
+	Delete(ctx echo.Context) error
+	Export(ctx echo.Context) error
+}
+
+func NewAccountHandler(repo repository.Repository, retryer *retryables.Retryer, hasher passwords.Hasher,
+	revoker revocation.Checker) AccountHandler {
+	return &accountHandler{repo, retryer, hasher, revoker}
+}
+
+type accountHandler struct {
+	repo    repository.Repository
+	retryer *retryables.Retryer
+	hasher  passwords.Hasher
+	revoker revocation.Checker
+}
+
+// reauthWindow - насколько свежим должен быть вход пользователя без пароля, чтобы удалить аккаунт
+const reauthWindow = time.Minute * 5
+
+// Delete удаляет аккаунт вместе с заказами и списаниями. Требует пароль, а у пользователя без пароля (OIDC) -
+// чтобы текущая сессия была открыта не раньше reauthWindow назад, то есть свежий вход через провайдера.
+func (h *accountHandler) Delete(ctx echo.Context) error {
+	var req models.AccountDeletion
+	err := ctx.Bind(&req)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidJSON.Error()})
+	}
+
+	userID := ctx.Get("user_id").(int64)
+	userLogin := ctx.Get("user_login").(string)
+
+	var hashedPassword string
+	err = h.retryer.Retry(func() error {
+		hashedPassword, err = h.repo.SelectPassword(ctx.Request().Context(), userID)
+		return err
+	})
+	switch {
+	case errors.Is(err, apperrors.ErrInvalidLP):
+		// У пользователя, вошедшего через OIDC, пароля нет
+		if confirmed, err := h.recentLogin(ctx); !confirmed {
+			return err
+		}
+	case err != nil:
+		log.Printf("Failed to get user: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	case req.Password == "":
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidJSON.Error()})
+	default:
+		match, err := h.hasher.Compare(hashedPassword, req.Password)
+		if err != nil {
+			log.Printf("Failed to compare password hash: %v for user: %v", err, userLogin)
+			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+		}
+		if !match {
+			return ctx.JSON(http.StatusForbidden, map[string]string{"error": apperrors.ErrWrongPass.Error()})
+		}
+	}
+
+	err = h.retryer.Retry(func() error {
+		return h.repo.DeleteUser(ctx.Request().Context(), userID)
+	})
+	if err != nil {
+		if errors.Is(err, apperrors.ErrUserNotFound) {
+			return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		log.Printf("Failed to delete user: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	// Токены удалённого пользователя отклоняются БД, но кеш проверок живёт до ttl
+	h.revoker.Invalidate(userID, time.Now())
+
+	return ctx.JSON(http.StatusOK, "account deleted")
+}
+
+// Export выгружает все данные пользователя одним JSON файлом
+func (h *accountHandler) Export(ctx echo.Context) error {
+	userID := ctx.Get("user_id").(int64)
+	reqCtx := ctx.Request().Context()
+
+	export := models.UserExport{ExportedAt: time.Now()}
+	err := h.retryer.Retry(func() error {
+		var err error
+		if export.Profile, err = h.repo.SelectProfile(reqCtx, userID); err != nil {
+			return err
+		}
+		if export.Orders, err = h.repo.SelectOrders(reqCtx, userID); err != nil {
+			return err
+		}
+		if export.Withdrawals, err = h.repo.SelectWithdrawals(reqCtx, userID); err != nil {
+			return err
+		}
+		if export.Sessions, err = h.repo.SelectSessionHistory(reqCtx, userID); err != nil {
+			return err
+		}
+		if export.APIKeys, err = h.repo.SelectAPIKeys(reqCtx, userID); err != nil {
+			return err
+		}
+		if export.Identities, err = h.repo.SelectIdentities(reqCtx, userID); err != nil {
+			return err
+		}
+		export.Webhooks, err = h.repo.SelectWebhooks(reqCtx, userID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, apperrors.ErrUserNotFound) {
+			return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		log.Printf("Failed to export user data: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	ctx.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="gophermart-export.json"`)
+	return ctx.JSON(http.StatusOK, export)
+}
+
+// internal
+
+// recentLogin проверяет, что текущая сессия открыта не раньше reauthWindow назад. При false ответ уже записан.
+func (h *accountHandler) recentLogin(ctx echo.Context) (bool, error) {
+	claims, ok := ctx.Get("user_claims").(*models.UserClaims)
+	if !ok || claims.SessionID == "" {
+		return false, ctx.JSON(http.StatusForbidden, map[string]string{"error": apperrors.ErrReauthNeeded.Error()})
+	}
+
+	var sessions []models.Session
+	err := h.retryer.Retry(func() error {
+		var err error
+		sessions, err = h.repo.SelectSessions(ctx.Request().Context(), claims.UserID)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to get sessions: %v", err)
+		return false, ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	for _, session := range sessions {
+		if session.ID == claims.SessionID && time.Since(session.CreatedAt) <= reauthWindow {
+			return true, nil
+		}
+	}
+	return false, ctx.JSON(http.StatusForbidden, map[string]string{"error": apperrors.ErrReauthNeeded.Error()})
+}
@@ -0,0 +1,191 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/handler"
+	"github.com/llaxzi/gophermart/internal/mocks"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/retryables/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeleteAccount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	revoker := mocks.NewMockChecker(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewAccountHandler(repo, retryer, newHasher(t), revoker)
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+
+	tests := []struct {
+		name             string
+		body             string
+		expectSelectCall bool
+		noPassword       bool             // пользователь вошёл через OIDC
+		sessions         []models.Session // активные сессии пользователя без пароля
+		expectDeleteCall bool
+		deleteError      error
+		expectedStatus   int
+	}{
+		{
+			name:             "Account deleted",
+			body:             `{"password":"password"}`,
+			expectSelectCall: true,
+			expectDeleteCall: true,
+			expectedStatus:   http.StatusOK,
+		},
+		{
+			name:             "Missing password",
+			body:             `{}`,
+			expectSelectCall: true,
+			expectedStatus:   http.StatusBadRequest,
+		},
+		{
+			name:             "No password, fresh login",
+			body:             `{}`,
+			expectSelectCall: true,
+			noPassword:       true,
+			sessions:         []models.Session{{ID: "other", CreatedAt: time.Now().Add(-time.Hour)}, {ID: "current", CreatedAt: time.Now().Add(-time.Minute)}},
+			expectDeleteCall: true,
+			expectedStatus:   http.StatusOK,
+		},
+		{
+			name:             "No password, stale login",
+			body:             `{}`,
+			expectSelectCall: true,
+			noPassword:       true,
+			sessions:         []models.Session{{ID: "current", CreatedAt: time.Now().Add(-time.Hour)}, {ID: "other", CreatedAt: time.Now()}},
+			expectedStatus:   http.StatusForbidden,
+		},
+		{
+			name:             "Wrong password",
+			body:             `{"password":"wrong"}`,
+			expectSelectCall: true,
+			expectedStatus:   http.StatusForbidden,
+		},
+		{
+			name:             "Database error",
+			body:             `{"password":"password"}`,
+			expectSelectCall: true,
+			expectDeleteCall: true,
+			deleteError:      apperrors.ErrServer,
+			expectedStatus:   http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodDelete, "/api/user", bytes.NewReader([]byte(test.body)))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+			ctx.Set("user_id", testUser.ID)
+			ctx.Set("user_login", testUser.Login)
+			ctx.Set("user_claims", &models.UserClaims{UserID: testUser.ID, UserLogin: testUser.Login, SessionID: "current"})
+
+			if test.expectSelectCall && test.noPassword {
+				repo.EXPECT().SelectPassword(gomock.Any(), testUser.ID).Return("", apperrors.ErrInvalidLP).Times(1)
+				repo.EXPECT().SelectSessions(gomock.Any(), testUser.ID).Return(test.sessions, nil).Times(1)
+			} else if test.expectSelectCall {
+				repo.EXPECT().SelectPassword(gomock.Any(), testUser.ID).Return(string(hashedPassword), nil).Times(1)
+			}
+			if test.expectDeleteCall {
+				repo.EXPECT().DeleteUser(gomock.Any(), testUser.ID).Return(test.deleteError).Times(1)
+			}
+			if test.expectedStatus == http.StatusOK {
+				revoker.EXPECT().Invalidate(testUser.ID, gomock.Any()).Times(1)
+			}
+
+			err := h.Delete(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestExportAccount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewAccountHandler(repo, retryer, nil, nil)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	accrual := 500.0
+
+	t.Run("Export contains all user data", func(t *testing.T) {
+		repo.EXPECT().SelectProfile(gomock.Any(), testUser.ID).
+			Return(models.Profile{ID: testUser.ID, Login: "testuser", Role: models.RoleUser, Balance: models.Balance{Current: 500, Withdrawn: 42}}, nil)
+		repo.EXPECT().SelectOrders(gomock.Any(), testUser.ID).
+			Return([]models.OrderResponse{{Number: "12345678903", Status: "PROCESSED", Accrual: &accrual, UploadedAt: now.Format(time.RFC3339)}}, nil)
+		repo.EXPECT().SelectWithdrawals(gomock.Any(), testUser.ID).
+			Return([]models.WithdrawalResponse{{Order: "2377225624", Sum: 42, ProcessedAt: now.Format(time.RFC3339)}}, nil)
+		repo.EXPECT().SelectSessionHistory(gomock.Any(), testUser.ID).
+			Return([]models.Session{
+				{ID: "current", UserAgent: "Mozilla/5.0", IP: "192.0.2.1", CreatedAt: now, LastSeenAt: now},
+				{ID: "old", UserAgent: "okhttp/4.9", IP: "198.51.100.7", CreatedAt: now, LastSeenAt: now, RevokedAt: &now},
+			}, nil)
+		repo.EXPECT().SelectAPIKeys(gomock.Any(), testUser.ID).Return(nil, nil)
+		repo.EXPECT().SelectIdentities(gomock.Any(), testUser.ID).
+			Return([]models.OIDCIdentity{{Issuer: "https://idp.example.com", Subject: "248289761001", CreatedAt: now}}, nil)
+		repo.EXPECT().SelectWebhooks(gomock.Any(), testUser.ID).
+			Return([]models.Webhook{{ID: "hook", URL: "https://partner.example/hook", Events: []string{models.EventOrderProcessed}, CreatedAt: now}}, nil)
+
+		e := echo.New()
+		rec := httptest.NewRecorder()
+		ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/user/export", nil), rec)
+		ctx.Set("user_id", testUser.ID)
+		ctx.Set("user_login", testUser.Login)
+
+		require.NoError(t, h.Export(ctx))
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Header().Get(echo.HeaderContentDisposition), "attachment")
+
+		var export models.UserExport
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &export))
+		assert.Equal(t, "testuser", export.Profile.Login)
+		assert.Equal(t, 42.0, export.Profile.Balance.Withdrawn)
+		assert.Len(t, export.Orders, 1)
+		assert.Len(t, export.Withdrawals, 1)
+		require.Len(t, export.Sessions, 2)
+		assert.NotNil(t, export.Sessions[1].RevokedAt)
+		assert.Len(t, export.Identities, 1)
+		require.Len(t, export.Webhooks, 1)
+		assert.Equal(t, "https://partner.example/hook", export.Webhooks[0].URL)
+		assert.Equal(t, now, export.Webhooks[0].CreatedAt)
+		// Секрет подписи в выгрузку не попадает
+		assert.NotContains(t, rec.Body.String(), "secret")
+	})
+
+	t.Run("Database error", func(t *testing.T) {
+		repo.EXPECT().SelectProfile(gomock.Any(), testUser.ID).Return(models.Profile{}, apperrors.ErrServer)
+
+		e := echo.New()
+		rec := httptest.NewRecorder()
+		ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/user/export", nil), rec)
+		ctx.Set("user_id", testUser.ID)
+		ctx.Set("user_login", testUser.Login)
+
+		require.NoError(t, h.Export(ctx))
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/gophermart/internal/repository"
+	"github.com/llaxzi/gophermart/internal/revocation"
+	"github.com/llaxzi/retryables/v2"
+	"log"
+	"net/http"
+)
+
+// AdminHandler - операторские ручки, доступ ограничивается middleware.RequireRole
+type AdminHandler interface {
+	GetUserOrders(ctx echo.Context) error
+	GetUserBalance(ctx echo.Context) error
+	GetUserSessions(ctx echo.Context) error
+	SetRole(ctx echo.Context) error
+}
+
+func NewAdminHandler(repo repository.Repository, retryer *retryables.Retryer, revoker revocation.Checker) AdminHandler {
+	return &adminHandler{repo, retryer, revoker}
+}
+
+type adminHandler struct {
+	repo    repository.Repository
+	retryer *retryables.Retryer
+	revoker revocation.Checker
+}
+
+func (h *adminHandler) GetUserOrders(ctx echo.Context) error {
+	userLogin := ctx.Param("login")
+	log.Printf("User %v viewed orders of user %v", ctx.Get("user_login"), userLogin)
+
+	var orders []models.OrderResponse
+	err := h.retryer.Retry(func() error {
+		userID, err := h.repo.SelectUserID(ctx.Request().Context(), userLogin)
+		if err != nil {
+			return err
+		}
+		orders, err = h.repo.SelectOrders(ctx.Request().Context(), userID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, apperrors.ErrUserNotFound) {
+			return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		log.Printf("Failed to get orders: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	if len(orders) < 1 {
+		return ctx.NoContent(http.StatusNoContent)
+	}
+
+	return ctx.JSON(http.StatusOK, orders)
+}
+
+func (h *adminHandler) GetUserBalance(ctx echo.Context) error {
+	userLogin := ctx.Param("login")
+	log.Printf("User %v viewed balance of user %v", ctx.Get("user_login"), userLogin)
+
+	var balance models.Balance
+	err := h.retryer.Retry(func() error {
+		userID, err := h.repo.SelectUserID(ctx.Request().Context(), userLogin)
+		if err != nil {
+			return err
+		}
+		balance, err = h.repo.SelectBalance(ctx.Request().Context(), userID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, apperrors.ErrUserNotFound) {
+			return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		log.Printf("Failed to get balance: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+	return ctx.JSON(http.StatusOK, balance)
+}
+
+func (h *adminHandler) GetUserSessions(ctx echo.Context) error {
+	userLogin := ctx.Param("login")
+	log.Printf("User %v viewed sessions of user %v", ctx.Get("user_login"), userLogin)
+
+	var sessions []models.Session
+	err := h.retryer.Retry(func() error {
+		userID, err := h.repo.SelectUserID(ctx.Request().Context(), userLogin)
+		if err != nil {
+			return err
+		}
+		sessions, err = h.repo.SelectSessions(ctx.Request().Context(), userID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, apperrors.ErrUserNotFound) {
+			return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		log.Printf("Failed to get sessions: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	if len(sessions) < 1 {
+		return ctx.NoContent(http.StatusNoContent)
+	}
+
+	return ctx.JSON(http.StatusOK, sessions)
+}
+
+// SetRole меняет роль и отзывает токены пользователя, чтобы старая роль не действовала до их истечения
+func (h *adminHandler) SetRole(ctx echo.Context) error {
+	var req models.RoleChange
+	err := ctx.Bind(&req)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidJSON.Error()})
+	}
+	if !isRole(req.Role) {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidRole.Error()})
+	}
+
+	userLogin := ctx.Param("login")
+	var userID int64
+	err = h.retryer.Retry(func() error {
+		userID, err = h.repo.SelectUserID(ctx.Request().Context(), userLogin)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, apperrors.ErrUserNotFound) {
+			return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		log.Printf("Failed to get user: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	// Защита от случайной потери последнего администратора
+	if userID == ctx.Get("user_id") {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrOwnRole.Error()})
+	}
+
+	err = h.retryer.Retry(func() error {
+		return h.repo.UpdateUserRole(ctx.Request().Context(), userID, req.Role)
+	})
+	if err != nil {
+		if errors.Is(err, apperrors.ErrUserNotFound) {
+			return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		log.Printf("Failed to update role: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	err = h.retryer.Retry(func() error {
+		return h.revoker.RevokeAll(ctx.Request().Context(), userID)
+	})
+	if err != nil {
+		log.Printf("Failed to revoke tokens after role change: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	log.Printf("User %v set role %v for user %v", ctx.Get("user_login"), req.Role, userLogin)
+	return ctx.JSON(http.StatusOK, "role updated")
+}
+
+// internal
+
+func isRole(role string) bool {
+	for _, r := range models.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/handler"
+	"github.com/llaxzi/gophermart/internal/mocks"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/retryables/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminGetUserBalance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewAdminHandler(repo, retryer, nil)
+
+	tests := []struct {
+		name           string
+		balance        models.Balance
+		lookupError    error
+		repoError      error
+		expectedStatus int
+	}{
+		{
+			name:           "Successful balance retrieval",
+			balance:        models.Balance{Current: 500.5, Withdrawn: 42},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "User not found",
+			lookupError:    apperrors.ErrUserNotFound,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Database error",
+			repoError:      apperrors.ErrServer,
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+			ctx.SetParamNames("login")
+			ctx.SetParamValues("customer")
+			ctx.Set("user_id", int64(1))
+			ctx.Set("user_login", "operator")
+
+			repo.EXPECT().SelectUserID(gomock.Any(), "customer").Return(int64(2), test.lookupError).Times(1)
+			if test.lookupError == nil {
+				repo.EXPECT().SelectBalance(gomock.Any(), int64(2)).Return(test.balance, test.repoError).Times(1)
+			}
+
+			err := h.GetUserBalance(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+			if test.expectedStatus == http.StatusOK {
+				var balance models.Balance
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &balance))
+				assert.Equal(t, test.balance, balance)
+			}
+		})
+	}
+}
+
+func TestAdminGetUserOrders(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewAdminHandler(repo, retryer, nil)
+
+	tests := []struct {
+		name           string
+		orders         []models.OrderResponse
+		repoError      error
+		expectedStatus int
+	}{
+		{
+			name:           "Orders found",
+			orders:         []models.OrderResponse{{Number: "79927398713", Status: "PROCESSED"}},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "No orders",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Database error",
+			repoError:      apperrors.ErrServer,
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+			ctx.SetParamNames("login")
+			ctx.SetParamValues("customer")
+			ctx.Set("user_id", int64(1))
+			ctx.Set("user_login", "operator")
+
+			repo.EXPECT().SelectUserID(gomock.Any(), "customer").Return(int64(2), nil).Times(1)
+			repo.EXPECT().SelectOrders(gomock.Any(), int64(2)).Return(test.orders, test.repoError).Times(1)
+
+			err := h.GetUserOrders(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestAdminSetRole(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	revoker := mocks.NewMockChecker(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewAdminHandler(repo, retryer, revoker)
+
+	tests := []struct {
+		name           string
+		login          string
+		userID         int64
+		lookupError    error
+		body           string
+		expectUpdate   bool
+		repoError      error
+		expectRevoke   bool
+		expectedStatus int
+	}{
+		{
+			name:           "Successful role change",
+			login:          "customer",
+			userID:         2,
+			body:           `{"role":"support"}`,
+			expectUpdate:   true,
+			expectRevoke:   true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Unknown role",
+			login:          "customer",
+			body:           `{"role":"root"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Own role",
+			login:          "operator",
+			userID:         1,
+			body:           `{"role":"user"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "User not found",
+			login:          "unknown",
+			lookupError:    apperrors.ErrUserNotFound,
+			body:           `{"role":"admin"}`,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPut, "/", bytes.NewReader([]byte(test.body)))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+			ctx.SetParamNames("login")
+			ctx.SetParamValues(test.login)
+			ctx.Set("user_id", int64(1))
+			ctx.Set("user_login", "operator")
+
+			if test.userID != 0 || test.lookupError != nil {
+				repo.EXPECT().SelectUserID(gomock.Any(), test.login).Return(test.userID, test.lookupError).Times(1)
+			}
+			if test.expectUpdate {
+				var role models.RoleChange
+				require.NoError(t, json.Unmarshal([]byte(test.body), &role))
+				repo.EXPECT().UpdateUserRole(gomock.Any(), test.userID, role.Role).Return(test.repoError).Times(1)
+			}
+			if test.expectRevoke {
+				revoker.EXPECT().RevokeAll(gomock.Any(), test.userID).Return(nil).Times(1)
+			}
+
+			err := h.SetRole(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+		})
+	}
+}
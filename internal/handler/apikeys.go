@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/gophermart/internal/repository"
+	"github.com/llaxzi/gophermart/internal/tokens"
+	"github.com/llaxzi/retryables/v2"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const maxAPIKeyNameLength = 100
+
+type APIKeyHandler interface {
+	Create(ctx echo.Context) error
+	List(ctx echo.Context) error
+	Revoke(ctx echo.Context) error
+}
+
+func NewAPIKeyHandler(repo repository.Repository, retryer *retryables.Retryer) APIKeyHandler {
+	return &apiKeyHandler{repo, retryer}
+}
+
+type apiKeyHandler struct {
+	repo    repository.Repository
+	retryer *retryables.Retryer
+}
+
+func (h *apiKeyHandler) Create(ctx echo.Context) error {
+	var req models.APIKeyRequest
+	err := ctx.Bind(&req)
+	req.Name = strings.TrimSpace(req.Name)
+	if err != nil || req.Name == "" || len(req.Name) > maxAPIKeyNameLength {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidJSON.Error()})
+	}
+
+	scopes, ok := normalizeScopes(req.Scopes)
+	if !ok {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidScope.Error()})
+	}
+
+	userID := ctx.Get("user_id").(int64)
+
+	key, err := tokens.NewAPIKey()
+	if err != nil {
+		log.Printf("Failed to generate API key: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+	id, err := tokens.NewID()
+	if err != nil {
+		log.Printf("Failed to generate API key id: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	apiKey := models.APIKey{ID: id, Name: req.Name, Scopes: scopes, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	err = h.retryer.Retry(func() error {
+		return h.repo.InsertAPIKey(ctx.Request().Context(), userID, apiKey, tokens.HashToken(key))
+	})
+	if err != nil {
+		if errors.Is(err, apperrors.ErrAPIKeyNameTaken) {
+			return ctx.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		log.Printf("Failed to insert API key: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	return ctx.JSON(http.StatusCreated, models.APIKeyCreated{APIKey: apiKey, Key: key})
+}
+
+func (h *apiKeyHandler) List(ctx echo.Context) error {
+	userID := ctx.Get("user_id").(int64)
+
+	var keys []models.APIKey
+	var err error
+	err = h.retryer.Retry(func() error {
+		keys, err = h.repo.SelectAPIKeys(ctx.Request().Context(), userID)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to get API keys: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+	if len(keys) == 0 {
+		return ctx.NoContent(http.StatusNoContent)
+	}
+
+	return ctx.JSON(http.StatusOK, keys)
+}
+
+func (h *apiKeyHandler) Revoke(ctx echo.Context) error {
+	userID := ctx.Get("user_id").(int64)
+	id := ctx.Param("id")
+
+	err := h.retryer.Retry(func() error {
+		return h.repo.RevokeAPIKey(ctx.Request().Context(), userID, id, time.Now())
+	})
+	if err != nil {
+		if errors.Is(err, apperrors.ErrAPIKeyNotFound) {
+			return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		log.Printf("Failed to revoke API key: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	return ctx.JSON(http.StatusOK, "api key revoked")
+}
+
+// internal
+
+// normalizeScopes проверяет scopes и убирает повторы
+func normalizeScopes(scopes []string) ([]string, bool) {
+	result := make([]string, 0, len(scopes))
+	seen := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		known := false
+		for _, s := range models.Scopes {
+			if s == scope {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, false
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	return result, true
+}
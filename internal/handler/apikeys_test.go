@@ -0,0 +1,236 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/handler"
+	"github.com/llaxzi/gophermart/internal/mocks"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/gophermart/internal/tokens"
+	"github.com/llaxzi/retryables/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewAPIKeyHandler(repo, retryer)
+
+	tests := []struct {
+		name           string
+		body           string
+		expectRepoCall bool
+		repoError      error
+		expectedScopes []string
+		expectedStatus int
+	}{
+		{
+			name:           "Successful creation",
+			body:           `{"name":"batch upload","scopes":["orders:write","orders:read","orders:write"]}`,
+			expectRepoCall: true,
+			expectedScopes: []string{models.ScopeOrdersWrite, models.ScopeOrdersRead},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Without scopes",
+			body:           `{"name":"full access"}`,
+			expectRepoCall: true,
+			expectedScopes: []string{},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Empty name",
+			body:           `{"name":"  "}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Unknown scope",
+			body:           `{"name":"admin","scopes":["users:delete"]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Name taken",
+			body:           `{"name":"batch upload"}`,
+			expectRepoCall: true,
+			repoError:      apperrors.ErrAPIKeyNameTaken,
+			expectedScopes: []string{},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "Server error",
+			body:           `{"name":"batch upload"}`,
+			expectRepoCall: true,
+			repoError:      apperrors.ErrPgConnExc,
+			expectedScopes: []string{},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/api/user/api-keys", bytes.NewReader([]byte(test.body)))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+			ctx.Set("user_id", testUser.ID)
+			ctx.Set("user_login", testUser.Login)
+
+			var storedHash string
+			if test.expectRepoCall {
+				repo.EXPECT().
+					InsertAPIKey(gomock.Any(), testUser.ID, gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, _ int64, key models.APIKey, keyHash string) error {
+						assert.Equal(t, test.expectedScopes, key.Scopes)
+						storedHash = keyHash
+						return test.repoError
+					}).
+					Times(1)
+			}
+
+			err := h.Create(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+
+			if test.expectedStatus == http.StatusCreated {
+				var created models.APIKeyCreated
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+				assert.True(t, strings.HasPrefix(created.Key, "gm_"))
+				assert.NotEmpty(t, created.ID)
+				// В БД попадает только хеш ключа
+				assert.Equal(t, tokens.HashToken(created.Key), storedHash)
+			}
+		})
+	}
+}
+
+func TestListAPIKeys(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewAPIKeyHandler(repo, retryer)
+
+	lastUsed := time.Now().UTC().Truncate(time.Second)
+	tests := []struct {
+		name           string
+		keys           []models.APIKey
+		repoError      error
+		expectedStatus int
+	}{
+		{
+			name: "Keys found",
+			keys: []models.APIKey{
+				{ID: "1", Name: "batch", Scopes: []string{models.ScopeOrdersWrite}, CreatedAt: lastUsed, LastUsedAt: &lastUsed},
+				{ID: "2", Name: "reports", Scopes: []string{}, CreatedAt: lastUsed},
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "No keys",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Server error",
+			repoError:      apperrors.ErrServer,
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/api/user/api-keys", nil)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+			ctx.Set("user_id", testUser.ID)
+			ctx.Set("user_login", testUser.Login)
+
+			repo.EXPECT().SelectAPIKeys(gomock.Any(), testUser.ID).Return(test.keys, test.repoError).Times(1)
+
+			err := h.List(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+
+			if test.expectedStatus == http.StatusOK {
+				var keys []models.APIKey
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &keys))
+				assert.Equal(t, test.keys, keys)
+				assert.NotContains(t, rec.Body.String(), "key_hash")
+			}
+		})
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewAPIKeyHandler(repo, retryer)
+
+	tests := []struct {
+		name           string
+		repoError      error
+		expectedStatus int
+	}{
+		{
+			name:           "Successful revoke",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Key not found",
+			repoError:      apperrors.ErrAPIKeyNotFound,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Server error",
+			repoError:      apperrors.ErrServer,
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodDelete, "/", nil)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+			ctx.SetPath("/api/user/api-keys/:id")
+			ctx.SetParamNames("id")
+			ctx.SetParamValues("key1")
+			ctx.Set("user_id", testUser.ID)
+			ctx.Set("user_login", testUser.Login)
+
+			repo.EXPECT().RevokeAPIKey(gomock.Any(), testUser.ID, "key1", gomock.Any()).Return(test.repoError).Times(1)
+
+			err := h.Revoke(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ShiraazMoollatjie/goluhn"
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/models"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxBatchOrders - номеров в одном запросе, больше партнёры присылают несколькими запросами
+const maxBatchOrders = 1000
+
+// maxBatchBody - предел тела запроса: по 64 байта на номер с кавычками, разделителями и пробелами
+const maxBatchBody = maxBatchOrders * 64
+
+// orderNumberRegex - длина ограничена колонкой orders.number varchar(255)
+var orderNumberRegex = regexp.MustCompile(`^\d{1,255}$`)
+
+// AddOrdersBatch загружает пакет номеров: JSON массив строк или text/plain по номеру на строку.
+// Отвечает результатом для каждого номера в порядке запроса.
+func (h *userHandler) AddOrdersBatch(ctx echo.Context) error {
+	// Тело читается целиком, поэтому ограничиваем его до чтения
+	body, err := io.ReadAll(http.MaxBytesReader(ctx.Response(), ctx.Request().Body, maxBatchBody))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return ctx.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": apperrors.ErrBatchTooBig.Error()})
+		}
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidJSON.Error()})
+	}
+	numbers, err := parseOrderBatch(ctx.Request().Header.Get(echo.HeaderContentType), body)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidJSON.Error()})
+	}
+	if len(numbers) == 0 {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrEmptyBatch.Error()})
+	}
+	if len(numbers) > maxBatchOrders {
+		return ctx.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": apperrors.ErrBatchTooBig.Error()})
+	}
+
+	results := make([]models.BatchOrderResult, len(numbers))
+	unique := make(map[string]bool, len(numbers))
+	var valid []string
+	for i, number := range numbers {
+		results[i].Number = number
+		if !orderNumberRegex.MatchString(number) || goluhn.Validate(number) != nil {
+			results[i].Result = models.BatchInvalid
+			continue
+		}
+		if !unique[number] {
+			unique[number] = true
+			valid = append(valid, number)
+		}
+	}
+
+	userID := ctx.Get("user_id").(int64)
+	inserted := map[string]string{}
+	if len(valid) > 0 {
+		err = h.retryer.Retry(func() error {
+			var err error
+			inserted, err = h.repo.InsertOrders(ctx.Request().Context(), userID, valid, time.Now())
+			return err
+		})
+		if err != nil {
+			log.Printf("Failed to add orders batch: %v", err)
+			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+		}
+	}
+
+	// Повтор номера внутри пакета - дубликат уже загруженного этим же запросом
+	seen := make(map[string]bool, len(valid))
+	accepted := 0
+	for i := range results {
+		if results[i].Result == models.BatchInvalid {
+			continue
+		}
+		number := results[i].Number
+		results[i].Result = inserted[number]
+		if results[i].Result == models.BatchAccepted {
+			if seen[number] {
+				results[i].Result = models.BatchDuplicateOwn
+				continue
+			}
+			accepted++
+		}
+		seen[number] = true
+	}
+
+	log.Printf("User %v uploaded batch of %d orders, %d accepted", userID, len(numbers), accepted)
+	return ctx.JSON(http.StatusOK, results)
+}
+
+// internal
+
+func parseOrderBatch(contentType string, body []byte) ([]string, error) {
+	if strings.HasPrefix(contentType, echo.MIMEApplicationJSON) {
+		var numbers []string
+		if err := json.Unmarshal(body, &numbers); err != nil {
+			return nil, err
+		}
+		return numbers, nil
+	}
+
+	var numbers []string
+	for _, line := range strings.Split(string(body), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			numbers = append(numbers, line)
+		}
+	}
+	return numbers, nil
+}
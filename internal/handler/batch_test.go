@@ -0,0 +1,149 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/handler"
+	"github.com/llaxzi/gophermart/internal/mocks"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/retryables/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAddOrdersBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewUserHandler(repo, nil, retryer, nil, nil, nil, nil, nil, nil, nil)
+
+	// Luhn-валидный номер из 256 цифр
+	longNumber := strings.Repeat("0", 245) + "79927398713"
+
+	tests := []struct {
+		name            string
+		contentType     string
+		body            string
+		expectedNumbers []string
+		inserted        map[string]string
+		repoError       error
+		expectedStatus  int
+		expectedResults []models.BatchOrderResult
+	}{
+		{
+			name:            "JSON batch with every outcome",
+			contentType:     echo.MIMEApplicationJSON,
+			body:            `["79927398713","12345678903","4561261212345467","123456789","79927398713"]`,
+			expectedNumbers: []string{"79927398713", "12345678903", "4561261212345467"},
+			inserted: map[string]string{
+				"79927398713":      models.BatchAccepted,
+				"12345678903":      models.BatchDuplicateOwn,
+				"4561261212345467": models.BatchOwnedByOther,
+			},
+			expectedStatus: http.StatusOK,
+			expectedResults: []models.BatchOrderResult{
+				{Number: "79927398713", Result: models.BatchAccepted},
+				{Number: "12345678903", Result: models.BatchDuplicateOwn},
+				{Number: "4561261212345467", Result: models.BatchOwnedByOther},
+				{Number: "123456789", Result: models.BatchInvalid},
+				{Number: "79927398713", Result: models.BatchDuplicateOwn},
+			},
+		},
+		{
+			name:            "Newline-delimited batch",
+			contentType:     echo.MIMETextPlain,
+			body:            "79927398713\r\n\nabc\n",
+			expectedNumbers: []string{"79927398713"},
+			inserted:        map[string]string{"79927398713": models.BatchAccepted},
+			expectedStatus:  http.StatusOK,
+			expectedResults: []models.BatchOrderResult{
+				{Number: "79927398713", Result: models.BatchAccepted},
+				{Number: "abc", Result: models.BatchInvalid},
+			},
+		},
+		{
+			name:            "Number longer than the column",
+			contentType:     echo.MIMETextPlain,
+			body:            "79927398713\n" + longNumber,
+			expectedNumbers: []string{"79927398713"},
+			inserted:        map[string]string{"79927398713": models.BatchAccepted},
+			expectedStatus:  http.StatusOK,
+			expectedResults: []models.BatchOrderResult{
+				{Number: "79927398713", Result: models.BatchAccepted},
+				{Number: longNumber, Result: models.BatchInvalid},
+			},
+		},
+		{
+			name:           "Invalid JSON",
+			contentType:    echo.MIMEApplicationJSON,
+			body:           `{"number":"79927398713"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Empty batch",
+			contentType:    echo.MIMETextPlain,
+			body:           "\n\n",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Batch too large",
+			contentType:    echo.MIMETextPlain,
+			body:           strings.Repeat("79927398713\n", 1001),
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "Body too large",
+			contentType:    echo.MIMETextPlain,
+			body:           "79927398713" + strings.Repeat(" ", 64000),
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:            "Database error",
+			contentType:     echo.MIMETextPlain,
+			body:            "79927398713",
+			expectedNumbers: []string{"79927398713"},
+			repoError:       apperrors.ErrServer,
+			expectedStatus:  http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/api/user/orders/batch", bytes.NewReader([]byte(test.body)))
+			req.Header.Set(echo.HeaderContentType, test.contentType)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+			ctx.Set("user_id", testUser.ID)
+			ctx.Set("user_login", testUser.Login)
+
+			if test.expectedNumbers != nil {
+				repo.EXPECT().
+					InsertOrders(gomock.Any(), testUser.ID, test.expectedNumbers, gomock.Any()).
+					Return(test.inserted, test.repoError).
+					Times(1)
+			}
+
+			err := h.AddOrdersBatch(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+			if test.expectedStatus == http.StatusOK {
+				var results []models.BatchOrderResult
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+				assert.Equal(t, test.expectedResults, results)
+			}
+		})
+	}
+}
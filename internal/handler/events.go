@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/events"
+	"github.com/llaxzi/gophermart/internal/models"
+	"net/http"
+	"time"
+)
+
+type EventsHandler interface {
+	OrderEvents(ctx echo.Context) error
+}
+
+// NewEventsHandler - heartbeat задаёт интервал комментариев, которые не дают прокси закрыть простаивающий поток
+func NewEventsHandler(broker events.Broker, heartbeat time.Duration) EventsHandler {
+	return &eventsHandler{broker, heartbeat}
+}
+
+type eventsHandler struct {
+	broker    events.Broker
+	heartbeat time.Duration
+}
+
+// OrderEvents - SSE поток изменений заказов пользователя.
+// Поток по JWT закрывается при истечении токена, клиент переподключается с новым.
+func (h *eventsHandler) OrderEvents(ctx echo.Context) error {
+	orderEvents, unsubscribe := h.broker.Subscribe(ctx.Get("user_id").(int64))
+	defer unsubscribe()
+
+	var expired <-chan time.Time
+	if claims, ok := ctx.Get("user_claims").(*models.UserClaims); ok && claims.ExpiresAt != nil {
+		timer := time.NewTimer(time.Until(claims.ExpiresAt.Time))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	res := ctx.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	// Отключаем буферизацию в nginx
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Request().Context().Done():
+			return nil
+		case <-expired:
+			return nil
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case event := <-orderEvents:
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			if _, err = fmt.Fprintf(res, "event: order\ndata: %s\n\n", data); err != nil {
+				return nil
+			}
+			res.Flush()
+		}
+	}
+}
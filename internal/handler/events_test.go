@@ -0,0 +1,64 @@
+package handler_test
+
+import (
+	"bufio"
+	"context"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/events"
+	"github.com/llaxzi/gophermart/internal/handler"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrderEvents(t *testing.T) {
+	broker := events.NewBroker(10)
+	h := handler.NewEventsHandler(broker, time.Minute)
+
+	e := echo.New()
+	e.GET("/api/user/orders/events", h.OrderEvents, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			ctx.Set("user_id", testUser.ID)
+			ctx.Set("user_claims", &models.UserClaims{
+				UserID:           testUser.ID,
+				RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Second))},
+			})
+			return next(ctx)
+		}
+	})
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/user/orders/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// Заголовки отправляются после подписки, события ниже не теряются
+	broker.Publish(context.Background(), models.OrderEvent{UserID: 2, Number: "12345678903", Status: "PROCESSED"})
+	broker.Publish(context.Background(), models.OrderEvent{UserID: testUser.ID, Number: "79927398713", Status: "PROCESSING"})
+
+	reader := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 2 {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	assert.Equal(t, []string{"event: order", `data: {"number":"79927398713","status":"PROCESSING"}`}, lines)
+
+	// Поток закрывается вместе с истечением access токена
+	_, err = io.ReadAll(reader)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/keyring"
+	"net/http"
+)
+
+type KeysHandler interface {
+	JWKS(ctx echo.Context) error
+}
+
+func NewKeysHandler(keys keyring.Keyring) KeysHandler {
+	return &keysHandler{keys}
+}
+
+type keysHandler struct {
+	keys keyring.Keyring
+}
+
+// JWKS публикует ключи для проверки токенов другими сервисами
+func (h *keysHandler) JWKS(ctx echo.Context) error {
+	ctx.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return ctx.JSON(http.StatusOK, h.keys.JWKS())
+}
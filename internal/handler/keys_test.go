@@ -0,0 +1,46 @@
+package handler_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/handler"
+	"github.com/llaxzi/gophermart/internal/keyring"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJWKS(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	keys := keyring.NewStatic(
+		keyring.Key{ID: "ed", Method: jwt.SigningMethodEdDSA, Private: edKey, Public: edKey.Public()},
+		keyring.Key{ID: "hmac", Secret: []byte("secret")},
+	)
+	h := handler.NewKeysHandler(keys)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+
+	err = h.JWKS(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var jwks models.JWKS
+	err = json.Unmarshal(rec.Body.Bytes(), &jwks)
+	require.NoError(t, err)
+	// HMAC секрет не публикуется
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "ed", jwks.Keys[0].Kid)
+	assert.Equal(t, "EdDSA", jwks.Keys[0].Alg)
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/lockout"
+	"github.com/llaxzi/gophermart/internal/mfa"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/gophermart/internal/revocation"
+	"github.com/llaxzi/retryables/v2"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// MFAHandler - подключение и отключение TOTP. Вход со вторым фактором - UserHandler.LoginMFA.
+type MFAHandler interface {
+	Setup(ctx echo.Context) error
+	Enable(ctx echo.Context) error
+	Disable(ctx echo.Context) error
+}
+
+func NewMFAHandler(mfaAuth mfa.Authenticator, retryer *retryables.Retryer, limiter lockout.Limiter, revoker revocation.Checker) MFAHandler {
+	return &mfaHandler{mfaAuth, retryer, limiter, revoker}
+}
+
+type mfaHandler struct {
+	mfa     mfa.Authenticator
+	retryer *retryables.Retryer
+	limiter lockout.Limiter
+	revoker revocation.Checker
+}
+
+// Setup выдаёт новый секрет. Второй фактор включается только после Enable.
+func (h *mfaHandler) Setup(ctx echo.Context) error {
+	userID := ctx.Get("user_id").(int64)
+
+	var setup models.TOTPSetup
+	err := h.retryer.Retry(func() error {
+		var err error
+		setup, err = h.mfa.Setup(ctx.Request().Context(), userID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, apperrors.ErrTOTPEnabled) {
+			return ctx.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		log.Printf("Failed to set up TOTP: %v for user: %v", err, userID)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	return ctx.JSON(http.StatusOK, setup)
+}
+
+func (h *mfaHandler) Enable(ctx echo.Context) error {
+	var req models.TOTPCode
+	err := ctx.Bind(&req)
+	if err != nil || req.Code == "" {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidJSON.Error()})
+	}
+
+	userID := ctx.Get("user_id").(int64)
+
+	var codes []string
+	err = h.retryer.Retry(func() error {
+		codes, err = h.mfa.Enable(ctx.Request().Context(), userID, req.Code)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, apperrors.ErrTOTPEnabled) {
+			return ctx.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		if mfa.IsInvalidCode(err) {
+			return ctx.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
+		log.Printf("Failed to enable TOTP: %v for user: %v", err, userID)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	// Сессии, открытые до включения второго фактора, могли быть выданы по одному паролю
+	err = h.retryer.Retry(func() error {
+		return h.revoker.RevokeAll(ctx.Request().Context(), userID)
+	})
+	if err != nil {
+		log.Printf("Failed to revoke sessions after enabling TOTP: %v for user: %v", err, userID)
+	}
+
+	log.Printf("Two-factor authentication enabled for user: %v", userID)
+	return ctx.JSON(http.StatusOK, models.RecoveryCodes{RecoveryCodes: codes})
+}
+
+// Disable требует действующий TOTP код или код восстановления
+func (h *mfaHandler) Disable(ctx echo.Context) error {
+	var req models.TOTPCode
+	err := ctx.Bind(&req)
+	if err != nil || req.Code == "" {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidJSON.Error()})
+	}
+
+	userID := ctx.Get("user_id").(int64)
+
+	ok, err := verifyTOTP(ctx, h.limiter, h.retryer, userID, func() error {
+		return h.mfa.Disable(ctx.Request().Context(), userID, req.Code)
+	})
+	if !ok {
+		return err
+	}
+
+	log.Printf("Two-factor authentication disabled for user: %v", userID)
+	return ctx.JSON(http.StatusOK, "two-factor authentication disabled")
+}
+
+// verifyTOTP выполняет проверку кода verify с учётом счётчика неверных кодов пользователя:
+// при блокировке отвечает 429, неверный код засчитывается как неудача. При ok == false ответ уже записан.
+func verifyTOTP(ctx echo.Context, limiter lockout.Limiter, retryer *retryables.Retryer, userID int64, verify func() error) (ok bool, err error) {
+	var retryAfter time.Duration
+	err = retryer.Retry(func() error {
+		retryAfter, err = limiter.CheckTOTP(ctx.Request().Context(), userID)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to check TOTP lockout: %v for user: %v", err, userID)
+		return false, ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+	if retryAfter > 0 {
+		ctx.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		return false, ctx.JSON(http.StatusTooManyRequests, map[string]string{"error": apperrors.ErrTooManyTOTP.Error()})
+	}
+
+	err = retryer.Retry(verify)
+	if err != nil {
+		if !mfa.IsInvalidCode(err) {
+			log.Printf("Failed to verify TOTP code: %v for user: %v", err, userID)
+			return false, ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+		}
+		// Выключенный второй фактор - не подбор кода
+		if errors.Is(err, apperrors.ErrInvalidTOTP) {
+			failErr := retryer.Retry(func() error {
+				return limiter.FailTOTP(ctx.Request().Context(), userID)
+			})
+			if failErr != nil {
+				log.Printf("Failed to record TOTP failure: %v for user: %v", failErr, userID)
+				return false, ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+			}
+		}
+		return false, ctx.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+
+	err = retryer.Retry(func() error {
+		return limiter.ResetTOTP(ctx.Request().Context(), userID)
+	})
+	if err != nil {
+		log.Printf("Failed to reset TOTP attempts: %v for user: %v", err, userID)
+	}
+	return true, nil
+}
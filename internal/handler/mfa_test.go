@@ -0,0 +1,206 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/handler"
+	"github.com/llaxzi/gophermart/internal/mocks"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/retryables/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMFASetup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mfaAuth := mocks.NewMockAuthenticator(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewMFAHandler(mfaAuth, retryer, nil, nil)
+
+	tests := []struct {
+		name           string
+		setup          models.TOTPSetup
+		mfaError       error
+		expectedStatus int
+	}{
+		{
+			name:           "Successful setup",
+			setup:          models.TOTPSetup{Secret: "JBSWY3DPEHPK3PXP", ProvisioningURI: "otpauth://totp/Gophermart:testuser"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Already enabled",
+			mfaError:       apperrors.ErrTOTPEnabled,
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+			ctx.Set("user_id", testUser.ID)
+			ctx.Set("user_login", testUser.Login)
+
+			mfaAuth.EXPECT().Setup(gomock.Any(), testUser.ID).Return(test.setup, test.mfaError).Times(1)
+
+			err := h.Setup(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+			if test.expectedStatus == http.StatusOK {
+				var setup models.TOTPSetup
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &setup))
+				assert.Equal(t, test.setup, setup)
+			}
+		})
+	}
+}
+
+func TestMFAEnable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mfaAuth := mocks.NewMockAuthenticator(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	revoker := mocks.NewMockChecker(ctrl)
+	h := handler.NewMFAHandler(mfaAuth, retryer, nil, revoker)
+
+	tests := []struct {
+		name           string
+		body           string
+		expectMFACall  bool
+		codes          []string
+		mfaError       error
+		expectedStatus int
+	}{
+		{
+			name:           "Successful enable",
+			body:           `{"code":"123456"}`,
+			expectMFACall:  true,
+			codes:          []string{"abcd-efgh", "ijkl-mnop"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Missing code",
+			body:           `{}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Wrong code",
+			body:           `{"code":"000000"}`,
+			expectMFACall:  true,
+			mfaError:       apperrors.ErrInvalidTOTP,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Already enabled",
+			body:           `{"code":"123456"}`,
+			expectMFACall:  true,
+			mfaError:       apperrors.ErrTOTPEnabled,
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+			ctx.Set("user_id", testUser.ID)
+			ctx.Set("user_login", testUser.Login)
+
+			if test.expectMFACall {
+				mfaAuth.EXPECT().Enable(gomock.Any(), testUser.ID, gomock.Any()).Return(test.codes, test.mfaError).Times(1)
+			}
+			// Сессии, выданные до включения второго фактора, отзываются
+			if test.expectedStatus == http.StatusOK {
+				revoker.EXPECT().RevokeAll(gomock.Any(), testUser.ID).Return(nil).Times(1)
+			}
+
+			err := h.Enable(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+			if test.expectedStatus == http.StatusOK {
+				var codes models.RecoveryCodes
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &codes))
+				assert.Equal(t, test.codes, codes.RecoveryCodes)
+			}
+		})
+	}
+}
+
+func TestMFADisable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mfaAuth := mocks.NewMockAuthenticator(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	limiter := mocks.NewMockLimiter(ctrl)
+	h := handler.NewMFAHandler(mfaAuth, retryer, limiter, nil)
+
+	tests := []struct {
+		name           string
+		mfaError       error
+		lockedFor      time.Duration
+		expectedStatus int
+	}{
+		{name: "Successful disable", expectedStatus: http.StatusOK},
+		{name: "Too many invalid codes", lockedFor: time.Minute, expectedStatus: http.StatusTooManyRequests},
+		{name: "Wrong code", mfaError: apperrors.ErrInvalidTOTP, expectedStatus: http.StatusForbidden},
+		{name: "Not enabled", mfaError: apperrors.ErrTOTPNotEnabled, expectedStatus: http.StatusForbidden},
+		{name: "Server error", mfaError: apperrors.ErrPgConnExc, expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"code":"abcd-efgh"}`))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+			ctx.Set("user_id", testUser.ID)
+			ctx.Set("user_login", testUser.Login)
+
+			limiter.EXPECT().CheckTOTP(gomock.Any(), testUser.ID).Return(test.lockedFor, nil).Times(1)
+			if test.lockedFor == 0 {
+				mfaAuth.EXPECT().Disable(gomock.Any(), testUser.ID, "abcd-efgh").Return(test.mfaError).Times(1)
+			}
+			// Засчитывается только неверный код
+			switch {
+			case test.mfaError == nil && test.lockedFor == 0:
+				limiter.EXPECT().ResetTOTP(gomock.Any(), testUser.ID).Return(nil).Times(1)
+			case errors.Is(test.mfaError, apperrors.ErrInvalidTOTP):
+				limiter.EXPECT().FailTOTP(gomock.Any(), testUser.ID).Return(nil).Times(1)
+			}
+
+			err := h.Disable(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+			if test.lockedFor > 0 {
+				assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
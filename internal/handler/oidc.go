@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/gophermart/internal/tokens"
+	"github.com/llaxzi/gophermart/internal/validation"
+	"log"
+	"net/http"
+	"time"
+)
+
+// OIDCLogin начинает вход через внешний провайдер: сохраняет state в БД и в cookie браузера
+// и перенаправляет на провайдера
+func (h *userHandler) OIDCLogin(ctx echo.Context) error {
+	authReq, err := h.oidc.AuthRequest(ctx.Request().Context())
+	if err != nil {
+		log.Printf("Failed to prepare OIDC login: %v", err)
+		return ctx.JSON(http.StatusBadGateway, map[string]string{"error": apperrors.ErrOIDCFailed.Error()})
+	}
+
+	ttl := h.oidc.StateTTL()
+	err = h.retryer.Retry(func() error {
+		return h.repo.InsertOIDCState(ctx.Request().Context(), models.OIDCState{
+			StateHash: tokens.HashToken(authReq.State),
+			Verifier:  authReq.Verifier,
+			Nonce:     authReq.Nonce,
+			ExpiresAt: time.Now().Add(ttl),
+		})
+	})
+	if err != nil {
+		log.Printf("Failed to save OIDC state: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+	h.cookies.SetOIDCState(ctx, authReq.State, ttl)
+
+	return ctx.Redirect(http.StatusFound, authReq.URL)
+}
+
+// OIDCCallback завершает вход через провайдера. При первом входе создаётся пользователь,
+// привязанный к внешнему аккаунту.
+func (h *userHandler) OIDCCallback(ctx echo.Context) error {
+	if providerErr := ctx.QueryParam("error"); providerErr != "" {
+		return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": apperrors.ErrOIDCFailed.Error() + ": " + providerErr})
+	}
+	stateParam, code := ctx.QueryParam("state"), ctx.QueryParam("code")
+	if stateParam == "" || code == "" {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidJSON.Error()})
+	}
+	// Без cookie callback мог прийти по ссылке атакующего с его собственным state (login CSRF)
+	if !h.cookies.ValidOIDCState(ctx, stateParam) {
+		return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": apperrors.ErrInvalidOIDCState.Error()})
+	}
+
+	var state models.OIDCState
+	err := h.retryer.Retry(func() error {
+		var err error
+		state, err = h.repo.UseOIDCState(ctx.Request().Context(), tokens.HashToken(stateParam), time.Now())
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, apperrors.ErrInvalidOIDCState) {
+			return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		}
+		log.Printf("Failed to use OIDC state: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	identity, err := h.oidc.Exchange(ctx.Request().Context(), code, state.Verifier, state.Nonce)
+	if err != nil {
+		log.Printf("OIDC login failed: %v", err)
+		return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": apperrors.ErrOIDCFailed.Error()})
+	}
+
+	account, err := h.federatedUser(ctx, identity)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrLoginTaken) {
+			return ctx.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		log.Printf("Failed to provision OIDC user: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	return h.completeLogin(ctx, account)
+}
+
+// federatedUser возвращает пользователя, привязанного к внешнему аккаунту, создавая его при первом входе
+func (h *userHandler) federatedUser(ctx echo.Context, identity models.OIDCIdentity) (models.Account, error) {
+	var account models.Account
+	err := h.retryer.Retry(func() error {
+		var err error
+		account, err = h.repo.SelectIdentityAccount(ctx.Request().Context(), identity.Issuer, identity.Subject)
+		return err
+	})
+	if !errors.Is(err, apperrors.ErrUserNotFound) {
+		return account, err
+	}
+
+	account = models.Account{Login: federatedLogin(identity), Role: models.RoleUser}
+	err = h.retryer.Retry(func() error {
+		var err error
+		account.ID, err = h.repo.InsertFederatedUser(ctx.Request().Context(), account.Login, identity)
+		return err
+	})
+	if errors.Is(err, apperrors.ErrLoginTaken) {
+		// Параллельный первый вход того же пользователя уже создал запись
+		err = h.retryer.Retry(func() error {
+			var err error
+			account, err = h.repo.SelectIdentityAccount(ctx.Request().Context(), identity.Issuer, identity.Subject)
+			return err
+		})
+		if errors.Is(err, apperrors.ErrUserNotFound) {
+			return account, apperrors.ErrLoginTaken
+		}
+	}
+	return account, err
+}
+
+// federatedLogin - детерминированный логин для внешнего аккаунта. Префикс зарезервирован валидатором,
+// поэтому локальный логин с ним не совпадёт; при совпадении вход завершится ошибкой, а не привяжется к чужому аккаунту.
+func federatedLogin(identity models.OIDCIdentity) string {
+	sum := sha256.Sum256([]byte(identity.Issuer + "\x00" + identity.Subject))
+	return validation.FederatedLoginPrefix + hex.EncodeToString(sum[:8])
+}
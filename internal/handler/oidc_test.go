@@ -0,0 +1,190 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/cookieauth"
+	"github.com/llaxzi/gophermart/internal/handler"
+	"github.com/llaxzi/gophermart/internal/mocks"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/gophermart/internal/oidc"
+	"github.com/llaxzi/gophermart/internal/tokens"
+	"github.com/llaxzi/retryables/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOIDCLogin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	provider := mocks.NewMockProvider(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewUserHandler(repo, nil, retryer, nil, nil, nil, nil, nil, cookieauth.NewManager(cookieauth.Config{}), provider)
+
+	authReq := oidc.AuthRequest{URL: "https://idp.example.com/authorize?state=state", State: "state", Nonce: "nonce", Verifier: "verifier"}
+	provider.EXPECT().AuthRequest(gomock.Any()).Return(authReq, nil)
+	provider.EXPECT().StateTTL().Return(time.Minute)
+	repo.EXPECT().
+		InsertOIDCState(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, state models.OIDCState) error {
+			// В БД только хеш state, verifier и nonce нужны для callback
+			assert.Equal(t, tokens.HashToken("state"), state.StateHash)
+			assert.Equal(t, "verifier", state.Verifier)
+			assert.Equal(t, "nonce", state.Nonce)
+			return nil
+		})
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/user/oidc/login", nil), rec)
+
+	require.NoError(t, h.OIDCLogin(ctx))
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, authReq.URL, rec.Header().Get(echo.HeaderLocation))
+
+	// Callback примет только браузер, получивший этот state
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, cookieauth.OIDCCookie, cookies[0].Name)
+	assert.Equal(t, "state", cookies[0].Value)
+}
+
+func TestOIDCCallback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	tokenBuilder := mocks.NewMockTokenBuilder(ctrl)
+	limiter := mocks.NewMockLimiter(ctrl)
+	mfaAuth := mocks.NewMockAuthenticator(ctrl)
+	provider := mocks.NewMockProvider(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewUserHandler(repo, tokenBuilder, retryer, nil, limiter, nil, nil, mfaAuth, cookieauth.NewManager(cookieauth.Config{}), provider)
+
+	identity := models.OIDCIdentity{Issuer: "https://idp.example.com", Subject: "248289761001"}
+	state := models.OIDCState{Verifier: "verifier", Nonce: "nonce"}
+
+	tests := []struct {
+		name           string
+		query          string
+		stateCookie    string
+		stateError     error
+		exchangeError  error
+		existingLogin  string
+		expectProvider bool
+		expectedStatus int
+	}{
+		{
+			name:           "Returning user",
+			query:          "?state=state&code=code",
+			stateCookie:    "state",
+			existingLogin:  "testuser",
+			expectProvider: true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "First login provisions user",
+			query:          "?state=state&code=code",
+			stateCookie:    "state",
+			expectProvider: true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Provider returned error",
+			query:          "?error=access_denied&state=state",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Missing code",
+			query:          "?state=state",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Unknown or expired state",
+			query:          "?state=state&code=code",
+			stateCookie:    "state",
+			stateError:     apperrors.ErrInvalidOIDCState,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "State not bound to browser",
+			query:          "?state=state&code=code",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "State from another browser",
+			query:          "?state=state&code=code",
+			stateCookie:    "attacker",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Invalid id token",
+			query:          "?state=state&code=code",
+			stateCookie:    "state",
+			exchangeError:  oidc.ErrInvalidToken,
+			expectProvider: true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/api/user/oidc/callback"+test.query, nil)
+			if test.stateCookie != "" {
+				req.AddCookie(&http.Cookie{Name: cookieauth.OIDCCookie, Value: test.stateCookie})
+			}
+			ctx := e.NewContext(req, rec)
+
+			if test.stateCookie == "state" {
+				repo.EXPECT().UseOIDCState(gomock.Any(), tokens.HashToken("state"), gomock.Any()).Return(state, test.stateError)
+			}
+			if test.expectProvider {
+				provider.EXPECT().Exchange(gomock.Any(), "code", state.Verifier, state.Nonce).Return(identity, test.exchangeError)
+			}
+			if test.expectedStatus == http.StatusOK {
+				account := models.Account{ID: 1, Login: test.existingLogin, Role: models.RoleUser}
+				if test.existingLogin == "" {
+					account = models.Account{ID: 2, Login: "oidc-new", Role: models.RoleUser}
+					repo.EXPECT().SelectIdentityAccount(gomock.Any(), identity.Issuer, identity.Subject).Return(models.Account{}, apperrors.ErrUserNotFound)
+					repo.EXPECT().
+						InsertFederatedUser(gomock.Any(), gomock.Any(), identity).
+						DoAndReturn(func(_ context.Context, userLogin string, _ models.OIDCIdentity) (int64, error) {
+							if !strings.HasPrefix(userLogin, "oidc-") {
+								return 0, errors.New("unexpected login " + userLogin)
+							}
+							return account.ID, nil
+						})
+				} else {
+					repo.EXPECT().SelectIdentityAccount(gomock.Any(), identity.Issuer, identity.Subject).Return(account, nil)
+				}
+				mfaAuth.EXPECT().Enabled(gomock.Any(), account.ID).Return(false, nil)
+				limiter.EXPECT().Reset(gomock.Any(), gomock.Any(), "").Return(nil)
+				expectTokenPair(tokenBuilder, repo, account)
+			}
+
+			err := h.OIDCCallback(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+			if test.expectedStatus == http.StatusOK {
+				assert.Equal(t, "Bearer mock_token", rec.Header().Get("Authorization"))
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/models"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+	// nextCursorHeader - курсор следующей страницы, тело ответа остаётся массивом для старых клиентов
+	nextCursorHeader = "X-Next-Cursor"
+	// Итоги по всем страницам под фильтром
+	totalCountHeader = "X-Total-Count"
+	totalSumHeader   = "X-Total-Sum"
+)
+
+// parsePageFilter читает limit, cursor, from, to и sort из query. Возвращает все ошибки сразу.
+// Без limit и cursor список отдаётся целиком, как до появления пагинации, с cursor - по defaultPageLimit.
+func parsePageFilter(ctx echo.Context) (models.PageFilter, []models.Violation) {
+	var filter models.PageFilter
+	if ctx.QueryParam("cursor") != "" {
+		filter.Limit = defaultPageLimit
+	}
+	var violations []models.Violation
+
+	if v := ctx.QueryParam("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			violations = append(violations, queryViolation("limit", "range", "limit must be between 1 and "+strconv.Itoa(maxPageLimit)))
+		}
+		filter.Limit = limit
+	}
+	if v := ctx.QueryParam("cursor"); v != "" {
+		cursor, err := decodeCursor(v)
+		if err != nil {
+			violations = append(violations, queryViolation("cursor", "format", "invalid cursor"))
+		}
+		filter.After = cursor
+	}
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		v := ctx.QueryParam(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			violations = append(violations, queryViolation(p.name, "format", p.name+" must be an RFC 3339 timestamp"))
+			continue
+		}
+		*p.dst = &t
+	}
+	switch ctx.QueryParam("sort") {
+	case "", "desc":
+	case "asc":
+		filter.Asc = true
+	default:
+		violations = append(violations, queryViolation("sort", "enum", "sort must be asc or desc"))
+	}
+	return filter, violations
+}
+
+// parseOrderFilter - parsePageFilter плюс статусы: ?status=NEW&status=PROCESSING или ?status=NEW,PROCESSING
+func parseOrderFilter(ctx echo.Context) (models.OrderFilter, []models.Violation) {
+	page, violations := parsePageFilter(ctx)
+	filter := models.OrderFilter{PageFilter: page}
+	for _, param := range ctx.QueryParams()["status"] {
+		for _, status := range strings.Split(param, ",") {
+			if !contains(models.OrderStatuses, status) {
+				violations = append(violations, queryViolation("status", "enum", "status must be one of "+strings.Join(models.OrderStatuses, ", ")))
+				return filter, violations
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+	return filter, violations
+}
+
+// parseWithdrawalFilter - parsePageFilter плюс min_sum
+func parseWithdrawalFilter(ctx echo.Context) (models.WithdrawalFilter, []models.Violation) {
+	page, violations := parsePageFilter(ctx)
+	filter := models.WithdrawalFilter{PageFilter: page}
+	if v := ctx.QueryParam("min_sum"); v != "" {
+		minSum, err := strconv.ParseFloat(v, 64)
+		if err != nil || minSum < 0 || math.IsNaN(minSum) || math.IsInf(minSum, 0) {
+			violations = append(violations, queryViolation("min_sum", "range", "min_sum must be a non-negative number"))
+		}
+		filter.MinSum = minSum
+	}
+	return filter, violations
+}
+
+// setNextCursor выставляет заголовок, только если есть следующая страница
+func setNextCursor(ctx echo.Context, next *models.Cursor) {
+	if next != nil {
+		ctx.Response().Header().Set(nextCursorHeader, encodeCursor(*next))
+	}
+}
+
+func encodeCursor(cursor models.Cursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*models.Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var cursor models.Cursor
+	if err = json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+func queryViolation(field, rule, message string) models.Violation {
+	return models.Violation{Field: field, Rule: rule, Message: message}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/gophermart/internal/repository"
+	"github.com/llaxzi/gophermart/internal/revocation"
+	"github.com/llaxzi/retryables/v2"
+	"log"
+	"net/http"
+)
+
+type SessionHandler interface {
+	List(ctx echo.Context) error
+	Delete(ctx echo.Context) error
+}
+
+func NewSessionHandler(repo repository.Repository, retryer *retryables.Retryer, revoker revocation.Checker) SessionHandler {
+	return &sessionHandler{repo, retryer, revoker}
+}
+
+type sessionHandler struct {
+	repo    repository.Repository
+	retryer *retryables.Retryer
+	revoker revocation.Checker
+}
+
+// List возвращает активные сессии, текущая помечена current
+func (h *sessionHandler) List(ctx echo.Context) error {
+	claims := ctx.Get("user_claims").(*models.UserClaims)
+
+	var sessions []models.Session
+	err := h.retryer.Retry(func() error {
+		var err error
+		sessions, err = h.repo.SelectSessions(ctx.Request().Context(), claims.UserID)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to get sessions: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	if len(sessions) < 1 {
+		return ctx.NoContent(http.StatusNoContent)
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == claims.SessionID
+	}
+
+	return ctx.JSON(http.StatusOK, sessions)
+}
+
+// Delete завершает сессию на другом устройстве (или текущую)
+func (h *sessionHandler) Delete(ctx echo.Context) error {
+	userID := ctx.Get("user_id").(int64)
+	id := ctx.Param("id")
+
+	err := h.retryer.Retry(func() error {
+		return h.revoker.RevokeSession(ctx.Request().Context(), userID, id)
+	})
+	if err != nil {
+		if errors.Is(err, apperrors.ErrSessionNotFound) {
+			return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		log.Printf("Failed to revoke session: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	return ctx.JSON(http.StatusOK, "session deleted")
+}
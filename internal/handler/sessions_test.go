@@ -0,0 +1,122 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/handler"
+	"github.com/llaxzi/gophermart/internal/mocks"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/retryables/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestListSessions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewSessionHandler(repo, retryer, nil)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	tests := []struct {
+		name           string
+		sessions       []models.Session
+		repoError      error
+		expectedStatus int
+	}{
+		{
+			name: "Sessions found",
+			sessions: []models.Session{
+				{ID: "current", UserAgent: "Mozilla/5.0", IP: "192.0.2.1", CreatedAt: now, LastSeenAt: now},
+				{ID: "phone", UserAgent: "okhttp/4.9", IP: "198.51.100.7", CreatedAt: now.Add(-time.Hour), LastSeenAt: now.Add(-time.Minute)},
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "No sessions",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Database error",
+			repoError:      apperrors.ErrServer,
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/user/sessions", nil), rec)
+			ctx.Set("user_id", testUser.ID)
+			ctx.Set("user_login", testUser.Login)
+			ctx.Set("user_claims", &models.UserClaims{UserID: testUser.ID, UserLogin: testUser.Login, SessionID: "current"})
+
+			repo.EXPECT().SelectSessions(gomock.Any(), testUser.ID).Return(test.sessions, test.repoError).Times(1)
+
+			err := h.List(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+
+			if test.expectedStatus == http.StatusOK {
+				var sessions []models.Session
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &sessions))
+				require.Len(t, sessions, len(test.sessions))
+				assert.True(t, sessions[0].Current)
+				assert.False(t, sessions[1].Current)
+				assert.Equal(t, test.sessions[1].UserAgent, sessions[1].UserAgent)
+			}
+		})
+	}
+}
+
+func TestDeleteSession(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	revoker := mocks.NewMockChecker(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewSessionHandler(nil, retryer, revoker)
+
+	tests := []struct {
+		name           string
+		revokeError    error
+		expectedStatus int
+	}{
+		{name: "Successful delete", expectedStatus: http.StatusOK},
+		{name: "Session not found", revokeError: apperrors.ErrSessionNotFound, expectedStatus: http.StatusNotFound},
+		{name: "Database error", revokeError: apperrors.ErrServer, expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(httptest.NewRequest(http.MethodDelete, "/", nil), rec)
+			ctx.SetParamNames("id")
+			ctx.SetParamValues("phone")
+			ctx.Set("user_id", testUser.ID)
+			ctx.Set("user_login", testUser.Login)
+
+			revoker.EXPECT().RevokeSession(gomock.Any(), testUser.ID, "phone").Return(test.revokeError).Times(1)
+
+			err := h.Delete(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+		})
+	}
+}
@@ -5,37 +5,67 @@ import (
 	"github.com/ShiraazMoollatjie/goluhn"
 	"github.com/labstack/echo/v4"
 	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/cookieauth"
+	"github.com/llaxzi/gophermart/internal/lockout"
+	"github.com/llaxzi/gophermart/internal/mfa"
 	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/gophermart/internal/oidc"
+	"github.com/llaxzi/gophermart/internal/passwords"
 	"github.com/llaxzi/gophermart/internal/repository"
+	"github.com/llaxzi/gophermart/internal/revocation"
 	"github.com/llaxzi/gophermart/internal/tokens"
+	"github.com/llaxzi/gophermart/internal/validation"
 	"github.com/llaxzi/retryables/v2"
-	"golang.org/x/crypto/bcrypt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
+const maxUserAgentLength = 256
+
 type UserHandler interface {
 	Register(ctx echo.Context) error
 	Login(ctx echo.Context) error
+	LoginMFA(ctx echo.Context) error
+	RefreshToken(ctx echo.Context) error
+	Logout(ctx echo.Context) error
+	LogoutAll(ctx echo.Context) error
+	ChangePassword(ctx echo.Context) error
+	ChangeLogin(ctx echo.Context) error
 	AddOrder(ctx echo.Context) error
+	AddOrdersBatch(ctx echo.Context) error
 	GetOrders(ctx echo.Context) error
+	GetOrder(ctx echo.Context) error
 	GetBalance(ctx echo.Context) error
 	Withdraw(ctx echo.Context) error
 	GetWithdrawals(ctx echo.Context) error
+	OIDCLogin(ctx echo.Context) error
+	OIDCCallback(ctx echo.Context) error
 }
 
-func NewUserHandler(repo repository.Repository, tokenB tokens.TokenBuilder, retryer *retryables.Retryer) UserHandler {
-	return &userHandler{repo, tokenB, retryer}
+func NewUserHandler(repo repository.Repository, tokenB tokens.TokenBuilder, retryer *retryables.Retryer,
+	revoker revocation.Checker, limiter lockout.Limiter, validator validation.Validator, hasher passwords.Hasher,
+	mfaAuth mfa.Authenticator, cookies cookieauth.Manager, provider oidc.Provider) UserHandler {
+	return &userHandler{repo, tokenB, retryer, revoker, limiter, validator, hasher, mfaAuth, cookies, provider}
 }
 
 type userHandler struct {
-	repo    repository.Repository
-	tokenB  tokens.TokenBuilder
-	retryer *retryables.Retryer
+	repo      repository.Repository
+	tokenB    tokens.TokenBuilder
+	retryer   *retryables.Retryer
+	revoker   revocation.Checker
+	limiter   lockout.Limiter
+	validator validation.Validator
+	hasher    passwords.Hasher
+	mfa       mfa.Authenticator
+	cookies   cookieauth.Manager
+	oidc      oidc.Provider
 }
 
 func (h *userHandler) Register(ctx echo.Context) error {
@@ -45,16 +75,23 @@ func (h *userHandler) Register(ctx echo.Context) error {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidJSON.Error()})
 	}
 
+	violations := append(h.validator.ValidateLogin(user.Login), h.validator.ValidatePassword(user.Login, user.Password)...)
+	if len(violations) > 0 {
+		return ctx.JSON(http.StatusBadRequest, models.ValidationErrorResponse{Error: apperrors.ErrValidation.Error(), Violations: violations})
+	}
+
 	// Хешируем пароль
-	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hash, err := h.hasher.Hash(user.Password)
 	if err != nil {
 		log.Printf("Hash password failed: %v", err)
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
 	}
-	user.Password = string(hash)
+	user.Password = hash
 
+	var userID int64
 	err = h.retryer.Retry(func() error {
-		return h.repo.InsertUser(ctx.Request().Context(), user)
+		userID, err = h.repo.InsertUser(ctx.Request().Context(), user)
+		return err
 	})
 
 	if err != nil {
@@ -65,16 +102,14 @@ func (h *userHandler) Register(ctx echo.Context) error {
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
 	}
 
-	// Генерируем JWT токен
-	token, err := h.tokenB.BuildJWTString(user.Login)
+	// Генерируем пару токенов
+	pair, err := h.issueTokens(ctx, userID, "")
 	if err != nil {
 		log.Printf("Failed to generate token: %v for user: %v", err, user.Login)
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
 	}
 
-	ctx.Response().Header().Add("Authorization", "Bearer "+token)
-
-	return ctx.JSON(http.StatusOK, "registered successfully")
+	return ctx.JSON(http.StatusOK, pair)
 }
 
 func (h *userHandler) Login(ctx echo.Context) error {
@@ -84,34 +119,277 @@ func (h *userHandler) Login(ctx echo.Context) error {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidJSON.Error()})
 	}
 
+	// Защита от перебора: блокировка по логину и по IP
+	ip := ctx.RealIP()
+	if allowed, err := h.checkLockout(ctx, user.Login, ip); !allowed {
+		return err
+	}
+
+	var userID int64
 	var hashedPassword string
 
 	err = h.retryer.Retry(func() error {
-		hashedPassword, err = h.repo.SelectUser(ctx.Request().Context(), user.Login)
+		userID, hashedPassword, err = h.repo.SelectUser(ctx.Request().Context(), user.Login)
 		return err
 	})
 	if err != nil {
 		if errors.Is(err, apperrors.ErrInvalidLP) {
+			// Логин, который нельзя зарегистрировать, не заводит свой счётчик: перебор таких логинов ограничивает счётчик IP
+			if !registrableLogin(h.validator, user.Login) {
+				return h.loginFailed(ctx, "", ip)
+			}
+			return h.loginFailed(ctx, user.Login, ip)
+		}
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	match, err := h.hasher.Compare(hashedPassword, user.Password)
+	if err != nil {
+		log.Printf("Failed to compare password hash: %v for user: %v", err, user.Login)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+	if !match {
+		return h.loginFailed(ctx, user.Login, ip)
+	}
+
+	// Хеш по устаревшей политике пересчитываем, пока известен пароль
+	if h.hasher.NeedsRehash(hashedPassword) {
+		h.rehashPassword(ctx, userID, hashedPassword, user.Password)
+	}
+
+	return h.completeLogin(ctx, models.Account{ID: userID, Login: user.Login})
+}
+
+// LoginMFA - второй шаг входа: mfa токен из Login и TOTP код или код восстановления
+func (h *userHandler) LoginMFA(ctx echo.Context) error {
+	var req models.MFALogin
+	err := ctx.Bind(&req)
+	if err != nil || req.MFAToken == "" || req.Code == "" {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidJSON.Error()})
+	}
+
+	ip := ctx.RealIP()
+	var account models.Account
+	err = h.retryer.Retry(func() error {
+		account, err = h.mfa.CompleteChallenge(ctx.Request().Context(), req.MFAToken, req.Code)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, apperrors.ErrInvalidMFAToken) {
 			return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
 		}
+		if mfa.IsInvalidCode(err) {
+			// Блокировка проверяется после разбора токена, чтобы знать логин
+			if allowed, err := h.checkLockout(ctx, account.Login, ip); !allowed {
+				return err
+			}
+			return h.loginFailed(ctx, account.Login, ip)
+		}
+		log.Printf("Failed to complete mfa challenge: %v", err)
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(user.Password))
+	if allowed, err := h.checkLockout(ctx, account.Login, ip); !allowed {
+		return err
+	}
+	return h.loginSucceeded(ctx, account)
+}
+
+// RefreshToken обменивает refresh токен на новую пару. Каждый refresh токен одноразовый.
+func (h *userHandler) RefreshToken(ctx echo.Context) error {
+	var req models.RefreshRequest
+	err := ctx.Bind(&req)
 	if err != nil {
-		return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": apperrors.ErrInvalidLP.Error()})
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidJSON.Error()})
+	}
+	// Браузерный клиент передаёт refresh токен в cookie
+	if req.RefreshToken == "" {
+		if req.RefreshToken = h.cookies.RefreshToken(ctx); req.RefreshToken != "" && !h.cookies.ValidCSRF(ctx) {
+			return ctx.JSON(http.StatusForbidden, map[string]string{"error": apperrors.ErrCSRF.Error()})
+		}
+	}
+	if req.RefreshToken == "" {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidJSON.Error()})
 	}
 
-	// Генерируем JWT токен
-	token, err := h.tokenB.BuildJWTString(user.Login)
+	var token models.RefreshToken
+	err = h.retryer.Retry(func() error {
+		token, err = h.repo.UseRefreshToken(ctx.Request().Context(), tokens.HashToken(req.RefreshToken))
+		return err
+	})
 	if err != nil {
-		log.Printf("Failed to generate token: %v for user: %v", err, user.Login)
+		if errors.Is(err, apperrors.ErrRefreshReused) {
+			log.Printf("Refresh token reuse detected for user: %v, family %v revoked", token.UserID, token.FamilyID)
+			return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		}
+		if errors.Is(err, apperrors.ErrInvalidRefresh) {
+			return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		}
+		log.Printf("Failed to use refresh token: %v", err)
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
 	}
 
-	ctx.Response().Header().Add("Authorization", "Bearer "+token)
+	pair, err := h.issueTokens(ctx, token.UserID, token.FamilyID)
+	if err != nil {
+		log.Printf("Failed to generate token: %v for user: %v", err, token.UserID)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
 
-	return ctx.JSON(http.StatusOK, "login successfully")
+	return ctx.JSON(http.StatusOK, pair)
+}
+
+// Logout отзывает текущий access токен и, если передан, семейство refresh токена
+func (h *userHandler) Logout(ctx echo.Context) error {
+	claims := ctx.Get("user_claims").(*models.UserClaims)
+
+	var req models.RefreshRequest
+	if ctx.Request().ContentLength != 0 {
+		if err := ctx.Bind(&req); err != nil {
+			return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidJSON.Error()})
+		}
+	}
+
+	err := h.retryer.Retry(func() error {
+		return h.revoker.Revoke(ctx.Request().Context(), claims)
+	})
+	if err != nil {
+		log.Printf("Failed to revoke token: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	// Завершение сессии отзывает и её refresh токены
+	if claims.SessionID != "" {
+		err = h.retryer.Retry(func() error {
+			return h.revoker.RevokeSession(ctx.Request().Context(), claims.UserID, claims.SessionID)
+		})
+		if err != nil && !errors.Is(err, apperrors.ErrSessionNotFound) {
+			log.Printf("Failed to revoke session: %v", err)
+			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+		}
+	}
+
+	if req.RefreshToken != "" {
+		err = h.retryer.Retry(func() error {
+			return h.repo.RevokeRefreshFamily(ctx.Request().Context(), tokens.HashToken(req.RefreshToken), claims.UserID)
+		})
+		if err != nil {
+			log.Printf("Failed to revoke refresh token: %v", err)
+			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+		}
+	}
+
+	h.cookies.Clear(ctx)
+	return ctx.JSON(http.StatusOK, "logout successfully")
+}
+
+// LogoutAll отзывает все токены пользователя на всех устройствах
+func (h *userHandler) LogoutAll(ctx echo.Context) error {
+	userID := ctx.Get("user_id").(int64)
+
+	err := h.retryer.Retry(func() error {
+		return h.revoker.RevokeAll(ctx.Request().Context(), userID)
+	})
+	if err != nil {
+		log.Printf("Failed to revoke all tokens: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	h.cookies.Clear(ctx)
+	return ctx.JSON(http.StatusOK, "logout from all sessions successfully")
+}
+
+// ChangePassword меняет пароль и отзывает все выпущенные ранее токены.
+// Вызывающему выдаётся новая пара токенов.
+func (h *userHandler) ChangePassword(ctx echo.Context) error {
+	var req models.PasswordChange
+	err := ctx.Bind(&req)
+	if err != nil || req.NewPassword == "" {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidJSON.Error()})
+	}
+
+	userID := ctx.Get("user_id").(int64)
+	userLogin := ctx.Get("user_login").(string)
+
+	var hashedPassword string
+	err = h.retryer.Retry(func() error {
+		hashedPassword, err = h.repo.SelectPassword(ctx.Request().Context(), userID)
+		return err
+	})
+	if err != nil {
+		// У пользователя, вошедшего через OIDC, пароля нет
+		if errors.Is(err, apperrors.ErrInvalidLP) {
+			return ctx.JSON(http.StatusForbidden, map[string]string{"error": apperrors.ErrWrongPass.Error()})
+		}
+		log.Printf("Failed to get user: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	match, err := h.hasher.Compare(hashedPassword, req.OldPassword)
+	if err != nil {
+		log.Printf("Failed to compare password hash: %v for user: %v", err, userLogin)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+	if !match {
+		return ctx.JSON(http.StatusForbidden, map[string]string{"error": apperrors.ErrWrongPass.Error()})
+	}
+
+	if violations := h.validator.ValidatePassword(userLogin, req.NewPassword); len(violations) > 0 {
+		return ctx.JSON(http.StatusBadRequest, models.ValidationErrorResponse{Error: apperrors.ErrValidation.Error(), Violations: violations})
+	}
+
+	hash, err := h.hasher.Hash(req.NewPassword)
+	if err != nil {
+		log.Printf("Hash password failed: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	// Точность iat - секунда: токен, выданный ниже, не должен попасть под отзыв
+	changedAt := time.Now().Truncate(time.Second)
+	err = h.retryer.Retry(func() error {
+		return h.repo.UpdatePassword(ctx.Request().Context(), userID, hash, changedAt)
+	})
+	if err != nil {
+		log.Printf("Failed to update password: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+	h.revoker.Invalidate(userID, changedAt)
+
+	pair, err := h.issueTokens(ctx, userID, "")
+	if err != nil {
+		log.Printf("Failed to generate token: %v for user: %v", err, userLogin)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	return ctx.JSON(http.StatusOK, pair)
+}
+
+// ChangeLogin переименовывает пользователя. Данные и токены привязаны к ID и продолжают действовать,
+// новый логин попадает в токены при следующем refresh.
+func (h *userHandler) ChangeLogin(ctx echo.Context) error {
+	var req models.LoginChange
+	err := ctx.Bind(&req)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidJSON.Error()})
+	}
+
+	if violations := h.validator.ValidateLogin(req.Login); len(violations) > 0 {
+		return ctx.JSON(http.StatusBadRequest, models.ValidationErrorResponse{Error: apperrors.ErrValidation.Error(), Violations: violations})
+	}
+
+	userID := ctx.Get("user_id").(int64)
+	err = h.retryer.Retry(func() error {
+		return h.repo.UpdateLogin(ctx.Request().Context(), userID, req.Login)
+	})
+	if err != nil {
+		if errors.Is(err, apperrors.ErrLoginTaken) {
+			return ctx.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		log.Printf("Failed to update login: %v for user: %v", err, userID)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	log.Printf("User %v renamed from %v to %v", userID, ctx.Get("user_login"), req.Login)
+	return ctx.JSON(http.StatusOK, "login changed")
 }
 
 func (h *userHandler) AddOrder(ctx echo.Context) error {
@@ -127,10 +405,9 @@ func (h *userHandler) AddOrder(ctx echo.Context) error {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidJSON.Error()})
 	}
 
-	login := ctx.Get("user_login").(string)
 	order := models.Order{
 		Number:     number,
-		Login:      login,
+		UserID:     ctx.Get("user_id").(int64),
 		Status:     "NEW",
 		UploadedAt: time.Now(),
 	}
@@ -156,14 +433,21 @@ func (h *userHandler) AddOrder(ctx echo.Context) error {
 	return ctx.JSON(http.StatusAccepted, "order accepted")
 }
 
-// GetOrders TODO: Пагинация
+// GetOrders - заказы пользователя постранично. Параметры: limit, cursor, status, from, to, sort=asc|desc.
+// Курсор следующей страницы возвращается в заголовке X-Next-Cursor.
 func (h *userHandler) GetOrders(ctx echo.Context) error {
-	userLogin := ctx.Get("user_login").(string)
+	filter, violations := parseOrderFilter(ctx)
+	if len(violations) > 0 {
+		return ctx.JSON(http.StatusBadRequest, models.ValidationErrorResponse{Error: apperrors.ErrValidation.Error(), Violations: violations})
+	}
+
+	userID := ctx.Get("user_id").(int64)
 	var orders []models.OrderResponse
+	var next *models.Cursor
 
 	err := h.retryer.Retry(func() error {
 		var err error
-		orders, err = h.repo.SelectOrders(ctx.Request().Context(), userLogin)
+		orders, next, err = h.repo.SelectOrdersPage(ctx.Request().Context(), userID, filter)
 		return err
 	})
 	if err != nil {
@@ -172,19 +456,42 @@ func (h *userHandler) GetOrders(ctx echo.Context) error {
 	}
 
 	if len(orders) < 1 {
-		return ctx.JSON(http.StatusNoContent, map[string]string{"error": apperrors.ErrNoData.Error()})
+		return ctx.NoContent(http.StatusNoContent)
 	}
 
+	setNextCursor(ctx, next)
 	return ctx.JSON(http.StatusOK, orders)
 
 }
 
+// GetOrder - заказ с историей статусов. Чужой заказ неотличим от несуществующего.
+func (h *userHandler) GetOrder(ctx echo.Context) error {
+	userID := ctx.Get("user_id").(int64)
+	number := ctx.Param("number")
+	var order models.OrderDetail
+
+	err := h.retryer.Retry(func() error {
+		var err error
+		order, err = h.repo.SelectOrder(ctx.Request().Context(), userID, number)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, apperrors.ErrOrderNotFound) {
+			return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		log.Printf("Failed to get order: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	return ctx.JSON(http.StatusOK, order)
+}
+
 func (h *userHandler) GetBalance(ctx echo.Context) error {
-	userLogin := ctx.Get("user_login").(string)
+	userID := ctx.Get("user_id").(int64)
 	var balance models.Balance
 	err := h.retryer.Retry(func() error {
 		var err error
-		balance, err = h.repo.SelectBalance(ctx.Request().Context(), userLogin)
+		balance, err = h.repo.SelectBalance(ctx.Request().Context(), userID)
 		return err
 	})
 	if err != nil {
@@ -205,7 +512,31 @@ func (h *userHandler) Withdraw(ctx echo.Context) error {
 		return ctx.JSON(http.StatusUnprocessableEntity, map[string]string{"error": apperrors.ErrInvalidOrder.Error()})
 	}
 
-	withdrawal.Login = ctx.Get("user_login").(string)
+	withdrawal.UserID = ctx.Get("user_id").(int64)
+
+	// Крупные списания подтверждаются свежим TOTP кодом, коды восстановления не принимаются
+	var totpRequired bool
+	err = h.retryer.Retry(func() error {
+		totpRequired, err = h.mfa.RequiredForWithdraw(ctx.Request().Context(), withdrawal.UserID, withdrawal.Sum)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to check two-factor authentication: %v for user: %v", err, withdrawal.UserID)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+	if totpRequired {
+		code := ctx.Request().Header.Get("X-TOTP-Code")
+		if code == "" {
+			return ctx.JSON(http.StatusForbidden, map[string]string{"error": apperrors.ErrTOTPRequired.Error()})
+		}
+		ok, err := verifyTOTP(ctx, h.limiter, h.retryer, withdrawal.UserID, func() error {
+			return h.mfa.Verify(ctx.Request().Context(), withdrawal.UserID, code, false)
+		})
+		if !ok {
+			return err
+		}
+	}
+
 	withdrawal.ProcessedAt = time.Now()
 
 	err = h.retryer.Retry(func() error {
@@ -221,25 +552,242 @@ func (h *userHandler) Withdraw(ctx echo.Context) error {
 	return ctx.JSON(http.StatusOK, "withdraw successfully")
 }
 
-// GetWithdrawals TODO: Пагинация
+// GetWithdrawals - списания пользователя постранично. Параметры: limit, cursor, from, to, min_sum, sort=asc|desc.
+// Количество и сумма списаний под фильтром по всем страницам - в X-Total-Count и X-Total-Sum.
 func (h *userHandler) GetWithdrawals(ctx echo.Context) error {
-	userLogin := ctx.Get("user_login").(string)
+	filter, violations := parseWithdrawalFilter(ctx)
+	if len(violations) > 0 {
+		return ctx.JSON(http.StatusBadRequest, models.ValidationErrorResponse{Error: apperrors.ErrValidation.Error(), Violations: violations})
+	}
+
+	userID := ctx.Get("user_id").(int64)
 	var withdrawals []models.WithdrawalResponse
+	var next *models.Cursor
+	var totals models.WithdrawalTotals
 
 	err := h.retryer.Retry(func() error {
 		var err error
-		withdrawals, err = h.repo.SelectWithdrawals(ctx.Request().Context(), userLogin)
+		withdrawals, next, err = h.repo.SelectWithdrawalsPage(ctx.Request().Context(), userID, filter)
+		if err != nil || len(withdrawals) < 1 {
+			return err
+		}
+		totals, err = h.repo.SelectWithdrawalTotals(ctx.Request().Context(), userID, filter)
 		return err
 	})
 	if err != nil {
-		log.Printf("Failed to get orders: %v", err)
+		log.Printf("Failed to get withdrawals: %v", err)
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
 	}
 
 	if len(withdrawals) < 1 {
-		return ctx.JSON(http.StatusNoContent, map[string]string{"error": apperrors.ErrNoData.Error()})
+		return ctx.NoContent(http.StatusNoContent)
 	}
 
+	setNextCursor(ctx, next)
+	ctx.Response().Header().Set(totalCountHeader, strconv.FormatInt(totals.Count, 10))
+	ctx.Response().Header().Set(totalSumHeader, strconv.FormatFloat(totals.Sum, 'f', -1, 64))
 	return ctx.JSON(http.StatusOK, withdrawals)
 
 }
+
+// internal
+
+// checkLockout отвечает 429, если вход заблокирован. При allowed == false ответ уже записан.
+func (h *userHandler) checkLockout(ctx echo.Context, login string, ip string) (allowed bool, err error) {
+	var retryAfter time.Duration
+	err = h.retryer.Retry(func() error {
+		retryAfter, err = h.limiter.Check(ctx.Request().Context(), login, ip)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to check login lockout: %v", err)
+		return false, ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+	if retryAfter > 0 {
+		ctx.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		return false, ctx.JSON(http.StatusTooManyRequests, map[string]string{"error": apperrors.ErrTooManyLogin.Error()})
+	}
+	return true, nil
+}
+
+// completeLogin выдаёт токены после проверки первого фактора или запрашивает второй
+func (h *userHandler) completeLogin(ctx echo.Context, account models.Account) error {
+	var mfaEnabled bool
+	err := h.retryer.Retry(func() error {
+		var err error
+		mfaEnabled, err = h.mfa.Enabled(ctx.Request().Context(), account.ID)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to check two-factor authentication: %v for user: %v", err, account.Login)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	// Со вторым фактором токены выдаёт LoginMFA, счётчик неудач не сбрасываем до его завершения
+	if mfaEnabled {
+		var mfaToken string
+		err = h.retryer.Retry(func() error {
+			mfaToken, err = h.mfa.NewChallenge(ctx.Request().Context(), account.ID)
+			return err
+		})
+		if err != nil {
+			log.Printf("Failed to create mfa challenge: %v for user: %v", err, account.Login)
+			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+		}
+		return ctx.JSON(http.StatusOK, models.MFAChallenge{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+			ExpiresIn:   int64(h.mfa.ChallengeTTL().Seconds()),
+		})
+	}
+
+	return h.loginSucceeded(ctx, account)
+}
+
+// loginSucceeded сбрасывает счётчик неудач и выдаёт токены
+func (h *userHandler) loginSucceeded(ctx echo.Context, account models.Account) error {
+	// Сбрасываем только счётчик логина: IP может быть общим с атакующим
+	err := h.retryer.Retry(func() error {
+		return h.limiter.Reset(ctx.Request().Context(), account.Login, "")
+	})
+	if err != nil {
+		log.Printf("Failed to reset login attempts: %v for user: %v", err, account.Login)
+	}
+
+	// Генерируем пару токенов
+	pair, err := h.issueTokens(ctx, account.ID, "")
+	if err != nil {
+		log.Printf("Failed to generate token: %v for user: %v", err, account.Login)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	return ctx.JSON(http.StatusOK, pair)
+}
+
+// registrableLogin - логин проходит ограничения длины и набора символов.
+// Зарезервированный префикс не мешает: с ним заведены федеративные пользователи.
+func registrableLogin(validator validation.Validator, login string) bool {
+	for _, violation := range validator.ValidateLogin(login) {
+		switch violation.Rule {
+		case "min_length", "max_length", "charset":
+			return false
+		}
+	}
+	return true
+}
+
+// loginFailed учитывает неудачную попытку входа
+func (h *userHandler) loginFailed(ctx echo.Context, login string, ip string) error {
+	err := h.retryer.Retry(func() error {
+		return h.limiter.Fail(ctx.Request().Context(), login, ip)
+	})
+	if err != nil {
+		log.Printf("Failed to record login failure: %v for user: %v", err, login)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+	return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": apperrors.ErrInvalidLP.Error()})
+}
+
+// rehashPassword сохраняет хеш по текущей политике. Ошибка не мешает входу:
+// хеш будет пересчитан при следующем логине.
+func (h *userHandler) rehashPassword(ctx echo.Context, userID int64, oldHash string, password string) {
+	newHash, err := h.hasher.Hash(password)
+	if err != nil {
+		log.Printf("Failed to rehash password: %v for user: %v", err, userID)
+		return
+	}
+	err = h.retryer.Retry(func() error {
+		return h.repo.UpdatePasswordHash(ctx.Request().Context(), userID, oldHash, newHash)
+	})
+	if err != nil {
+		log.Printf("Failed to save rehashed password: %v for user: %v", err, userID)
+	}
+}
+
+// issueTokens выпускает access и refresh токены и сохраняет refresh токен.
+// Пустой familyID начинает новое семейство refresh токенов и новую сессию с тем же ID.
+// Логин и роль читаются из БД, поэтому их смена применяется при следующем refresh.
+func (h *userHandler) issueTokens(ctx echo.Context, userID int64, familyID string) (models.TokenPair, error) {
+	var pair models.TokenPair
+
+	var account models.Account
+	err := h.retryer.Retry(func() error {
+		var err error
+		account, err = h.repo.SelectAccount(ctx.Request().Context(), userID)
+		return err
+	})
+	if err != nil {
+		return pair, err
+	}
+
+	if familyID == "" {
+		familyID, err = tokens.NewID()
+		if err != nil {
+			return pair, err
+		}
+	}
+
+	// Для существующей сессии обновляется только время и IP последнего обращения
+	now := time.Now()
+	session := models.Session{
+		ID:         familyID,
+		UserID:     userID,
+		UserAgent:  truncate(ctx.Request().UserAgent(), maxUserAgentLength),
+		IP:         ctx.RealIP(),
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+	err = h.retryer.Retry(func() error {
+		return h.repo.SaveSession(ctx.Request().Context(), session)
+	})
+	if err != nil {
+		return pair, err
+	}
+
+	accessToken, err := h.tokenB.BuildJWTString(models.TokenSubject{UserID: userID, Login: account.Login, Role: account.Role, SessionID: familyID})
+	if err != nil {
+		return pair, err
+	}
+
+	refreshToken, expiresAt, err := h.tokenB.BuildRefreshToken()
+	if err != nil {
+		return pair, err
+	}
+
+	err = h.retryer.Retry(func() error {
+		return h.repo.InsertRefreshToken(ctx.Request().Context(), models.RefreshToken{
+			Hash:      tokens.HashToken(refreshToken),
+			UserID:    userID,
+			FamilyID:  familyID,
+			ExpiresAt: expiresAt,
+		})
+	})
+	if err != nil {
+		return pair, err
+	}
+
+	accessExp := h.tokenB.AccessTokenExp()
+	ctx.Response().Header().Add("Authorization", "Bearer "+accessToken)
+	if err = h.cookies.SetTokens(ctx, accessToken, accessExp, refreshToken, expiresAt); err != nil {
+		return pair, err
+	}
+
+	pair = models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(accessExp.Seconds()),
+	}
+	return pair, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	// Не разрезаем многобайтовый символ
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -2,19 +2,28 @@ package handler_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/golang/mock/gomock"
 	"github.com/labstack/echo/v4"
 	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/cookieauth"
 	"github.com/llaxzi/gophermart/internal/handler"
 	"github.com/llaxzi/gophermart/internal/mocks"
 	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/gophermart/internal/passwords"
+	"github.com/llaxzi/gophermart/internal/tokens"
+	"github.com/llaxzi/gophermart/internal/validation"
 	"github.com/llaxzi/retryables/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/bcrypt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -28,7 +37,7 @@ func TestUserRegister(t *testing.T) {
 	retryer := retryables.NewRetryer(nil)
 	retryer.SetCount(1)
 
-	h := handler.NewUserHandler(repo, tokenBuilder, retryer)
+	h := handler.NewUserHandler(repo, tokenBuilder, retryer, nil, nil, validation.NewValidator(validation.DefaultConfig()), newHasher(t), nil, cookieauth.NewManager(cookieauth.Config{}), nil)
 
 	tests := []struct {
 		name           string
@@ -42,7 +51,7 @@ func TestUserRegister(t *testing.T) {
 			name: "Successful registration",
 			inputUser: models.User{
 				Login:    "testuser",
-				Password: "password123",
+				Password: "correct-horse-battery",
 			},
 			repoError:      nil,
 			expectRepoCall: true,
@@ -53,7 +62,7 @@ func TestUserRegister(t *testing.T) {
 			name: "Conflict - username already taken",
 			inputUser: models.User{
 				Login:    "existing_user",
-				Password: "password123",
+				Password: "correct-horse-battery",
 			},
 			repoError:      apperrors.ErrLoginTaken,
 			expectRepoCall: true,
@@ -68,16 +77,243 @@ func TestUserRegister(t *testing.T) {
 			expectJWTCall:  false,
 			expectedStatus: http.StatusBadRequest,
 		},
+		{
+			name: "Weak password and invalid login",
+			inputUser: models.User{
+				Login:    "a b",
+				Password: "qwerty",
+			},
+			repoError:      nil,
+			expectRepoCall: false,
+			expectJWTCall:  false,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Login too long",
+			inputUser: models.User{
+				Login:    strings.Repeat("a", 51),
+				Password: "correct-horse-battery",
+			},
+			repoError:      nil,
+			expectRepoCall: false,
+			expectJWTCall:  false,
+			expectedStatus: http.StatusBadRequest,
+		},
 		{
 			name: "Internal server error",
 			inputUser: models.User{
 				Login:    "server_error_user",
-				Password: "password123",
+				Password: "correct-horse-battery",
+			},
+			repoError:      apperrors.ErrServer,
+			expectRepoCall: true,
+			expectJWTCall:  false,
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+
+			var userJSON []byte
+			if test.name == "Invalid JSON" {
+				userJSON = []byte("{invalid-json}")
+			} else {
+				userJSON, _ = json.Marshal(test.inputUser)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(userJSON))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+
+			if test.expectRepoCall {
+				repo.EXPECT().
+					InsertUser(gomock.Any(), gomock.Any()).
+					Return(testUser.ID, test.repoError).
+					Times(1)
+			}
+
+			if test.expectJWTCall {
+				expectTokenPair(tokenBuilder, repo, testUser)
+			}
+
+			err := h.Register(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code, "Expected status %d but got %d", test.expectedStatus, rec.Code)
+
+			if test.name == "Weak password and invalid login" {
+				var resp models.ValidationErrorResponse
+				err = json.Unmarshal(rec.Body.Bytes(), &resp)
+				require.NoError(t, err)
+				var rules []string
+				for _, v := range resp.Violations {
+					rules = append(rules, v.Field+":"+v.Rule)
+				}
+				assert.ElementsMatch(t, []string{"login:charset", "password:min_length", "password:common"}, rules)
+			}
+		})
+	}
+}
+
+func TestUserLogin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	tokenBuilder := mocks.NewMockTokenBuilder(ctrl)
+	limiter := mocks.NewMockLimiter(ctrl)
+	mfaAuth := mocks.NewMockAuthenticator(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewUserHandler(repo, tokenBuilder, retryer, nil, limiter, validation.NewValidator(validation.DefaultConfig()), newHasher(t), mfaAuth, cookieauth.NewManager(cookieauth.Config{}), nil)
+
+	password := "password123"
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	outdatedHash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+
+	tests := []struct {
+		name           string
+		inputUser      models.User
+		repoError      error
+		tokenError     error
+		expectRepoCall bool
+		expectJWTCall  bool
+		expectedStatus int
+		returnedHash   string
+		lockedFor      time.Duration
+		expectFail     bool
+		failIPOnly     bool
+		expectRehash   bool
+		mfaEnabled     bool
+	}{
+		{
+			name: "Successful login",
+			inputUser: models.User{
+				Login:    "testuser",
+				Password: password,
+			},
+			repoError:      nil,
+			tokenError:     nil,
+			expectRepoCall: true,
+			expectJWTCall:  true,
+			expectedStatus: http.StatusOK,
+			returnedHash:   string(hashedPassword),
+		},
+		{
+			name: "Two-factor authentication enabled",
+			inputUser: models.User{
+				Login:    "testuser",
+				Password: password,
+			},
+			expectRepoCall: true,
+			expectedStatus: http.StatusOK,
+			returnedHash:   string(hashedPassword),
+			mfaEnabled:     true,
+		},
+		{
+			name: "Outdated hash is upgraded",
+			inputUser: models.User{
+				Login:    "testuser",
+				Password: password,
+			},
+			expectRepoCall: true,
+			expectJWTCall:  true,
+			expectedStatus: http.StatusOK,
+			returnedHash:   string(outdatedHash),
+			expectRehash:   true,
+		},
+		{
+			name: "Invalid JSON",
+			inputUser: models.User{
+				Login:    "",
+				Password: "",
+			},
+			repoError:      nil,
+			tokenError:     nil,
+			expectRepoCall: false,
+			expectJWTCall:  false,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "User not found",
+			inputUser: models.User{
+				Login:    "unknown_user",
+				Password: password,
+			},
+			repoError:      apperrors.ErrInvalidLP,
+			tokenError:     nil,
+			expectRepoCall: true,
+			expectJWTCall:  false,
+			expectedStatus: http.StatusUnauthorized,
+			returnedHash:   "",
+			expectFail:     true,
+		},
+		{
+			name: "Unregistrable login counts only IP",
+			inputUser: models.User{
+				Login:    "no such user!",
+				Password: password,
+			},
+			repoError:      apperrors.ErrInvalidLP,
+			expectRepoCall: true,
+			expectedStatus: http.StatusUnauthorized,
+			expectFail:     true,
+			failIPOnly:     true,
+		},
+		{
+			name: "Incorrect password",
+			inputUser: models.User{
+				Login:    "testuser",
+				Password: "wrongpassword",
+			},
+			repoError:      nil,
+			tokenError:     nil,
+			expectRepoCall: true,
+			expectJWTCall:  false,
+			expectedStatus: http.StatusUnauthorized,
+			returnedHash:   string(hashedPassword),
+			expectFail:     true,
+		},
+		{
+			name: "Locked out",
+			inputUser: models.User{
+				Login:    "testuser",
+				Password: password,
+			},
+			expectRepoCall: false,
+			expectJWTCall:  false,
+			expectedStatus: http.StatusTooManyRequests,
+			lockedFor:      time.Second * 90,
+		},
+		{
+			name: "Server error when retrieving password",
+			inputUser: models.User{
+				Login:    "server_error_user",
+				Password: password,
 			},
 			repoError:      apperrors.ErrServer,
+			tokenError:     nil,
 			expectRepoCall: true,
 			expectJWTCall:  false,
 			expectedStatus: http.StatusInternalServerError,
+			returnedHash:   "",
+		},
+		{
+			name: "Error generating JWT token",
+			inputUser: models.User{
+				Login:    "testuser",
+				Password: password,
+			},
+			repoError:      nil,
+			tokenError:     apperrors.ErrServer,
+			expectRepoCall: true,
+			expectJWTCall:  true,
+			expectedStatus: http.StatusInternalServerError,
+			returnedHash:   string(hashedPassword),
 		},
 	}
 
@@ -92,26 +328,563 @@ func TestUserRegister(t *testing.T) {
 				userJSON, _ = json.Marshal(test.inputUser)
 			}
 
-			req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(userJSON))
+			req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(userJSON))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+
+			if test.name != "Invalid JSON" {
+				limiter.EXPECT().
+					Check(gomock.Any(), test.inputUser.Login, "192.0.2.1").
+					Return(test.lockedFor, nil).
+					Times(1)
+			}
+			if test.expectFail {
+				failLogin := test.inputUser.Login
+				if test.failIPOnly {
+					failLogin = ""
+				}
+				limiter.EXPECT().Fail(gomock.Any(), failLogin, "192.0.2.1").Return(nil).Times(1)
+			}
+			if test.expectJWTCall {
+				limiter.EXPECT().Reset(gomock.Any(), test.inputUser.Login, "").Return(nil).Times(1)
+			}
+			if test.expectJWTCall || test.mfaEnabled {
+				mfaAuth.EXPECT().Enabled(gomock.Any(), testUser.ID).Return(test.mfaEnabled, nil).Times(1)
+			}
+			if test.mfaEnabled {
+				mfaAuth.EXPECT().NewChallenge(gomock.Any(), testUser.ID).Return("mfa_token", nil).Times(1)
+				mfaAuth.EXPECT().ChallengeTTL().Return(time.Minute * 5).Times(1)
+			}
+
+			if test.expectRepoCall {
+				repo.EXPECT().
+					SelectUser(gomock.Any(), test.inputUser.Login).
+					Return(testUser.ID, test.returnedHash, test.repoError).
+					Times(1)
+			}
+			if test.expectRehash {
+				repo.EXPECT().
+					UpdatePasswordHash(gomock.Any(), testUser.ID, test.returnedHash, gomock.Any()).
+					DoAndReturn(func(_ context.Context, _ int64, _ string, newHash string) error {
+						cost, err := bcrypt.Cost([]byte(newHash))
+						assert.NoError(t, err)
+						assert.Equal(t, bcrypt.DefaultCost, cost)
+						return nil
+					}).
+					Times(1)
+			}
+
+			account := models.Account{ID: testUser.ID, Login: test.inputUser.Login, Role: models.RoleUser}
+			if test.expectJWTCall && test.tokenError == nil {
+				expectTokenPair(tokenBuilder, repo, account)
+			} else if test.expectJWTCall {
+				repo.EXPECT().SelectAccount(gomock.Any(), account.ID).Return(account, nil).Times(1)
+				repo.EXPECT().SaveSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+				tokenBuilder.EXPECT().
+					BuildJWTString(subjectMatcher{account.ID, account.Login, models.RoleUser, ""}).
+					Return("", test.tokenError).
+					Times(1)
+			}
+
+			err := h.Login(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code, "Expected status %d but got %d", test.expectedStatus, rec.Code)
+			if test.lockedFor > 0 {
+				assert.Equal(t, "90", rec.Header().Get("Retry-After"))
+			}
+			if test.mfaEnabled {
+				// Токены выдаются только после второго шага
+				assert.Empty(t, rec.Header().Get("Authorization"))
+				var challenge models.MFAChallenge
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &challenge))
+				assert.Equal(t, models.MFAChallenge{MFARequired: true, MFAToken: "mfa_token", ExpiresIn: 300}, challenge)
+			}
+		})
+	}
+}
+
+func TestLoginMFA(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	tokenBuilder := mocks.NewMockTokenBuilder(ctrl)
+	limiter := mocks.NewMockLimiter(ctrl)
+	mfaAuth := mocks.NewMockAuthenticator(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewUserHandler(repo, tokenBuilder, retryer, nil, limiter, nil, nil, mfaAuth, cookieauth.NewManager(cookieauth.Config{}), nil)
+
+	tests := []struct {
+		name            string
+		body            string
+		expectChallenge bool
+		challengeError  error
+		lockedFor       time.Duration
+		expectFail      bool
+		expectedStatus  int
+	}{
+		{
+			name:            "Successful second step",
+			body:            `{"mfa_token":"mfa_token","code":"123456"}`,
+			expectChallenge: true,
+			expectedStatus:  http.StatusOK,
+		},
+		{
+			name:           "Missing code",
+			body:           `{"mfa_token":"mfa_token"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:            "Invalid or expired mfa token",
+			body:            `{"mfa_token":"expired","code":"123456"}`,
+			expectChallenge: true,
+			challengeError:  apperrors.ErrInvalidMFAToken,
+			expectedStatus:  http.StatusUnauthorized,
+		},
+		{
+			name:            "Wrong code",
+			body:            `{"mfa_token":"mfa_token","code":"000000"}`,
+			expectChallenge: true,
+			challengeError:  apperrors.ErrInvalidTOTP,
+			expectFail:      true,
+			expectedStatus:  http.StatusUnauthorized,
+		},
+		{
+			name:            "Locked out",
+			body:            `{"mfa_token":"mfa_token","code":"000000"}`,
+			expectChallenge: true,
+			challengeError:  apperrors.ErrInvalidTOTP,
+			lockedFor:       time.Minute,
+			expectedStatus:  http.StatusTooManyRequests,
+		},
+		{
+			name:            "Server error",
+			body:            `{"mfa_token":"mfa_token","code":"123456"}`,
+			expectChallenge: true,
+			challengeError:  apperrors.ErrPgConnExc,
+			expectedStatus:  http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/api/user/login/2fa", strings.NewReader(test.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+
+			if test.expectChallenge {
+				var body models.MFALogin
+				require.NoError(t, json.Unmarshal([]byte(test.body), &body))
+				account := testUser
+				if errors.Is(test.challengeError, apperrors.ErrInvalidMFAToken) {
+					account = models.Account{}
+				}
+				mfaAuth.EXPECT().
+					CompleteChallenge(gomock.Any(), body.MFAToken, body.Code).
+					Return(account, test.challengeError).
+					Times(1)
+			}
+			if test.challengeError == nil || errors.Is(test.challengeError, apperrors.ErrInvalidTOTP) {
+				if test.expectChallenge {
+					limiter.EXPECT().Check(gomock.Any(), "testuser", "192.0.2.1").Return(test.lockedFor, nil).Times(1)
+				}
+			}
+			if test.expectFail {
+				limiter.EXPECT().Fail(gomock.Any(), "testuser", "192.0.2.1").Return(nil).Times(1)
+			}
+			if test.expectedStatus == http.StatusOK {
+				limiter.EXPECT().Reset(gomock.Any(), "testuser", "").Return(nil).Times(1)
+				expectTokenPair(tokenBuilder, repo, testUser)
+			}
+
+			err := h.LoginMFA(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+			if test.expectedStatus == http.StatusOK {
+				assert.Equal(t, "Bearer mock_token", rec.Header().Get("Authorization"))
+			}
+		})
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	tokenBuilder := mocks.NewMockTokenBuilder(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewUserHandler(repo, tokenBuilder, retryer, nil, nil, nil, nil, nil, cookieauth.NewManager(cookieauth.Config{}), nil)
+
+	stored := models.RefreshToken{UserID: testUser.ID, FamilyID: "family"}
+
+	tests := []struct {
+		name           string
+		body           string
+		repoError      error
+		expectRepoCall bool
+		expectedStatus int
+	}{
+		{
+			name:           "Successful refresh",
+			body:           `{"refresh_token":"old_refresh"}`,
+			expectRepoCall: true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Empty refresh token",
+			body:           `{}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Unknown or expired refresh token",
+			body:           `{"refresh_token":"unknown"}`,
+			repoError:      apperrors.ErrInvalidRefresh,
+			expectRepoCall: true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Reused refresh token",
+			body:           `{"refresh_token":"old_refresh"}`,
+			repoError:      apperrors.ErrRefreshReused,
+			expectRepoCall: true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Database error",
+			body:           `{"refresh_token":"old_refresh"}`,
+			repoError:      apperrors.ErrServer,
+			expectRepoCall: true,
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/token/refresh", bytes.NewReader([]byte(test.body)))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+
+			if test.expectRepoCall {
+				var body models.RefreshRequest
+				require.NoError(t, json.Unmarshal([]byte(test.body), &body))
+				repo.EXPECT().
+					UseRefreshToken(gomock.Any(), tokens.HashToken(body.RefreshToken)).
+					Return(stored, test.repoError).
+					Times(1)
+			}
+			if test.expectedStatus == http.StatusOK {
+				// Логин и роль перечитываются при каждом обновлении токенов
+				repo.EXPECT().
+					SelectAccount(gomock.Any(), stored.UserID).
+					Return(models.Account{ID: stored.UserID, Login: "renamed", Role: models.RoleSupport}, nil).
+					Times(1)
+				repo.EXPECT().
+					SaveSession(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, session models.Session) error {
+						// Сессия продолжается, обновляется время последнего обращения
+						assert.Equal(t, stored.FamilyID, session.ID)
+						return nil
+					}).
+					Times(1)
+				tokenBuilder.EXPECT().
+					BuildJWTString(subjectMatcher{stored.UserID, "renamed", models.RoleSupport, stored.FamilyID}).
+					Return("access", nil).
+					Times(1)
+				tokenBuilder.EXPECT().BuildRefreshToken().Return("new_refresh", time.Now().Add(time.Hour), nil).Times(1)
+				tokenBuilder.EXPECT().AccessTokenExp().Return(time.Minute).Times(1)
+				repo.EXPECT().
+					InsertRefreshToken(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, token models.RefreshToken) error {
+						// Новый токен остаётся в том же семействе
+						assert.Equal(t, stored.FamilyID, token.FamilyID)
+						assert.Equal(t, tokens.HashToken("new_refresh"), token.Hash)
+						return nil
+					}).
+					Times(1)
+			}
+
+			err := h.RefreshToken(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code, "Expected status %d but got %d", test.expectedStatus, rec.Code)
+
+			if test.expectedStatus == http.StatusOK {
+				var pair models.TokenPair
+				err = json.Unmarshal(rec.Body.Bytes(), &pair)
+				require.NoError(t, err)
+				assert.Equal(t, "access", pair.AccessToken)
+				assert.Equal(t, "new_refresh", pair.RefreshToken)
+				assert.Equal(t, "Bearer access", rec.Header().Get("Authorization"))
+			}
+		})
+	}
+}
+
+func TestRefreshTokenCookie(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewUserHandler(repo, nil, retryer, nil, nil, nil, nil, nil, cookieauth.NewManager(cookieauth.Config{Enabled: true}), nil)
+
+	tests := []struct {
+		name           string
+		csrfHeader     string
+		expectRepoCall bool
+		expectedStatus int
+	}{
+		{
+			name:           "Refresh token from cookie",
+			csrfHeader:     "csrf",
+			expectRepoCall: true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Missing CSRF token",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/api/user/token/refresh", nil)
+			req.AddCookie(&http.Cookie{Name: cookieauth.RefreshCookie, Value: "cookie_refresh"})
+			req.AddCookie(&http.Cookie{Name: cookieauth.CSRFCookie, Value: "csrf"})
+			if test.csrfHeader != "" {
+				req.Header.Set(cookieauth.CSRFHeader, test.csrfHeader)
+			}
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+
+			if test.expectRepoCall {
+				repo.EXPECT().
+					UseRefreshToken(gomock.Any(), tokens.HashToken("cookie_refresh")).
+					Return(models.RefreshToken{}, apperrors.ErrInvalidRefresh).
+					Times(1)
+			}
+
+			err := h.RefreshToken(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	revoker := mocks.NewMockChecker(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewUserHandler(repo, nil, retryer, revoker, nil, nil, nil, nil, cookieauth.NewManager(cookieauth.Config{}), nil)
+
+	tests := []struct {
+		name              string
+		body              string
+		sessionID         string
+		revokeError       error
+		expectRefreshCall bool
+		expectedStatus    int
+	}{
+		{
+			name:           "Logout access token only",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:              "Logout with refresh token",
+			body:              `{"refresh_token":"refresh"}`,
+			expectRefreshCall: true,
+			expectedStatus:    http.StatusOK,
+		},
+		{
+			name:           "Logout ends session",
+			sessionID:      "session",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Database error",
+			revokeError:    apperrors.ErrServer,
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/logout", bytes.NewReader([]byte(test.body)))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+
+			claims := &models.UserClaims{UserID: testUser.ID, UserLogin: testUser.Login, SessionID: test.sessionID}
+			claims.ID = "jti"
+			ctx.Set("user_id", testUser.ID)
+			ctx.Set("user_login", testUser.Login)
+			ctx.Set("user_claims", claims)
+
+			revoker.EXPECT().Revoke(gomock.Any(), claims).Return(test.revokeError).Times(1)
+			if test.sessionID != "" {
+				revoker.EXPECT().RevokeSession(gomock.Any(), testUser.ID, test.sessionID).Return(nil).Times(1)
+			}
+			if test.expectRefreshCall {
+				repo.EXPECT().
+					RevokeRefreshFamily(gomock.Any(), tokens.HashToken("refresh"), testUser.ID).
+					Return(nil).
+					Times(1)
+			}
+
+			err := h.Logout(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code, "Expected status %d but got %d", test.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestLogoutAll(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	revoker := mocks.NewMockChecker(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewUserHandler(nil, nil, retryer, revoker, nil, nil, nil, nil, cookieauth.NewManager(cookieauth.Config{}), nil)
+
+	tests := []struct {
+		name           string
+		revokeError    error
+		expectedStatus int
+	}{
+		{"Successful logout from all sessions", nil, http.StatusOK},
+		{"Database error", apperrors.ErrServer, http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/logout/all", nil)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+
+			ctx.Set("user_id", testUser.ID)
+			ctx.Set("user_login", testUser.Login)
+
+			revoker.EXPECT().RevokeAll(gomock.Any(), testUser.ID).Return(test.revokeError).Times(1)
+
+			err := h.LogoutAll(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code, "Expected status %d but got %d", test.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	tokenBuilder := mocks.NewMockTokenBuilder(ctrl)
+	revoker := mocks.NewMockChecker(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewUserHandler(repo, tokenBuilder, retryer, revoker, nil, validation.NewValidator(validation.DefaultConfig()), newHasher(t), nil, cookieauth.NewManager(cookieauth.Config{}), nil)
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("old_password"), bcrypt.MinCost)
+
+	tests := []struct {
+		name             string
+		body             string
+		expectSelectCall bool
+		expectUpdateCall bool
+		updateError      error
+		expectedStatus   int
+	}{
+		{
+			name:             "Successful password change",
+			body:             `{"old_password":"old_password","new_password":"new_password"}`,
+			expectSelectCall: true,
+			expectUpdateCall: true,
+			expectedStatus:   http.StatusOK,
+		},
+		{
+			name:           "Empty new password",
+			body:           `{"old_password":"old_password"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:             "New password violates policy",
+			body:             `{"old_password":"old_password","new_password":"password"}`,
+			expectSelectCall: true,
+			expectedStatus:   http.StatusBadRequest,
+		},
+		{
+			name:             "Wrong old password",
+			body:             `{"old_password":"wrong","new_password":"new_password"}`,
+			expectSelectCall: true,
+			expectedStatus:   http.StatusForbidden,
+		},
+		{
+			name:             "Database error",
+			body:             `{"old_password":"old_password","new_password":"new_password"}`,
+			expectSelectCall: true,
+			expectUpdateCall: true,
+			updateError:      apperrors.ErrServer,
+			expectedStatus:   http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/password", bytes.NewReader([]byte(test.body)))
 			req.Header.Set("Content-Type", "application/json")
 			rec := httptest.NewRecorder()
 			ctx := e.NewContext(req, rec)
 
-			if test.expectRepoCall {
+			ctx.Set("user_id", testUser.ID)
+			ctx.Set("user_login", testUser.Login)
+
+			if test.expectSelectCall {
+				repo.EXPECT().SelectPassword(gomock.Any(), testUser.ID).Return(string(hashedPassword), nil).Times(1)
+			}
+			if test.expectUpdateCall {
 				repo.EXPECT().
-					InsertUser(gomock.Any(), gomock.Any()).
-					Return(test.repoError).
+					UpdatePassword(gomock.Any(), testUser.ID, gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, _ int64, password string, _ time.Time) error {
+						assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(password), []byte("new_password")))
+						return test.updateError
+					}).
 					Times(1)
 			}
-
-			if test.expectJWTCall {
-				tokenBuilder.EXPECT().
-					BuildJWTString(gomock.Any()).
-					Return("mock_token", nil).
-					Times(1)
+			if test.expectedStatus == http.StatusOK {
+				revoker.EXPECT().Invalidate(testUser.ID, gomock.Any()).Times(1)
+				expectTokenPair(tokenBuilder, repo, testUser)
 			}
 
-			err := h.Register(ctx)
+			err := h.ChangePassword(ctx)
 
 			require.NoError(t, err)
 			assert.Equal(t, test.expectedStatus, rec.Code, "Expected status %d but got %d", test.expectedStatus, rec.Code)
@@ -119,143 +892,68 @@ func TestUserRegister(t *testing.T) {
 	}
 }
 
-func TestUserLogin(t *testing.T) {
+func TestChangeLogin(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	repo := mocks.NewMockRepository(ctrl)
-	tokenBuilder := mocks.NewMockTokenBuilder(ctrl)
 	retryer := retryables.NewRetryer(nil)
 	retryer.SetCount(1)
 
-	h := handler.NewUserHandler(repo, tokenBuilder, retryer)
-
-	password := "password123"
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	h := handler.NewUserHandler(repo, nil, retryer, nil, nil, validation.NewValidator(validation.DefaultConfig()), nil, nil, nil, nil)
 
 	tests := []struct {
 		name           string
-		inputUser      models.User
-		repoError      error
-		tokenError     error
-		expectRepoCall bool
-		expectJWTCall  bool
+		body           string
+		expectUpdate   bool
+		updateError    error
 		expectedStatus int
-		returnedHash   string
 	}{
 		{
-			name: "Successful login",
-			inputUser: models.User{
-				Login:    "testuser",
-				Password: password,
-			},
-			repoError:      nil,
-			tokenError:     nil,
-			expectRepoCall: true,
-			expectJWTCall:  true,
+			name:           "Login changed",
+			body:           `{"login":"newlogin"}`,
+			expectUpdate:   true,
 			expectedStatus: http.StatusOK,
-			returnedHash:   string(hashedPassword),
 		},
 		{
-			name: "Invalid JSON",
-			inputUser: models.User{
-				Login:    "",
-				Password: "",
-			},
-			repoError:      nil,
-			tokenError:     nil,
-			expectRepoCall: false,
-			expectJWTCall:  false,
+			name:           "Invalid login",
+			body:           `{"login":"a"}`,
 			expectedStatus: http.StatusBadRequest,
 		},
 		{
-			name: "User not found",
-			inputUser: models.User{
-				Login:    "unknown_user",
-				Password: password,
-			},
-			repoError:      apperrors.ErrInvalidLP,
-			tokenError:     nil,
-			expectRepoCall: true,
-			expectJWTCall:  false,
-			expectedStatus: http.StatusUnauthorized,
-			returnedHash:   "",
-		},
-		{
-			name: "Incorrect password",
-			inputUser: models.User{
-				Login:    "testuser",
-				Password: "wrongpassword",
-			},
-			repoError:      nil,
-			tokenError:     nil,
-			expectRepoCall: true,
-			expectJWTCall:  false,
-			expectedStatus: http.StatusUnauthorized,
-			returnedHash:   string(hashedPassword),
-		},
-		{
-			name: "Server error when retrieving password",
-			inputUser: models.User{
-				Login:    "server_error_user",
-				Password: password,
-			},
-			repoError:      apperrors.ErrServer,
-			tokenError:     nil,
-			expectRepoCall: true,
-			expectJWTCall:  false,
-			expectedStatus: http.StatusInternalServerError,
-			returnedHash:   "",
+			name:           "Login taken",
+			body:           `{"login":"newlogin"}`,
+			expectUpdate:   true,
+			updateError:    apperrors.ErrLoginTaken,
+			expectedStatus: http.StatusConflict,
 		},
 		{
-			name: "Error generating JWT token",
-			inputUser: models.User{
-				Login:    "testuser",
-				Password: password,
-			},
-			repoError:      nil,
-			tokenError:     apperrors.ErrServer,
-			expectRepoCall: true,
-			expectJWTCall:  true,
+			name:           "Database error",
+			body:           `{"login":"newlogin"}`,
+			expectUpdate:   true,
+			updateError:    apperrors.ErrServer,
 			expectedStatus: http.StatusInternalServerError,
-			returnedHash:   string(hashedPassword),
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			e := echo.New()
-
-			var userJSON []byte
-			if test.name == "Invalid JSON" {
-				userJSON = []byte("{invalid-json}")
-			} else {
-				userJSON, _ = json.Marshal(test.inputUser)
-			}
-
-			req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(userJSON))
+			req := httptest.NewRequest(http.MethodPut, "/api/user/login", bytes.NewReader([]byte(test.body)))
 			req.Header.Set("Content-Type", "application/json")
 			rec := httptest.NewRecorder()
 			ctx := e.NewContext(req, rec)
+			ctx.Set("user_id", testUser.ID)
+			ctx.Set("user_login", testUser.Login)
 
-			if test.expectRepoCall {
-				repo.EXPECT().
-					SelectUser(gomock.Any(), test.inputUser.Login).
-					Return(test.returnedHash, test.repoError).
-					Times(1)
-			}
-
-			if test.expectJWTCall {
-				tokenBuilder.EXPECT().
-					BuildJWTString(test.inputUser.Login).
-					Return("mock_token", test.tokenError).
-					Times(1)
+			if test.expectUpdate {
+				repo.EXPECT().UpdateLogin(gomock.Any(), testUser.ID, "newlogin").Return(test.updateError).Times(1)
 			}
 
-			err := h.Login(ctx)
+			err := h.ChangeLogin(ctx)
 
 			require.NoError(t, err)
-			assert.Equal(t, test.expectedStatus, rec.Code, "Expected status %d but got %d", test.expectedStatus, rec.Code)
+			assert.Equal(t, test.expectedStatus, rec.Code)
 		})
 	}
 }
@@ -268,7 +966,7 @@ func TestAddOrder(t *testing.T) {
 	retryer := retryables.NewRetryer(nil)
 	retryer.SetCount(1)
 
-	h := handler.NewUserHandler(repo, nil, retryer)
+	h := handler.NewUserHandler(repo, nil, retryer, nil, nil, nil, nil, nil, nil, nil)
 
 	tests := []struct {
 		name           string
@@ -337,7 +1035,8 @@ func TestAddOrder(t *testing.T) {
 			rec := httptest.NewRecorder()
 			ctx := e.NewContext(req, rec)
 
-			ctx.Set("user_login", "testuser")
+			ctx.Set("user_id", testUser.ID)
+			ctx.Set("user_login", testUser.Login)
 
 			if test.expectRepoCall {
 				repo.EXPECT().
@@ -362,16 +1061,26 @@ func TestGetOrders(t *testing.T) {
 	retryer := retryables.NewRetryer(nil)
 	retryer.SetCount(1)
 
-	h := handler.NewUserHandler(repo, nil, retryer)
+	h := handler.NewUserHandler(repo, nil, retryer, nil, nil, nil, nil, nil, nil, nil)
+
+	after := models.Cursor{Time: time.Date(2024, 5, 1, 10, 0, 0, 123456000, time.UTC), Key: "79927398713"}
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	next := &models.Cursor{Time: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC), Key: "12345678903"}
 
 	tests := []struct {
 		name           string
+		query          string
+		expectRepoCall bool
+		expectedFilter models.OrderFilter
 		orders         []models.OrderResponse
+		next           *models.Cursor
 		repoError      error
 		expectedStatus int
 	}{
 		{
-			name: "Successful order retrieval",
+			name:           "Successful order retrieval",
+			expectRepoCall: true,
+			expectedFilter: models.OrderFilter{},
 			orders: []models.OrderResponse{
 				{Number: "79927398713", Status: "PROCESSED", UploadedAt: time.Now().Format(time.RFC3339)},
 				{Number: "12345678903", Status: "NEW", UploadedAt: time.Now().Format(time.RFC3339)},
@@ -379,14 +1088,53 @@ func TestGetOrders(t *testing.T) {
 			repoError:      nil,
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name:           "Filtered page with next cursor",
+			query:          "?limit=1&cursor=" + encodeTestCursor(t, after) + "&status=NEW,PROCESSING&status=PROCESSED&from=2024-01-01T00:00:00Z&sort=asc",
+			expectRepoCall: true,
+			expectedFilter: models.OrderFilter{
+				PageFilter: models.PageFilter{Limit: 1, After: &after, From: &from, Asc: true},
+				Statuses:   []string{"NEW", "PROCESSING", "PROCESSED"},
+			},
+			orders:         []models.OrderResponse{{Number: "12345678903", Status: "NEW", UploadedAt: next.Time.Format(time.RFC3339)}},
+			next:           next,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Cursor without limit",
+			query:          "?cursor=" + encodeTestCursor(t, after),
+			expectRepoCall: true,
+			expectedFilter: models.OrderFilter{PageFilter: models.PageFilter{Limit: 50, After: &after}},
+			orders:         []models.OrderResponse{{Number: "12345678903", Status: "NEW", UploadedAt: next.Time.Format(time.RFC3339)}},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Invalid limit",
+			query:          "?limit=1000",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid cursor",
+			query:          "?cursor=not-a-cursor",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Unknown status",
+			query:          "?status=DONE",
+			expectedStatus: http.StatusBadRequest,
+		},
 		{
 			name:           "No orders found",
+			expectRepoCall: true,
+			expectedFilter: models.OrderFilter{},
 			orders:         []models.OrderResponse{},
 			repoError:      nil,
 			expectedStatus: http.StatusNoContent,
 		},
 		{
 			name:           "Database error",
+			expectRepoCall: true,
+			expectedFilter: models.OrderFilter{},
 			orders:         nil,
 			repoError:      apperrors.ErrServer,
 			expectedStatus: http.StatusInternalServerError,
@@ -396,16 +1144,19 @@ func TestGetOrders(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			e := echo.New()
-			req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			req := httptest.NewRequest(http.MethodGet, "/orders"+test.query, nil)
 			rec := httptest.NewRecorder()
 			ctx := e.NewContext(req, rec)
 
-			ctx.Set("user_login", "testuser")
+			ctx.Set("user_id", testUser.ID)
+			ctx.Set("user_login", testUser.Login)
 
-			repo.EXPECT().
-				SelectOrders(gomock.Any(), "testuser").
-				Return(test.orders, test.repoError).
-				Times(1)
+			if test.expectRepoCall {
+				repo.EXPECT().
+					SelectOrdersPage(gomock.Any(), testUser.ID, test.expectedFilter).
+					Return(test.orders, test.next, test.repoError).
+					Times(1)
+			}
 
 			err := h.GetOrders(ctx)
 
@@ -417,6 +1168,79 @@ func TestGetOrders(t *testing.T) {
 				err = json.Unmarshal(rec.Body.Bytes(), &responseOrders)
 				require.NoError(t, err)
 				assert.Equal(t, test.orders, responseOrders)
+
+				if test.next == nil {
+					assert.Empty(t, rec.Header().Get("X-Next-Cursor"))
+				} else {
+					assert.Equal(t, encodeTestCursor(t, *test.next), rec.Header().Get("X-Next-Cursor"))
+				}
+			}
+		})
+	}
+}
+
+func TestGetOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewUserHandler(repo, nil, retryer, nil, nil, nil, nil, nil, nil, nil)
+
+	accrual := 500.0
+	checkedAt := time.Now().Format(time.RFC3339)
+	order := models.OrderDetail{
+		OrderResponse: models.OrderResponse{Number: "79927398713", Status: "PROCESSED", Accrual: &accrual, UploadedAt: checkedAt},
+		CheckedAt:     &checkedAt,
+		History: []models.OrderStatusChange{
+			{Status: "NEW", ChangedAt: checkedAt},
+			{Status: "PROCESSED", ChangedAt: checkedAt},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		repoError      error
+		expectedStatus int
+	}{
+		{
+			name:           "Order found",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Unknown or foreign order",
+			repoError:      apperrors.ErrOrderNotFound,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Database error",
+			repoError:      apperrors.ErrServer,
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+			ctx.SetParamNames("number")
+			ctx.SetParamValues(order.Number)
+			ctx.Set("user_id", testUser.ID)
+			ctx.Set("user_login", testUser.Login)
+
+			repo.EXPECT().SelectOrder(gomock.Any(), testUser.ID, order.Number).Return(order, test.repoError).Times(1)
+
+			err := h.GetOrder(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+			if test.expectedStatus == http.StatusOK {
+				var response models.OrderDetail
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+				assert.Equal(t, order, response)
 			}
 		})
 	}
@@ -430,7 +1254,7 @@ func TestGetBalance(t *testing.T) {
 	retryer := retryables.NewRetryer(nil)
 	retryer.SetCount(1)
 
-	h := handler.NewUserHandler(repo, nil, retryer)
+	h := handler.NewUserHandler(repo, nil, retryer, nil, nil, nil, nil, nil, nil, nil)
 
 	tests := []struct {
 		name           string
@@ -462,11 +1286,12 @@ func TestGetBalance(t *testing.T) {
 			rec := httptest.NewRecorder()
 			ctx := e.NewContext(req, rec)
 
-			ctx.Set("user_login", "testuser")
+			ctx.Set("user_id", testUser.ID)
+			ctx.Set("user_login", testUser.Login)
 
 			// Ожидание вызова `SelectBalance`
 			repo.EXPECT().
-				SelectBalance(gomock.Any(), "testuser").
+				SelectBalance(gomock.Any(), testUser.ID).
 				Return(test.balance, test.repoError).
 				Times(1)
 
@@ -490,10 +1315,12 @@ func TestWithdraw(t *testing.T) {
 	defer ctrl.Finish()
 
 	repo := mocks.NewMockRepository(ctrl)
+	mfaAuth := mocks.NewMockAuthenticator(ctrl)
+	limiter := mocks.NewMockLimiter(ctrl)
 	retryer := retryables.NewRetryer(nil)
 	retryer.SetCount(1)
 
-	h := handler.NewUserHandler(repo, nil, retryer)
+	h := handler.NewUserHandler(repo, nil, retryer, nil, limiter, nil, nil, mfaAuth, nil, nil)
 
 	tests := []struct {
 		name           string
@@ -501,6 +1328,10 @@ func TestWithdraw(t *testing.T) {
 		repoError      error
 		expectRepoCall bool
 		expectedStatus int
+		totpRequired   bool
+		totpCode       string
+		totpError      error
+		totpLockedFor  time.Duration
 	}{
 		{
 			name: "Successful withdrawal",
@@ -562,6 +1393,48 @@ func TestWithdraw(t *testing.T) {
 			expectRepoCall: true,
 			expectedStatus: http.StatusInternalServerError,
 		},
+		{
+			name: "TOTP code required",
+			withdrawal: models.Withdrawal{
+				Order: "79927398713",
+				Sum:   5000.00,
+			},
+			totpRequired:   true,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "Invalid TOTP code",
+			withdrawal: models.Withdrawal{
+				Order: "79927398713",
+				Sum:   5000.00,
+			},
+			totpRequired:   true,
+			totpCode:       "123456",
+			totpError:      apperrors.ErrInvalidTOTP,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "Too many invalid TOTP codes",
+			withdrawal: models.Withdrawal{
+				Order: "79927398713",
+				Sum:   5000.00,
+			},
+			totpRequired:   true,
+			totpCode:       "123456",
+			totpLockedFor:  time.Second * 90,
+			expectedStatus: http.StatusTooManyRequests,
+		},
+		{
+			name: "Valid TOTP code",
+			withdrawal: models.Withdrawal{
+				Order: "79927398713",
+				Sum:   5000.00,
+			},
+			totpRequired:   true,
+			totpCode:       "654321",
+			expectRepoCall: true,
+			expectedStatus: http.StatusOK,
+		},
 	}
 
 	for _, test := range tests {
@@ -577,10 +1450,32 @@ func TestWithdraw(t *testing.T) {
 
 			req := httptest.NewRequest(http.MethodPost, "/withdraw", bytes.NewReader(withdrawalJSON))
 			req.Header.Set("Content-Type", "application/json")
+			if test.totpCode != "" {
+				req.Header.Set("X-TOTP-Code", test.totpCode)
+			}
 			rec := httptest.NewRecorder()
 			ctx := e.NewContext(req, rec)
 
-			ctx.Set("user_login", "testuser")
+			ctx.Set("user_id", testUser.ID)
+			ctx.Set("user_login", testUser.Login)
+
+			if test.expectRepoCall || test.totpRequired {
+				mfaAuth.EXPECT().
+					RequiredForWithdraw(gomock.Any(), testUser.ID, test.withdrawal.Sum).
+					Return(test.totpRequired, nil).
+					Times(1)
+			}
+			if test.totpCode != "" {
+				limiter.EXPECT().CheckTOTP(gomock.Any(), testUser.ID).Return(test.totpLockedFor, nil).Times(1)
+			}
+			if test.totpCode != "" && test.totpLockedFor == 0 {
+				mfaAuth.EXPECT().Verify(gomock.Any(), testUser.ID, test.totpCode, false).Return(test.totpError).Times(1)
+				if test.totpError != nil {
+					limiter.EXPECT().FailTOTP(gomock.Any(), testUser.ID).Return(nil).Times(1)
+				} else {
+					limiter.EXPECT().ResetTOTP(gomock.Any(), testUser.ID).Return(nil).Times(1)
+				}
+			}
 
 			if test.expectRepoCall {
 				repo.EXPECT().
@@ -593,6 +1488,9 @@ func TestWithdraw(t *testing.T) {
 
 			require.NoError(t, err)
 			assert.Equal(t, test.expectedStatus, rec.Code, "Expected status %d but got %d", test.expectedStatus, rec.Code)
+			if test.totpLockedFor > 0 {
+				assert.Equal(t, "90", rec.Header().Get("Retry-After"))
+			}
 		})
 	}
 }
@@ -605,31 +1503,68 @@ func TestGetWithdrawals(t *testing.T) {
 	retryer := retryables.NewRetryer(nil)
 	retryer.SetCount(1)
 
-	h := handler.NewUserHandler(repo, nil, retryer)
+	h := handler.NewUserHandler(repo, nil, retryer, nil, nil, nil, nil, nil, nil, nil)
+
+	to := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	next := &models.Cursor{Time: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC), Key: "12345678903"}
+	// Без limit и cursor - все списания, как до пагинации
+	defaultFilter := models.WithdrawalFilter{}
 
 	tests := []struct {
 		name           string
+		query          string
+		expectRepoCall bool
+		expectedFilter models.WithdrawalFilter
 		withdrawals    []models.WithdrawalResponse
+		next           *models.Cursor
+		totals         models.WithdrawalTotals
 		repoError      error
 		expectedStatus int
 	}{
 		{
-			name: "Successful withdrawals retrieval",
+			name:           "Successful withdrawals retrieval",
+			expectRepoCall: true,
+			expectedFilter: defaultFilter,
 			withdrawals: []models.WithdrawalResponse{
 				{Order: "79927398713", Sum: 50.00, ProcessedAt: time.Now().Format(time.RFC3339)},
 				{Order: "12345678903", Sum: 25.00, ProcessedAt: time.Now().Format(time.RFC3339)},
 			},
+			totals:         models.WithdrawalTotals{Count: 2, Sum: 75},
 			repoError:      nil,
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name:           "Filtered page with next cursor",
+			query:          "?limit=1&to=2024-06-01T00:00:00Z&min_sum=10.5",
+			expectRepoCall: true,
+			expectedFilter: models.WithdrawalFilter{PageFilter: models.PageFilter{Limit: 1, To: &to}, MinSum: 10.5},
+			withdrawals:    []models.WithdrawalResponse{{Order: "12345678903", Sum: 25.5, ProcessedAt: next.Time.Format(time.RFC3339)}},
+			next:           next,
+			totals:         models.WithdrawalTotals{Count: 3, Sum: 120.25},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Negative minimum sum",
+			query:          "?min_sum=-1",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid date range",
+			query:          "?from=yesterday",
+			expectedStatus: http.StatusBadRequest,
+		},
 		{
 			name:           "No withdrawals found",
+			expectRepoCall: true,
+			expectedFilter: defaultFilter,
 			withdrawals:    []models.WithdrawalResponse{},
 			repoError:      nil,
 			expectedStatus: http.StatusNoContent,
 		},
 		{
 			name:           "Database error",
+			expectRepoCall: true,
+			expectedFilter: defaultFilter,
 			withdrawals:    nil,
 			repoError:      apperrors.ErrServer,
 			expectedStatus: http.StatusInternalServerError,
@@ -639,16 +1574,25 @@ func TestGetWithdrawals(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			e := echo.New()
-			req := httptest.NewRequest(http.MethodGet, "/withdrawals", nil)
+			req := httptest.NewRequest(http.MethodGet, "/withdrawals"+test.query, nil)
 			rec := httptest.NewRecorder()
 			ctx := e.NewContext(req, rec)
 
-			ctx.Set("user_login", "testuser")
+			ctx.Set("user_id", testUser.ID)
+			ctx.Set("user_login", testUser.Login)
 
-			repo.EXPECT().
-				SelectWithdrawals(gomock.Any(), "testuser").
-				Return(test.withdrawals, test.repoError).
-				Times(1)
+			if test.expectRepoCall {
+				repo.EXPECT().
+					SelectWithdrawalsPage(gomock.Any(), testUser.ID, test.expectedFilter).
+					Return(test.withdrawals, test.next, test.repoError).
+					Times(1)
+			}
+			if len(test.withdrawals) > 0 {
+				repo.EXPECT().
+					SelectWithdrawalTotals(gomock.Any(), testUser.ID, test.expectedFilter).
+					Return(test.totals, nil).
+					Times(1)
+			}
 
 			err := h.GetWithdrawals(ctx)
 
@@ -660,7 +1604,88 @@ func TestGetWithdrawals(t *testing.T) {
 				err := json.Unmarshal(rec.Body.Bytes(), &responseWithdrawals)
 				require.NoError(t, err)
 				assert.Equal(t, test.withdrawals, responseWithdrawals)
+				assert.Equal(t, fmt.Sprint(test.totals.Count), rec.Header().Get("X-Total-Count"))
+				assert.Equal(t, fmt.Sprint(test.totals.Sum), rec.Header().Get("X-Total-Sum"))
+
+				if test.next != nil {
+					assert.Equal(t, encodeTestCursor(t, *test.next), rec.Header().Get("X-Next-Cursor"))
+				}
 			}
 		})
 	}
 }
+
+// encodeTestCursor кодирует курсор так же, как сервер отдаёт его в X-Next-Cursor
+func encodeTestCursor(t *testing.T, cursor models.Cursor) string {
+	data, err := json.Marshal(cursor)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// testUser - пользователь, от имени которого выполняются запросы в тестах
+var testUser = models.Account{ID: 1, Login: "testuser", Role: models.RoleUser}
+
+// expectTokenPair ожидает выпуск пары access/refresh токенов для account в новой сессии
+func expectTokenPair(tokenBuilder *mocks.MockTokenBuilder, repo *mocks.MockRepository, account models.Account) {
+	var sessionID string
+	repo.EXPECT().SelectAccount(gomock.Any(), account.ID).Return(account, nil).Times(1)
+	repo.EXPECT().
+		SaveSession(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, session models.Session) error {
+			sessionID = session.ID
+			return nil
+		}).
+		Times(1)
+	tokenBuilder.EXPECT().
+		BuildJWTString(gomock.Any()).
+		DoAndReturn(func(subject models.TokenSubject) (string, error) {
+			if subject.UserID != account.ID || subject.Login != account.Login {
+				return "", errors.New("unexpected subject " + subject.Login)
+			}
+			if subject.SessionID == "" || subject.SessionID != sessionID {
+				return "", errors.New("token is not bound to the session")
+			}
+			return "mock_token", nil
+		}).
+		Times(1)
+	tokenBuilder.EXPECT().BuildRefreshToken().Return("mock_refresh", time.Now().Add(time.Hour), nil).Times(1)
+	tokenBuilder.EXPECT().AccessTokenExp().Return(time.Minute).Times(1)
+	repo.EXPECT().
+		InsertRefreshToken(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, token models.RefreshToken) error {
+			if token.UserID != account.ID || token.FamilyID != sessionID {
+				return errors.New("refresh token family differs from session")
+			}
+			return nil
+		}).
+		Times(1)
+}
+
+// subjectMatcher сравнивает models.TokenSubject, пустой SessionID - любая непустая сессия
+type subjectMatcher struct {
+	userID    int64
+	login     string
+	role      string
+	sessionID string
+}
+
+func (m subjectMatcher) Matches(x interface{}) bool {
+	subject, ok := x.(models.TokenSubject)
+	if !ok || subject.UserID != m.userID || subject.Login != m.login || subject.Role != m.role || subject.SessionID == "" {
+		return false
+	}
+	return m.sessionID == "" || subject.SessionID == m.sessionID
+}
+
+func (m subjectMatcher) String() string {
+	return fmt.Sprintf("token subject for %s (%s)", m.login, m.role)
+}
+
+// newHasher - bcrypt с DefaultCost, как было до настраиваемой политики
+func newHasher(t *testing.T) passwords.Hasher {
+	config := passwords.DefaultConfig()
+	config.BcryptCost = bcrypt.DefaultCost
+	hasher, err := passwords.NewHasher(config)
+	require.NoError(t, err)
+	return hasher
+}
@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/gophermart/internal/repository"
+	"github.com/llaxzi/gophermart/internal/tokens"
+	"github.com/llaxzi/gophermart/internal/webhooks"
+	"github.com/llaxzi/retryables/v2"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxWebhookURLLength = 2048
+	minWebhookSecret    = 16
+	maxWebhookSecret    = 128
+)
+
+type WebhookHandler interface {
+	Create(ctx echo.Context) error
+	List(ctx echo.Context) error
+	Delete(ctx echo.Context) error
+	Deliveries(ctx echo.Context) error
+}
+
+func NewWebhookHandler(repo repository.Repository, retryer *retryables.Retryer) WebhookHandler {
+	return &webhookHandler{repo, retryer}
+}
+
+type webhookHandler struct {
+	repo    repository.Repository
+	retryer *retryables.Retryer
+}
+
+func (h *webhookHandler) Create(ctx echo.Context) error {
+	var req models.WebhookRequest
+	err := ctx.Bind(&req)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidJSON.Error()})
+	}
+
+	req.URL = strings.TrimSpace(req.URL)
+	if !validWebhookURL(req.URL) {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidHook.Error()})
+	}
+	// Секрет можно задать самому, иначе генерируем
+	if req.Secret != "" && (len(req.Secret) < minWebhookSecret || len(req.Secret) > maxWebhookSecret) {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidHook.Error()})
+	}
+
+	events, ok := normalizeEvents(req.Events)
+	if !ok {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": apperrors.ErrInvalidEvent.Error()})
+	}
+
+	userID := ctx.Get("user_id").(int64)
+
+	secret := req.Secret
+	if secret == "" {
+		secret, err = tokens.NewWebhookSecret()
+		if err != nil {
+			log.Printf("Failed to generate webhook secret: %v", err)
+			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+		}
+	}
+	id, err := tokens.NewID()
+	if err != nil {
+		log.Printf("Failed to generate webhook id: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	webhook := models.Webhook{ID: id, URL: req.URL, Events: events, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	err = h.retryer.Retry(func() error {
+		return h.repo.InsertWebhook(ctx.Request().Context(), userID, webhook, secret)
+	})
+	if err != nil {
+		log.Printf("Failed to insert webhook: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	return ctx.JSON(http.StatusCreated, models.WebhookCreated{Webhook: webhook, Secret: secret})
+}
+
+func (h *webhookHandler) List(ctx echo.Context) error {
+	userID := ctx.Get("user_id").(int64)
+
+	var hooks []models.Webhook
+	var err error
+	err = h.retryer.Retry(func() error {
+		hooks, err = h.repo.SelectWebhooks(ctx.Request().Context(), userID)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to get webhooks: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+	if len(hooks) == 0 {
+		return ctx.NoContent(http.StatusNoContent)
+	}
+
+	return ctx.JSON(http.StatusOK, hooks)
+}
+
+func (h *webhookHandler) Delete(ctx echo.Context) error {
+	userID := ctx.Get("user_id").(int64)
+	id := ctx.Param("id")
+
+	err := h.retryer.Retry(func() error {
+		return h.repo.DeleteWebhook(ctx.Request().Context(), userID, id)
+	})
+	if err != nil {
+		if errors.Is(err, apperrors.ErrWebhookNotFound) {
+			return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		log.Printf("Failed to delete webhook: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	return ctx.JSON(http.StatusOK, "webhook deleted")
+}
+
+// Deliveries - журнал последних доставок вебхука, ?limit= как у списков заказов
+func (h *webhookHandler) Deliveries(ctx echo.Context) error {
+	limit := defaultPageLimit
+	if v := ctx.QueryParam("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			violations := []models.Violation{queryViolation("limit", "range", "limit must be between 1 and "+strconv.Itoa(maxPageLimit))}
+			return ctx.JSON(http.StatusBadRequest, models.ValidationErrorResponse{Error: apperrors.ErrValidation.Error(), Violations: violations})
+		}
+	}
+
+	userID := ctx.Get("user_id").(int64)
+	id := ctx.Param("id")
+
+	var deliveries []models.WebhookDelivery
+	var err error
+	err = h.retryer.Retry(func() error {
+		deliveries, err = h.repo.SelectWebhookDeliveries(ctx.Request().Context(), userID, id, limit)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, apperrors.ErrWebhookNotFound) {
+			return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		log.Printf("Failed to get webhook deliveries: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+	if len(deliveries) == 0 {
+		return ctx.NoContent(http.StatusNoContent)
+	}
+
+	return ctx.JSON(http.StatusOK, deliveries)
+}
+
+// internal
+
+func validWebhookURL(raw string) bool {
+	if raw == "" || len(raw) > maxWebhookURLLength {
+		return false
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" || u.User != nil {
+		return false
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	// Явно внутренние адреса отклоняем сразу, имена проверяет клиент диспетчера после разрешения DNS
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil && !webhooks.IsPublicIP(ip) {
+		return false
+	}
+	return true
+}
+
+// normalizeEvents проверяет события и убирает повторы, пустой список - подписка на все
+func normalizeEvents(events []string) ([]string, bool) {
+	result := make([]string, 0, len(events))
+	for _, event := range events {
+		if !contains(models.WebhookEvents, event) {
+			return nil, false
+		}
+		if !contains(result, event) {
+			result = append(result, event)
+		}
+	}
+	return result, true
+}
@@ -0,0 +1,255 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/handler"
+	"github.com/llaxzi/gophermart/internal/mocks"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/retryables/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateWebhook(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewWebhookHandler(repo, retryer)
+
+	tests := []struct {
+		name           string
+		body           string
+		expectRepoCall bool
+		expectedEvents []string
+		expectedSecret string
+		expectedStatus int
+	}{
+		{
+			name:           "Own secret and events",
+			body:           `{"url":"https://partner.example/hook","secret":"0123456789abcdef","events":["order.processed","withdrawal.created","order.processed"]}`,
+			expectRepoCall: true,
+			expectedEvents: []string{models.EventOrderProcessed, models.EventWithdrawalCreated},
+			expectedSecret: "0123456789abcdef",
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Generated secret, all events",
+			body:           `{"url":"http://203.0.113.10:9000/hook"}`,
+			expectRepoCall: true,
+			expectedEvents: []string{},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Not an http URL",
+			body:           `{"url":"ftp://partner.example/hook"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "URL without host",
+			body:           `{"url":"https:///hook"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Loopback host",
+			body:           `{"url":"http://localhost:8080/api/admin"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Cloud metadata address",
+			body:           `{"url":"http://169.254.169.254/latest/meta-data"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Private network address",
+			body:           `{"url":"https://[::ffff:10.0.0.5]/hook"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Short secret",
+			body:           `{"url":"https://partner.example/hook","secret":"short"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Unknown event",
+			body:           `{"url":"https://partner.example/hook","events":["order.deleted"]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/api/user/webhooks", bytes.NewReader([]byte(test.body)))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+			ctx.Set("user_id", testUser.ID)
+
+			var storedSecret string
+			if test.expectRepoCall {
+				repo.EXPECT().
+					InsertWebhook(gomock.Any(), testUser.ID, gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, _ int64, webhook models.Webhook, secret string) error {
+						assert.Equal(t, test.expectedEvents, webhook.Events)
+						storedSecret = secret
+						return nil
+					}).
+					Times(1)
+			}
+
+			err := h.Create(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+
+			if test.expectedStatus == http.StatusCreated {
+				var created models.WebhookCreated
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+				assert.NotEmpty(t, created.ID)
+				assert.Equal(t, storedSecret, created.Secret)
+				if test.expectedSecret != "" {
+					assert.Equal(t, test.expectedSecret, created.Secret)
+				} else {
+					assert.True(t, strings.HasPrefix(created.Secret, "whsec_"))
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteWebhook(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewWebhookHandler(repo, retryer)
+
+	tests := []struct {
+		name           string
+		repoError      error
+		expectedStatus int
+	}{
+		{"Deleted", nil, http.StatusOK},
+		{"Unknown or foreign webhook", apperrors.ErrWebhookNotFound, http.StatusNotFound},
+		{"Server error", apperrors.ErrPgConnExc, http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodDelete, "/api/user/webhooks/abc", nil)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+			ctx.SetParamNames("id")
+			ctx.SetParamValues("abc")
+			ctx.Set("user_id", testUser.ID)
+
+			repo.EXPECT().DeleteWebhook(gomock.Any(), testUser.ID, "abc").Return(test.repoError).Times(1)
+
+			err := h.Delete(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	h := handler.NewWebhookHandler(repo, retryer)
+
+	code := http.StatusInternalServerError
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	deliveries := []models.WebhookDelivery{
+		{ID: 2, Event: models.EventOrderProcessed, Status: models.DeliveryPending, Attempts: 1, LastStatusCode: &code, CreatedAt: createdAt},
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectRepoCall bool
+		expectedLimit  int
+		deliveries     []models.WebhookDelivery
+		repoError      error
+		expectedStatus int
+	}{
+		{
+			name:           "Default limit",
+			expectRepoCall: true,
+			expectedLimit:  50,
+			deliveries:     deliveries,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Custom limit, no deliveries",
+			query:          "?limit=5",
+			expectRepoCall: true,
+			expectedLimit:  5,
+			deliveries:     []models.WebhookDelivery{},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Limit out of range",
+			query:          "?limit=500",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Unknown or foreign webhook",
+			expectRepoCall: true,
+			expectedLimit:  50,
+			repoError:      apperrors.ErrWebhookNotFound,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/api/user/webhooks/abc/deliveries"+test.query, nil)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+			ctx.SetParamNames("id")
+			ctx.SetParamValues("abc")
+			ctx.Set("user_id", testUser.ID)
+
+			if test.expectRepoCall {
+				repo.EXPECT().SelectWebhookDeliveries(gomock.Any(), testUser.ID, "abc", test.expectedLimit).
+					Return(test.deliveries, test.repoError).Times(1)
+			}
+
+			err := h.Deliveries(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+
+			if test.expectedStatus == http.StatusOK {
+				var got []models.WebhookDelivery
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+				assert.Equal(t, test.deliveries, got)
+			}
+		})
+	}
+}
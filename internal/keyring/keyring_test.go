@@ -0,0 +1,157 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestKeyring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	err := os.WriteFile(path, []byte(`{"current":"k2","keys":[
+		{"kid":"k1","secret":"old","retired":true},
+		{"kid":"k2","secret":"current"},
+		{"kid":"k3","secret":"next"}]}`), 0600)
+	require.NoError(t, err)
+
+	ring, err := NewKeyring(FileSource(path))
+	require.NoError(t, err)
+
+	key, err := ring.SigningKey()
+	require.NoError(t, err)
+	assert.Equal(t, "k2", key.ID)
+	assert.Equal(t, []byte("current"), key.Secret)
+
+	_, err = ring.VerificationKey("k1")
+	assert.ErrorIs(t, err, ErrRetiredKey)
+	_, err = ring.VerificationKey("unknown")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	key, err = ring.VerificationKey("k3")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("next"), key.Secret)
+
+	t.Run("Reload rotates current key", func(t *testing.T) {
+		err = os.WriteFile(path, []byte(`{"current":"k3","keys":[
+			{"kid":"k2","secret":"current"},
+			{"kid":"k3","secret":"next"}]}`), 0600)
+		require.NoError(t, err)
+		require.NoError(t, ring.Reload())
+
+		key, err = ring.SigningKey()
+		require.NoError(t, err)
+		assert.Equal(t, "k3", key.ID)
+		_, err = ring.VerificationKey("k2")
+		assert.NoError(t, err)
+		_, err = ring.VerificationKey("k1")
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	})
+
+	t.Run("Failed reload keeps previous keys", func(t *testing.T) {
+		err = os.WriteFile(path, []byte(`{"current":"k4","keys":[{"kid":"k3","secret":"next"}]}`), 0600)
+		require.NoError(t, err)
+		assert.ErrorIs(t, ring.Reload(), ErrUnknownKey)
+
+		key, err = ring.SigningKey()
+		require.NoError(t, err)
+		assert.Equal(t, "k3", key.ID)
+	})
+}
+
+func TestKeyring_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"Invalid JSON", `{`},
+		{"Retired current key", `{"current":"k1","keys":[{"kid":"k1","secret":"s","retired":true}]}`},
+		{"Empty secret", `{"current":"k1","keys":[{"kid":"k1","secret":""}]}`},
+		{"Duplicate kid", `{"current":"k1","keys":[{"kid":"k1","secret":"a"},{"kid":"k1","secret":"b"}]}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("TEST_JWT_KEYS", test.config)
+			_, err := NewKeyring(EnvSource("TEST_JWT_KEYS"))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestKeyring_Asymmetric(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaDER, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	require.NoError(t, err)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	edPublicDER, err := x509.MarshalPKIXPublicKey(edKey.Public())
+	require.NoError(t, err)
+
+	config, err := json.Marshal(map[string]interface{}{
+		"current": "rsa",
+		"keys": []map[string]interface{}{
+			{"kid": "rsa", "alg": "RS256", "private_key": string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: rsaDER}))},
+			{"kid": "ed", "alg": "EdDSA", "private_key": string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edDER}))},
+			{"kid": "ed-verify", "alg": "EdDSA", "public_key": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: edPublicDER}))},
+			{"kid": "hmac", "secret": "secret"},
+		},
+	})
+	require.NoError(t, err)
+	t.Setenv("TEST_JWT_KEYS", string(config))
+
+	ring, err := NewKeyring(EnvSource("TEST_JWT_KEYS"))
+	require.NoError(t, err)
+
+	key, err := ring.SigningKey()
+	require.NoError(t, err)
+	assert.Equal(t, jwt.SigningMethodRS256, key.Method)
+	assert.Equal(t, rsaKey, key.SignKey())
+	assert.Equal(t, &rsaKey.PublicKey, key.VerifyKey())
+
+	key, err = ring.VerificationKey("ed-verify")
+	require.NoError(t, err)
+	assert.Nil(t, key.SignKey())
+	assert.Equal(t, edKey.Public(), key.VerifyKey())
+
+	jwks := ring.JWKS()
+	require.Len(t, jwks.Keys, 3)
+	assert.Equal(t, "ed", jwks.Keys[0].Kid)
+	assert.Equal(t, "OKP", jwks.Keys[0].Kty)
+	assert.Equal(t, "Ed25519", jwks.Keys[0].Crv)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(edKey.Public().(ed25519.PublicKey)), jwks.Keys[0].X)
+	assert.Equal(t, "rsa", jwks.Keys[2].Kid)
+	assert.Equal(t, "RSA", jwks.Keys[2].Kty)
+	assert.Equal(t, "RS256", jwks.Keys[2].Alg)
+	assert.Equal(t, "AQAB", jwks.Keys[2].E)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()), jwks.Keys[2].N)
+
+	t.Run("Key type does not match alg", func(t *testing.T) {
+		config := `{"current":"k","keys":[{"kid":"k","alg":"RS256","private_key":` +
+			strconv.Quote(string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edDER}))) + `}]}`
+		t.Setenv("TEST_JWT_KEYS", config)
+		_, err := NewKeyring(EnvSource("TEST_JWT_KEYS"))
+		assert.Error(t, err)
+	})
+
+	t.Run("Current key without private part", func(t *testing.T) {
+		config := `{"current":"k","keys":[{"kid":"k","alg":"EdDSA","public_key":` +
+			strconv.Quote(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: edPublicDER}))) + `}]}`
+		t.Setenv("TEST_JWT_KEYS", config)
+		_, err := NewKeyring(EnvSource("TEST_JWT_KEYS"))
+		assert.Error(t, err)
+	})
+}
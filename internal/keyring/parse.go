@@ -0,0 +1,110 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/llaxzi/gophermart/internal/models"
+	"math/big"
+)
+
+func parseKey(kid, alg, secret, privatePEM, publicPEM string) (Key, error) {
+	key := Key{ID: kid}
+
+	switch alg {
+	case "", jwt.SigningMethodHS256.Alg():
+		if secret == "" {
+			return key, errors.New("empty secret")
+		}
+		key.Method = jwt.SigningMethodHS256
+		key.Secret = []byte(secret)
+		return key, nil
+	case jwt.SigningMethodRS256.Alg():
+		key.Method = jwt.SigningMethodRS256
+	case jwt.SigningMethodEdDSA.Alg():
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return key, fmt.Errorf("unsupported alg %q", alg)
+	}
+
+	if privatePEM != "" {
+		private, err := parsePrivateKey(privatePEM)
+		if err != nil {
+			return key, err
+		}
+		switch p := private.(type) {
+		case *rsa.PrivateKey:
+			key.Private, key.Public = p, &p.PublicKey
+		case ed25519.PrivateKey:
+			key.Private, key.Public = p, p.Public()
+		}
+	} else if publicPEM != "" {
+		public, err := parsePublicKey(publicPEM)
+		if err != nil {
+			return key, err
+		}
+		key.Public = public
+	} else {
+		return key, errors.New("private_key or public_key required")
+	}
+
+	// Тип ключа должен соответствовать alg, иначе подпись/проверка упадут в рантайме
+	switch key.Public.(type) {
+	case *rsa.PublicKey:
+		if key.Method != jwt.SigningMethodRS256 {
+			return key, fmt.Errorf("key type RSA does not match alg %s", key.Method.Alg())
+		}
+	case ed25519.PublicKey:
+		if key.Method != jwt.SigningMethodEdDSA {
+			return key, fmt.Errorf("key type Ed25519 does not match alg %s", key.Method.Alg())
+		}
+	default:
+		return key, fmt.Errorf("unsupported key type %T", key.Public)
+	}
+	return key, nil
+}
+
+func parsePrivateKey(data string) (interface{}, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("invalid private key PEM")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return x509.ParsePKCS8PrivateKey(block.Bytes)
+}
+
+func parsePublicKey(data string) (interface{}, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("invalid public key PEM")
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// publicJWK - представление публичного ключа по RFC 7517/8037
+func publicJWK(key Key) (models.JWK, error) {
+	jwk := models.JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+	switch public := key.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	default:
+		return jwk, fmt.Errorf("unsupported key type %T", key.Public)
+	}
+	return jwk, nil
+}
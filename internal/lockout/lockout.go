@@ -0,0 +1,143 @@
+package lockout
+
+import (
+	"context"
+	"github.com/llaxzi/gophermart/internal/repository"
+	"strconv"
+	"time"
+)
+
+// Limiter считает неудачные попытки входа по логину и по IP клиента,
+// а также неверные коды второго фактора вне входа (списание, отключение 2FA).
+// Состояние хранится в Postgres, поэтому блокировка общая для всех инстансов.
+type Limiter interface {
+	// Check возвращает оставшееся время блокировки, 0 - вход разрешён
+	Check(ctx context.Context, login string, ip string) (time.Duration, error)
+	// Fail учитывает попытку по логину и IP, пустой login не учитывается
+	Fail(ctx context.Context, login string, ip string) error
+	// Reset сбрасывает счётчик и блокировку: после успешного входа (только login)
+	// или при ручной разблокировке. Пустые login/ip пропускаются.
+	Reset(ctx context.Context, login string, ip string) error
+
+	// CheckTOTP, FailTOTP, ResetTOTP - то же для кодов второго фактора пользователя
+	CheckTOTP(ctx context.Context, userID int64) (time.Duration, error)
+	FailTOTP(ctx context.Context, userID int64) error
+	ResetTOTP(ctx context.Context, userID int64) error
+
+	// Prune удаляет счётчики, по которым не было попыток дольше Window и нет действующей блокировки
+	Prune(ctx context.Context) error
+}
+
+type Config struct {
+	LoginAttempts int           // неудачных попыток на логин до первой блокировки
+	IPAttempts    int           // неудачных попыток с одного IP до первой блокировки
+	TOTPAttempts  int           // неверных кодов второго фактора до первой блокировки
+	BaseDelay     time.Duration // первая блокировка, далее удваивается с каждой попыткой
+	MaxDelay      time.Duration
+	Window        time.Duration // счётчик начинается заново, если попыток не было дольше Window
+}
+
+func NewLimiter(repo repository.Repository, config Config) Limiter {
+	return &limiter{repo, config}
+}
+
+type limiter struct {
+	repo   repository.Repository
+	config Config
+}
+
+func LoginKey(login string) string {
+	return "login:" + login
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+func TOTPKey(userID int64) string {
+	return "totp:" + strconv.FormatInt(userID, 10)
+}
+
+func (l *limiter) Check(ctx context.Context, login string, ip string) (time.Duration, error) {
+	return l.lockedFor(ctx, LoginKey(login), IPKey(ip))
+}
+
+func (l *limiter) Fail(ctx context.Context, login string, ip string) error {
+	if login != "" {
+		if err := l.fail(ctx, LoginKey(login), l.config.LoginAttempts); err != nil {
+			return err
+		}
+	}
+	return l.fail(ctx, IPKey(ip), l.config.IPAttempts)
+}
+
+func (l *limiter) Reset(ctx context.Context, login string, ip string) error {
+	if login != "" {
+		if err := l.repo.DeleteLoginAttempts(ctx, LoginKey(login)); err != nil {
+			return err
+		}
+	}
+	if ip != "" {
+		return l.repo.DeleteLoginAttempts(ctx, IPKey(ip))
+	}
+	return nil
+}
+
+func (l *limiter) CheckTOTP(ctx context.Context, userID int64) (time.Duration, error) {
+	return l.lockedFor(ctx, TOTPKey(userID))
+}
+
+func (l *limiter) FailTOTP(ctx context.Context, userID int64) error {
+	return l.fail(ctx, TOTPKey(userID), l.config.TOTPAttempts)
+}
+
+func (l *limiter) ResetTOTP(ctx context.Context, userID int64) error {
+	return l.repo.DeleteLoginAttempts(ctx, TOTPKey(userID))
+}
+
+// Prune - такие счётчики и так начались бы заново при следующей неудаче
+func (l *limiter) Prune(ctx context.Context) error {
+	now := time.Now()
+	return l.repo.DeleteStaleLoginAttempts(ctx, now.Add(-l.config.Window), now)
+}
+
+// internal
+
+// lockedFor - оставшееся время самой долгой блокировки из keys
+func (l *limiter) lockedFor(ctx context.Context, keys ...string) (time.Duration, error) {
+	lockedUntil, err := l.repo.SelectLockedUntil(ctx, keys)
+	if err != nil {
+		return 0, err
+	}
+	if d := time.Until(lockedUntil); d > 0 {
+		return d, nil
+	}
+	return 0, nil
+}
+
+func (l *limiter) fail(ctx context.Context, key string, attempts int) error {
+	now := time.Now()
+	failures, err := l.repo.IncrementLoginFailures(ctx, key, now, now.Add(-l.config.Window))
+	if err != nil {
+		return err
+	}
+	if failures <= attempts {
+		return nil
+	}
+	return l.repo.LockLogin(ctx, key, now.Add(l.delay(failures-attempts)))
+}
+
+// delay - BaseDelay * 2^(n-1), но не больше MaxDelay
+func (l *limiter) delay(n int) time.Duration {
+	d := l.config.BaseDelay
+	for i := 1; i < n; i++ {
+		d *= 2
+		if d >= l.config.MaxDelay {
+			return l.config.MaxDelay
+		}
+	}
+	if d > l.config.MaxDelay {
+		return l.config.MaxDelay
+	}
+	return d
+}
@@ -0,0 +1,149 @@
+package lockout
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	"github.com/llaxzi/gophermart/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var testConfig = Config{
+	LoginAttempts: 3,
+	IPAttempts:    10,
+	TOTPAttempts:  5,
+	BaseDelay:     time.Second,
+	MaxDelay:      time.Minute,
+	Window:        time.Hour,
+}
+
+func TestLimiter_Check(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	l := NewLimiter(repo, testConfig)
+
+	tests := []struct {
+		name        string
+		lockedUntil time.Time
+		locked      bool
+	}{
+		{"Never locked", time.Time{}, false},
+		{"Lock expired", time.Now().Add(-time.Second), false},
+		{"Locked", time.Now().Add(time.Minute), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo.EXPECT().SelectLockedUntil(gomock.Any(), []string{"login:alice", "ip:203.0.113.7"}).
+				Return(test.lockedUntil, nil).Times(1)
+
+			retryAfter, err := l.Check(context.Background(), "alice", "203.0.113.7")
+			assert.NoError(t, err)
+			assert.Equal(t, test.locked, retryAfter > 0)
+		})
+	}
+}
+
+func TestLimiter_Fail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	l := NewLimiter(repo, testConfig)
+
+	tests := []struct {
+		name          string
+		loginFailures int
+		ipFailures    int
+		expectedLock  time.Duration // блокировка логина, 0 - без блокировки
+	}{
+		{"Within free attempts", 3, 1, 0},
+		{"First lock", 4, 2, time.Second},
+		{"Escalating lock", 6, 3, time.Second * 4},
+		{"Lock capped", 40, 4, time.Minute},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo.EXPECT().IncrementLoginFailures(gomock.Any(), "login:alice", gomock.Any(), gomock.Any()).
+				Return(test.loginFailures, nil).Times(1)
+			repo.EXPECT().IncrementLoginFailures(gomock.Any(), "ip:203.0.113.7", gomock.Any(), gomock.Any()).
+				Return(test.ipFailures, nil).Times(1)
+			if test.expectedLock > 0 {
+				repo.EXPECT().LockLogin(gomock.Any(), "login:alice", gomock.Any()).
+					DoAndReturn(func(_ context.Context, _ string, until time.Time) error {
+						assert.WithinDuration(t, time.Now().Add(test.expectedLock), until, time.Second)
+						return nil
+					}).Times(1)
+			}
+
+			assert.NoError(t, l.Fail(context.Background(), "alice", "203.0.113.7"))
+		})
+	}
+
+	t.Run("Empty login counts only IP", func(t *testing.T) {
+		repo.EXPECT().IncrementLoginFailures(gomock.Any(), "ip:203.0.113.7", gomock.Any(), gomock.Any()).
+			Return(1, nil).Times(1)
+
+		assert.NoError(t, l.Fail(context.Background(), "", "203.0.113.7"))
+	})
+}
+
+func TestLimiter_Prune(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	l := NewLimiter(repo, testConfig)
+
+	repo.EXPECT().DeleteStaleLoginAttempts(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, windowStart time.Time, now time.Time) error {
+			assert.WithinDuration(t, time.Now(), now, time.Second)
+			assert.Equal(t, testConfig.Window, now.Sub(windowStart))
+			return nil
+		}).Times(1)
+
+	assert.NoError(t, l.Prune(context.Background()))
+}
+
+func TestLimiter_Reset(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	l := NewLimiter(repo, testConfig)
+
+	repo.EXPECT().DeleteLoginAttempts(gomock.Any(), "login:alice").Return(nil).Times(1)
+	assert.NoError(t, l.Reset(context.Background(), "alice", ""))
+
+	repo.EXPECT().DeleteLoginAttempts(gomock.Any(), "ip:203.0.113.7").Return(nil).Times(1)
+	assert.NoError(t, l.Reset(context.Background(), "", "203.0.113.7"))
+}
+
+func TestLimiter_TOTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	l := NewLimiter(repo, testConfig)
+	ctx := context.Background()
+
+	repo.EXPECT().SelectLockedUntil(gomock.Any(), []string{"totp:42"}).Return(time.Now().Add(time.Minute), nil).Times(1)
+	retryAfter, err := l.CheckTOTP(ctx, 42)
+	assert.NoError(t, err)
+	assert.True(t, retryAfter > 0)
+
+	// Пятая ошибка ещё без блокировки, шестая блокирует
+	repo.EXPECT().IncrementLoginFailures(gomock.Any(), "totp:42", gomock.Any(), gomock.Any()).Return(5, nil).Times(1)
+	assert.NoError(t, l.FailTOTP(ctx, 42))
+
+	repo.EXPECT().IncrementLoginFailures(gomock.Any(), "totp:42", gomock.Any(), gomock.Any()).Return(6, nil).Times(1)
+	repo.EXPECT().LockLogin(gomock.Any(), "totp:42", gomock.Any()).Return(nil).Times(1)
+	assert.NoError(t, l.FailTOTP(ctx, 42))
+
+	repo.EXPECT().DeleteLoginAttempts(gomock.Any(), "totp:42").Return(nil).Times(1)
+	assert.NoError(t, l.ResetTOTP(ctx, 42))
+}
@@ -0,0 +1,198 @@
+package mfa
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/gophermart/internal/repository"
+	"github.com/llaxzi/gophermart/internal/tokens"
+	"strings"
+	"time"
+)
+
+// Authenticator - второй фактор на TOTP с кодами восстановления.
+// Вход в два шага: после пароля выдаётся одноразовый mfa токен, который обменивается на токены вместе с кодом.
+type Authenticator interface {
+	Enabled(ctx context.Context, userID int64) (bool, error)
+	Setup(ctx context.Context, userID int64) (models.TOTPSetup, error)
+	// Enable подтверждает настройку кодом из приложения и возвращает коды восстановления
+	Enable(ctx context.Context, userID int64, code string) ([]string, error)
+	Disable(ctx context.Context, userID int64, code string) error
+	// Verify проверяет TOTP код, а при allowRecovery и код восстановления. Каждый код принимается один раз.
+	Verify(ctx context.Context, userID int64, code string, allowRecovery bool) error
+	RequiredForWithdraw(ctx context.Context, userID int64, sum float64) (bool, error)
+	NewChallenge(ctx context.Context, userID int64) (string, error)
+	// CompleteChallenge возвращает владельца mfa токена, в том числе при неверном коде
+	CompleteChallenge(ctx context.Context, mfaToken string, code string) (models.Account, error)
+	ChallengeTTL() time.Duration
+}
+
+type Config struct {
+	Issuer            string
+	Skew              int // допустимое расхождение часов в шагах TOTP
+	ChallengeTTL      time.Duration
+	MaxAttempts       int // попыток ввода кода на один mfa токен
+	RecoveryCodes     int
+	WithdrawThreshold float64 // списания больше этой суммы требуют TOTP код
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Issuer:            "Gophermart",
+		Skew:              1,
+		ChallengeTTL:      time.Minute * 5,
+		MaxAttempts:       5,
+		RecoveryCodes:     10,
+		WithdrawThreshold: 1000,
+	}
+}
+
+func NewAuthenticator(repo repository.Repository, config Config) Authenticator {
+	return &authenticator{repo, config}
+}
+
+type authenticator struct {
+	repo   repository.Repository
+	config Config
+}
+
+func (a *authenticator) Enabled(ctx context.Context, userID int64) (bool, error) {
+	totp, err := a.repo.SelectTOTP(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return totp.Enabled, nil
+}
+
+func (a *authenticator) Setup(ctx context.Context, userID int64) (models.TOTPSetup, error) {
+	// Имя в приложении - текущий логин, в токене он может быть устаревшим после переименования
+	account, err := a.repo.SelectAccount(ctx, userID)
+	if err != nil {
+		return models.TOTPSetup{}, err
+	}
+	secret, err := GenerateSecret()
+	if err != nil {
+		return models.TOTPSetup{}, err
+	}
+	if err = a.repo.UpdateTOTPSecret(ctx, userID, secret); err != nil {
+		return models.TOTPSetup{}, err
+	}
+	return models.TOTPSetup{Secret: secret, ProvisioningURI: ProvisioningURI(secret, a.config.Issuer, account.Login)}, nil
+}
+
+func (a *authenticator) Enable(ctx context.Context, userID int64, code string) ([]string, error) {
+	totp, err := a.repo.SelectTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if totp.Enabled {
+		return nil, apperrors.ErrTOTPEnabled
+	}
+	if totp.Secret == "" {
+		return nil, apperrors.ErrTOTPNotEnabled
+	}
+
+	counter, ok := Validate(totp.Secret, code, time.Now(), a.config.Skew)
+	if !ok {
+		return nil, apperrors.ErrInvalidTOTP
+	}
+
+	codes := make([]string, a.config.RecoveryCodes)
+	hashes := make([]string, a.config.RecoveryCodes)
+	for i := range codes {
+		if codes[i], err = newRecoveryCode(); err != nil {
+			return nil, err
+		}
+		hashes[i] = tokens.HashToken(normalizeRecoveryCode(codes[i]))
+	}
+
+	if err = a.repo.EnableTOTP(ctx, userID, counter, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (a *authenticator) Disable(ctx context.Context, userID int64, code string) error {
+	if err := a.Verify(ctx, userID, code, true); err != nil {
+		return err
+	}
+	return a.repo.DisableTOTP(ctx, userID)
+}
+
+func (a *authenticator) Verify(ctx context.Context, userID int64, code string, allowRecovery bool) error {
+	totp, err := a.repo.SelectTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !totp.Enabled {
+		return apperrors.ErrTOTPNotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if counter, ok := Validate(totp.Secret, code, time.Now(), a.config.Skew); ok {
+		return a.repo.UseTOTPCounter(ctx, userID, counter)
+	}
+	if !allowRecovery || code == "" {
+		return apperrors.ErrInvalidTOTP
+	}
+	return a.repo.UseRecoveryCode(ctx, userID, tokens.HashToken(normalizeRecoveryCode(code)), time.Now())
+}
+
+func (a *authenticator) RequiredForWithdraw(ctx context.Context, userID int64, sum float64) (bool, error) {
+	if sum <= a.config.WithdrawThreshold {
+		return false, nil
+	}
+	return a.Enabled(ctx, userID)
+}
+
+func (a *authenticator) NewChallenge(ctx context.Context, userID int64) (string, error) {
+	mfaToken, err := tokens.NewID()
+	if err != nil {
+		return "", err
+	}
+	err = a.repo.InsertMFAChallenge(ctx, tokens.HashToken(mfaToken), userID, time.Now().Add(a.config.ChallengeTTL))
+	if err != nil {
+		return "", err
+	}
+	return mfaToken, nil
+}
+
+func (a *authenticator) CompleteChallenge(ctx context.Context, mfaToken string, code string) (models.Account, error) {
+	tokenHash := tokens.HashToken(mfaToken)
+	account, err := a.repo.UseMFAChallenge(ctx, tokenHash, a.config.MaxAttempts, time.Now())
+	if err != nil {
+		return account, err
+	}
+
+	if err = a.Verify(ctx, account.ID, code, true); err != nil {
+		return account, err
+	}
+	return account, a.repo.DeleteMFAChallenge(ctx, tokenHash)
+}
+
+func (a *authenticator) ChallengeTTL() time.Duration {
+	return a.config.ChallengeTTL
+}
+
+// internal
+
+// newRecoveryCode - 8 символов base32 в виде xxxx-xxxx
+func newRecoveryCode() (string, error) {
+	buf := make([]byte, 5)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(secretEncoding.EncodeToString(buf))
+	return code[:4] + "-" + code[4:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// IsInvalidCode - ошибки, вызванные неверным вводом пользователя
+func IsInvalidCode(err error) bool {
+	return errors.Is(err, apperrors.ErrInvalidTOTP) || errors.Is(err, apperrors.ErrTOTPNotEnabled)
+}
@@ -0,0 +1,188 @@
+package mfa
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/mocks"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/gophermart/internal/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+var alice = models.Account{ID: 1, Login: "alice", Role: models.RoleUser}
+
+func TestAuthenticator_Setup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	a := NewAuthenticator(repo, DefaultConfig())
+
+	// В URI попадает текущий логин из БД
+	repo.EXPECT().SelectAccount(gomock.Any(), alice.ID).Return(alice, nil).Times(1)
+	repo.EXPECT().UpdateTOTPSecret(gomock.Any(), alice.ID, gomock.Any()).Return(nil).Times(1)
+
+	setup, err := a.Setup(context.Background(), alice.ID)
+	require.NoError(t, err)
+	assert.Contains(t, setup.ProvisioningURI, "Gophermart:alice")
+	assert.Contains(t, setup.ProvisioningURI, "secret="+setup.Secret)
+}
+
+func TestAuthenticator_Enable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	a := NewAuthenticator(repo, DefaultConfig())
+
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	code, err := Code(secret, Counter(time.Now()))
+	require.NoError(t, err)
+
+	t.Run("Wrong code", func(t *testing.T) {
+		repo.EXPECT().SelectTOTP(gomock.Any(), alice.ID).Return(models.TOTP{Secret: secret}, nil).Times(1)
+
+		_, err := a.Enable(context.Background(), alice.ID, "000000")
+		assert.ErrorIs(t, err, apperrors.ErrInvalidTOTP)
+	})
+
+	t.Run("Setup not started", func(t *testing.T) {
+		repo.EXPECT().SelectTOTP(gomock.Any(), alice.ID).Return(models.TOTP{}, nil).Times(1)
+
+		_, err := a.Enable(context.Background(), alice.ID, code)
+		assert.ErrorIs(t, err, apperrors.ErrTOTPNotEnabled)
+	})
+
+	t.Run("Recovery codes are stored hashed", func(t *testing.T) {
+		var hashes []string
+		repo.EXPECT().SelectTOTP(gomock.Any(), alice.ID).Return(models.TOTP{Secret: secret}, nil).Times(1)
+		repo.EXPECT().
+			EnableTOTP(gomock.Any(), alice.ID, gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ int64, _ int64, codeHashes []string) error {
+				hashes = codeHashes
+				return nil
+			}).
+			Times(1)
+
+		codes, err := a.Enable(context.Background(), alice.ID, code)
+		require.NoError(t, err)
+		require.Len(t, codes, DefaultConfig().RecoveryCodes)
+		assert.Regexp(t, `^[a-z2-7]{4}-[a-z2-7]{4}$`, codes[0])
+		assert.Equal(t, tokens.HashToken(normalizeRecoveryCode(codes[0])), hashes[0])
+	})
+}
+
+func TestAuthenticator_Verify(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	a := NewAuthenticator(repo, DefaultConfig())
+
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	counter := Counter(time.Now())
+	code, err := Code(secret, counter)
+	require.NoError(t, err)
+	enabled := models.TOTP{Secret: secret, Enabled: true}
+
+	t.Run("TOTP code", func(t *testing.T) {
+		repo.EXPECT().SelectTOTP(gomock.Any(), alice.ID).Return(enabled, nil).Times(1)
+		repo.EXPECT().UseTOTPCounter(gomock.Any(), alice.ID, counter).Return(nil).Times(1)
+
+		assert.NoError(t, a.Verify(context.Background(), alice.ID, code, false))
+	})
+
+	t.Run("Reused TOTP code", func(t *testing.T) {
+		repo.EXPECT().SelectTOTP(gomock.Any(), alice.ID).Return(enabled, nil).Times(1)
+		repo.EXPECT().UseTOTPCounter(gomock.Any(), alice.ID, counter).Return(apperrors.ErrInvalidTOTP).Times(1)
+
+		assert.ErrorIs(t, a.Verify(context.Background(), alice.ID, code, false), apperrors.ErrInvalidTOTP)
+	})
+
+	t.Run("Recovery code", func(t *testing.T) {
+		repo.EXPECT().SelectTOTP(gomock.Any(), alice.ID).Return(enabled, nil).Times(1)
+		repo.EXPECT().UseRecoveryCode(gomock.Any(), alice.ID, tokens.HashToken("abcdefgh"), gomock.Any()).Return(nil).Times(1)
+
+		assert.NoError(t, a.Verify(context.Background(), alice.ID, "ABCD-EFGH", true))
+	})
+
+	t.Run("Recovery code not allowed", func(t *testing.T) {
+		repo.EXPECT().SelectTOTP(gomock.Any(), alice.ID).Return(enabled, nil).Times(1)
+
+		assert.ErrorIs(t, a.Verify(context.Background(), alice.ID, "abcd-efgh", false), apperrors.ErrInvalidTOTP)
+	})
+
+	t.Run("Not enabled", func(t *testing.T) {
+		repo.EXPECT().SelectTOTP(gomock.Any(), alice.ID).Return(models.TOTP{Secret: secret}, nil).Times(1)
+
+		assert.ErrorIs(t, a.Verify(context.Background(), alice.ID, code, true), apperrors.ErrTOTPNotEnabled)
+	})
+}
+
+func TestAuthenticator_CompleteChallenge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	config := DefaultConfig()
+	a := NewAuthenticator(repo, config)
+
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	code, err := Code(secret, Counter(time.Now()))
+	require.NoError(t, err)
+	tokenHash := tokens.HashToken("mfa_token")
+
+	t.Run("Valid code consumes challenge", func(t *testing.T) {
+		repo.EXPECT().UseMFAChallenge(gomock.Any(), tokenHash, config.MaxAttempts, gomock.Any()).Return(alice, nil).Times(1)
+		repo.EXPECT().SelectTOTP(gomock.Any(), alice.ID).Return(models.TOTP{Secret: secret, Enabled: true}, nil).Times(1)
+		repo.EXPECT().UseTOTPCounter(gomock.Any(), alice.ID, gomock.Any()).Return(nil).Times(1)
+		repo.EXPECT().DeleteMFAChallenge(gomock.Any(), tokenHash).Return(nil).Times(1)
+
+		account, err := a.CompleteChallenge(context.Background(), "mfa_token", code)
+		assert.NoError(t, err)
+		assert.Equal(t, alice, account)
+	})
+
+	t.Run("Wrong code keeps challenge", func(t *testing.T) {
+		repo.EXPECT().UseMFAChallenge(gomock.Any(), tokenHash, config.MaxAttempts, gomock.Any()).Return(alice, nil).Times(1)
+		repo.EXPECT().SelectTOTP(gomock.Any(), alice.ID).Return(models.TOTP{Secret: secret, Enabled: true}, nil).Times(1)
+		repo.EXPECT().UseRecoveryCode(gomock.Any(), alice.ID, gomock.Any(), gomock.Any()).Return(apperrors.ErrInvalidTOTP).Times(1)
+
+		account, err := a.CompleteChallenge(context.Background(), "mfa_token", "wrong")
+		assert.ErrorIs(t, err, apperrors.ErrInvalidTOTP)
+		assert.Equal(t, alice, account)
+	})
+
+	t.Run("Expired challenge", func(t *testing.T) {
+		repo.EXPECT().UseMFAChallenge(gomock.Any(), tokenHash, config.MaxAttempts, gomock.Any()).Return(models.Account{}, apperrors.ErrInvalidMFAToken).Times(1)
+
+		_, err := a.CompleteChallenge(context.Background(), "mfa_token", code)
+		assert.ErrorIs(t, err, apperrors.ErrInvalidMFAToken)
+	})
+}
+
+func TestAuthenticator_RequiredForWithdraw(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	config := DefaultConfig()
+	config.WithdrawThreshold = 100
+	a := NewAuthenticator(repo, config)
+
+	required, err := a.RequiredForWithdraw(context.Background(), alice.ID, 100)
+	assert.NoError(t, err)
+	assert.False(t, required)
+
+	repo.EXPECT().SelectTOTP(gomock.Any(), alice.ID).Return(models.TOTP{Enabled: true}, nil).Times(1)
+	required, err = a.RequiredForWithdraw(context.Background(), alice.ID, 100.01)
+	assert.NoError(t, err)
+	assert.True(t, required)
+}
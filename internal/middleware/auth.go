@@ -1,33 +1,91 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/apperrors"
 	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/gophermart/internal/tokens"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 )
 
+// Auth принимает Bearer JWT, API ключ в заголовке X-Api-Key или JWT в cookie.
+// Запросы с cookie, изменяющие состояние, должны передать CSRF токен.
 func (m *middleware) Auth(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(ctx echo.Context) error {
-		authHeader := ctx.Request().Header.Get("Authorization")
-		if authHeader == "" {
+		if apiKey := ctx.Request().Header.Get("X-Api-Key"); apiKey != "" {
+			return m.authAPIKey(ctx, next, apiKey)
+		}
+
+		var tokenStr string
+		if authHeader := ctx.Request().Header.Get("Authorization"); authHeader != "" {
+			tokenStr = strings.TrimPrefix(authHeader, "Bearer ")
+		} else if tokenStr = m.cookies.AccessToken(ctx); tokenStr != "" {
+			if !isSafeMethod(ctx.Request().Method) && !m.cookies.ValidCSRF(ctx) {
+				return ctx.JSON(http.StatusForbidden, map[string]string{"error": apperrors.ErrCSRF.Error()})
+			}
+		} else {
 			return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": "Authorization header required"})
 		}
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
 
 		claims := &models.UserClaims{}
 		token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			kid, _ := token.Header["kid"].(string)
+			key, err := m.keys.VerificationKey(kid)
+			if err != nil {
+				return nil, err
+			}
+			// Алгоритм задаёт ключ, а не заголовок токена
+			if token.Method.Alg() != key.Method.Alg() {
 				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 			}
-			return m.secretKey, nil
+			return key.VerifyKey(), nil
 		})
-		if err != nil || !token.Valid {
+		// Токены без uid выпущены до перехода на ID пользователя, клиент получит новый через refresh
+		if err != nil || !token.Valid || claims.ID == "" || claims.UserID == 0 {
 			return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid token"})
 		}
+
+		revoked, err := m.revoker.IsRevoked(ctx.Request().Context(), claims)
+		if err != nil {
+			log.Printf("Failed to check token revocation: %v", err)
+			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+		}
+		if revoked {
+			return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": "Token revoked"})
+		}
+
+		ctx.Set("user_id", claims.UserID)
 		ctx.Set("user_login", claims.UserLogin)
+		ctx.Set("user_role", claims.UserRole())
+		ctx.Set("user_claims", claims)
 		return next(ctx)
 	}
 }
+
+func (m *middleware) authAPIKey(ctx echo.Context, next echo.HandlerFunc, apiKey string) error {
+	account, scopes, err := m.repo.UseAPIKey(ctx.Request().Context(), tokens.HashToken(apiKey), time.Now())
+	if err != nil {
+		if errors.Is(err, apperrors.ErrInvalidAPIKey) {
+			return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid API key"})
+		}
+		log.Printf("Failed to check API key: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": apperrors.ErrServer.Error()})
+	}
+
+	// API ключ действует только с правами обычного пользователя
+	ctx.Set("user_id", account.ID)
+	ctx.Set("user_login", account.Login)
+	ctx.Set("user_role", models.RoleUser)
+	ctx.Set("api_key_scopes", scopes)
+	return next(ctx)
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
@@ -2,17 +2,27 @@ package middleware
 
 import (
 	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/cookieauth"
+	"github.com/llaxzi/gophermart/internal/keyring"
+	"github.com/llaxzi/gophermart/internal/repository"
+	"github.com/llaxzi/gophermart/internal/revocation"
 )
 
 type Middleware interface {
 	Auth(next echo.HandlerFunc) echo.HandlerFunc
 	Gzip(next echo.HandlerFunc) echo.HandlerFunc
+	RequireScope(scope string) echo.MiddlewareFunc
+	RequireJWT(next echo.HandlerFunc) echo.HandlerFunc
+	RequireRole(roles ...string) echo.MiddlewareFunc
 }
 
-func NewMiddleware(secretKey []byte) Middleware {
-	return &middleware{secretKey}
+func NewMiddleware(keys keyring.Keyring, revoker revocation.Checker, repo repository.Repository, cookies cookieauth.Manager) Middleware {
+	return &middleware{keys, revoker, repo, cookies}
 }
 
 type middleware struct {
-	secretKey []byte
+	keys    keyring.Keyring
+	revoker revocation.Checker
+	repo    repository.Repository
+	cookies cookieauth.Manager
 }
@@ -3,8 +3,18 @@ package middleware
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
 	"encoding/json"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/golang/mock/gomock"
 	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/cookieauth"
+	"github.com/llaxzi/gophermart/internal/keyring"
+	"github.com/llaxzi/gophermart/internal/mocks"
+	"github.com/llaxzi/gophermart/internal/models"
 	"github.com/llaxzi/gophermart/internal/tokens"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -16,9 +26,14 @@ import (
 )
 
 func TestMiddleware_Auth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
 
-	tokenB := tokens.NewTokenBuilder([]byte("test"), time.Minute)
-	mw := NewMiddleware([]byte("test"))
+	revoker := mocks.NewMockChecker(ctrl)
+	repo := mocks.NewMockRepository(ctrl)
+	keys := keyring.NewStatic(keyring.Key{ID: "current", Secret: []byte("test")}, keyring.Key{ID: "retired", Secret: []byte("old"), Retired: true})
+	tokenB := tokens.NewTokenBuilder(keys, time.Minute, time.Hour)
+	mw := NewMiddleware(keys, revoker, repo, cookieauth.NewManager(cookieauth.Config{}))
 
 	e := echo.New()
 	nextHandler := func(ctx echo.Context) error {
@@ -62,7 +77,7 @@ func TestMiddleware_Auth(t *testing.T) {
 
 	t.Run("Valid Token", func(t *testing.T) {
 		login := "test_user"
-		validToken, err := tokenB.BuildJWTString(login)
+		validToken, err := tokenB.BuildJWTString(models.TokenSubject{UserID: 1, Login: login, Role: models.RoleAdmin, SessionID: "session"})
 		assert.NoError(t, err)
 
 		req := httptest.NewRequest(http.MethodGet, "/", nil)
@@ -70,21 +85,375 @@ func TestMiddleware_Auth(t *testing.T) {
 		rec := httptest.NewRecorder()
 		ctx := e.NewContext(req, rec)
 
+		revoker.EXPECT().IsRevoked(gomock.Any(), gomock.Any()).Return(false, nil).Times(1)
+
 		handler := mw.Auth(nextHandler)
 		err = handler(ctx)
 
 		require.NoError(t, err)
 		assert.Equal(t, http.StatusOK, rec.Code)
 
+		assert.Equal(t, int64(1), ctx.Get("user_id"))
 		userLogin := ctx.Get("user_login")
 		assert.Equal(t, login, userLogin)
+		assert.Equal(t, models.RoleAdmin, ctx.Get("user_role"))
+
+		claims, ok := ctx.Get("user_claims").(*models.UserClaims)
+		require.True(t, ok)
+		assert.NotEmpty(t, claims.ID)
+	})
+
+	t.Run("Token Without User ID", func(t *testing.T) {
+		// Токен, выпущенный до перехода на ID пользователя
+		legacyToken, err := tokenB.BuildJWTString(models.TokenSubject{Login: "test_user", Role: models.RoleUser})
+		assert.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+legacyToken)
+		rec := httptest.NewRecorder()
+		ctx := e.NewContext(req, rec)
+
+		err = mw.Auth(nextHandler)(ctx)
+
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("Token Signed With Retired Key", func(t *testing.T) {
+		retiredB := tokens.NewTokenBuilder(keyring.NewStatic(keyring.Key{ID: "retired", Secret: []byte("old")}), time.Minute, time.Hour)
+		retiredToken, err := retiredB.BuildJWTString(models.TokenSubject{UserID: 1, Login: "test_user", Role: models.RoleUser})
+		assert.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+retiredToken)
+		rec := httptest.NewRecorder()
+		ctx := e.NewContext(req, rec)
+
+		handler := mw.Auth(nextHandler)
+		err = handler(ctx)
+
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
 	})
 
+	t.Run("Asymmetric Keys", func(t *testing.T) {
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		_, edKey, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+
+		for _, key := range []keyring.Key{
+			{ID: "rsa", Method: jwt.SigningMethodRS256, Private: rsaKey, Public: &rsaKey.PublicKey},
+			{ID: "ed", Method: jwt.SigningMethodEdDSA, Private: edKey, Public: edKey.Public()},
+		} {
+			asymKeys := keyring.NewStatic(key)
+			asymMW := NewMiddleware(asymKeys, revoker, nil, cookieauth.NewManager(cookieauth.Config{}))
+			token, err := tokens.NewTokenBuilder(asymKeys, time.Minute, time.Hour).BuildJWTString(models.TokenSubject{UserID: 1, Login: "test_user", Role: models.RoleUser})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+
+			revoker.EXPECT().IsRevoked(gomock.Any(), gomock.Any()).Return(false, nil).Times(1)
+
+			err = asymMW.Auth(nextHandler)(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, rec.Code, key.Method.Alg())
+		}
+	})
+
+	t.Run("Algorithm Does Not Match Key", func(t *testing.T) {
+		// HS256 токен с kid RSA ключа не должен проверяться публичным ключом как секретом
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		asymKeys := keyring.NewStatic(keyring.Key{ID: "rsa", Method: jwt.SigningMethodRS256, Private: rsaKey, Public: &rsaKey.PublicKey})
+		forged := jwt.NewWithClaims(jwt.SigningMethodHS256, models.UserClaims{UserLogin: "test_user"})
+		forged.Header["kid"] = "rsa"
+		forgedStr, err := forged.SignedString([]byte("whatever"))
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+forgedStr)
+		rec := httptest.NewRecorder()
+		ctx := e.NewContext(req, rec)
+
+		err = NewMiddleware(asymKeys, revoker, nil, cookieauth.NewManager(cookieauth.Config{})).Auth(nextHandler)(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("Revoked Token", func(t *testing.T) {
+		revokedToken, err := tokenB.BuildJWTString(models.TokenSubject{UserID: 1, Login: "test_user", Role: models.RoleUser})
+		assert.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+revokedToken)
+		rec := httptest.NewRecorder()
+		ctx := e.NewContext(req, rec)
+
+		revoker.EXPECT().IsRevoked(gomock.Any(), gomock.Any()).Return(true, nil).Times(1)
+
+		handler := mw.Auth(nextHandler)
+		err = handler(ctx)
+
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		var resp map[string]string
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		require.NoError(t, err)
+		assert.Equal(t, "Token revoked", resp["error"])
+	})
+
+}
+
+func TestMiddleware_AuthAPIKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	mw := NewMiddleware(nil, nil, repo, cookieauth.NewManager(cookieauth.Config{}))
+
+	e := echo.New()
+	nextHandler := func(ctx echo.Context) error {
+		return ctx.JSON(http.StatusOK, map[string]string{"message": "Success"})
+	}
+
+	tests := []struct {
+		name           string
+		repoAccount    models.Account
+		repoScopes     []string
+		repoError      error
+		expectedStatus int
+	}{
+		{
+			name:           "Valid key",
+			repoAccount:    models.Account{ID: 1, Login: "test_user", Role: models.RoleAdmin},
+			repoScopes:     []string{models.ScopeOrdersWrite},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Unknown or revoked key",
+			repoError:      apperrors.ErrInvalidAPIKey,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Server error",
+			repoError:      apperrors.ErrPgConnExc,
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Api-Key", "gm_key")
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+
+			repo.EXPECT().
+				UseAPIKey(gomock.Any(), tokens.HashToken("gm_key"), gomock.Any()).
+				Return(test.repoAccount, test.repoScopes, test.repoError).
+				Times(1)
+
+			err := mw.Auth(nextHandler)(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+			if test.expectedStatus == http.StatusOK {
+				assert.Equal(t, test.repoAccount.ID, ctx.Get("user_id"))
+				assert.Equal(t, test.repoAccount.Login, ctx.Get("user_login"))
+				// API ключ не получает роль владельца
+				assert.Equal(t, models.RoleUser, ctx.Get("user_role"))
+				assert.Equal(t, test.repoScopes, ctx.Get("api_key_scopes"))
+				assert.Nil(t, ctx.Get("user_claims"))
+			}
+		})
+	}
+}
+
+func TestMiddleware_AuthCookie(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	revoker := mocks.NewMockChecker(ctrl)
+	keys := keyring.NewStatic(keyring.Key{ID: "current", Secret: []byte("test")})
+	tokenB := tokens.NewTokenBuilder(keys, time.Minute, time.Hour)
+	mw := NewMiddleware(keys, revoker, nil, cookieauth.NewManager(cookieauth.Config{Enabled: true}))
+
+	token, err := tokenB.BuildJWTString(models.TokenSubject{UserID: 1, Login: "test_user", Role: models.RoleUser, SessionID: "session"})
+	require.NoError(t, err)
+
+	e := echo.New()
+	nextHandler := func(ctx echo.Context) error {
+		return ctx.JSON(http.StatusOK, map[string]string{"message": "Success"})
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		csrfCookie     string
+		csrfHeader     string
+		expectedStatus int
+	}{
+		{
+			name:           "Safe method without CSRF token",
+			method:         http.MethodGet,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "State-changing request with CSRF token",
+			method:         http.MethodPost,
+			csrfCookie:     "csrf",
+			csrfHeader:     "csrf",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "State-changing request without CSRF header",
+			method:         http.MethodPost,
+			csrfCookie:     "csrf",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "CSRF header does not match cookie",
+			method:         http.MethodPost,
+			csrfCookie:     "csrf",
+			csrfHeader:     "forged",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, "/", nil)
+			req.AddCookie(&http.Cookie{Name: cookieauth.AccessCookie, Value: token})
+			if test.csrfCookie != "" {
+				req.AddCookie(&http.Cookie{Name: cookieauth.CSRFCookie, Value: test.csrfCookie})
+			}
+			if test.csrfHeader != "" {
+				req.Header.Set(cookieauth.CSRFHeader, test.csrfHeader)
+			}
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+
+			if test.expectedStatus == http.StatusOK {
+				revoker.EXPECT().IsRevoked(gomock.Any(), gomock.Any()).Return(false, nil).Times(1)
+			}
+
+			err := mw.Auth(nextHandler)(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+			if test.expectedStatus == http.StatusOK {
+				assert.Equal(t, "test_user", ctx.Get("user_login"))
+			}
+		})
+	}
+}
+
+func TestMiddleware_RequireScope(t *testing.T) {
+	mw := NewMiddleware(nil, nil, nil, cookieauth.NewManager(cookieauth.Config{}))
+
+	e := echo.New()
+	nextHandler := func(ctx echo.Context) error {
+		return ctx.JSON(http.StatusOK, map[string]string{"message": "Success"})
+	}
+
+	tests := []struct {
+		name            string
+		claims          *models.UserClaims
+		scopes          []string
+		expectedScope   int
+		expectedJWTOnly int
+	}{
+		{
+			name:            "JWT",
+			claims:          &models.UserClaims{UserLogin: "test_user"},
+			expectedScope:   http.StatusOK,
+			expectedJWTOnly: http.StatusOK,
+		},
+		{
+			name:            "API key without scopes",
+			scopes:          []string{},
+			expectedScope:   http.StatusOK,
+			expectedJWTOnly: http.StatusForbidden,
+		},
+		{
+			name:            "API key with scope",
+			scopes:          []string{models.ScopeBalanceRead, models.ScopeOrdersRead},
+			expectedScope:   http.StatusOK,
+			expectedJWTOnly: http.StatusForbidden,
+		},
+		{
+			name:            "API key without required scope",
+			scopes:          []string{models.ScopeOrdersWrite},
+			expectedScope:   http.StatusForbidden,
+			expectedJWTOnly: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newCtx := func() (echo.Context, *httptest.ResponseRecorder) {
+				rec := httptest.NewRecorder()
+				ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+				if test.claims != nil {
+					ctx.Set("user_claims", test.claims)
+				} else {
+					ctx.Set("api_key_scopes", test.scopes)
+				}
+				return ctx, rec
+			}
+
+			ctx, rec := newCtx()
+			require.NoError(t, mw.RequireScope(models.ScopeOrdersRead)(nextHandler)(ctx))
+			assert.Equal(t, test.expectedScope, rec.Code)
+
+			ctx, rec = newCtx()
+			require.NoError(t, mw.RequireJWT(nextHandler)(ctx))
+			assert.Equal(t, test.expectedJWTOnly, rec.Code)
+		})
+	}
+}
+
+func TestMiddleware_RequireRole(t *testing.T) {
+	mw := NewMiddleware(nil, nil, nil, cookieauth.NewManager(cookieauth.Config{}))
+
+	e := echo.New()
+	nextHandler := func(ctx echo.Context) error {
+		return ctx.JSON(http.StatusOK, map[string]string{"message": "Success"})
+	}
+
+	tests := []struct {
+		name           string
+		role           interface{}
+		expectedStatus int
+	}{
+		{name: "Admin", role: models.RoleAdmin, expectedStatus: http.StatusOK},
+		{name: "Support", role: models.RoleSupport, expectedStatus: http.StatusOK},
+		{name: "User", role: models.RoleUser, expectedStatus: http.StatusForbidden},
+		{name: "No role", role: nil, expectedStatus: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+			ctx.Set("user_role", test.role)
+
+			err := mw.RequireRole(models.RoleSupport, models.RoleAdmin)(nextHandler)(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, rec.Code)
+		})
+	}
 }
 
 func TestMiddleware_Gzip(t *testing.T) {
 	e := echo.New()
-	mw := NewMiddleware([]byte("test_secret"))
+	mw := NewMiddleware(nil, nil, nil, cookieauth.NewManager(cookieauth.Config{}))
 
 	nextHandler := func(c echo.Context) error {
 		return c.JSON(http.StatusOK, map[string]string{"message": "Success"})
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"net/http"
+)
+
+// RequireRole пропускает только пользователей с одной из ролей
+func (m *middleware) RequireRole(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			role, _ := ctx.Get("user_role").(string)
+			for _, r := range roles {
+				if r == role {
+					return next(ctx)
+				}
+			}
+			return ctx.JSON(http.StatusForbidden, map[string]string{"error": apperrors.ErrNoRole.Error()})
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/models"
+	"net/http"
+)
+
+// RequireScope пропускает запросы с JWT и запросы с API ключом, которому выдан scope.
+// Ключ без scopes не ограничен.
+func (m *middleware) RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			scopes, ok := ctx.Get("api_key_scopes").([]string)
+			if !ok || len(scopes) == 0 {
+				return next(ctx)
+			}
+			for _, s := range scopes {
+				if s == scope {
+					return next(ctx)
+				}
+			}
+			return ctx.JSON(http.StatusForbidden, map[string]string{"error": apperrors.ErrNoScope.Error()})
+		}
+	}
+}
+
+// RequireJWT закрывает управление аккаунтом от API ключей
+func (m *middleware) RequireJWT(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		if _, ok := ctx.Get("user_claims").(*models.UserClaims); !ok {
+			return ctx.JSON(http.StatusForbidden, map[string]string{"error": apperrors.ErrJWTRequired.Error()})
+		}
+		return next(ctx)
+	}
+}
@@ -0,0 +1,11 @@
+CREATE TABLE gophermart.refresh_tokens(
+    token_hash VARCHAR(64) PRIMARY KEY,
+    login VARCHAR(50) NOT NULL,
+    family_id VARCHAR(32) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    revoked BOOLEAN NOT NULL DEFAULT FALSE,
+    CONSTRAINT fk FOREIGN KEY (login) REFERENCES gophermart.users(login)
+);
+
+CREATE INDEX refresh_tokens_family_idx ON gophermart.refresh_tokens(family_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS gophermart.revoked_tokens;
+ALTER TABLE gophermart.users DROP COLUMN IF EXISTS tokens_revoked_at;
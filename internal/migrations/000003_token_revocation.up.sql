@@ -0,0 +1,10 @@
+ALTER TABLE gophermart.users ADD COLUMN tokens_revoked_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE gophermart.revoked_tokens(
+    jti VARCHAR(32) PRIMARY KEY,
+    login VARCHAR(50) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    CONSTRAINT fk FOREIGN KEY (login) REFERENCES gophermart.users(login)
+);
+
+CREATE INDEX revoked_tokens_expires_idx ON gophermart.revoked_tokens(expires_at);
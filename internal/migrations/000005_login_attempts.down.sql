@@ -0,0 +1 @@
+DROP TABLE IF EXISTS gophermart.login_attempts;
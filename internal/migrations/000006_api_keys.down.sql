@@ -0,0 +1 @@
+DROP TABLE IF EXISTS gophermart.api_keys;
\ No newline at end of file
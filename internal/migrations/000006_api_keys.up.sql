@@ -0,0 +1,13 @@
+CREATE TABLE gophermart.api_keys(
+    id VARCHAR(32) PRIMARY KEY,
+    login VARCHAR(50) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT fk FOREIGN KEY (login) REFERENCES gophermart.users(login)
+);
+
+CREATE UNIQUE INDEX api_keys_login_name_idx ON gophermart.api_keys(login, name) WHERE revoked_at IS NULL;
@@ -0,0 +1 @@
+ALTER TABLE gophermart.users DROP COLUMN IF EXISTS role;
\ No newline at end of file
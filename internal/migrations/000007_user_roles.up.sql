@@ -0,0 +1,2 @@
+ALTER TABLE gophermart.users ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'user'
+    CONSTRAINT users_role_check CHECK (role IN ('user', 'support', 'admin'));
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS gophermart.mfa_challenges;
+DROP TABLE IF EXISTS gophermart.totp_recovery_codes;
+ALTER TABLE gophermart.users DROP COLUMN IF EXISTS totp_last_counter;
+ALTER TABLE gophermart.users DROP COLUMN IF EXISTS totp_enabled;
+ALTER TABLE gophermart.users DROP COLUMN IF EXISTS totp_secret;
@@ -0,0 +1,19 @@
+ALTER TABLE gophermart.users ADD COLUMN totp_secret VARCHAR(64);
+ALTER TABLE gophermart.users ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE gophermart.users ADD COLUMN totp_last_counter BIGINT;
+
+CREATE TABLE gophermart.totp_recovery_codes(
+    login VARCHAR(50) NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (login, code_hash),
+    CONSTRAINT fk FOREIGN KEY (login) REFERENCES gophermart.users(login)
+);
+
+CREATE TABLE gophermart.mfa_challenges(
+    token_hash VARCHAR(64) PRIMARY KEY,
+    login VARCHAR(50) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    CONSTRAINT fk FOREIGN KEY (login) REFERENCES gophermart.users(login)
+);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS gophermart.sessions;
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE gophermart.sessions(
+    id VARCHAR(32) PRIMARY KEY,
+    login VARCHAR(50) NOT NULL,
+    user_agent VARCHAR(256) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT fk FOREIGN KEY (login) REFERENCES gophermart.users(login)
+);
+
+CREATE INDEX sessions_login_idx ON gophermart.sessions(login);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS gophermart.oidc_states;
+DROP TABLE IF EXISTS gophermart.user_identities;
@@ -0,0 +1,64 @@
+-- Возврат к login как ключу пользователя
+
+ALTER TABLE gophermart.orders ADD COLUMN login VARCHAR(50);
+UPDATE gophermart.orders t SET login = u.login FROM gophermart.users u WHERE u.id = t.user_id;
+ALTER TABLE gophermart.orders DROP COLUMN user_id;
+
+ALTER TABLE gophermart.withdrawals ADD COLUMN login VARCHAR(50);
+UPDATE gophermart.withdrawals t SET login = u.login FROM gophermart.users u WHERE u.id = t.user_id;
+ALTER TABLE gophermart.withdrawals DROP COLUMN user_id;
+
+ALTER TABLE gophermart.refresh_tokens ADD COLUMN login VARCHAR(50);
+UPDATE gophermart.refresh_tokens t SET login = u.login FROM gophermart.users u WHERE u.id = t.user_id;
+ALTER TABLE gophermart.refresh_tokens DROP COLUMN user_id;
+
+ALTER TABLE gophermart.revoked_tokens ADD COLUMN login VARCHAR(50);
+UPDATE gophermart.revoked_tokens t SET login = u.login FROM gophermart.users u WHERE u.id = t.user_id;
+ALTER TABLE gophermart.revoked_tokens DROP COLUMN user_id;
+
+ALTER TABLE gophermart.api_keys ADD COLUMN login VARCHAR(50);
+UPDATE gophermart.api_keys t SET login = u.login FROM gophermart.users u WHERE u.id = t.user_id;
+ALTER TABLE gophermart.api_keys DROP COLUMN user_id;
+
+ALTER TABLE gophermart.totp_recovery_codes ADD COLUMN login VARCHAR(50);
+UPDATE gophermart.totp_recovery_codes t SET login = u.login FROM gophermart.users u WHERE u.id = t.user_id;
+ALTER TABLE gophermart.totp_recovery_codes DROP COLUMN user_id;
+
+ALTER TABLE gophermart.mfa_challenges ADD COLUMN login VARCHAR(50);
+UPDATE gophermart.mfa_challenges t SET login = u.login FROM gophermart.users u WHERE u.id = t.user_id;
+ALTER TABLE gophermart.mfa_challenges DROP COLUMN user_id;
+
+ALTER TABLE gophermart.sessions ADD COLUMN login VARCHAR(50);
+UPDATE gophermart.sessions t SET login = u.login FROM gophermart.users u WHERE u.id = t.user_id;
+ALTER TABLE gophermart.sessions DROP COLUMN user_id;
+
+ALTER TABLE gophermart.user_identities ADD COLUMN login VARCHAR(50);
+UPDATE gophermart.user_identities t SET login = u.login FROM gophermart.users u WHERE u.id = t.user_id;
+ALTER TABLE gophermart.user_identities DROP COLUMN user_id;
+
+ALTER TABLE gophermart.users DROP CONSTRAINT users_login_key;
+ALTER TABLE gophermart.users DROP CONSTRAINT users_pkey;
+ALTER TABLE gophermart.users ADD PRIMARY KEY (login);
+ALTER TABLE gophermart.users DROP COLUMN id;
+
+ALTER TABLE gophermart.orders ADD CONSTRAINT fk FOREIGN KEY (login) REFERENCES gophermart.users(login);
+ALTER TABLE gophermart.withdrawals ADD CONSTRAINT fk FOREIGN KEY (login) REFERENCES gophermart.users(login);
+ALTER TABLE gophermart.refresh_tokens ALTER COLUMN login SET NOT NULL;
+ALTER TABLE gophermart.refresh_tokens ADD CONSTRAINT fk FOREIGN KEY (login) REFERENCES gophermart.users(login);
+ALTER TABLE gophermart.revoked_tokens ALTER COLUMN login SET NOT NULL;
+ALTER TABLE gophermart.revoked_tokens ADD CONSTRAINT fk FOREIGN KEY (login) REFERENCES gophermart.users(login);
+ALTER TABLE gophermart.api_keys ALTER COLUMN login SET NOT NULL;
+ALTER TABLE gophermart.api_keys ADD CONSTRAINT fk FOREIGN KEY (login) REFERENCES gophermart.users(login);
+ALTER TABLE gophermart.totp_recovery_codes ALTER COLUMN login SET NOT NULL;
+ALTER TABLE gophermart.totp_recovery_codes ADD CONSTRAINT fk FOREIGN KEY (login) REFERENCES gophermart.users(login);
+ALTER TABLE gophermart.mfa_challenges ALTER COLUMN login SET NOT NULL;
+ALTER TABLE gophermart.mfa_challenges ADD CONSTRAINT fk FOREIGN KEY (login) REFERENCES gophermart.users(login);
+ALTER TABLE gophermart.sessions ALTER COLUMN login SET NOT NULL;
+ALTER TABLE gophermart.sessions ADD CONSTRAINT fk FOREIGN KEY (login) REFERENCES gophermart.users(login);
+ALTER TABLE gophermart.user_identities ALTER COLUMN login SET NOT NULL;
+ALTER TABLE gophermart.user_identities ADD CONSTRAINT fk FOREIGN KEY (login) REFERENCES gophermart.users(login);
+
+ALTER TABLE gophermart.totp_recovery_codes ADD PRIMARY KEY (login, code_hash);
+CREATE UNIQUE INDEX api_keys_login_name_idx ON gophermart.api_keys(login, name) WHERE revoked_at IS NULL;
+CREATE INDEX sessions_login_idx ON gophermart.sessions(login);
+CREATE INDEX user_identities_login_idx ON gophermart.user_identities(login);
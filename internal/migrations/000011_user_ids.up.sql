@@ -0,0 +1,76 @@
+-- Суррогатный ключ пользователя: логин можно менять, внешние ключи ссылаются на id
+ALTER TABLE gophermart.users ADD COLUMN id BIGSERIAL NOT NULL;
+
+ALTER TABLE gophermart.orders ADD COLUMN user_id BIGINT;
+UPDATE gophermart.orders t SET user_id = u.id FROM gophermart.users u WHERE u.login = t.login;
+ALTER TABLE gophermart.orders DROP COLUMN login;
+
+ALTER TABLE gophermart.withdrawals ADD COLUMN user_id BIGINT;
+UPDATE gophermart.withdrawals t SET user_id = u.id FROM gophermart.users u WHERE u.login = t.login;
+ALTER TABLE gophermart.withdrawals DROP COLUMN login;
+
+ALTER TABLE gophermart.refresh_tokens ADD COLUMN user_id BIGINT;
+UPDATE gophermart.refresh_tokens t SET user_id = u.id FROM gophermart.users u WHERE u.login = t.login;
+ALTER TABLE gophermart.refresh_tokens DROP COLUMN login;
+
+ALTER TABLE gophermart.revoked_tokens ADD COLUMN user_id BIGINT;
+UPDATE gophermart.revoked_tokens t SET user_id = u.id FROM gophermart.users u WHERE u.login = t.login;
+ALTER TABLE gophermart.revoked_tokens DROP COLUMN login;
+
+ALTER TABLE gophermart.api_keys ADD COLUMN user_id BIGINT;
+UPDATE gophermart.api_keys t SET user_id = u.id FROM gophermart.users u WHERE u.login = t.login;
+ALTER TABLE gophermart.api_keys DROP COLUMN login;
+
+ALTER TABLE gophermart.totp_recovery_codes ADD COLUMN user_id BIGINT;
+UPDATE gophermart.totp_recovery_codes t SET user_id = u.id FROM gophermart.users u WHERE u.login = t.login;
+ALTER TABLE gophermart.totp_recovery_codes DROP COLUMN login;
+
+ALTER TABLE gophermart.mfa_challenges ADD COLUMN user_id BIGINT;
+UPDATE gophermart.mfa_challenges t SET user_id = u.id FROM gophermart.users u WHERE u.login = t.login;
+ALTER TABLE gophermart.mfa_challenges DROP COLUMN login;
+
+ALTER TABLE gophermart.sessions ADD COLUMN user_id BIGINT;
+UPDATE gophermart.sessions t SET user_id = u.id FROM gophermart.users u WHERE u.login = t.login;
+ALTER TABLE gophermart.sessions DROP COLUMN login;
+
+ALTER TABLE gophermart.user_identities ADD COLUMN user_id BIGINT;
+UPDATE gophermart.user_identities t SET user_id = u.id FROM gophermart.users u WHERE u.login = t.login;
+ALTER TABLE gophermart.user_identities DROP COLUMN login;
+
+-- Внешние ключи на login удалены вместе со столбцами, первичный ключ можно перенести
+ALTER TABLE gophermart.users DROP CONSTRAINT users_pkey;
+ALTER TABLE gophermart.users ADD PRIMARY KEY (id);
+ALTER TABLE gophermart.users ADD CONSTRAINT users_login_key UNIQUE (login);
+
+ALTER TABLE gophermart.orders ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE gophermart.orders ADD CONSTRAINT fk FOREIGN KEY (user_id) REFERENCES gophermart.users(id);
+CREATE INDEX orders_user_idx ON gophermart.orders(user_id);
+
+ALTER TABLE gophermart.withdrawals ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE gophermart.withdrawals ADD CONSTRAINT fk FOREIGN KEY (user_id) REFERENCES gophermart.users(id);
+CREATE INDEX withdrawals_user_idx ON gophermart.withdrawals(user_id);
+
+ALTER TABLE gophermart.refresh_tokens ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE gophermart.refresh_tokens ADD CONSTRAINT fk FOREIGN KEY (user_id) REFERENCES gophermart.users(id);
+
+ALTER TABLE gophermart.revoked_tokens ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE gophermart.revoked_tokens ADD CONSTRAINT fk FOREIGN KEY (user_id) REFERENCES gophermart.users(id);
+
+ALTER TABLE gophermart.api_keys ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE gophermart.api_keys ADD CONSTRAINT fk FOREIGN KEY (user_id) REFERENCES gophermart.users(id);
+CREATE UNIQUE INDEX api_keys_user_name_idx ON gophermart.api_keys(user_id, name) WHERE revoked_at IS NULL;
+
+ALTER TABLE gophermart.totp_recovery_codes ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE gophermart.totp_recovery_codes ADD CONSTRAINT fk FOREIGN KEY (user_id) REFERENCES gophermart.users(id);
+ALTER TABLE gophermart.totp_recovery_codes ADD PRIMARY KEY (user_id, code_hash);
+
+ALTER TABLE gophermart.mfa_challenges ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE gophermart.mfa_challenges ADD CONSTRAINT fk FOREIGN KEY (user_id) REFERENCES gophermart.users(id);
+
+ALTER TABLE gophermart.sessions ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE gophermart.sessions ADD CONSTRAINT fk FOREIGN KEY (user_id) REFERENCES gophermart.users(id);
+CREATE INDEX sessions_user_idx ON gophermart.sessions(user_id);
+
+ALTER TABLE gophermart.user_identities ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE gophermart.user_identities ADD CONSTRAINT fk FOREIGN KEY (user_id) REFERENCES gophermart.users(id);
+CREATE INDEX user_identities_user_idx ON gophermart.user_identities(user_id);
@@ -0,0 +1,2 @@
+CREATE INDEX orders_user_idx ON gophermart.orders(user_id);
+DROP INDEX gophermart.orders_user_uploaded_idx;
@@ -0,0 +1,3 @@
+-- Keyset пагинация заказов пользователя по (uploaded_at, number), индекс по user_id становится лишним
+CREATE INDEX orders_user_uploaded_idx ON gophermart.orders(user_id, uploaded_at, number);
+DROP INDEX gophermart.orders_user_idx;
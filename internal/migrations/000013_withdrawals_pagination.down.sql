@@ -0,0 +1,2 @@
+CREATE INDEX withdrawals_user_idx ON gophermart.withdrawals(user_id);
+DROP INDEX gophermart.withdrawals_user_processed_idx;
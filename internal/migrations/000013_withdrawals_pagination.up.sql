@@ -0,0 +1,3 @@
+-- Keyset пагинация списаний по (processed_at, order_id), индекс по user_id становится лишним
+CREATE INDEX withdrawals_user_processed_idx ON gophermart.withdrawals(user_id, processed_at, order_id);
+DROP INDEX gophermart.withdrawals_user_idx;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS gophermart.order_status_history;
+ALTER TABLE gophermart.orders DROP COLUMN checked_at;
@@ -0,0 +1,15 @@
+ALTER TABLE gophermart.orders ADD COLUMN checked_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE gophermart.order_status_history(
+    id BIGSERIAL PRIMARY KEY,
+    order_number VARCHAR(255) NOT NULL,
+    status gophermart.status NOT NULL,
+    changed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    CONSTRAINT fk FOREIGN KEY (order_number) REFERENCES gophermart.orders(number) ON DELETE CASCADE
+);
+
+CREATE INDEX order_status_history_order_idx ON gophermart.order_status_history(order_number, changed_at);
+
+-- Прошлые переходы не сохранялись, для существующих заказов история начинается с текущего статуса
+INSERT INTO gophermart.order_status_history(order_number, status, changed_at)
+SELECT number, status, uploaded_at FROM gophermart.orders;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS gophermart.webhook_deliveries;
+DROP TYPE IF EXISTS gophermart.delivery_status;
+DROP TABLE IF EXISTS gophermart.webhooks;
@@ -0,0 +1,33 @@
+-- Секрет хранится открытым: он нужен для подписи каждой доставки
+CREATE TABLE gophermart.webhooks(
+    id VARCHAR(32) PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(128) NOT NULL,
+    events TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    CONSTRAINT fk FOREIGN KEY (user_id) REFERENCES gophermart.users(id)
+);
+
+CREATE INDEX webhooks_user_idx ON gophermart.webhooks(user_id);
+
+CREATE TYPE gophermart.delivery_status AS ENUM('PENDING','DELIVERED','DEAD');
+
+-- Очередь доставок, запись добавляется в той же транзакции, что и событие
+CREATE TABLE gophermart.webhook_deliveries(
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id VARCHAR(32) NOT NULL,
+    event VARCHAR(64) NOT NULL,
+    payload TEXT NOT NULL,
+    status gophermart.delivery_status NOT NULL DEFAULT 'PENDING',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE,
+    last_status_code INT,
+    last_error VARCHAR(512),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    delivered_at TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT fk FOREIGN KEY (webhook_id) REFERENCES gophermart.webhooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON gophermart.webhook_deliveries(next_attempt_at) WHERE status = 'PENDING';
+CREATE INDEX webhook_deliveries_webhook_idx ON gophermart.webhook_deliveries(webhook_id, id);
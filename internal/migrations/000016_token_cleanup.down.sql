@@ -0,0 +1 @@
+DROP INDEX IF EXISTS gophermart.refresh_tokens_expires_idx;
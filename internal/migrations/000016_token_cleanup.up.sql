@@ -0,0 +1 @@
+CREATE INDEX refresh_tokens_expires_idx ON gophermart.refresh_tokens(expires_at);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS gophermart.login_attempts_last_failure_idx;
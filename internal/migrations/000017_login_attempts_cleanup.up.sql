@@ -0,0 +1 @@
+CREATE INDEX login_attempts_last_failure_idx ON gophermart.login_attempts(last_failure_at);
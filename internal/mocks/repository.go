@@ -6,10 +6,10 @@ package mocks
 
 import (
 	context "context"
-	"github.com/golang/mock/gomock"
 	reflect "reflect"
+	time "time"
 
-
+	gomock "github.com/golang/mock/gomock"
 	models "github.com/llaxzi/gophermart/internal/models"
 )
 
@@ -50,6 +50,233 @@ func (mr *MockRepositoryMockRecorder) Bootstrap(dsn, steps interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Bootstrap", reflect.TypeOf((*MockRepository)(nil).Bootstrap), dsn, steps)
 }
 
+// ClaimWebhookDeliveries mocks base method.
+func (m *MockRepository) ClaimWebhookDeliveries(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]models.WebhookTask, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimWebhookDeliveries", ctx, now, leaseUntil, limit)
+	ret0, _ := ret[0].([]models.WebhookTask)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimWebhookDeliveries indicates an expected call of ClaimWebhookDeliveries.
+func (mr *MockRepositoryMockRecorder) ClaimWebhookDeliveries(ctx, now, leaseUntil, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimWebhookDeliveries", reflect.TypeOf((*MockRepository)(nil).ClaimWebhookDeliveries), ctx, now, leaseUntil, limit)
+}
+
+// CompleteWebhookDelivery mocks base method.
+func (m *MockRepository) CompleteWebhookDelivery(ctx context.Context, id int64, statusCode int, at time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompleteWebhookDelivery", ctx, id, statusCode, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CompleteWebhookDelivery indicates an expected call of CompleteWebhookDelivery.
+func (mr *MockRepositoryMockRecorder) CompleteWebhookDelivery(ctx, id, statusCode, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteWebhookDelivery", reflect.TypeOf((*MockRepository)(nil).CompleteWebhookDelivery), ctx, id, statusCode, at)
+}
+
+// DeleteExpiredTokens mocks base method.
+func (m *MockRepository) DeleteExpiredTokens(ctx context.Context, before time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteExpiredTokens", ctx, before)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteExpiredTokens indicates an expected call of DeleteExpiredTokens.
+func (mr *MockRepositoryMockRecorder) DeleteExpiredTokens(ctx, before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExpiredTokens", reflect.TypeOf((*MockRepository)(nil).DeleteExpiredTokens), ctx, before)
+}
+
+// DeleteLoginAttempts mocks base method.
+func (m *MockRepository) DeleteLoginAttempts(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteLoginAttempts", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteLoginAttempts indicates an expected call of DeleteLoginAttempts.
+func (mr *MockRepositoryMockRecorder) DeleteLoginAttempts(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteLoginAttempts", reflect.TypeOf((*MockRepository)(nil).DeleteLoginAttempts), ctx, key)
+}
+
+// DeleteMFAChallenge mocks base method.
+func (m *MockRepository) DeleteMFAChallenge(ctx context.Context, tokenHash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMFAChallenge", ctx, tokenHash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteMFAChallenge indicates an expected call of DeleteMFAChallenge.
+func (mr *MockRepositoryMockRecorder) DeleteMFAChallenge(ctx, tokenHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMFAChallenge", reflect.TypeOf((*MockRepository)(nil).DeleteMFAChallenge), ctx, tokenHash)
+}
+
+// DeleteStaleLoginAttempts mocks base method.
+func (m *MockRepository) DeleteStaleLoginAttempts(ctx context.Context, windowStart time.Time, now time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteStaleLoginAttempts", ctx, windowStart, now)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteStaleLoginAttempts indicates an expected call of DeleteStaleLoginAttempts.
+func (mr *MockRepositoryMockRecorder) DeleteStaleLoginAttempts(ctx, windowStart, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteStaleLoginAttempts", reflect.TypeOf((*MockRepository)(nil).DeleteStaleLoginAttempts), ctx, windowStart, now)
+}
+
+// DeleteUser mocks base method.
+func (m *MockRepository) DeleteUser(ctx context.Context, userID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockRepositoryMockRecorder) DeleteUser(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockRepository)(nil).DeleteUser), ctx, userID)
+}
+
+// DeleteWebhook mocks base method.
+func (m *MockRepository) DeleteWebhook(ctx context.Context, userID int64, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWebhook", ctx, userID, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteWebhook indicates an expected call of DeleteWebhook.
+func (mr *MockRepositoryMockRecorder) DeleteWebhook(ctx, userID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWebhook", reflect.TypeOf((*MockRepository)(nil).DeleteWebhook), ctx, userID, id)
+}
+
+// DisableTOTP mocks base method.
+func (m *MockRepository) DisableTOTP(ctx context.Context, userID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableTOTP", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DisableTOTP indicates an expected call of DisableTOTP.
+func (mr *MockRepositoryMockRecorder) DisableTOTP(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableTOTP", reflect.TypeOf((*MockRepository)(nil).DisableTOTP), ctx, userID)
+}
+
+// EnableTOTP mocks base method.
+func (m *MockRepository) EnableTOTP(ctx context.Context, userID int64, counter int64, codeHashes []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnableTOTP", ctx, userID, counter, codeHashes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnableTOTP indicates an expected call of EnableTOTP.
+func (mr *MockRepositoryMockRecorder) EnableTOTP(ctx, userID, counter, codeHashes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableTOTP", reflect.TypeOf((*MockRepository)(nil).EnableTOTP), ctx, userID, counter, codeHashes)
+}
+
+// FailWebhookDelivery mocks base method.
+func (m *MockRepository) FailWebhookDelivery(ctx context.Context, id int64, statusCode int, reason string, nextAttemptAt *time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FailWebhookDelivery", ctx, id, statusCode, reason, nextAttemptAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FailWebhookDelivery indicates an expected call of FailWebhookDelivery.
+func (mr *MockRepositoryMockRecorder) FailWebhookDelivery(ctx, id, statusCode, reason, nextAttemptAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FailWebhookDelivery", reflect.TypeOf((*MockRepository)(nil).FailWebhookDelivery), ctx, id, statusCode, reason, nextAttemptAt)
+}
+
+// IncrementLoginFailures mocks base method.
+func (m *MockRepository) IncrementLoginFailures(ctx context.Context, key string, at time.Time, windowStart time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementLoginFailures", ctx, key, at, windowStart)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IncrementLoginFailures indicates an expected call of IncrementLoginFailures.
+func (mr *MockRepositoryMockRecorder) IncrementLoginFailures(ctx, key, at, windowStart interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementLoginFailures", reflect.TypeOf((*MockRepository)(nil).IncrementLoginFailures), ctx, key, at, windowStart)
+}
+
+// InsertAPIKey mocks base method.
+func (m *MockRepository) InsertAPIKey(ctx context.Context, userID int64, key models.APIKey, keyHash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertAPIKey", ctx, userID, key, keyHash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertAPIKey indicates an expected call of InsertAPIKey.
+func (mr *MockRepositoryMockRecorder) InsertAPIKey(ctx, userID, key, keyHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertAPIKey", reflect.TypeOf((*MockRepository)(nil).InsertAPIKey), ctx, userID, key, keyHash)
+}
+
+// InsertFederatedUser mocks base method.
+func (m *MockRepository) InsertFederatedUser(ctx context.Context, userLogin string, identity models.OIDCIdentity) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertFederatedUser", ctx, userLogin, identity)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InsertFederatedUser indicates an expected call of InsertFederatedUser.
+func (mr *MockRepositoryMockRecorder) InsertFederatedUser(ctx, userLogin, identity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertFederatedUser", reflect.TypeOf((*MockRepository)(nil).InsertFederatedUser), ctx, userLogin, identity)
+}
+
+// InsertMFAChallenge mocks base method.
+func (m *MockRepository) InsertMFAChallenge(ctx context.Context, tokenHash string, userID int64, expiresAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertMFAChallenge", ctx, tokenHash, userID, expiresAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertMFAChallenge indicates an expected call of InsertMFAChallenge.
+func (mr *MockRepositoryMockRecorder) InsertMFAChallenge(ctx, tokenHash, userID, expiresAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertMFAChallenge", reflect.TypeOf((*MockRepository)(nil).InsertMFAChallenge), ctx, tokenHash, userID, expiresAt)
+}
+
+// InsertOIDCState mocks base method.
+func (m *MockRepository) InsertOIDCState(ctx context.Context, state models.OIDCState) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertOIDCState", ctx, state)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertOIDCState indicates an expected call of InsertOIDCState.
+func (mr *MockRepositoryMockRecorder) InsertOIDCState(ctx, state interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertOIDCState", reflect.TypeOf((*MockRepository)(nil).InsertOIDCState), ctx, state)
+}
+
 // InsertOrder mocks base method.
 func (m *MockRepository) InsertOrder(ctx context.Context, order models.Order) error {
 	m.ctrl.T.Helper()
@@ -64,20 +291,106 @@ func (mr *MockRepositoryMockRecorder) InsertOrder(ctx, order interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertOrder", reflect.TypeOf((*MockRepository)(nil).InsertOrder), ctx, order)
 }
 
-// InsertUser mocks base method.
-func (m *MockRepository) InsertUser(ctx context.Context, user models.User) error {
+// InsertOrders mocks base method.
+func (m *MockRepository) InsertOrders(ctx context.Context, userID int64, numbers []string, uploadedAt time.Time) (map[string]string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "InsertUser", ctx, user)
+	ret := m.ctrl.Call(m, "InsertOrders", ctx, userID, numbers, uploadedAt)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InsertOrders indicates an expected call of InsertOrders.
+func (mr *MockRepositoryMockRecorder) InsertOrders(ctx, userID, numbers, uploadedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertOrders", reflect.TypeOf((*MockRepository)(nil).InsertOrders), ctx, userID, numbers, uploadedAt)
+}
+
+// InsertRefreshToken mocks base method.
+func (m *MockRepository) InsertRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertRefreshToken", ctx, token)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
+// InsertRefreshToken indicates an expected call of InsertRefreshToken.
+func (mr *MockRepositoryMockRecorder) InsertRefreshToken(ctx, token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertRefreshToken", reflect.TypeOf((*MockRepository)(nil).InsertRefreshToken), ctx, token)
+}
+
+// InsertUser mocks base method.
+func (m *MockRepository) InsertUser(ctx context.Context, user models.User) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertUser", ctx, user)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // InsertUser indicates an expected call of InsertUser.
 func (mr *MockRepositoryMockRecorder) InsertUser(ctx, user interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertUser", reflect.TypeOf((*MockRepository)(nil).InsertUser), ctx, user)
 }
 
+// InsertWebhook mocks base method.
+func (m *MockRepository) InsertWebhook(ctx context.Context, userID int64, webhook models.Webhook, secret string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertWebhook", ctx, userID, webhook, secret)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertWebhook indicates an expected call of InsertWebhook.
+func (mr *MockRepositoryMockRecorder) InsertWebhook(ctx, userID, webhook, secret interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertWebhook", reflect.TypeOf((*MockRepository)(nil).InsertWebhook), ctx, userID, webhook, secret)
+}
+
+// LockLogin mocks base method.
+func (m *MockRepository) LockLogin(ctx context.Context, key string, until time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LockLogin", ctx, key, until)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LockLogin indicates an expected call of LockLogin.
+func (mr *MockRepositoryMockRecorder) LockLogin(ctx, key, until interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockLogin", reflect.TypeOf((*MockRepository)(nil).LockLogin), ctx, key, until)
+}
+
+// MarkOrderChecked mocks base method.
+func (m *MockRepository) MarkOrderChecked(ctx context.Context, number string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkOrderChecked", ctx, number)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkOrderChecked indicates an expected call of MarkOrderChecked.
+func (mr *MockRepositoryMockRecorder) MarkOrderChecked(ctx, number interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkOrderChecked", reflect.TypeOf((*MockRepository)(nil).MarkOrderChecked), ctx, number)
+}
+
+// Notify mocks base method.
+func (m *MockRepository) Notify(ctx context.Context, channel string, payload string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Notify", ctx, channel, payload)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Notify indicates an expected call of Notify.
+func (mr *MockRepositoryMockRecorder) Notify(ctx, channel, payload interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Notify", reflect.TypeOf((*MockRepository)(nil).Notify), ctx, channel, payload)
+}
+
 // ResetStatus mocks base method.
 func (m *MockRepository) ResetStatus(ctx context.Context, orderNumber string) error {
 	m.ctrl.T.Helper()
@@ -92,19 +405,178 @@ func (mr *MockRepositoryMockRecorder) ResetStatus(ctx, orderNumber interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetStatus", reflect.TypeOf((*MockRepository)(nil).ResetStatus), ctx, orderNumber)
 }
 
+// RevokeAPIKey mocks base method.
+func (m *MockRepository) RevokeAPIKey(ctx context.Context, userID int64, id string, at time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKey", ctx, userID, id, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAPIKey indicates an expected call of RevokeAPIKey.
+func (mr *MockRepositoryMockRecorder) RevokeAPIKey(ctx, userID, id, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKey", reflect.TypeOf((*MockRepository)(nil).RevokeAPIKey), ctx, userID, id, at)
+}
+
+// RevokeAllTokens mocks base method.
+func (m *MockRepository) RevokeAllTokens(ctx context.Context, userID int64, at time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAllTokens", ctx, userID, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAllTokens indicates an expected call of RevokeAllTokens.
+func (mr *MockRepositoryMockRecorder) RevokeAllTokens(ctx, userID, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAllTokens", reflect.TypeOf((*MockRepository)(nil).RevokeAllTokens), ctx, userID, at)
+}
+
+// RevokeRefreshFamily mocks base method.
+func (m *MockRepository) RevokeRefreshFamily(ctx context.Context, tokenHash string, userID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeRefreshFamily", ctx, tokenHash, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeRefreshFamily indicates an expected call of RevokeRefreshFamily.
+func (mr *MockRepositoryMockRecorder) RevokeRefreshFamily(ctx, tokenHash, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeRefreshFamily", reflect.TypeOf((*MockRepository)(nil).RevokeRefreshFamily), ctx, tokenHash, userID)
+}
+
+// RevokeSession mocks base method.
+func (m *MockRepository) RevokeSession(ctx context.Context, userID int64, id string, at time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeSession", ctx, userID, id, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeSession indicates an expected call of RevokeSession.
+func (mr *MockRepositoryMockRecorder) RevokeSession(ctx, userID, id, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeSession", reflect.TypeOf((*MockRepository)(nil).RevokeSession), ctx, userID, id, at)
+}
+
+// RevokeToken mocks base method.
+func (m *MockRepository) RevokeToken(ctx context.Context, jti string, userID int64, expiresAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeToken", ctx, jti, userID, expiresAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeToken indicates an expected call of RevokeToken.
+func (mr *MockRepositoryMockRecorder) RevokeToken(ctx, jti, userID, expiresAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeToken", reflect.TypeOf((*MockRepository)(nil).RevokeToken), ctx, jti, userID, expiresAt)
+}
+
+// SaveSession mocks base method.
+func (m *MockRepository) SaveSession(ctx context.Context, session models.Session) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveSession", ctx, session)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveSession indicates an expected call of SaveSession.
+func (mr *MockRepositoryMockRecorder) SaveSession(ctx, session interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveSession", reflect.TypeOf((*MockRepository)(nil).SaveSession), ctx, session)
+}
+
+// SelectAPIKeys mocks base method.
+func (m *MockRepository) SelectAPIKeys(ctx context.Context, userID int64) ([]models.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectAPIKeys", ctx, userID)
+	ret0, _ := ret[0].([]models.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectAPIKeys indicates an expected call of SelectAPIKeys.
+func (mr *MockRepositoryMockRecorder) SelectAPIKeys(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectAPIKeys", reflect.TypeOf((*MockRepository)(nil).SelectAPIKeys), ctx, userID)
+}
+
+// SelectAccount mocks base method.
+func (m *MockRepository) SelectAccount(ctx context.Context, userID int64) (models.Account, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectAccount", ctx, userID)
+	ret0, _ := ret[0].(models.Account)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectAccount indicates an expected call of SelectAccount.
+func (mr *MockRepositoryMockRecorder) SelectAccount(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectAccount", reflect.TypeOf((*MockRepository)(nil).SelectAccount), ctx, userID)
+}
+
 // SelectBalance mocks base method.
-func (m *MockRepository) SelectBalance(ctx context.Context, userLogin string) (models.Balance, error) {
+func (m *MockRepository) SelectBalance(ctx context.Context, userID int64) (models.Balance, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SelectBalance", ctx, userLogin)
+	ret := m.ctrl.Call(m, "SelectBalance", ctx, userID)
 	ret0, _ := ret[0].(models.Balance)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // SelectBalance indicates an expected call of SelectBalance.
-func (mr *MockRepositoryMockRecorder) SelectBalance(ctx, userLogin interface{}) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) SelectBalance(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectBalance", reflect.TypeOf((*MockRepository)(nil).SelectBalance), ctx, userID)
+}
+
+// SelectIdentities mocks base method.
+func (m *MockRepository) SelectIdentities(ctx context.Context, userID int64) ([]models.OIDCIdentity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectIdentities", ctx, userID)
+	ret0, _ := ret[0].([]models.OIDCIdentity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectIdentities indicates an expected call of SelectIdentities.
+func (mr *MockRepositoryMockRecorder) SelectIdentities(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectIdentities", reflect.TypeOf((*MockRepository)(nil).SelectIdentities), ctx, userID)
+}
+
+// SelectIdentityAccount mocks base method.
+func (m *MockRepository) SelectIdentityAccount(ctx context.Context, issuer string, subject string) (models.Account, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectIdentityAccount", ctx, issuer, subject)
+	ret0, _ := ret[0].(models.Account)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectIdentityAccount indicates an expected call of SelectIdentityAccount.
+func (mr *MockRepositoryMockRecorder) SelectIdentityAccount(ctx, issuer, subject interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectBalance", reflect.TypeOf((*MockRepository)(nil).SelectBalance), ctx, userLogin)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectIdentityAccount", reflect.TypeOf((*MockRepository)(nil).SelectIdentityAccount), ctx, issuer, subject)
+}
+
+// SelectLockedUntil mocks base method.
+func (m *MockRepository) SelectLockedUntil(ctx context.Context, keys []string) (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectLockedUntil", ctx, keys)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectLockedUntil indicates an expected call of SelectLockedUntil.
+func (mr *MockRepositoryMockRecorder) SelectLockedUntil(ctx, keys interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectLockedUntil", reflect.TypeOf((*MockRepository)(nil).SelectLockedUntil), ctx, keys)
 }
 
 // SelectNewOrders mocks base method.
@@ -122,49 +594,261 @@ func (mr *MockRepositoryMockRecorder) SelectNewOrders(ctx interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectNewOrders", reflect.TypeOf((*MockRepository)(nil).SelectNewOrders), ctx)
 }
 
+// SelectOrder mocks base method.
+func (m *MockRepository) SelectOrder(ctx context.Context, userID int64, number string) (models.OrderDetail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectOrder", ctx, userID, number)
+	ret0, _ := ret[0].(models.OrderDetail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectOrder indicates an expected call of SelectOrder.
+func (mr *MockRepositoryMockRecorder) SelectOrder(ctx, userID, number interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectOrder", reflect.TypeOf((*MockRepository)(nil).SelectOrder), ctx, userID, number)
+}
+
 // SelectOrders mocks base method.
-func (m *MockRepository) SelectOrders(ctx context.Context, userLogin string) ([]models.OrderResponse, error) {
+func (m *MockRepository) SelectOrders(ctx context.Context, userID int64) ([]models.OrderResponse, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SelectOrders", ctx, userLogin)
+	ret := m.ctrl.Call(m, "SelectOrders", ctx, userID)
 	ret0, _ := ret[0].([]models.OrderResponse)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // SelectOrders indicates an expected call of SelectOrders.
-func (mr *MockRepositoryMockRecorder) SelectOrders(ctx, userLogin interface{}) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) SelectOrders(ctx, userID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectOrders", reflect.TypeOf((*MockRepository)(nil).SelectOrders), ctx, userLogin)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectOrders", reflect.TypeOf((*MockRepository)(nil).SelectOrders), ctx, userID)
 }
 
-// SelectUser mocks base method.
-func (m *MockRepository) SelectUser(ctx context.Context, userLogin string) (string, error) {
+// SelectOrdersPage mocks base method.
+func (m *MockRepository) SelectOrdersPage(ctx context.Context, userID int64, filter models.OrderFilter) ([]models.OrderResponse, *models.Cursor, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SelectUser", ctx, userLogin)
+	ret := m.ctrl.Call(m, "SelectOrdersPage", ctx, userID, filter)
+	ret0, _ := ret[0].([]models.OrderResponse)
+	ret1, _ := ret[1].(*models.Cursor)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// SelectOrdersPage indicates an expected call of SelectOrdersPage.
+func (mr *MockRepositoryMockRecorder) SelectOrdersPage(ctx, userID, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectOrdersPage", reflect.TypeOf((*MockRepository)(nil).SelectOrdersPage), ctx, userID, filter)
+}
+
+// SelectPassword mocks base method.
+func (m *MockRepository) SelectPassword(ctx context.Context, userID int64) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectPassword", ctx, userID)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
+// SelectPassword indicates an expected call of SelectPassword.
+func (mr *MockRepositoryMockRecorder) SelectPassword(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectPassword", reflect.TypeOf((*MockRepository)(nil).SelectPassword), ctx, userID)
+}
+
+// SelectProfile mocks base method.
+func (m *MockRepository) SelectProfile(ctx context.Context, userID int64) (models.Profile, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectProfile", ctx, userID)
+	ret0, _ := ret[0].(models.Profile)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectProfile indicates an expected call of SelectProfile.
+func (mr *MockRepositoryMockRecorder) SelectProfile(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectProfile", reflect.TypeOf((*MockRepository)(nil).SelectProfile), ctx, userID)
+}
+
+// SelectSessionHistory mocks base method.
+func (m *MockRepository) SelectSessionHistory(ctx context.Context, userID int64) ([]models.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectSessionHistory", ctx, userID)
+	ret0, _ := ret[0].([]models.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectSessionHistory indicates an expected call of SelectSessionHistory.
+func (mr *MockRepositoryMockRecorder) SelectSessionHistory(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectSessionHistory", reflect.TypeOf((*MockRepository)(nil).SelectSessionHistory), ctx, userID)
+}
+
+// SelectSessions mocks base method.
+func (m *MockRepository) SelectSessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectSessions", ctx, userID)
+	ret0, _ := ret[0].([]models.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectSessions indicates an expected call of SelectSessions.
+func (mr *MockRepositoryMockRecorder) SelectSessions(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectSessions", reflect.TypeOf((*MockRepository)(nil).SelectSessions), ctx, userID)
+}
+
+// SelectTOTP mocks base method.
+func (m *MockRepository) SelectTOTP(ctx context.Context, userID int64) (models.TOTP, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectTOTP", ctx, userID)
+	ret0, _ := ret[0].(models.TOTP)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectTOTP indicates an expected call of SelectTOTP.
+func (mr *MockRepositoryMockRecorder) SelectTOTP(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectTOTP", reflect.TypeOf((*MockRepository)(nil).SelectTOTP), ctx, userID)
+}
+
+// SelectTokenRevocation mocks base method.
+func (m *MockRepository) SelectTokenRevocation(ctx context.Context, jti string, userID int64, sessionID string) (models.TokenRevocation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectTokenRevocation", ctx, jti, userID, sessionID)
+	ret0, _ := ret[0].(models.TokenRevocation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectTokenRevocation indicates an expected call of SelectTokenRevocation.
+func (mr *MockRepositoryMockRecorder) SelectTokenRevocation(ctx, jti, userID, sessionID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectTokenRevocation", reflect.TypeOf((*MockRepository)(nil).SelectTokenRevocation), ctx, jti, userID, sessionID)
+}
+
+// SelectUser mocks base method.
+func (m *MockRepository) SelectUser(ctx context.Context, userLogin string) (int64, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectUser", ctx, userLogin)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
 // SelectUser indicates an expected call of SelectUser.
 func (mr *MockRepositoryMockRecorder) SelectUser(ctx, userLogin interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectUser", reflect.TypeOf((*MockRepository)(nil).SelectUser), ctx, userLogin)
 }
 
+// SelectUserID mocks base method.
+func (m *MockRepository) SelectUserID(ctx context.Context, userLogin string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectUserID", ctx, userLogin)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectUserID indicates an expected call of SelectUserID.
+func (mr *MockRepositoryMockRecorder) SelectUserID(ctx, userLogin interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectUserID", reflect.TypeOf((*MockRepository)(nil).SelectUserID), ctx, userLogin)
+}
+
+// SelectWebhookDeliveries mocks base method.
+func (m *MockRepository) SelectWebhookDeliveries(ctx context.Context, userID int64, webhookID string, limit int) ([]models.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectWebhookDeliveries", ctx, userID, webhookID, limit)
+	ret0, _ := ret[0].([]models.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectWebhookDeliveries indicates an expected call of SelectWebhookDeliveries.
+func (mr *MockRepositoryMockRecorder) SelectWebhookDeliveries(ctx, userID, webhookID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectWebhookDeliveries", reflect.TypeOf((*MockRepository)(nil).SelectWebhookDeliveries), ctx, userID, webhookID, limit)
+}
+
+// SelectWebhooks mocks base method.
+func (m *MockRepository) SelectWebhooks(ctx context.Context, userID int64) ([]models.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectWebhooks", ctx, userID)
+	ret0, _ := ret[0].([]models.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectWebhooks indicates an expected call of SelectWebhooks.
+func (mr *MockRepositoryMockRecorder) SelectWebhooks(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectWebhooks", reflect.TypeOf((*MockRepository)(nil).SelectWebhooks), ctx, userID)
+}
+
+// SelectWithdrawalTotals mocks base method.
+func (m *MockRepository) SelectWithdrawalTotals(ctx context.Context, userID int64, filter models.WithdrawalFilter) (models.WithdrawalTotals, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectWithdrawalTotals", ctx, userID, filter)
+	ret0, _ := ret[0].(models.WithdrawalTotals)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectWithdrawalTotals indicates an expected call of SelectWithdrawalTotals.
+func (mr *MockRepositoryMockRecorder) SelectWithdrawalTotals(ctx, userID, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectWithdrawalTotals", reflect.TypeOf((*MockRepository)(nil).SelectWithdrawalTotals), ctx, userID, filter)
+}
+
 // SelectWithdrawals mocks base method.
-func (m *MockRepository) SelectWithdrawals(ctx context.Context, userLogin string) ([]models.WithdrawalResponse, error) {
+func (m *MockRepository) SelectWithdrawals(ctx context.Context, userID int64) ([]models.WithdrawalResponse, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SelectWithdrawals", ctx, userLogin)
+	ret := m.ctrl.Call(m, "SelectWithdrawals", ctx, userID)
 	ret0, _ := ret[0].([]models.WithdrawalResponse)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // SelectWithdrawals indicates an expected call of SelectWithdrawals.
-func (mr *MockRepositoryMockRecorder) SelectWithdrawals(ctx, userLogin interface{}) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) SelectWithdrawals(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectWithdrawals", reflect.TypeOf((*MockRepository)(nil).SelectWithdrawals), ctx, userID)
+}
+
+// SelectWithdrawalsPage mocks base method.
+func (m *MockRepository) SelectWithdrawalsPage(ctx context.Context, userID int64, filter models.WithdrawalFilter) ([]models.WithdrawalResponse, *models.Cursor, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectWithdrawalsPage", ctx, userID, filter)
+	ret0, _ := ret[0].([]models.WithdrawalResponse)
+	ret1, _ := ret[1].(*models.Cursor)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// SelectWithdrawalsPage indicates an expected call of SelectWithdrawalsPage.
+func (mr *MockRepositoryMockRecorder) SelectWithdrawalsPage(ctx, userID, filter interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectWithdrawals", reflect.TypeOf((*MockRepository)(nil).SelectWithdrawals), ctx, userLogin)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectWithdrawalsPage", reflect.TypeOf((*MockRepository)(nil).SelectWithdrawalsPage), ctx, userID, filter)
+}
+
+// UpdateLogin mocks base method.
+func (m *MockRepository) UpdateLogin(ctx context.Context, userID int64, userLogin string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateLogin", ctx, userID, userLogin)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateLogin indicates an expected call of UpdateLogin.
+func (mr *MockRepositoryMockRecorder) UpdateLogin(ctx, userID, userLogin interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateLogin", reflect.TypeOf((*MockRepository)(nil).UpdateLogin), ctx, userID, userLogin)
 }
 
 // UpdateOrder mocks base method.
@@ -181,6 +865,151 @@ func (mr *MockRepositoryMockRecorder) UpdateOrder(ctx, order interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrder", reflect.TypeOf((*MockRepository)(nil).UpdateOrder), ctx, order)
 }
 
+// UpdatePassword mocks base method.
+func (m *MockRepository) UpdatePassword(ctx context.Context, userID int64, password string, changedAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePassword", ctx, userID, password, changedAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePassword indicates an expected call of UpdatePassword.
+func (mr *MockRepositoryMockRecorder) UpdatePassword(ctx, userID, password, changedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePassword", reflect.TypeOf((*MockRepository)(nil).UpdatePassword), ctx, userID, password, changedAt)
+}
+
+// UpdatePasswordHash mocks base method.
+func (m *MockRepository) UpdatePasswordHash(ctx context.Context, userID int64, oldHash string, newHash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePasswordHash", ctx, userID, oldHash, newHash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePasswordHash indicates an expected call of UpdatePasswordHash.
+func (mr *MockRepositoryMockRecorder) UpdatePasswordHash(ctx, userID, oldHash, newHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePasswordHash", reflect.TypeOf((*MockRepository)(nil).UpdatePasswordHash), ctx, userID, oldHash, newHash)
+}
+
+// UpdateTOTPSecret mocks base method.
+func (m *MockRepository) UpdateTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateTOTPSecret", ctx, userID, secret)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateTOTPSecret indicates an expected call of UpdateTOTPSecret.
+func (mr *MockRepositoryMockRecorder) UpdateTOTPSecret(ctx, userID, secret interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateTOTPSecret", reflect.TypeOf((*MockRepository)(nil).UpdateTOTPSecret), ctx, userID, secret)
+}
+
+// UpdateUserRole mocks base method.
+func (m *MockRepository) UpdateUserRole(ctx context.Context, userID int64, role string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserRole", ctx, userID, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUserRole indicates an expected call of UpdateUserRole.
+func (mr *MockRepositoryMockRecorder) UpdateUserRole(ctx, userID, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserRole", reflect.TypeOf((*MockRepository)(nil).UpdateUserRole), ctx, userID, role)
+}
+
+// UseAPIKey mocks base method.
+func (m *MockRepository) UseAPIKey(ctx context.Context, keyHash string, at time.Time) (models.Account, []string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseAPIKey", ctx, keyHash, at)
+	ret0, _ := ret[0].(models.Account)
+	ret1, _ := ret[1].([]string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// UseAPIKey indicates an expected call of UseAPIKey.
+func (mr *MockRepositoryMockRecorder) UseAPIKey(ctx, keyHash, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseAPIKey", reflect.TypeOf((*MockRepository)(nil).UseAPIKey), ctx, keyHash, at)
+}
+
+// UseMFAChallenge mocks base method.
+func (m *MockRepository) UseMFAChallenge(ctx context.Context, tokenHash string, maxAttempts int, at time.Time) (models.Account, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseMFAChallenge", ctx, tokenHash, maxAttempts, at)
+	ret0, _ := ret[0].(models.Account)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseMFAChallenge indicates an expected call of UseMFAChallenge.
+func (mr *MockRepositoryMockRecorder) UseMFAChallenge(ctx, tokenHash, maxAttempts, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseMFAChallenge", reflect.TypeOf((*MockRepository)(nil).UseMFAChallenge), ctx, tokenHash, maxAttempts, at)
+}
+
+// UseOIDCState mocks base method.
+func (m *MockRepository) UseOIDCState(ctx context.Context, stateHash string, at time.Time) (models.OIDCState, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseOIDCState", ctx, stateHash, at)
+	ret0, _ := ret[0].(models.OIDCState)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseOIDCState indicates an expected call of UseOIDCState.
+func (mr *MockRepositoryMockRecorder) UseOIDCState(ctx, stateHash, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseOIDCState", reflect.TypeOf((*MockRepository)(nil).UseOIDCState), ctx, stateHash, at)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockRepository) UseRecoveryCode(ctx context.Context, userID int64, codeHash string, at time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", ctx, userID, codeHash, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockRepositoryMockRecorder) UseRecoveryCode(ctx, userID, codeHash, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockRepository)(nil).UseRecoveryCode), ctx, userID, codeHash, at)
+}
+
+// UseRefreshToken mocks base method.
+func (m *MockRepository) UseRefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRefreshToken", ctx, tokenHash)
+	ret0, _ := ret[0].(models.RefreshToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseRefreshToken indicates an expected call of UseRefreshToken.
+func (mr *MockRepositoryMockRecorder) UseRefreshToken(ctx, tokenHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRefreshToken", reflect.TypeOf((*MockRepository)(nil).UseRefreshToken), ctx, tokenHash)
+}
+
+// UseTOTPCounter mocks base method.
+func (m *MockRepository) UseTOTPCounter(ctx context.Context, userID int64, counter int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTOTPCounter", ctx, userID, counter)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseTOTPCounter indicates an expected call of UseTOTPCounter.
+func (mr *MockRepositoryMockRecorder) UseTOTPCounter(ctx, userID, counter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTOTPCounter", reflect.TypeOf((*MockRepository)(nil).UseTOTPCounter), ctx, userID, counter)
+}
+
 // WithdrawBalance mocks base method.
 func (m *MockRepository) WithdrawBalance(ctx context.Context, withdrawal models.Withdrawal) error {
 	m.ctrl.T.Helper()
@@ -6,8 +6,10 @@ package mocks
 
 import (
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
+	models "github.com/llaxzi/gophermart/internal/models"
 )
 
 // MockTokenBuilder is a mock of TokenBuilder interface.
@@ -33,17 +35,47 @@ func (m *MockTokenBuilder) EXPECT() *MockTokenBuilderMockRecorder {
 	return m.recorder
 }
 
+// AccessTokenExp mocks base method.
+func (m *MockTokenBuilder) AccessTokenExp() time.Duration {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AccessTokenExp")
+	ret0, _ := ret[0].(time.Duration)
+	return ret0
+}
+
+// AccessTokenExp indicates an expected call of AccessTokenExp.
+func (mr *MockTokenBuilderMockRecorder) AccessTokenExp() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AccessTokenExp", reflect.TypeOf((*MockTokenBuilder)(nil).AccessTokenExp))
+}
+
 // BuildJWTString mocks base method.
-func (m *MockTokenBuilder) BuildJWTString(userLogin string) (string, error) {
+func (m *MockTokenBuilder) BuildJWTString(subject models.TokenSubject) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "BuildJWTString", userLogin)
+	ret := m.ctrl.Call(m, "BuildJWTString", subject)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // BuildJWTString indicates an expected call of BuildJWTString.
-func (mr *MockTokenBuilderMockRecorder) BuildJWTString(userLogin interface{}) *gomock.Call {
+func (mr *MockTokenBuilderMockRecorder) BuildJWTString(subject interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BuildJWTString", reflect.TypeOf((*MockTokenBuilder)(nil).BuildJWTString), subject)
+}
+
+// BuildRefreshToken mocks base method.
+func (m *MockTokenBuilder) BuildRefreshToken() (string, time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BuildRefreshToken")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(time.Time)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// BuildRefreshToken indicates an expected call of BuildRefreshToken.
+func (mr *MockTokenBuilderMockRecorder) BuildRefreshToken() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BuildJWTString", reflect.TypeOf((*MockTokenBuilder)(nil).BuildJWTString), userLogin)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BuildRefreshToken", reflect.TypeOf((*MockTokenBuilder)(nil).BuildRefreshToken))
 }
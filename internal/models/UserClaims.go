@@ -1,8 +1,34 @@
 package models
 
-import "github.com/golang-jwt/jwt/v4"
+import (
+	"github.com/golang-jwt/jwt/v4"
+	"time"
+)
 
+// UserClaims - RegisteredClaims.ID используется как jti для отзыва токена.
+// Пользователя определяет UserID, UserLogin - логин на момент выпуска токена.
 type UserClaims struct {
 	jwt.RegisteredClaims
+	UserID    int64 `json:"uid"`
 	UserLogin string
+	Role      string `json:",omitempty"`
+	SessionID string `json:"sid,omitempty"`
+}
+
+// UserRole - токены, выпущенные до появления ролей, считаются токенами обычного пользователя
+func (c *UserClaims) UserRole() string {
+	if c.Role == "" {
+		return RoleUser
+	}
+	return c.Role
+}
+
+// TokenRevocation - состояние отзыва токена в БД
+type TokenRevocation struct {
+	Revoked       bool      // jti в списке отозванных, сессия завершена, либо пользователь удалён
+	RevokedBefore time.Time // все токены, выпущенные раньше, отозваны
+}
+
+func (r TokenRevocation) IsRevoked(issuedAt time.Time) bool {
+	return r.Revoked || issuedAt.Before(r.RevokedBefore)
 }
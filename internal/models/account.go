@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+type AccountDeletion struct {
+	Password string `json:"password"` // у пользователей без пароля (OIDC) не передаётся
+}
+
+// Profile - данные пользователя из таблицы users для выгрузки
+type Profile struct {
+	ID                int64      `json:"id"`
+	Login             string     `json:"login"`
+	Role              string     `json:"role"`
+	Balance           Balance    `json:"balance"`
+	TOTPEnabled       bool       `json:"totp_enabled"`
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty"`
+}
+
+// UserExport - всё, что сервис хранит о пользователе. Хеши паролей, ключей, секрет TOTP и секреты вебхуков не выгружаются.
+type UserExport struct {
+	ExportedAt  time.Time            `json:"exported_at"`
+	Profile     Profile              `json:"profile"`
+	Orders      []OrderResponse      `json:"orders"`
+	Withdrawals []WithdrawalResponse `json:"withdrawals"`
+	Sessions    []Session            `json:"sessions"`
+	APIKeys     []APIKey             `json:"api_keys"`
+	Identities  []OIDCIdentity       `json:"identities"`
+	Webhooks    []Webhook            `json:"webhooks"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// OrderEvent - изменение статуса или начисления заказа, уходит владельцу по SSE
+type OrderEvent struct {
+	UserID  int64    `json:"-"`
+	Number  string   `json:"number"`
+	Status  string   `json:"status"`
+	Accrual *float64 `json:"accrual,omitempty"`
+}
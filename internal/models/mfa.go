@@ -0,0 +1,33 @@
+package models
+
+// TOTP - состояние второго фактора пользователя. Secret без Enabled - незавершённая настройка.
+type TOTP struct {
+	Secret      string
+	Enabled     bool
+	LastCounter int64 // последний принятый шаг TOTP, защищает от повторного использования кода
+}
+
+type TOTPSetup struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TOTPCode struct {
+	Code string `json:"code"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFAChallenge возвращается из Login вместо токенов, если включён второй фактор
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+type MFALogin struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
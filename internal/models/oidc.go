@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// OIDCIdentity - внешний аккаунт у провайдера, привязанный к пользователю
+type OIDCIdentity struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OIDCState - начатый вход через провайдера. Хранится до callback.
+type OIDCState struct {
+	StateHash string
+	Verifier  string
+	Nonce     string
+	ExpiresAt time.Time
+}
@@ -4,9 +4,12 @@ import (
 	"time"
 )
 
+// OrderStatuses - статусы обработки заказа в системе начислений
+var OrderStatuses = []string{"NEW", "PROCESSING", "INVALID", "PROCESSED"}
+
 type Order struct {
 	Number     string
-	Login      string
+	UserID     int64
 	Status     string
 	Accrual    *float64
 	UploadedAt time.Time
@@ -19,3 +22,34 @@ type OrderResponse struct {
 	Accrual    *float64 `json:"accrual,omitempty"`
 	UploadedAt string   `json:"uploaded_at"`
 }
+
+// OrderFilter - выборка заказов пользователя, пустой Statuses - любой статус
+type OrderFilter struct {
+	PageFilter
+	Statuses []string
+}
+
+// OrderDetail - заказ с временем последнего опроса accrual и историей статусов
+type OrderDetail struct {
+	OrderResponse
+	CheckedAt *string             `json:"checked_at,omitempty"`
+	History   []OrderStatusChange `json:"history"`
+}
+
+type OrderStatusChange struct {
+	Status    string `json:"status"`
+	ChangedAt string `json:"changed_at"`
+}
+
+// Результат пакетной загрузки для отдельного номера
+const (
+	BatchAccepted     = "accepted"
+	BatchDuplicateOwn = "duplicate-own"
+	BatchOwnedByOther = "owned-by-other"
+	BatchInvalid      = "invalid"
+)
+
+type BatchOrderResult struct {
+	Number string `json:"number"`
+	Result string `json:"result"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Cursor - позиция keyset пагинации: время и ключ последней строки страницы.
+// Клиенту отдаётся в непрозрачном виде.
+type Cursor struct {
+	Time time.Time `json:"t"`
+	Key  string    `json:"k"`
+}
+
+// PageFilter - общие параметры постраничной выборки
+type PageFilter struct {
+	Limit int        // 0 - без ограничения
+	After *Cursor    // nil - первая страница
+	From  *time.Time // включительно
+	To    *time.Time // не включительно
+	Asc   bool       // по умолчанию сначала новые
+}
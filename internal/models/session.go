@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Session - вход с устройства. ID совпадает с семейством refresh токенов и claim sid в access токене.
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int64      `json:"-"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Current    bool       `json:"current,omitempty"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+type RefreshToken struct {
+	Hash      string
+	UserID    int64
+	FamilyID  string
+	ExpiresAt time.Time
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenSubject - данные, которые попадают в access токен
+type TokenSubject struct {
+	UserID    int64
+	Login     string
+	Role      string
+	SessionID string
+}
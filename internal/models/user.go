@@ -1,6 +1,35 @@
 package models
 
+// Роли пользователей: support видит данные любого пользователя, admin ещё и назначает роли
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+var Roles = []string{RoleUser, RoleSupport, RoleAdmin}
+
 type User struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
 }
+
+// Account - пользователь по суррогатному ID. Логин можно сменить, ID - нет.
+type Account struct {
+	ID    int64
+	Login string
+	Role  string
+}
+
+type LoginChange struct {
+	Login string `json:"login"`
+}
+
+type PasswordChange struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+type RoleChange struct {
+	Role string `json:"role"`
+}
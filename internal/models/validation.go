@@ -0,0 +1,12 @@
+package models
+
+type Violation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type ValidationErrorResponse struct {
+	Error      string      `json:"error"`
+	Violations []Violation `json:"violations"`
+}
@@ -4,7 +4,7 @@ import "time"
 
 type Withdrawal struct {
 	Order       string    `json:"order"`
-	Login       string    `json:"login,omitempty"`
+	UserID      int64     `json:"-"`
 	Sum         float64   `json:"sum"`
 	ProcessedAt time.Time `json:"processed_at,omitempty"`
 }
@@ -15,3 +15,15 @@ type WithdrawalResponse struct {
 	Sum         float64 `json:"sum"`
 	ProcessedAt string  `json:"processed_at"`
 }
+
+// WithdrawalFilter - выборка списаний пользователя, MinSum 0 - без ограничения
+type WithdrawalFilter struct {
+	PageFilter
+	MinSum float64
+}
+
+// WithdrawalTotals - итоги по всем списаниям под фильтром, без учёта страницы
+type WithdrawalTotals struct {
+	Count int64
+	Sum   float64
+}
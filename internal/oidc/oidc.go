@@ -0,0 +1,308 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/gophermart/internal/tokens"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDiscovery    = errors.New("oidc discovery failed")
+	ErrExchange     = errors.New("oidc code exchange failed")
+	ErrInvalidToken = errors.New("invalid id token")
+)
+
+// Provider - вход через внешний OpenID Connect провайдер (authorization code + PKCE)
+type Provider interface {
+	// AuthRequest готовит redirect на провайдера. State, Nonce и Verifier нужно сохранить до callback.
+	AuthRequest(ctx context.Context) (AuthRequest, error)
+	// Exchange обменивает code на токены и проверяет id_token
+	Exchange(ctx context.Context, code string, verifier string, nonce string) (models.OIDCIdentity, error)
+	StateTTL() time.Duration
+}
+
+type AuthRequest struct {
+	URL      string
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	StateTTL     time.Duration
+	Timeout      time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Scopes:   []string{"openid"},
+		StateTTL: time.Minute * 10,
+		Timeout:  time.Second * 10,
+	}
+}
+
+func NewProvider(config Config) Provider {
+	client := resty.New()
+	client.SetTimeout(config.Timeout)
+	return &provider{config: config, client: client}
+}
+
+type provider struct {
+	config Config
+	client *resty.Client
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      map[string]interface{} // kid -> публичный ключ провайдера
+}
+
+// discovery - нужные поля /.well-known/openid-configuration
+type discovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+}
+
+type tokenResponse struct {
+	IDToken string `json:"id_token"`
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce string `json:"nonce"`
+}
+
+func (p *provider) AuthRequest(ctx context.Context) (AuthRequest, error) {
+	var req AuthRequest
+	doc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return req, err
+	}
+
+	if req.State, err = tokens.NewID(); err != nil {
+		return req, err
+	}
+	if req.Nonce, err = tokens.NewID(); err != nil {
+		return req, err
+	}
+	if req.Verifier, err = newVerifier(); err != nil {
+		return req, err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", req.State)
+	query.Set("nonce", req.Nonce)
+	query.Set("code_challenge", CodeChallenge(req.Verifier))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	req.URL = doc.AuthorizationEndpoint + separator + query.Encode()
+	return req, nil
+}
+
+func (p *provider) Exchange(ctx context.Context, code string, verifier string, nonce string) (models.OIDCIdentity, error) {
+	var identity models.OIDCIdentity
+	doc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return identity, err
+	}
+
+	req := p.client.R().SetContext(ctx).SetFormData(map[string]string{
+		"grant_type":    "authorization_code",
+		"code":          code,
+		"redirect_uri":  p.config.RedirectURL,
+		"client_id":     p.config.ClientID,
+		"code_verifier": verifier,
+	})
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	var token tokenResponse
+	resp, err := req.SetResult(&token).Post(doc.TokenEndpoint)
+	if err != nil {
+		return identity, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return identity, fmt.Errorf("%w: token endpoint returned %d: %s", ErrExchange, resp.StatusCode(), resp.String())
+	}
+	if token.IDToken == "" {
+		return identity, fmt.Errorf("%w: no id_token in response", ErrExchange)
+	}
+
+	claims, err := p.verify(ctx, doc, token.IDToken)
+	if err != nil {
+		return identity, err
+	}
+	if claims.Nonce != nonce {
+		return identity, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+
+	identity.Issuer = claims.Issuer
+	identity.Subject = claims.Subject
+	identity.CreatedAt = time.Now()
+	return identity, nil
+}
+
+func (p *provider) StateTTL() time.Duration {
+	return p.config.StateTTL
+}
+
+// CodeChallenge - PKCE S256: base64url(sha256(verifier))
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// internal
+
+// getDiscovery загружает документ провайдера при первом обращении.
+// Ошибка не кешируется, следующий вход повторит попытку.
+func (p *provider) getDiscovery(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var doc discovery
+	endpoint := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	resp, err := p.client.R().SetContext(ctx).SetResult(&doc).Get(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s returned %d", ErrDiscovery, endpoint, resp.StatusCode())
+	}
+	// OpenID Connect Discovery 1.0, 4.3: issuer должен совпадать с тем, у кого запрашивали документ
+	if doc.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("%w: issuer %q does not match %q", ErrDiscovery, doc.Issuer, p.config.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: missing endpoints", ErrDiscovery)
+	}
+	if len(doc.CodeChallengeMethods) > 0 && !contains(doc.CodeChallengeMethods, "S256") {
+		return nil, fmt.Errorf("%w: provider does not support PKCE S256", ErrDiscovery)
+	}
+
+	p.discovery = &doc
+	return p.discovery, nil
+}
+
+func (p *provider) verify(ctx context.Context, doc *discovery, idToken string) (*idTokenClaims, error) {
+	claims := &idTokenClaims{}
+	token, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := p.key(ctx, doc, kid)
+		if err != nil {
+			return nil, err
+		}
+		if !algMatchesKey(token.Method, key) {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	now := time.Now()
+	if claims.Issuer != doc.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.Issuer)
+	}
+	if !claims.VerifyAudience(p.config.ClientID, true) {
+		return nil, fmt.Errorf("%w: audience does not contain client id", ErrInvalidToken)
+	}
+	if !claims.VerifyExpiresAt(now, true) {
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// key ищет ключ по kid. Неизвестный kid означает ротацию у провайдера - JWKS перечитывается.
+func (p *provider) key(ctx context.Context, doc *discovery, kid string) (interface{}, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	var jwks models.JWKS
+	resp, err := p.client.R().SetContext(ctx).SetResult(&jwks).Get(doc.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("jwks endpoint returned %d", resp.StatusCode())
+	}
+
+	keys := make(map[string]interface{}, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		public, err := parseJWK(jwk)
+		if err != nil {
+			// Ключи неподдерживаемых типов пропускаем, провайдер может подписывать другими
+			continue
+		}
+		keys[jwk.Kid] = public
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	if key, ok = keys[kid]; !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+// newVerifier - RFC 7636: 43-128 символов, 32 случайных байта в base64url дают 43
+func newVerifier() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubIdP - провайдер на httptest: discovery, JWKS и token endpoint с проверкой PKCE
+type stubIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+
+	mu    sync.Mutex
+	codes map[string]url.Values // code -> параметры запроса авторизации
+	// claims позволяет тесту испортить id_token
+	claims func(claims jwt.MapClaims)
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	idp := &stubIdP{key: key, kid: "idp-key", codes: map[string]url.Values{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"issuer":                           idp.server.URL,
+			"authorization_endpoint":           idp.server.URL + "/authorize",
+			"token_endpoint":                   idp.server.URL + "/token",
+			"jwks_uri":                         idp.server.URL + "/jwks",
+			"code_challenge_methods_supported": []string{"S256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, models.JWKS{Keys: []models.JWK{{
+			Kty: "RSA",
+			Kid: idp.kid,
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// authorize имитирует вход пользователя у провайдера и возвращает code для callback
+func (idp *stubIdP) authorize(t *testing.T, authURL string) (code string, state string) {
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	query := u.Query()
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	code = "code-" + query.Get("state")
+	idp.codes[code] = query
+	return code, query.Get("state")
+}
+
+func (idp *stubIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	idp.mu.Lock()
+	authReq, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	if !ok || CodeChallenge(r.PostForm.Get("code_verifier")) != authReq.Get("code_challenge") ||
+		r.PostForm.Get("redirect_uri") != authReq.Get("redirect_uri") {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   idp.server.URL,
+		"sub":   "248289761001",
+		"aud":   authReq.Get("client_id"),
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": authReq.Get("nonce"),
+	}
+	if idp.claims != nil {
+		idp.claims(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = idp.kid
+	idToken, err := token.SignedString(idp.key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]string{"id_token": idToken, "access_token": "access", "token_type": "Bearer"})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func newTestProvider(idp *stubIdP) Provider {
+	config := DefaultConfig()
+	config.Issuer = idp.server.URL
+	config.ClientID = "gophermart"
+	config.RedirectURL = "https://gophermart.example.com/api/user/oidc/callback"
+	return NewProvider(config)
+}
+
+func TestProvider_AuthRequest(t *testing.T) {
+	idp := newStubIdP(t)
+	provider := newTestProvider(idp)
+
+	req, err := provider.AuthRequest(context.Background())
+	require.NoError(t, err)
+
+	u, err := url.Parse(req.URL)
+	require.NoError(t, err)
+	assert.Equal(t, idp.server.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+
+	query := u.Query()
+	assert.Equal(t, "code", query.Get("response_type"))
+	assert.Equal(t, "gophermart", query.Get("client_id"))
+	assert.Equal(t, "openid", query.Get("scope"))
+	assert.Equal(t, req.State, query.Get("state"))
+	assert.Equal(t, req.Nonce, query.Get("nonce"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Equal(t, CodeChallenge(req.Verifier), query.Get("code_challenge"))
+	assert.GreaterOrEqual(t, len(req.Verifier), 43)
+}
+
+func TestProvider_Exchange(t *testing.T) {
+	tests := []struct {
+		name        string
+		claims      func(claims jwt.MapClaims)
+		verifier    func(verifier string) string
+		nonce       func(nonce string) string
+		expectedErr error
+	}{
+		{
+			name: "Successful login",
+		},
+		{
+			name:        "Wrong PKCE verifier",
+			verifier:    func(string) string { return "forged-verifier-forged-verifier-forged-verif" },
+			expectedErr: ErrExchange,
+		},
+		{
+			name:        "Nonce mismatch",
+			nonce:       func(string) string { return "other" },
+			expectedErr: ErrInvalidToken,
+		},
+		{
+			name:        "Token for another client",
+			claims:      func(claims jwt.MapClaims) { claims["aud"] = "another-client" },
+			expectedErr: ErrInvalidToken,
+		},
+		{
+			name:        "Token from another issuer",
+			claims:      func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" },
+			expectedErr: ErrInvalidToken,
+		},
+		{
+			name:        "Expired token",
+			claims:      func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() },
+			expectedErr: ErrInvalidToken,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			idp := newStubIdP(t)
+			idp.claims = test.claims
+			provider := newTestProvider(idp)
+
+			req, err := provider.AuthRequest(context.Background())
+			require.NoError(t, err)
+			code, _ := idp.authorize(t, req.URL)
+
+			verifier, nonce := req.Verifier, req.Nonce
+			if test.verifier != nil {
+				verifier = test.verifier(verifier)
+			}
+			if test.nonce != nil {
+				nonce = test.nonce(nonce)
+			}
+
+			identity, err := provider.Exchange(context.Background(), code, verifier, nonce)
+
+			if test.expectedErr != nil {
+				assert.ErrorIs(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, idp.server.URL, identity.Issuer)
+			assert.Equal(t, "248289761001", identity.Subject)
+		})
+	}
+}
+
+func TestProvider_DiscoveryIssuerMismatch(t *testing.T) {
+	idp := newStubIdP(t)
+
+	config := DefaultConfig()
+	// Документ провайдера объявляет другой issuer, чем тот, что настроен
+	config.Issuer = idp.server.URL + "/"
+	config.ClientID = "gophermart"
+
+	_, err := NewProvider(config).AuthRequest(context.Background())
+	assert.ErrorIs(t, err, ErrDiscovery)
+}
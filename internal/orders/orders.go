@@ -2,33 +2,43 @@ package orders
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"github.com/go-resty/resty/v2"
+	"github.com/llaxzi/gophermart/internal/accrual"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/breaker"
+	"github.com/llaxzi/gophermart/internal/events"
 	"github.com/llaxzi/gophermart/internal/models"
 	"github.com/llaxzi/gophermart/internal/repository"
 	"github.com/llaxzi/retryables/v2"
 	"log"
-	"net/http"
-	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// resetTimeout - время на сброс статуса одного заказа при остановке
+const resetTimeout = time.Second * 5
+
 type Processor interface {
 	ProcessOrders(ctx context.Context)
 }
 
-func NewProcessor(repo repository.Repository, retryer *retryables.Retryer, accrualAddr string,
-	getInterval time.Duration, workerCount int) Processor {
+// NewProcessor - пока breaker открыт, новые заказы не берутся в работу, а воркеры не обращаются к accrual.
+// Заказ, который accrual ещё обрабатывает, опрашивается повторно не чаще раза в getInterval.
+func NewProcessor(repo repository.Repository, retryer *retryables.Retryer, client accrual.Client, breaker breaker.Breaker,
+	getInterval time.Duration, workerCount int, publisher events.Publisher) Processor {
 	p := &processor{
 		repo:             repo,
 		retryer:          retryer,
-		accrualAddr:      accrualAddr,
+		publisher:        publisher,
+		client:           client,
+		breaker:          breaker,
 		ordersCh:         make(chan models.Order, 50),
 		returnedOrdersCh: make(chan models.Order, 50),
 		errCh:            make(chan error, 50),
 		getInterval:      getInterval,
+		recheckInterval:  getInterval,
 		workerCount:      workerCount,
 	}
 	return p
@@ -37,13 +47,17 @@ func NewProcessor(repo repository.Repository, retryer *retryables.Retryer, accru
 type processor struct {
 	repo             repository.Repository
 	retryer          *retryables.Retryer
-	accrualAddr      string
+	publisher        events.Publisher
+	client           accrual.Client
+	breaker          breaker.Breaker
 	ordersCh         chan models.Order
 	returnedOrdersCh chan models.Order
 	errCh            chan error
 	retryAfter       atomic.Value
 	getInterval      time.Duration
+	recheckInterval  time.Duration
 	workerCount      int
+	delayed          sync.WaitGroup // заказы, ожидающие повторного опроса
 }
 
 // getNewOrders - generator
@@ -56,6 +70,10 @@ func (p *processor) getNewOrders(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			// Система начислений недоступна, заказы остаются NEW
+			if p.breaker.State() == breaker.Open {
+				continue
+			}
 			var orders []models.Order
 			err := p.retryer.Retry(func() error {
 				var err error
@@ -63,9 +81,12 @@ func (p *processor) getNewOrders(ctx context.Context) {
 				return err
 			})
 			if err != nil {
-				p.errCh <- fmt.Errorf("failed to select new orders: %w", err)
+				p.logError(fmt.Errorf("failed to select new orders: %w", err))
 				continue
 			}
+			for _, order := range orders {
+				p.publisher.Publish(ctx, models.OrderEvent{UserID: order.UserID, Number: order.Number, Status: "PROCESSING"})
+			}
 
 			go func(orders []models.Order) {
 				for _, order := range orders {
@@ -116,6 +137,7 @@ func (p *processor) ProcessOrders(ctx context.Context) {
 	<-ctx.Done()
 
 	wg.Wait()
+	p.delayed.Wait()
 
 	// Возвращаем необработанные заказы
 	close(p.ordersCh)
@@ -132,76 +154,61 @@ func (p *processor) ProcessOrders(ctx context.Context) {
 }
 
 func (p *processor) worker(ctx context.Context) {
-	client := resty.New()
-	// Настройка retry
-	client.SetRetryCount(3)
-	client.SetRetryAfter(func(client *resty.Client, response *resty.Response) (time.Duration, error) {
-		retryCount := response.Request.Attempt
-		switch retryCount {
-		case 1:
-			return 1 * time.Second, nil
-		case 2:
-			return 3 * time.Second, nil
-		case 3:
-			return 5 * time.Second, nil
-		default:
-			return 0, nil
-		}
-	})
-	client.AddRetryCondition(func(response *resty.Response, err error) bool {
-		if response.StatusCode() == http.StatusServiceUnavailable || response.StatusCode() == http.StatusInternalServerError {
-			return true
-		}
-		return false
-	}) // retry только в случае, если сервер недоступен (maintenance или перегрузка) или внут. ошибка
-
 	for {
 		select {
 		case order := <-p.ordersCh:
 			// Ждём, если нужно
 			p.wait()
-
-			resp, err := client.R().SetResult(&order).Get(p.accrualAddr + "/api/orders/" + order.Number)
-
-			if err != nil {
-				p.errCh <- fmt.Errorf("failed to send request: %w", err)
-				p.returnedOrdersCh <- order
-				continue
+			// Пока breaker открыт, заказ остаётся у воркера и не гоняется через returnedOrdersCh
+			if err := p.breaker.Wait(ctx); err != nil {
+				p.release(order)
+				return
 			}
 
-			if resp.StatusCode() == http.StatusTooManyRequests {
-				retryAfterStr := resp.Header().Get("Retry-After")
-				retryAfter, err := strconv.Atoi(retryAfterStr)
-				if err != nil {
-					p.errCh <- fmt.Errorf("failed to atoi: %w", err)
+			resp, err := p.client.GetOrder(ctx, order.Number)
+			p.report(err)
+			if err != nil {
+				var rateLimit *accrual.RateLimitError
+				switch {
+				case errors.As(err, &rateLimit):
+					// Паузу до следующего запроса выдерживает wait
+					if rateLimit.RetryAfter > 0 {
+						p.setDelay(time.Now().Add(rateLimit.RetryAfter))
+					}
 					p.returnedOrdersCh <- order
-					continue
-				}
-				if retryAfter > 0 {
-					p.setDelay(time.Now().Add(time.Duration(retryAfter) * time.Second))
+				case errors.Is(err, apperrors.ErrOrderNotRegistered):
+					// Заказ ещё не зарегистрирован в системе начислений, спросим позже
+					p.recheck(ctx, order)
+				default:
+					p.logError(fmt.Errorf("failed to get order accrual: %w", err))
+					p.recheck(ctx, order)
 				}
-				p.returnedOrdersCh <- order
-				continue
-			}
-
-			if resp.StatusCode() != http.StatusOK {
-				p.returnedOrdersCh <- order
 				continue
 			}
 
-			if order.Status == "PROCESSING" || order.Status == "REGISTERED" {
-				p.ordersCh <- order
+			if !resp.Status.Final() {
+				// Статус не изменился, запоминаем только время опроса
+				err = p.retryer.Retry(func() error {
+					return p.repo.MarkOrderChecked(ctx, order.Number)
+				})
+				if err != nil {
+					p.logError(fmt.Errorf("failed to mark order checked: %w", err))
+				}
+				p.recheck(ctx, order)
 				continue
 			}
 
+			order.Status = string(resp.Status)
+			order.Accrual = resp.Accrual
 			err = p.retryer.Retry(func() error {
 				return p.repo.UpdateOrder(ctx, order)
 			})
 			if err != nil {
-				p.errCh <- fmt.Errorf("failed to update order: %w", err)
+				p.logError(fmt.Errorf("failed to update order: %w", err))
 				p.returnedOrdersCh <- order
 				continue
 			}
+			p.publisher.Publish(ctx, models.OrderEvent{UserID: order.UserID, Number: order.Number, Status: order.Status, Accrual: order.Accrual})
 		case <-ctx.Done():
 			return
 		}
@@ -210,6 +217,56 @@ func (p *processor) worker(ctx context.Context) {
 
 // internal
 
+// report сообщает breaker'у результат запроса: отказом считаются только недоступность и 5xx,
+// 204, 429 и прочие ответы означают, что система начислений работает
+func (p *processor) report(err error) {
+	if errors.Is(err, apperrors.ErrAccrualUnavailable) || errors.Is(err, apperrors.ErrAccrualServer) {
+		p.breaker.Failure()
+		return
+	}
+	p.breaker.Success()
+}
+
+// release возвращает заказ при остановке, ProcessOrders сбросит его статус
+func (p *processor) release(order models.Order) {
+	select {
+	case p.returnedOrdersCh <- order:
+	default:
+		log.Printf("Failed to release order %s on shutdown", order.Number)
+	}
+}
+
+// recheck возвращает заказ воркерам через recheckInterval. При остановке статус заказа сбрасывается.
+func (p *processor) recheck(ctx context.Context, order models.Order) {
+	p.delayed.Add(1)
+	go func() {
+		defer p.delayed.Done()
+		timer := time.NewTimer(p.recheckInterval)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+			select {
+			case <-ctx.Done():
+			case p.ordersCh <- order:
+				return
+			}
+		}
+		p.resetOrderStatus(ctx, order.Number)
+	}()
+}
+
+// logError передаёт ошибку обработчику errCh. После остановки обработчика ошибка пишется в лог сразу,
+// чтобы заполненный errCh не блокировал воркеры.
+func (p *processor) logError(err error) {
+	select {
+	case p.errCh <- err:
+	default:
+		log.Println(err.Error())
+	}
+}
+
 func (p *processor) setDelay(after time.Time) {
 	p.retryAfter.Store(after)
 }
@@ -220,13 +277,18 @@ func (p *processor) wait() {
 	}
 }
 
+// resetOrderStatus возвращает заказ в NEW при остановке. К этому моменту ctx уже отменён, поэтому запрос
+// идёт с отвязанным контекстом, а ошибка пишется сразу в лог: обработчик errCh уже остановлен.
 func (p *processor) resetOrderStatus(ctx context.Context, orderNumber string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), resetTimeout)
+	defer cancel()
+
 	err := p.retryer.Retry(func() error {
 		return p.repo.ResetStatus(ctx, orderNumber)
 	})
 	if err != nil {
-		p.errCh <- fmt.Errorf("failed to reset order status: %w", err)
-		fmt.Printf("Reset order status for order: %v error: %v\n", orderNumber, err)
+		log.Printf("Failed to reset order status for order: %v error: %v", orderNumber, err)
+		return
 	}
-	fmt.Printf("Reset order status for order: %v\n", orderNumber)
+	log.Printf("Reset order status for order: %v", orderNumber)
 }
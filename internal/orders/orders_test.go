@@ -5,18 +5,22 @@ import (
 	"errors"
 	"fmt"
 	"github.com/golang/mock/gomock"
+	"github.com/llaxzi/gophermart/internal/accrual"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/breaker"
+	"github.com/llaxzi/gophermart/internal/events"
 	"github.com/llaxzi/gophermart/internal/mocks"
 	"github.com/llaxzi/gophermart/internal/models"
 	"github.com/llaxzi/retryables/v2"
 	"github.com/stretchr/testify/assert"
-	"net/http"
-	"net/http/httptest"
 	"os"
 	"sync"
 	"testing"
 	"time"
 )
 
+var testBreakerConfig = breaker.Config{FailureThreshold: 3, CoolDown: time.Minute}
+
 func TestGetNewOrders(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -32,6 +36,8 @@ func TestGetNewOrders(t *testing.T) {
 	p := processor{
 		repo:             repo,
 		retryer:          retryer,
+		publisher:        events.NewBroker(10),
+		breaker:          breaker.NewBreaker("accrual", testBreakerConfig),
 		ordersCh:         ordersCh,
 		returnedOrdersCh: returnedOrdersCh,
 		errCh:            errCh,
@@ -42,8 +48,8 @@ func TestGetNewOrders(t *testing.T) {
 	defer cancel()
 
 	orders := []models.Order{
-		{Number: "7458", Login: "test1", Status: "NEW", Accrual: nil, UploadedAt: time.Now()},
-		{Number: "7459", Login: "test2", Status: "PROCESSING", Accrual: nil, UploadedAt: time.Now()},
+		{Number: "7458", UserID: 1, Status: "NEW", Accrual: nil, UploadedAt: time.Now()},
+		{Number: "7459", UserID: 2, Status: "PROCESSING", Accrual: nil, UploadedAt: time.Now()},
 	}
 
 	repo.EXPECT().SelectNewOrders(gomock.Any()).
@@ -78,6 +84,36 @@ func TestGetNewOrders(t *testing.T) {
 	assert.ElementsMatch(t, expectedOrders, receivedOrders)
 }
 
+// fakeClient отвечает по сценарию: очередной ответ на каждый запрос заказа, последний повторяется
+type fakeClient struct {
+	mu        sync.Mutex
+	responses map[string][]fakeResponse
+	calls     int
+	callTimes []time.Time
+}
+
+type fakeResponse struct {
+	resp accrual.Response
+	err  error
+}
+
+func (c *fakeClient) GetOrder(_ context.Context, number string) (accrual.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls++
+	c.callTimes = append(c.callTimes, time.Now())
+	script := c.responses[number]
+	if len(script) == 0 {
+		return accrual.Response{}, apperrors.ErrOrderNotRegistered
+	}
+	next := script[0]
+	if len(script) > 1 {
+		c.responses[number] = script[1:]
+	}
+	return next.resp, next.err
+}
+
 func TestWorker(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -85,35 +121,30 @@ func TestWorker(t *testing.T) {
 	repo := mocks.NewMockRepository(ctrl)
 	retryer := retryables.NewRetryer(nil)
 	retryer.SetCount(1)
+	retryer.SetDelay(0, 0)
 
-	// Accrual mock
-	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		orderID := r.URL.Path[len("/api/orders/"):]
-		switch orderID {
-		case "too_many_requests":
-			w.Header().Set("Retry-After", "2")
-			w.WriteHeader(http.StatusTooManyRequests)
-		case "no_content":
-			w.WriteHeader(http.StatusNoContent)
-		case "error":
-			w.WriteHeader(http.StatusInternalServerError)
-		default:
-			w.WriteHeader(http.StatusOK)
-			fmt.Fprintf(w, `{"Number": "%s", "Status": "PROCESSED"}`, orderID)
-		}
-	}))
-	defer mockServer.Close()
+	accrualSum := 500.0
+	client := &fakeClient{responses: map[string][]fakeResponse{
+		"12345":    {{resp: accrual.Response{Order: "12345", Status: accrual.StatusProcessed, Accrual: &accrualSum}}},
+		"invalid":  {{resp: accrual.Response{Order: "invalid", Status: accrual.StatusInvalid}}},
+		"error":    {{err: fmt.Errorf("%w: 500 Internal Server Error", apperrors.ErrAccrualServer)}},
+		"db_error": {{resp: accrual.Response{Order: "db_error", Status: accrual.StatusProcessed, Accrual: &accrualSum}}},
+	}}
 
+	// expectedRecheck - заказ откладывается до recheckInterval и при остановке возвращается в NEW
 	tests := []struct {
-		name           string
-		order          models.Order
-		expectedReturn bool
-		mockRepoUpdate error
+		name            string
+		order           models.Order
+		expectedReturn  bool
+		expectedRecheck bool
+		expectedStatus  string
+		mockRepoUpdate  error
 	}{
-		{"Successful Order Processing", models.Order{Number: "12345", Status: "NEW"}, false, nil},
-		{"No Content", models.Order{Number: "no_content", Status: "NEW"}, true, nil},
-		{"Internal Server Error", models.Order{Number: "error", Status: "NEW"}, true, nil},
-		{"DB Update Error", models.Order{Number: "db_error", Status: "NEW"}, true, errors.New("db error")},
+		{"Successful Order Processing", models.Order{Number: "12345", Status: "NEW"}, false, false, "PROCESSED", nil},
+		{"Invalid Order", models.Order{Number: "invalid", Status: "NEW"}, false, false, "INVALID", nil},
+		{"Not Registered", models.Order{Number: "no_content", Status: "NEW"}, false, true, "", nil},
+		{"Internal Server Error", models.Order{Number: "error", Status: "NEW"}, false, true, "", nil},
+		{"DB Update Error", models.Order{Number: "db_error", Status: "NEW"}, true, false, "PROCESSED", errors.New("db error")},
 	}
 
 	for _, test := range tests {
@@ -124,14 +155,26 @@ func TestWorker(t *testing.T) {
 			p := &processor{
 				repo:             repo,
 				retryer:          retryer,
-				accrualAddr:      mockServer.URL,
+				publisher:        events.NewBroker(10),
+				breaker:          breaker.NewBreaker("accrual", testBreakerConfig),
+				client:           client,
 				ordersCh:         make(chan models.Order, 10),
 				returnedOrdersCh: make(chan models.Order, 10),
 				errCh:            make(chan error, 10),
+				recheckInterval:  time.Hour,
 			}
 
-			if test.mockRepoUpdate != nil || !test.expectedReturn {
-				repo.EXPECT().UpdateOrder(gomock.Any(), gomock.Any()).Return(test.mockRepoUpdate).Times(1)
+			updated := make(chan struct{})
+			if test.expectedRecheck {
+				repo.EXPECT().ResetStatus(gomock.Any(), test.order.Number).Return(nil).Times(1)
+			}
+			if test.expectedStatus != "" {
+				repo.EXPECT().UpdateOrder(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, order models.Order) error {
+						assert.Equal(t, test.expectedStatus, order.Status)
+						close(updated)
+						return test.mockRepoUpdate
+					}).Times(1)
 			}
 
 			var wg sync.WaitGroup
@@ -141,22 +184,36 @@ func TestWorker(t *testing.T) {
 				p.worker(ctx)
 			}()
 
+			calls := client.Calls()
 			p.ordersCh <- test.order
 
+			// Ждём, пока воркер обработает заказ, и только потом останавливаем его
+			switch {
+			case test.expectedRecheck:
+				assert.Eventually(t, func() bool { return client.Calls() > calls }, time.Second, time.Millisecond)
+			case test.expectedReturn:
+				select {
+				case returnedOrder := <-p.returnedOrdersCh:
+					assert.Equal(t, test.order.Number, returnedOrder.Number)
+				case <-time.After(time.Second):
+					t.Fatalf("Order %s should be returned but was not", test.order.Number)
+				}
+			default:
+				select {
+				case <-updated:
+				case <-time.After(time.Second):
+					t.Fatalf("Order %s was not updated", test.order.Number)
+				}
+			}
+
 			cancel()
 			wg.Wait()
+			p.delayed.Wait()
 
-			// Проверяем, попал ли заказ в returnedOrdersCh
 			select {
 			case returnedOrder := <-p.returnedOrdersCh:
-				if !test.expectedReturn {
-					t.Fatalf("Order %s should NOT be returned", returnedOrder.Number)
-				}
-				assert.Equal(t, test.order.Number, returnedOrder.Number)
+				t.Fatalf("Order %s should NOT be returned", returnedOrder.Number)
 			default:
-				if test.expectedReturn {
-					t.Fatalf("Order %s should be returned but was not", test.order.Number)
-				}
 			}
 
 			close(p.ordersCh)
@@ -166,35 +223,213 @@ func TestWorker(t *testing.T) {
 	}
 }
 
-func TestWorker_RetryAfter(t *testing.T) {
+func TestWorker_InProgress(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	repo := mocks.NewMockRepository(ctrl)
 	retryer := retryables.NewRetryer(nil)
 	retryer.SetCount(1)
+	retryer.SetDelay(0, 0)
+
+	client := &fakeClient{responses: map[string][]fakeResponse{
+		"12345": {{resp: accrual.Response{Order: "12345", Status: accrual.StatusProcessing}}},
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Незавершённый заказ возвращается в ordersCh через recheckInterval, и воркер опрашивает его снова до остановки
+	p := &processor{
+		repo:             repo,
+		retryer:          retryer,
+		publisher:        events.NewBroker(10),
+		breaker:          breaker.NewBreaker("accrual", testBreakerConfig),
+		client:           client,
+		ordersCh:         make(chan models.Order, 1),
+		returnedOrdersCh: make(chan models.Order, 10),
+		errCh:            make(chan error, 10),
+		recheckInterval:  time.Millisecond * 50,
+	}
+
+	checked := make(chan time.Time, 2)
+	repo.EXPECT().MarkOrderChecked(gomock.Any(), "12345").
+		DoAndReturn(func(context.Context, string) error {
+			select {
+			case checked <- time.Now():
+			default:
+			}
+			return nil
+		}).MinTimes(2)
+	// Заказ, ожидающий повторного опроса при остановке, возвращается в NEW
+	var resets int
+	repo.EXPECT().ResetStatus(gomock.Any(), "12345").
+		DoAndReturn(func(context.Context, string) error {
+			resets++
+			return nil
+		}).MaxTimes(1)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.worker(ctx)
+	}()
+
+	p.ordersCh <- models.Order{Number: "12345", Status: "PROCESSING"}
 
-	// Accrual mock сначала вернет 429, а потом 200
-	requestCount := 0
-	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if requestCount == 0 {
-			w.Header().Set("Retry-After", "2")
-			w.WriteHeader(http.StatusTooManyRequests)
-			requestCount++
-		} else {
-			w.WriteHeader(http.StatusOK)
-			fmt.Fprintf(w, `{"Number": "retry_after_test", "Status": "PROCESSED"}`)
+	var times []time.Time
+	for len(times) < 2 {
+		select {
+		case at := <-checked:
+			times = append(times, at)
+		case <-time.After(time.Second):
+			t.Fatalf("Order was not marked checked")
 		}
-	}))
-	defer mockServer.Close()
+	}
+	assert.GreaterOrEqual(t, times[1].Sub(times[0]), p.recheckInterval)
+
+	cancel()
+	wg.Wait()
+	p.delayed.Wait()
+	assert.Empty(t, p.returnedOrdersCh)
+	// Заказ либо сброшен, либо остался в ordersCh, который сбрасывает ProcessOrders
+	assert.Equal(t, 1, resets+len(p.ordersCh))
+}
+
+func TestWorker_NotRegistered(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+	retryer.SetDelay(0, 0)
+
+	// 204 считается успехом breaker'а, поэтому пауза между опросами только от recheckInterval
+	client := &fakeClient{responses: map[string][]fakeResponse{}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p := &processor{
+		repo:             repo,
+		retryer:          retryer,
+		publisher:        events.NewBroker(10),
+		breaker:          breaker.NewBreaker("accrual", testBreakerConfig),
+		client:           client,
+		ordersCh:         make(chan models.Order, 1),
+		returnedOrdersCh: make(chan models.Order, 10),
+		errCh:            make(chan error, 10),
+		recheckInterval:  time.Millisecond * 50,
+	}
+	repo.EXPECT().ResetStatus(gomock.Any(), "12345").Return(nil).MaxTimes(1)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.worker(ctx)
+	}()
+
+	p.ordersCh <- models.Order{Number: "12345", Status: "PROCESSING"}
+	assert.Eventually(t, func() bool { return client.Calls() >= 2 }, time.Second, time.Millisecond)
+
+	cancel()
+	wg.Wait()
+	p.delayed.Wait()
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	assert.GreaterOrEqual(t, client.callTimes[1].Sub(client.callTimes[0]), p.recheckInterval)
+	assert.Empty(t, p.returnedOrdersCh)
+}
+
+func TestRecheck_Shutdown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+	retryer.SetDelay(0, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Буферы как в NewProcessor, обработчика errCh нет, как после остановки
+	p := &processor{
+		repo:             repo,
+		retryer:          retryer,
+		ordersCh:         make(chan models.Order, 50),
+		returnedOrdersCh: make(chan models.Order, 50),
+		errCh:            make(chan error, 50),
+		recheckInterval:  time.Hour,
+	}
+
+	const pending = 80
+	var mu sync.Mutex
+	reset := map[string]bool{}
+	repo.EXPECT().ResetStatus(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, number string) error {
+			// Сброс идёт уже после отмены, но не с отменённым контекстом
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			mu.Lock()
+			reset[number] = true
+			mu.Unlock()
+			return nil
+		}).Times(pending)
+
+	for i := 0; i < pending; i++ {
+		p.recheck(ctx, models.Order{Number: fmt.Sprint(i), Status: "PROCESSING"})
+	}
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		p.delayed.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("Pending rechecks blocked shutdown")
+	}
+	assert.Len(t, reset, pending)
+}
+
+func TestWorker_RetryAfter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+	retryer.SetDelay(0, 0)
+
+	// Система начислений сначала вернет 429, а потом PROCESSED
+	accrualSum := 100.0
+	client := &fakeClient{responses: map[string][]fakeResponse{
+		"retry_after_test": {
+			{err: &accrual.RateLimitError{RetryAfter: 2 * time.Second}},
+			{resp: accrual.Response{Order: "retry_after_test", Status: accrual.StatusProcessed, Accrual: &accrualSum}},
+		},
+	}}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	broker := events.NewBroker(10)
+	orderEvents, unsubscribe := broker.Subscribe(1)
+	defer unsubscribe()
+
 	p := &processor{
 		repo:             repo,
 		retryer:          retryer,
-		accrualAddr:      mockServer.URL,
+		publisher:        broker,
+		breaker:          breaker.NewBreaker("accrual", testBreakerConfig),
+		client:           client,
 		ordersCh:         make(chan models.Order, 10),
 		returnedOrdersCh: make(chan models.Order, 10),
 		errCh:            make(chan error, 10),
@@ -207,7 +442,7 @@ func TestWorker_RetryAfter(t *testing.T) {
 		p.worker(ctx)
 	}()
 
-	order := models.Order{Number: "retry_after_test", Status: "NEW"}
+	order := models.Order{Number: "retry_after_test", UserID: 1, Status: "NEW"}
 	p.ordersCh <- order
 
 	start := time.Now()
@@ -225,13 +460,15 @@ func TestWorker_RetryAfter(t *testing.T) {
 
 	p.ordersCh <- returnedOrder
 
-	// Проверяем, что заказ обработан спустя `Retry-After`
+	// После UpdateOrder владелец получает событие с новым статусом, но не раньше `Retry-After`
 	select {
+	case event := <-orderEvents:
+		assert.GreaterOrEqual(t, time.Since(start).Seconds(), 2.0, "Worker did not wait for Retry-After duration")
+		assert.Equal(t, models.OrderEvent{UserID: 1, Number: "retry_after_test", Status: "PROCESSED", Accrual: &accrualSum}, event)
 	case finalOrder := <-p.returnedOrdersCh:
 		t.Fatalf("Order %s should not be in returnedOrdersCh again, it should be processed", finalOrder.Number)
-	case <-time.After(2 * time.Second):
-		duration := time.Since(start)
-		assert.GreaterOrEqual(t, duration.Seconds(), 2.0, "Worker did not wait for Retry-After duration")
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Order event was not published")
 	}
 
 	cancel()
@@ -241,3 +478,97 @@ func TestWorker_RetryAfter(t *testing.T) {
 	close(p.returnedOrdersCh)
 	close(p.errCh)
 }
+
+func (c *fakeClient) Calls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+func TestGetNewOrders_BreakerOpen(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+
+	b := breaker.NewBreaker("accrual", breaker.Config{FailureThreshold: 1, CoolDown: time.Minute})
+	b.Failure()
+
+	p := processor{
+		repo:             repo,
+		retryer:          retryables.NewRetryer(nil),
+		publisher:        events.NewBroker(10),
+		breaker:          b,
+		ordersCh:         make(chan models.Order, 10),
+		returnedOrdersCh: make(chan models.Order, 10),
+		errCh:            make(chan error, 1),
+		getInterval:      time.Millisecond * 10,
+	}
+
+	// Пока breaker открыт, заказы не переводятся в PROCESSING
+	repo.EXPECT().SelectNewOrders(gomock.Any()).Times(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	p.getNewOrders(ctx)
+
+	assert.Empty(t, p.ordersCh)
+}
+
+func TestWorker_BreakerOpen(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	retryer := retryables.NewRetryer(nil)
+	retryer.SetCount(1)
+
+	serverError := fakeResponse{err: fmt.Errorf("%w: 503 Service Unavailable", apperrors.ErrAccrualServer)}
+	client := &fakeClient{responses: map[string][]fakeResponse{
+		"1": {serverError}, "2": {serverError}, "3": {serverError},
+	}}
+
+	coolDown := time.Millisecond * 300
+	p := &processor{
+		repo:             repo,
+		retryer:          retryer,
+		publisher:        events.NewBroker(10),
+		client:           client,
+		breaker:          breaker.NewBreaker("accrual", breaker.Config{FailureThreshold: 2, CoolDown: coolDown}),
+		ordersCh:         make(chan models.Order, 10),
+		returnedOrdersCh: make(chan models.Order, 10),
+		errCh:            make(chan error, 10),
+		recheckInterval:  time.Hour,
+	}
+	// Заказы с ошибкой ждут повторного опроса и при остановке возвращаются в NEW
+	repo.EXPECT().ResetStatus(gomock.Any(), gomock.Any()).Return(nil).Times(3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.worker(ctx)
+	}()
+
+	for _, number := range []string{"1", "2", "3"} {
+		p.ordersCh <- models.Order{Number: number, Status: "PROCESSING"}
+	}
+
+	// Две ошибки открывают breaker, третий заказ ждёт у воркера
+	assert.Eventually(t, func() bool { return client.Calls() == 2 }, time.Second, time.Millisecond)
+	time.Sleep(coolDown / 2)
+	assert.Equal(t, 2, client.Calls())
+	assert.Equal(t, breaker.Open, p.breaker.State())
+
+	// После cool-down проходит пробный запрос, его ошибка снова открывает breaker
+	assert.Eventually(t, func() bool { return client.Calls() == 3 }, coolDown*2, time.Millisecond)
+	assert.Eventually(t, func() bool { return p.breaker.State() == breaker.Open }, time.Second, time.Millisecond)
+
+	cancel()
+	wg.Wait()
+	p.delayed.Wait()
+	assert.Empty(t, p.returnedOrdersCh)
+}
@@ -0,0 +1,84 @@
+package passwords
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+func testConfig(algorithm string) Config {
+	config := DefaultConfig()
+	config.Algorithm = algorithm
+	config.BcryptCost = bcrypt.MinCost
+	config.Argon2Memory = 64
+	return config
+}
+
+func TestHasher_HashAndCompare(t *testing.T) {
+	for _, algorithm := range []string{Bcrypt, Argon2id} {
+		t.Run(algorithm, func(t *testing.T) {
+			h, err := NewHasher(testConfig(algorithm))
+			require.NoError(t, err)
+
+			hash, err := h.Hash("correct-horse-battery")
+			require.NoError(t, err)
+			assert.False(t, h.NeedsRehash(hash))
+
+			ok, err := h.Compare(hash, "correct-horse-battery")
+			assert.NoError(t, err)
+			assert.True(t, ok)
+
+			ok, err = h.Compare(hash, "wrong")
+			assert.NoError(t, err)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestHasher_NeedsRehash(t *testing.T) {
+	oldBcrypt, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	argonHasher, err := NewHasher(testConfig(Argon2id))
+	require.NoError(t, err)
+	argonHash, err := argonHasher.Hash("secret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(argonHash, "$argon2id$v=19$m=64,t=2,p=1$"))
+
+	strongerConfig := testConfig(Bcrypt)
+	strongerConfig.BcryptCost = bcrypt.MinCost + 1
+	strongerBcrypt, err := NewHasher(strongerConfig)
+	require.NoError(t, err)
+
+	strongerArgonConfig := testConfig(Argon2id)
+	strongerArgonConfig.Argon2Time = 3
+	strongerArgon, err := NewHasher(strongerArgonConfig)
+	require.NoError(t, err)
+
+	assert.True(t, strongerBcrypt.NeedsRehash(string(oldBcrypt)), "bcrypt cost bump")
+	assert.True(t, strongerBcrypt.NeedsRehash(argonHash), "argon2id to bcrypt")
+	assert.True(t, argonHasher.NeedsRehash(string(oldBcrypt)), "bcrypt to argon2id")
+	assert.True(t, strongerArgon.NeedsRehash(argonHash), "argon2id parameters bump")
+
+	// Старые хеши по-прежнему проверяются после смены политики
+	ok, err := argonHasher.Compare(string(oldBcrypt), "secret")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = strongerBcrypt.Compare(argonHash, "secret")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestHasher_InvalidInput(t *testing.T) {
+	_, err := NewHasher(Config{Algorithm: "md5"})
+	assert.Error(t, err)
+	_, err = NewHasher(Config{Algorithm: Bcrypt, BcryptCost: 100})
+	assert.Error(t, err)
+
+	h, err := NewHasher(testConfig(Argon2id))
+	require.NoError(t, err)
+	_, err = h.Compare("$argon2id$v=19$broken", "secret")
+	assert.ErrorIs(t, err, ErrUnknownHash)
+}
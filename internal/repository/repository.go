@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/golang-migrate/migrate/v4"
@@ -14,20 +15,79 @@ import (
 	"github.com/lib/pq"
 	"github.com/llaxzi/gophermart/internal/apperrors"
 	"github.com/llaxzi/gophermart/internal/models"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Repository interface {
-	InsertUser(ctx context.Context, user models.User) error
-	SelectUser(ctx context.Context, userLogin string) (string, error)
+	InsertUser(ctx context.Context, user models.User) (int64, error)
+	SelectUser(ctx context.Context, userLogin string) (int64, string, error)
+	SelectPassword(ctx context.Context, userID int64) (string, error)
+	SelectAccount(ctx context.Context, userID int64) (models.Account, error)
+	SelectUserID(ctx context.Context, userLogin string) (int64, error)
+	UpdateUserRole(ctx context.Context, userID int64, role string) error
+	UpdateLogin(ctx context.Context, userID int64, userLogin string) error
 	InsertOrder(ctx context.Context, order models.Order) error
-	SelectOrders(ctx context.Context, userLogin string) ([]models.OrderResponse, error)
-	SelectBalance(ctx context.Context, userLogin string) (models.Balance, error)
+	InsertOrders(ctx context.Context, userID int64, numbers []string, uploadedAt time.Time) (map[string]string, error)
+	SelectOrders(ctx context.Context, userID int64) ([]models.OrderResponse, error)
+	SelectOrdersPage(ctx context.Context, userID int64, filter models.OrderFilter) ([]models.OrderResponse, *models.Cursor, error)
+	SelectOrder(ctx context.Context, userID int64, number string) (models.OrderDetail, error)
+	SelectBalance(ctx context.Context, userID int64) (models.Balance, error)
 	WithdrawBalance(ctx context.Context, withdrawal models.Withdrawal) error
-	SelectWithdrawals(ctx context.Context, userLogin string) ([]models.WithdrawalResponse, error)
+	SelectWithdrawals(ctx context.Context, userID int64) ([]models.WithdrawalResponse, error)
+	SelectWithdrawalsPage(ctx context.Context, userID int64, filter models.WithdrawalFilter) ([]models.WithdrawalResponse, *models.Cursor, error)
+	SelectWithdrawalTotals(ctx context.Context, userID int64, filter models.WithdrawalFilter) (models.WithdrawalTotals, error)
 	SelectNewOrders(ctx context.Context) ([]models.Order, error)
 	UpdateOrder(ctx context.Context, order models.Order) error
+	MarkOrderChecked(ctx context.Context, number string) error
+	Notify(ctx context.Context, channel string, payload string) error
 	ResetStatus(ctx context.Context, orderNumber string) error
+	InsertRefreshToken(ctx context.Context, token models.RefreshToken) error
+	UseRefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error)
+	RevokeRefreshFamily(ctx context.Context, tokenHash string, userID int64) error
+	SelectTokenRevocation(ctx context.Context, jti string, userID int64, sessionID string) (models.TokenRevocation, error)
+	RevokeToken(ctx context.Context, jti string, userID int64, expiresAt time.Time) error
+	RevokeAllTokens(ctx context.Context, userID int64, at time.Time) error
+	DeleteExpiredTokens(ctx context.Context, before time.Time) error
+	UpdatePassword(ctx context.Context, userID int64, password string, changedAt time.Time) error
+	UpdatePasswordHash(ctx context.Context, userID int64, oldHash string, newHash string) error
+	SelectLockedUntil(ctx context.Context, keys []string) (time.Time, error)
+	IncrementLoginFailures(ctx context.Context, key string, at time.Time, windowStart time.Time) (int, error)
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	DeleteLoginAttempts(ctx context.Context, key string) error
+	DeleteStaleLoginAttempts(ctx context.Context, windowStart time.Time, now time.Time) error
+	InsertAPIKey(ctx context.Context, userID int64, key models.APIKey, keyHash string) error
+	SelectAPIKeys(ctx context.Context, userID int64) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID int64, id string, at time.Time) error
+	UseAPIKey(ctx context.Context, keyHash string, at time.Time) (models.Account, []string, error)
+	InsertWebhook(ctx context.Context, userID int64, webhook models.Webhook, secret string) error
+	SelectWebhooks(ctx context.Context, userID int64) ([]models.Webhook, error)
+	DeleteWebhook(ctx context.Context, userID int64, id string) error
+	SelectWebhookDeliveries(ctx context.Context, userID int64, webhookID string, limit int) ([]models.WebhookDelivery, error)
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]models.WebhookTask, error)
+	CompleteWebhookDelivery(ctx context.Context, id int64, statusCode int, at time.Time) error
+	FailWebhookDelivery(ctx context.Context, id int64, statusCode int, reason string, nextAttemptAt *time.Time) error
+	SelectTOTP(ctx context.Context, userID int64) (models.TOTP, error)
+	UpdateTOTPSecret(ctx context.Context, userID int64, secret string) error
+	EnableTOTP(ctx context.Context, userID int64, counter int64, codeHashes []string) error
+	DisableTOTP(ctx context.Context, userID int64) error
+	UseTOTPCounter(ctx context.Context, userID int64, counter int64) error
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string, at time.Time) error
+	InsertMFAChallenge(ctx context.Context, tokenHash string, userID int64, expiresAt time.Time) error
+	UseMFAChallenge(ctx context.Context, tokenHash string, maxAttempts int, at time.Time) (models.Account, error)
+	DeleteMFAChallenge(ctx context.Context, tokenHash string) error
+	SaveSession(ctx context.Context, session models.Session) error
+	SelectSessions(ctx context.Context, userID int64) ([]models.Session, error)
+	RevokeSession(ctx context.Context, userID int64, id string, at time.Time) error
+	SelectSessionHistory(ctx context.Context, userID int64) ([]models.Session, error)
+	SelectProfile(ctx context.Context, userID int64) (models.Profile, error)
+	DeleteUser(ctx context.Context, userID int64) error
+	InsertOIDCState(ctx context.Context, state models.OIDCState) error
+	UseOIDCState(ctx context.Context, stateHash string, at time.Time) (models.OIDCState, error)
+	SelectIdentityAccount(ctx context.Context, issuer string, subject string) (models.Account, error)
+	SelectIdentities(ctx context.Context, userID int64) ([]models.OIDCIdentity, error)
+	InsertFederatedUser(ctx context.Context, userLogin string, identity models.OIDCIdentity) (int64, error)
 	Bootstrap(dsn string, steps int) error
 }
 
@@ -43,38 +103,142 @@ type repository struct {
 	db *sql.DB
 }
 
-func (r *repository) InsertUser(ctx context.Context, user models.User) error {
-	query := "INSERT INTO gophermart.users(login,password,balance_current,balance_withdrawn) VALUES ($1,$2,$3,$4)"
-	_, err := r.db.ExecContext(ctx, query, user.Login, user.Password, 0, 0)
+func (r *repository) InsertUser(ctx context.Context, user models.User) (int64, error) {
+	var userID int64
+	query := "INSERT INTO gophermart.users(login,password,balance_current,balance_withdrawn) VALUES ($1,$2,$3,$4) RETURNING id"
+	err := r.db.QueryRowContext(ctx, query, user.Login, user.Password, 0, 0).Scan(&userID)
 
 	if r.isPgConnErr(err) {
-		return apperrors.ErrPgConnExc
+		return 0, apperrors.ErrPgConnExc
 	}
 	if r.isPgUniqueViolationErr(err) {
-		return apperrors.ErrLoginTaken
+		return 0, apperrors.ErrLoginTaken
 	}
 
-	return err
+	return userID, err
+}
+
+// SelectUser возвращает ID и хеш пароля по логину
+func (r *repository) SelectUser(ctx context.Context, userLogin string) (int64, string, error) {
+	var userID int64
+	var password sql.NullString
+	query := "SELECT id, password FROM gophermart.users WHERE login = $1"
+
+	if err := r.db.QueryRowContext(ctx, query, userLogin).Scan(&userID, &password); err != nil {
+		if r.isPgConnErr(err) {
+			return 0, "", apperrors.ErrPgConnExc
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, "", apperrors.ErrInvalidLP
+		}
+		return 0, "", err
+	}
+	// У пользователя, созданного входом через OIDC, пароля нет
+	if !password.Valid {
+		return 0, "", apperrors.ErrInvalidLP
+	}
+	return userID, password.String, nil
 }
 
-func (r *repository) SelectUser(ctx context.Context, userLogin string) (string, error) {
-	var password string
-	query := "SELECT password FROM gophermart.users WHERE login = $1"
+func (r *repository) SelectPassword(ctx context.Context, userID int64) (string, error) {
+	var password sql.NullString
+	query := "SELECT password FROM gophermart.users WHERE id = $1"
 
-	if err := r.db.QueryRowContext(ctx, query, userLogin).Scan(&password); err != nil {
+	if err := r.db.QueryRowContext(ctx, query, userID).Scan(&password); err != nil {
 		if r.isPgConnErr(err) {
 			return "", apperrors.ErrPgConnExc
 		}
 		if errors.Is(err, sql.ErrNoRows) {
 			return "", apperrors.ErrInvalidLP
 		}
+		return "", err
+	}
+	if !password.Valid {
+		return "", apperrors.ErrInvalidLP
+	}
+	return password.String, nil
+}
+
+func (r *repository) SelectAccount(ctx context.Context, userID int64) (models.Account, error) {
+	account := models.Account{ID: userID}
+	query := "SELECT login, role FROM gophermart.users WHERE id = $1"
+
+	if err := r.db.QueryRowContext(ctx, query, userID).Scan(&account.Login, &account.Role); err != nil {
+		if r.isPgConnErr(err) {
+			return account, apperrors.ErrPgConnExc
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return account, apperrors.ErrUserNotFound
+		}
+		return account, err
+	}
+	return account, nil
+}
+
+func (r *repository) SelectUserID(ctx context.Context, userLogin string) (int64, error) {
+	var userID int64
+	query := "SELECT id FROM gophermart.users WHERE login = $1"
+
+	if err := r.db.QueryRowContext(ctx, query, userLogin).Scan(&userID); err != nil {
+		if r.isPgConnErr(err) {
+			return 0, apperrors.ErrPgConnExc
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, apperrors.ErrUserNotFound
+		}
+		return 0, err
+	}
+	return userID, nil
+}
+
+func (r *repository) UpdateUserRole(ctx context.Context, userID int64, role string) error {
+	query := "UPDATE gophermart.users SET role = $1 WHERE id = $2"
+	res, err := r.db.ExecContext(ctx, query, role, userID)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return apperrors.ErrUserNotFound
+	}
+	return nil
+}
+
+// UpdateLogin переименовывает пользователя. Данные привязаны к ID и остаются за ним.
+func (r *repository) UpdateLogin(ctx context.Context, userID int64, userLogin string) error {
+	query := "UPDATE gophermart.users SET login = $1 WHERE id = $2"
+	res, err := r.db.ExecContext(ctx, query, userLogin, userID)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		if r.isPgUniqueViolationErr(err) {
+			return apperrors.ErrLoginTaken
+		}
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return apperrors.ErrUserNotFound
 	}
-	return password, nil
+	return nil
 }
 
 func (r *repository) InsertOrder(ctx context.Context, order models.Order) error {
-	query := "INSERT INTO gophermart.orders(number, login, status, uploaded_at) VALUES ($1,$2,$3,$4)"
-	_, err := r.db.ExecContext(ctx, query, order.Number, order.Login, order.Status, order.UploadedAt)
+	query := "WITH o AS (INSERT INTO gophermart.orders(number, user_id, status, uploaded_at) VALUES ($1,$2,$3,$4) RETURNING number, status, uploaded_at) " +
+		"INSERT INTO gophermart.order_status_history(order_number, status, changed_at) SELECT number, status, uploaded_at FROM o"
+	_, err := r.db.ExecContext(ctx, query, order.Number, order.UserID, order.Status, order.UploadedAt)
 	if r.isPgConnErr(err) {
 		return apperrors.ErrPgConnExc
 	}
@@ -82,22 +246,85 @@ func (r *repository) InsertOrder(ctx context.Context, order models.Order) error
 		return err
 	}
 
-	var orderLogin string
-	query = "SELECT login FROM gophermart.orders WHERE number = $1"
-	err = r.db.QueryRowContext(ctx, query, order.Number).Scan(&orderLogin)
+	var orderUserID int64
+	query = "SELECT user_id FROM gophermart.orders WHERE number = $1"
+	err = r.db.QueryRowContext(ctx, query, order.Number).Scan(&orderUserID)
 	if err != nil {
 		return err
 	}
 
-	if orderLogin == order.Login {
+	if orderUserID == order.UserID {
 		return apperrors.ErrOrderInserted
 	}
 	return apperrors.ErrOrderInsertedLogin
 }
 
-func (r *repository) SelectOrders(ctx context.Context, userLogin string) ([]models.OrderResponse, error) {
-	query := "SELECT number,status,accrual,uploaded_at FROM gophermart.orders WHERE login = $1 ORDER BY uploaded_at DESC"
-	rows, err := r.db.QueryContext(ctx, query, userLogin)
+// InsertOrders загружает номера одним запросом и возвращает результат для каждого номера
+// (models.BatchAccepted, BatchDuplicateOwn или BatchOwnedByOther). Номера должны быть уникальны.
+func (r *repository) InsertOrders(ctx context.Context, userID int64, numbers []string, uploadedAt time.Time) (map[string]string, error) {
+	// Вторая часть UNION видит снимок до вставки, поэтому возвращает только уже существовавшие заказы
+	query := "WITH ins AS (INSERT INTO gophermart.orders(number, user_id, status, uploaded_at) " +
+		"SELECT unnest($1::varchar[]), $2, 'NEW', $3 ON CONFLICT (number) DO NOTHING RETURNING number, status, uploaded_at), " +
+		"hist AS (INSERT INTO gophermart.order_status_history(order_number, status, changed_at) SELECT number, status, uploaded_at FROM ins) " +
+		"SELECT number, $2::bigint, TRUE FROM ins UNION ALL SELECT number, user_id, FALSE FROM gophermart.orders WHERE number = ANY($1)"
+	results, err := r.scanBatchResults(ctx, userID, query, pq.Array(numbers), userID, uploadedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Номер, вставленный параллельной транзакцией, не попадает ни в одну из частей, перечитываем владельца
+	var missing []string
+	for _, number := range numbers {
+		if _, ok := results[number]; !ok {
+			missing = append(missing, number)
+		}
+	}
+	if len(missing) > 0 {
+		query = "SELECT number, user_id, FALSE FROM gophermart.orders WHERE number = ANY($1)"
+		owners, err := r.scanBatchResults(ctx, userID, query, pq.Array(missing))
+		if err != nil {
+			return nil, err
+		}
+		for number, result := range owners {
+			results[number] = result
+		}
+	}
+	return results, nil
+}
+
+func (r *repository) scanBatchResults(ctx context.Context, userID int64, query string, args ...interface{}) (map[string]string, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return nil, apperrors.ErrPgConnExc
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make(map[string]string)
+	for rows.Next() {
+		var number string
+		var ownerID int64
+		var inserted bool
+		if err = rows.Scan(&number, &ownerID, &inserted); err != nil {
+			return nil, err
+		}
+		switch {
+		case inserted:
+			results[number] = models.BatchAccepted
+		case ownerID == userID:
+			results[number] = models.BatchDuplicateOwn
+		default:
+			results[number] = models.BatchOwnedByOther
+		}
+	}
+	return results, rows.Err()
+}
+
+func (r *repository) SelectOrders(ctx context.Context, userID int64) ([]models.OrderResponse, error) {
+	query := "SELECT number,status,accrual,uploaded_at FROM gophermart.orders WHERE user_id = $1 ORDER BY uploaded_at DESC"
+	rows, err := r.db.QueryContext(ctx, query, userID)
 	if err != nil {
 		if r.isPgConnErr(err) {
 			return nil, apperrors.ErrPgConnExc
@@ -126,14 +353,113 @@ func (r *repository) SelectOrders(ctx context.Context, userLogin string) ([]mode
 	return orders, nil
 }
 
-func (r *repository) SelectBalance(ctx context.Context, userLogin string) (models.Balance, error) {
-	query := "SELECT balance_current, balance_withdrawn FROM gophermart.users WHERE login = $1"
+// SelectOrdersPage - страница заказов по (uploaded_at, number), индекс orders_user_uploaded_idx.
+// Курсор следующей страницы nil, если страница последняя.
+func (r *repository) SelectOrdersPage(ctx context.Context, userID int64, filter models.OrderFilter) ([]models.OrderResponse, *models.Cursor, error) {
+	q := newPageQuery("uploaded_at", "number", userID)
+	if len(filter.Statuses) > 0 {
+		q.where("status = ANY(%s::gophermart.status[])", pq.Array(filter.Statuses))
+	}
+	query := "SELECT number,status,accrual,uploaded_at FROM gophermart.orders WHERE " + q.build(filter.PageFilter)
+
+	rows, err := r.db.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return nil, nil, apperrors.ErrPgConnExc
+		}
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var orders []models.OrderResponse
+	var next *models.Cursor
+	var last models.Cursor
+	for rows.Next() {
+		// Лишняя строка означает, что есть следующая страница
+		if filter.Limit > 0 && len(orders) == filter.Limit {
+			next = &last
+			break
+		}
+		var order models.OrderResponse
+		var accr sql.NullFloat64
+		var uploadedAt time.Time
+		if err = rows.Scan(&order.Number, &order.Status, &accr, &uploadedAt); err != nil {
+			return nil, nil, err
+		}
+		if accr.Valid {
+			order.Accrual = &accr.Float64
+		}
+		order.UploadedAt = uploadedAt.Format(time.RFC3339)
+		orders = append(orders, order)
+		last = models.Cursor{Time: uploadedAt, Key: order.Number}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return orders, next, nil
+}
+
+// SelectOrder - заказ пользователя с историей статусов.
+// Чужой и несуществующий заказ неотличимы: в обоих случаях ErrOrderNotFound.
+func (r *repository) SelectOrder(ctx context.Context, userID int64, number string) (models.OrderDetail, error) {
+	var order models.OrderDetail
+	var accr sql.NullFloat64
+	var uploadedAt time.Time
+	var checkedAt sql.NullTime
+	query := "SELECT number,status,accrual,uploaded_at,checked_at FROM gophermart.orders WHERE number = $1 AND user_id = $2"
+	err := r.db.QueryRowContext(ctx, query, number, userID).Scan(&order.Number, &order.Status, &accr, &uploadedAt, &checkedAt)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return order, apperrors.ErrPgConnExc
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return order, apperrors.ErrOrderNotFound
+		}
+		return order, err
+	}
+	if accr.Valid {
+		order.Accrual = &accr.Float64
+	}
+	order.UploadedAt = uploadedAt.Format(time.RFC3339)
+	if checkedAt.Valid {
+		formatted := checkedAt.Time.Format(time.RFC3339)
+		order.CheckedAt = &formatted
+	}
+
+	query = "SELECT status, changed_at FROM gophermart.order_status_history WHERE order_number = $1 ORDER BY changed_at, id"
+	rows, err := r.db.QueryContext(ctx, query, number)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return order, apperrors.ErrPgConnExc
+		}
+		return order, err
+	}
+	defer rows.Close()
+
+	order.History = []models.OrderStatusChange{}
+	for rows.Next() {
+		var change models.OrderStatusChange
+		var changedAt time.Time
+		if err = rows.Scan(&change.Status, &changedAt); err != nil {
+			return order, err
+		}
+		change.ChangedAt = changedAt.Format(time.RFC3339)
+		order.History = append(order.History, change)
+	}
+	return order, rows.Err()
+}
+
+func (r *repository) SelectBalance(ctx context.Context, userID int64) (models.Balance, error) {
+	query := "SELECT balance_current, balance_withdrawn FROM gophermart.users WHERE id = $1"
 	var balance models.Balance
-	err := r.db.QueryRowContext(ctx, query, userLogin).Scan(&balance.Current, &balance.Withdrawn)
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&balance.Current, &balance.Withdrawn)
 
 	if r.isPgConnErr(err) {
 		return balance, apperrors.ErrPgConnExc
 	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return balance, apperrors.ErrUserNotFound
+	}
 
 	return balance, err
 
@@ -154,8 +480,8 @@ func (r *repository) WithdrawBalance(ctx context.Context, withdrawal models.With
 		}
 	}()
 
-	query := "UPDATE gophermart.users SET balance_current = balance_current - $1, balance_withdrawn = balance_withdrawn + $1 WHERE login = $2 AND balance_current >= $1 RETURNING balance_current"
-	res, err := tx.ExecContext(ctx, query, withdrawal.Sum, withdrawal.Login)
+	query := "UPDATE gophermart.users SET balance_current = balance_current - $1, balance_withdrawn = balance_withdrawn + $1 WHERE id = $2 AND balance_current >= $1 RETURNING balance_current"
+	res, err := tx.ExecContext(ctx, query, withdrawal.Sum, withdrawal.UserID)
 	if err != nil {
 		if r.isPgConnErr(err) {
 			return apperrors.ErrPgConnExc
@@ -176,8 +502,8 @@ func (r *repository) WithdrawBalance(ctx context.Context, withdrawal models.With
 		return err
 	}
 
-	query = "INSERT INTO gophermart.withdrawals (order_id, login, sum, processed_at)  VALUES ($1, $2, $3, $4)"
-	_, err = tx.ExecContext(ctx, query, withdrawal.Order, withdrawal.Login, withdrawal.Sum, withdrawal.ProcessedAt)
+	query = "INSERT INTO gophermart.withdrawals (order_id, user_id, sum, processed_at)  VALUES ($1, $2, $3, $4)"
+	_, err = tx.ExecContext(ctx, query, withdrawal.Order, withdrawal.UserID, withdrawal.Sum, withdrawal.ProcessedAt)
 	if err != nil {
 		if r.isPgConnErr(err) {
 			return apperrors.ErrPgConnExc
@@ -185,6 +511,10 @@ func (r *repository) WithdrawBalance(ctx context.Context, withdrawal models.With
 		return err
 	}
 
+	if err = r.enqueueWebhooks(ctx, tx, withdrawal.UserID, models.EventWithdrawalCreated, withdrawal); err != nil {
+		return err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		if r.isPgConnErr(err) {
@@ -210,7 +540,7 @@ func (r *repository) SelectNewOrders(ctx context.Context) ([]models.Order, error
 		}
 	}()
 
-	query := "SELECT number,login, status, accrual FROM gophermart.orders WHERE status = 'NEW' ORDER BY uploaded_at FOR UPDATE SKIP LOCKED"
+	query := "SELECT number,user_id, status, accrual FROM gophermart.orders WHERE status = 'NEW' ORDER BY uploaded_at FOR UPDATE SKIP LOCKED"
 	rows, err := tx.QueryContext(ctx, query)
 	if err != nil {
 		if r.isPgConnErr(err) {
@@ -224,7 +554,7 @@ func (r *repository) SelectNewOrders(ctx context.Context) ([]models.Order, error
 	var orderNumbers []string
 	for rows.Next() {
 		var order models.Order
-		if err = rows.Scan(&order.Number, &order.Login, &order.Status, &order.Accrual); err != nil {
+		if err = rows.Scan(&order.Number, &order.UserID, &order.Status, &order.Accrual); err != nil {
 			return orders, err
 		}
 		orders = append(orders, order)
@@ -237,7 +567,8 @@ func (r *repository) SelectNewOrders(ctx context.Context) ([]models.Order, error
 	if len(orders) == 0 {
 		orders = []models.Order{}
 	} else {
-		updateQuery := "UPDATE gophermart.orders SET status = 'PROCESSING' where number = ANY($1)"
+		updateQuery := "WITH o AS (UPDATE gophermart.orders SET status = 'PROCESSING' where number = ANY($1) RETURNING number) " +
+			historyFrom("o", "'PROCESSING'")
 		_, err = tx.ExecContext(ctx, updateQuery, pq.Array(orderNumbers))
 		if err != nil {
 			if r.isPgConnErr(err) {
@@ -272,7 +603,8 @@ func (r *repository) UpdateOrder(ctx context.Context, order models.Order) error
 		}
 	}()
 
-	query := "UPDATE gophermart.orders SET status = $1, accrual = $2 WHERE number = $3"
+	query := "WITH o AS (UPDATE gophermart.orders SET status = $1, accrual = $2, checked_at = now() WHERE number = $3 RETURNING number) " +
+		historyFrom("o", "$1")
 	_, err = tx.ExecContext(ctx, query, order.Status, order.Accrual, order.Number)
 	if err != nil {
 		if r.isPgConnErr(err) {
@@ -282,8 +614,8 @@ func (r *repository) UpdateOrder(ctx context.Context, order models.Order) error
 	}
 
 	if order.Status == "PROCESSED" {
-		query = "UPDATE gophermart.users SET balance_current = balance_current + $1 WHERE login = $2 RETURNING balance_current"
-		_, err = tx.ExecContext(ctx, query, order.Accrual, order.Login)
+		query = "UPDATE gophermart.users SET balance_current = balance_current + $1 WHERE id = $2 RETURNING balance_current"
+		_, err = tx.ExecContext(ctx, query, order.Accrual, order.UserID)
 		if err != nil {
 			if r.isPgConnErr(err) {
 				return apperrors.ErrPgConnExc
@@ -292,6 +624,14 @@ func (r *repository) UpdateOrder(ctx context.Context, order models.Order) error
 		}
 	}
 
+	event := map[string]string{"PROCESSED": models.EventOrderProcessed, "INVALID": models.EventOrderInvalid}[order.Status]
+	if event != "" {
+		data := models.OrderEvent{Number: order.Number, Status: order.Status, Accrual: order.Accrual}
+		if err = r.enqueueWebhooks(ctx, tx, order.UserID, event, data); err != nil {
+			return err
+		}
+	}
+
 	if err = tx.Commit(); err != nil {
 		if r.isPgConnErr(err) {
 			return apperrors.ErrPgConnExc
@@ -302,8 +642,29 @@ func (r *repository) UpdateOrder(ctx context.Context, order models.Order) error
 	return nil
 }
 
+// MarkOrderChecked запоминает время опроса accrual, когда статус не изменился
+func (r *repository) MarkOrderChecked(ctx context.Context, number string) error {
+	query := "UPDATE gophermart.orders SET checked_at = now() WHERE number = $1"
+
+	_, err := r.db.ExecContext(ctx, query, number)
+	if r.isPgConnErr(err) {
+		return apperrors.ErrPgConnExc
+	}
+	return err
+}
+
+// Notify - NOTIFY в канал channel, доставляется всем слушающим инстансам после коммита
+func (r *repository) Notify(ctx context.Context, channel string, payload string) error {
+	_, err := r.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", channel, payload)
+	if r.isPgConnErr(err) {
+		return apperrors.ErrPgConnExc
+	}
+	return err
+}
+
 func (r *repository) ResetStatus(ctx context.Context, orderNumber string) error {
-	query := "UPDATE gophermart.orders SET status = 'NEW' WHERE number = $1"
+	query := "WITH o AS (UPDATE gophermart.orders SET status = 'NEW' WHERE number = $1 RETURNING number) " +
+		historyFrom("o", "'NEW'")
 
 	_, err := r.db.ExecContext(ctx, query, orderNumber)
 	if r.isPgConnErr(err) {
@@ -341,9 +702,9 @@ func (r *repository) isPgUniqueViolationErr(err error) bool {
 	return errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation
 }
 
-func (r *repository) SelectWithdrawals(ctx context.Context, userLogin string) ([]models.WithdrawalResponse, error) {
-	query := "SELECT order_id,sum,processed_at FROM gophermart.withdrawals WHERE login = $1 ORDER BY processed_at DESC"
-	rows, err := r.db.QueryContext(ctx, query, userLogin)
+func (r *repository) SelectWithdrawals(ctx context.Context, userID int64) ([]models.WithdrawalResponse, error) {
+	query := "SELECT order_id,sum,processed_at FROM gophermart.withdrawals WHERE user_id = $1 ORDER BY processed_at DESC"
+	rows, err := r.db.QueryContext(ctx, query, userID)
 	if err != nil {
 		if r.isPgConnErr(err) {
 			return nil, apperrors.ErrPgConnExc
@@ -368,3 +729,1270 @@ func (r *repository) SelectWithdrawals(ctx context.Context, userLogin string) ([
 	}
 	return withdrawals, nil
 }
+
+// SelectWithdrawalsPage - страница списаний по (processed_at, order_id), индекс withdrawals_user_processed_idx
+func (r *repository) SelectWithdrawalsPage(ctx context.Context, userID int64, filter models.WithdrawalFilter) ([]models.WithdrawalResponse, *models.Cursor, error) {
+	q := newPageQuery("processed_at", "order_id", userID)
+	if filter.MinSum > 0 {
+		q.where("sum >= %s", filter.MinSum)
+	}
+	query := "SELECT order_id,sum,processed_at FROM gophermart.withdrawals WHERE " + q.build(filter.PageFilter)
+
+	rows, err := r.db.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return nil, nil, apperrors.ErrPgConnExc
+		}
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var withdrawals []models.WithdrawalResponse
+	var next *models.Cursor
+	var last models.Cursor
+	for rows.Next() {
+		// Лишняя строка означает, что есть следующая страница
+		if filter.Limit > 0 && len(withdrawals) == filter.Limit {
+			next = &last
+			break
+		}
+		var withdrawal models.WithdrawalResponse
+		var processedAt time.Time
+		if err = rows.Scan(&withdrawal.Order, &withdrawal.Sum, &processedAt); err != nil {
+			return nil, nil, err
+		}
+		withdrawal.ProcessedAt = processedAt.Format(time.RFC3339)
+		withdrawals = append(withdrawals, withdrawal)
+		last = models.Cursor{Time: processedAt, Key: withdrawal.Order}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return withdrawals, next, nil
+}
+
+// SelectWithdrawalTotals - количество и сумма списаний под фильтром по всем страницам, курсор и лимит не учитываются
+func (r *repository) SelectWithdrawalTotals(ctx context.Context, userID int64, filter models.WithdrawalFilter) (models.WithdrawalTotals, error) {
+	q := newPageQuery("processed_at", "order_id", userID)
+	if filter.MinSum > 0 {
+		q.where("sum >= %s", filter.MinSum)
+	}
+	q.timeRange(filter.PageFilter)
+	query := "SELECT COUNT(*), COALESCE(SUM(sum), 0) FROM gophermart.withdrawals WHERE " + q.conditions()
+
+	var totals models.WithdrawalTotals
+	err := r.db.QueryRowContext(ctx, query, q.args...).Scan(&totals.Count, &totals.Sum)
+	if r.isPgConnErr(err) {
+		return totals, apperrors.ErrPgConnExc
+	}
+	return totals, err
+}
+
+func (r *repository) InsertRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	query := "INSERT INTO gophermart.refresh_tokens(token_hash, user_id, family_id, expires_at) VALUES ($1,$2,$3,$4)"
+	_, err := r.db.ExecContext(ctx, query, token.Hash, token.UserID, token.FamilyID, token.ExpiresAt)
+	if r.isPgConnErr(err) {
+		return apperrors.ErrPgConnExc
+	}
+	return err
+}
+
+// UseRefreshToken помечает refresh токен использованным и возвращает его.
+// Повторное использование токена отзывает всё семейство (ротация с обнаружением кражи).
+func (r *repository) UseRefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error) {
+	var token models.RefreshToken
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return token, apperrors.ErrPgConnExc
+		}
+		return token, err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var usedAt sql.NullTime
+	var revoked bool
+	query := "SELECT user_id, family_id, expires_at, used_at, revoked FROM gophermart.refresh_tokens WHERE token_hash = $1 FOR UPDATE"
+	err = tx.QueryRowContext(ctx, query, tokenHash).Scan(&token.UserID, &token.FamilyID, &token.ExpiresAt, &usedAt, &revoked)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return token, apperrors.ErrPgConnExc
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			err = apperrors.ErrInvalidRefresh
+		}
+		return token, err
+	}
+	token.Hash = tokenHash
+
+	if usedAt.Valid {
+		query = "UPDATE gophermart.refresh_tokens SET revoked = TRUE WHERE family_id = $1"
+		if _, err = tx.ExecContext(ctx, query, token.FamilyID); err != nil {
+			if r.isPgConnErr(err) {
+				return token, apperrors.ErrPgConnExc
+			}
+			return token, err
+		}
+		if err = tx.Commit(); err != nil {
+			if r.isPgConnErr(err) {
+				return token, apperrors.ErrPgConnExc
+			}
+			return token, err
+		}
+		return token, apperrors.ErrRefreshReused
+	}
+
+	if revoked || time.Now().After(token.ExpiresAt) {
+		err = apperrors.ErrInvalidRefresh
+		return token, err
+	}
+
+	query = "UPDATE gophermart.refresh_tokens SET used_at = $1 WHERE token_hash = $2"
+	if _, err = tx.ExecContext(ctx, query, time.Now(), tokenHash); err != nil {
+		if r.isPgConnErr(err) {
+			return token, apperrors.ErrPgConnExc
+		}
+		return token, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		if r.isPgConnErr(err) {
+			return token, apperrors.ErrPgConnExc
+		}
+		return token, err
+	}
+	return token, nil
+}
+
+func (r *repository) RevokeRefreshFamily(ctx context.Context, tokenHash string, userID int64) error {
+	query := "UPDATE gophermart.refresh_tokens SET revoked = TRUE WHERE family_id = (SELECT family_id FROM gophermart.refresh_tokens WHERE token_hash = $1 AND user_id = $2)"
+	_, err := r.db.ExecContext(ctx, query, tokenHash, userID)
+	if r.isPgConnErr(err) {
+		return apperrors.ErrPgConnExc
+	}
+	return err
+}
+
+// SelectTokenRevocation - удалённый пользователь считается отозванным.
+// Смена пароля отзывает токены так же, как выход со всех устройств.
+func (r *repository) SelectTokenRevocation(ctx context.Context, jti string, userID int64, sessionID string) (models.TokenRevocation, error) {
+	var revocation models.TokenRevocation
+	var revokedAt sql.NullTime
+	query := "SELECT EXISTS(SELECT 1 FROM gophermart.revoked_tokens WHERE jti = $1) " +
+		"OR EXISTS(SELECT 1 FROM gophermart.sessions WHERE id = $3 AND revoked_at IS NOT NULL), " +
+		"GREATEST(tokens_revoked_at, password_changed_at) FROM gophermart.users WHERE id = $2"
+
+	err := r.db.QueryRowContext(ctx, query, jti, userID, sessionID).Scan(&revocation.Revoked, &revokedAt)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return revocation, apperrors.ErrPgConnExc
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			revocation.Revoked = true
+			return revocation, nil
+		}
+		return revocation, err
+	}
+	if revokedAt.Valid {
+		revocation.RevokedBefore = revokedAt.Time
+	}
+	return revocation, nil
+}
+
+func (r *repository) RevokeToken(ctx context.Context, jti string, userID int64, expiresAt time.Time) error {
+	query := "INSERT INTO gophermart.revoked_tokens(jti, user_id, expires_at) VALUES ($1,$2,$3) ON CONFLICT (jti) DO NOTHING"
+	_, err := r.db.ExecContext(ctx, query, jti, userID, expiresAt)
+	if r.isPgConnErr(err) {
+		return apperrors.ErrPgConnExc
+	}
+	return err
+}
+
+// DeleteExpiredTokens удаляет истёкшие refresh токены и записи об отзыве истёкших access токенов:
+// истёкший токен отклоняется и без них
+func (r *repository) DeleteExpiredTokens(ctx context.Context, before time.Time) error {
+	for _, query := range []string{
+		"DELETE FROM gophermart.revoked_tokens WHERE expires_at < $1",
+		"DELETE FROM gophermart.refresh_tokens WHERE expires_at < $1",
+	} {
+		if _, err := r.db.ExecContext(ctx, query, before); err != nil {
+			if r.isPgConnErr(err) {
+				return apperrors.ErrPgConnExc
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// RevokeAllTokens отзывает все access токены, выпущенные до at, все refresh токены и сессии пользователя
+func (r *repository) RevokeAllTokens(ctx context.Context, userID int64, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query := "UPDATE gophermart.users SET tokens_revoked_at = $1 WHERE id = $2"
+	if _, err = tx.ExecContext(ctx, query, at, userID); err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	query = "UPDATE gophermart.refresh_tokens SET revoked = TRUE WHERE user_id = $1 AND NOT revoked"
+	if _, err = tx.ExecContext(ctx, query, userID); err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	query = "UPDATE gophermart.sessions SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL"
+	if _, err = tx.ExecContext(ctx, query, at, userID); err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+	return nil
+}
+
+// UpdatePassword меняет хеш пароля, отзывает refresh токены и завершает сессии.
+// Access токены с iat раньше changedAt отклоняются через SelectTokenRevocation.
+func (r *repository) UpdatePassword(ctx context.Context, userID int64, password string, changedAt time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query := "UPDATE gophermart.users SET password = $1, password_changed_at = $2 WHERE id = $3"
+	if _, err = tx.ExecContext(ctx, query, password, changedAt, userID); err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	query = "UPDATE gophermart.refresh_tokens SET revoked = TRUE WHERE user_id = $1 AND NOT revoked"
+	if _, err = tx.ExecContext(ctx, query, userID); err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	query = "UPDATE gophermart.sessions SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL"
+	if _, err = tx.ExecContext(ctx, query, changedAt, userID); err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+	return nil
+}
+
+// UpdatePasswordHash заменяет хеш того же пароля на пересчитанный по текущей политике.
+// Токены не отзываются, а если пароль успели сменить, запись не меняется.
+func (r *repository) UpdatePasswordHash(ctx context.Context, userID int64, oldHash string, newHash string) error {
+	query := "UPDATE gophermart.users SET password = $1 WHERE id = $2 AND password = $3"
+	_, err := r.db.ExecContext(ctx, query, newHash, userID, oldHash)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+	return nil
+}
+
+// SelectLockedUntil - самая поздняя блокировка среди ключей, нулевое время если блокировок нет
+func (r *repository) SelectLockedUntil(ctx context.Context, keys []string) (time.Time, error) {
+	var lockedUntil sql.NullTime
+	query := "SELECT MAX(locked_until) FROM gophermart.login_attempts WHERE key = ANY($1)"
+
+	err := r.db.QueryRowContext(ctx, query, pq.Array(keys)).Scan(&lockedUntil)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return time.Time{}, apperrors.ErrPgConnExc
+		}
+		return time.Time{}, err
+	}
+	return lockedUntil.Time, nil
+}
+
+// IncrementLoginFailures возвращает число неудачных попыток с учётом текущей.
+// Если предыдущая попытка была раньше windowStart, счёт начинается заново.
+func (r *repository) IncrementLoginFailures(ctx context.Context, key string, at time.Time, windowStart time.Time) (int, error) {
+	var failures int
+	query := `INSERT INTO gophermart.login_attempts(key, failures, last_failure_at) VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+		failures = CASE WHEN gophermart.login_attempts.last_failure_at < $3 THEN 1 ELSE gophermart.login_attempts.failures + 1 END,
+		last_failure_at = $2
+		RETURNING failures`
+
+	err := r.db.QueryRowContext(ctx, query, key, at, windowStart).Scan(&failures)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return 0, apperrors.ErrPgConnExc
+		}
+		return 0, err
+	}
+	return failures, nil
+}
+
+func (r *repository) LockLogin(ctx context.Context, key string, until time.Time) error {
+	query := "UPDATE gophermart.login_attempts SET locked_until = $1 WHERE key = $2"
+	_, err := r.db.ExecContext(ctx, query, until, key)
+	if r.isPgConnErr(err) {
+		return apperrors.ErrPgConnExc
+	}
+	return err
+}
+
+func (r *repository) DeleteLoginAttempts(ctx context.Context, key string) error {
+	query := "DELETE FROM gophermart.login_attempts WHERE key = $1"
+	_, err := r.db.ExecContext(ctx, query, key)
+	if r.isPgConnErr(err) {
+		return apperrors.ErrPgConnExc
+	}
+	return err
+}
+
+// DeleteStaleLoginAttempts удаляет счётчики без неудач с windowStart, блокировка которых истекла к now
+func (r *repository) DeleteStaleLoginAttempts(ctx context.Context, windowStart time.Time, now time.Time) error {
+	query := "DELETE FROM gophermart.login_attempts WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until < $2)"
+	_, err := r.db.ExecContext(ctx, query, windowStart, now)
+	if r.isPgConnErr(err) {
+		return apperrors.ErrPgConnExc
+	}
+	return err
+}
+
+func (r *repository) InsertAPIKey(ctx context.Context, userID int64, key models.APIKey, keyHash string) error {
+	query := "INSERT INTO gophermart.api_keys(id, user_id, name, key_hash, scopes, created_at) VALUES ($1,$2,$3,$4,$5,$6)"
+	_, err := r.db.ExecContext(ctx, query, key.ID, userID, key.Name, keyHash, pq.Array(key.Scopes), key.CreatedAt)
+
+	if r.isPgConnErr(err) {
+		return apperrors.ErrPgConnExc
+	}
+	if r.isPgUniqueViolationErr(err) {
+		return apperrors.ErrAPIKeyNameTaken
+	}
+	return err
+}
+
+// SelectAPIKeys возвращает активные ключи пользователя
+func (r *repository) SelectAPIKeys(ctx context.Context, userID int64) ([]models.APIKey, error) {
+	query := "SELECT id, name, scopes, created_at, last_used_at FROM gophermart.api_keys WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC"
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return nil, apperrors.ErrPgConnExc
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		var key models.APIKey
+		var lastUsedAt sql.NullTime
+		if err = rows.Scan(&key.ID, &key.Name, pq.Array(&key.Scopes), &key.CreatedAt, &lastUsedAt); err != nil {
+			return keys, err
+		}
+		if lastUsedAt.Valid {
+			key.LastUsedAt = &lastUsedAt.Time
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return keys, err
+	}
+	return keys, nil
+}
+
+func (r *repository) RevokeAPIKey(ctx context.Context, userID int64, id string, at time.Time) error {
+	query := "UPDATE gophermart.api_keys SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL"
+	res, err := r.db.ExecContext(ctx, query, at, id, userID)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return apperrors.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// UseAPIKey отмечает использование активного ключа и возвращает его владельца и scopes
+func (r *repository) UseAPIKey(ctx context.Context, keyHash string, at time.Time) (models.Account, []string, error) {
+	var account models.Account
+	var scopes []string
+
+	query := "UPDATE gophermart.api_keys k SET last_used_at = $1 FROM gophermart.users u " +
+		"WHERE k.key_hash = $2 AND k.revoked_at IS NULL AND u.id = k.user_id RETURNING u.id, u.login, u.role, k.scopes"
+	err := r.db.QueryRowContext(ctx, query, at, keyHash).Scan(&account.ID, &account.Login, &account.Role, pq.Array(&scopes))
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return account, nil, apperrors.ErrPgConnExc
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return account, nil, apperrors.ErrInvalidAPIKey
+		}
+		return account, nil, err
+	}
+	return account, scopes, nil
+}
+
+func (r *repository) SelectTOTP(ctx context.Context, userID int64) (models.TOTP, error) {
+	var totp models.TOTP
+	var secret sql.NullString
+	var lastCounter sql.NullInt64
+	query := "SELECT totp_secret, totp_enabled, totp_last_counter FROM gophermart.users WHERE id = $1"
+
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&secret, &totp.Enabled, &lastCounter)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return totp, apperrors.ErrPgConnExc
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return totp, apperrors.ErrUserNotFound
+		}
+		return totp, err
+	}
+	totp.Secret = secret.String
+	totp.LastCounter = lastCounter.Int64
+	return totp, nil
+}
+
+// UpdateTOTPSecret сохраняет секрет незавершённой настройки, включённый второй фактор не трогает
+func (r *repository) UpdateTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	query := "UPDATE gophermart.users SET totp_secret = $1, totp_last_counter = NULL WHERE id = $2 AND NOT totp_enabled"
+	res, err := r.db.ExecContext(ctx, query, secret, userID)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return apperrors.ErrTOTPEnabled
+	}
+	return nil
+}
+
+// EnableTOTP включает второй фактор и заменяет коды восстановления
+func (r *repository) EnableTOTP(ctx context.Context, userID int64, counter int64, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query := "UPDATE gophermart.users SET totp_enabled = TRUE, totp_last_counter = $1 WHERE id = $2 AND NOT totp_enabled AND totp_secret IS NOT NULL"
+	res, err := tx.ExecContext(ctx, query, counter, userID)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		err = apperrors.ErrTOTPEnabled
+		return err
+	}
+
+	query = "DELETE FROM gophermart.totp_recovery_codes WHERE user_id = $1"
+	if _, err = tx.ExecContext(ctx, query, userID); err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	query = "INSERT INTO gophermart.totp_recovery_codes(user_id, code_hash) SELECT $1, unnest($2::text[])"
+	if _, err = tx.ExecContext(ctx, query, userID, pq.Array(codeHashes)); err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *repository) DisableTOTP(ctx context.Context, userID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query := "UPDATE gophermart.users SET totp_secret = NULL, totp_enabled = FALSE, totp_last_counter = NULL WHERE id = $1"
+	if _, err = tx.ExecContext(ctx, query, userID); err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	query = "DELETE FROM gophermart.totp_recovery_codes WHERE user_id = $1"
+	if _, err = tx.ExecContext(ctx, query, userID); err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+	return nil
+}
+
+// UseTOTPCounter принимает шаг TOTP, только если он новее последнего принятого
+func (r *repository) UseTOTPCounter(ctx context.Context, userID int64, counter int64) error {
+	query := "UPDATE gophermart.users SET totp_last_counter = $1 WHERE id = $2 AND (totp_last_counter IS NULL OR totp_last_counter < $1)"
+	res, err := r.db.ExecContext(ctx, query, counter, userID)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return apperrors.ErrInvalidTOTP
+	}
+	return nil
+}
+
+func (r *repository) UseRecoveryCode(ctx context.Context, userID int64, codeHash string, at time.Time) error {
+	query := "UPDATE gophermart.totp_recovery_codes SET used_at = $1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL"
+	res, err := r.db.ExecContext(ctx, query, at, userID, codeHash)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return apperrors.ErrInvalidTOTP
+	}
+	return nil
+}
+
+// InsertMFAChallenge заодно удаляет просроченные challenge пользователя
+func (r *repository) InsertMFAChallenge(ctx context.Context, tokenHash string, userID int64, expiresAt time.Time) error {
+	query := "DELETE FROM gophermart.mfa_challenges WHERE user_id = $1 AND expires_at < now()"
+	if _, err := r.db.ExecContext(ctx, query, userID); err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	query = "INSERT INTO gophermart.mfa_challenges(token_hash, user_id, expires_at) VALUES ($1,$2,$3)"
+	_, err := r.db.ExecContext(ctx, query, tokenHash, userID, expiresAt)
+	if r.isPgConnErr(err) {
+		return apperrors.ErrPgConnExc
+	}
+	return err
+}
+
+// UseMFAChallenge засчитывает попытку ввода кода и возвращает владельца токена.
+// Просроченный токен или токен с исчерпанными попытками недействителен.
+func (r *repository) UseMFAChallenge(ctx context.Context, tokenHash string, maxAttempts int, at time.Time) (models.Account, error) {
+	var account models.Account
+	query := "UPDATE gophermart.mfa_challenges c SET attempts = c.attempts + 1 FROM gophermart.users u " +
+		"WHERE c.token_hash = $1 AND c.expires_at > $2 AND c.attempts < $3 AND u.id = c.user_id RETURNING u.id, u.login, u.role"
+
+	err := r.db.QueryRowContext(ctx, query, tokenHash, at, maxAttempts).Scan(&account.ID, &account.Login, &account.Role)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return account, apperrors.ErrPgConnExc
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return account, apperrors.ErrInvalidMFAToken
+		}
+		return account, err
+	}
+	return account, nil
+}
+
+func (r *repository) DeleteMFAChallenge(ctx context.Context, tokenHash string) error {
+	query := "DELETE FROM gophermart.mfa_challenges WHERE token_hash = $1"
+	_, err := r.db.ExecContext(ctx, query, tokenHash)
+	if r.isPgConnErr(err) {
+		return apperrors.ErrPgConnExc
+	}
+	return err
+}
+
+// SaveSession создаёт сессию, а для существующей обновляет время и IP последнего обращения
+func (r *repository) SaveSession(ctx context.Context, session models.Session) error {
+	query := "INSERT INTO gophermart.sessions(id, user_id, user_agent, ip, created_at, last_seen_at) VALUES ($1,$2,$3,$4,$5,$6) " +
+		"ON CONFLICT (id) DO UPDATE SET ip = EXCLUDED.ip, last_seen_at = EXCLUDED.last_seen_at"
+	_, err := r.db.ExecContext(ctx, query, session.ID, session.UserID, session.UserAgent, session.IP, session.CreatedAt, session.LastSeenAt)
+	if r.isPgConnErr(err) {
+		return apperrors.ErrPgConnExc
+	}
+	return err
+}
+
+// SelectSessions возвращает активные сессии, последние использованные первыми
+func (r *repository) SelectSessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	query := "SELECT id, user_agent, ip, created_at, last_seen_at FROM gophermart.sessions WHERE user_id = $1 AND revoked_at IS NULL ORDER BY last_seen_at DESC"
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return nil, apperrors.ErrPgConnExc
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		session := models.Session{UserID: userID}
+		if err = rows.Scan(&session.ID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt); err != nil {
+			return sessions, err
+		}
+		sessions = append(sessions, session)
+	}
+	if err = rows.Err(); err != nil {
+		return sessions, err
+	}
+	return sessions, nil
+}
+
+// RevokeSession завершает сессию и отзывает её refresh токены.
+// Access токены сессии отклоняются через SelectTokenRevocation.
+func (r *repository) RevokeSession(ctx context.Context, userID int64, id string, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query := "UPDATE gophermart.sessions SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL"
+	res, err := tx.ExecContext(ctx, query, at, id, userID)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		err = apperrors.ErrSessionNotFound
+		return err
+	}
+
+	query = "UPDATE gophermart.refresh_tokens SET revoked = TRUE WHERE family_id = $1 AND user_id = $2 AND NOT revoked"
+	if _, err = tx.ExecContext(ctx, query, id, userID); err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+	return nil
+}
+
+// SelectSessionHistory возвращает все сессии пользователя, включая завершённые
+func (r *repository) SelectSessionHistory(ctx context.Context, userID int64) ([]models.Session, error) {
+	query := "SELECT id, user_agent, ip, created_at, last_seen_at, revoked_at FROM gophermart.sessions WHERE user_id = $1 ORDER BY created_at DESC"
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return nil, apperrors.ErrPgConnExc
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		session := models.Session{UserID: userID}
+		var revokedAt sql.NullTime
+		if err = rows.Scan(&session.ID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt, &revokedAt); err != nil {
+			return sessions, err
+		}
+		if revokedAt.Valid {
+			session.RevokedAt = &revokedAt.Time
+		}
+		sessions = append(sessions, session)
+	}
+	if err = rows.Err(); err != nil {
+		return sessions, err
+	}
+	return sessions, nil
+}
+
+func (r *repository) SelectProfile(ctx context.Context, userID int64) (models.Profile, error) {
+	profile := models.Profile{ID: userID}
+	var passwordChangedAt sql.NullTime
+	query := "SELECT login, role, balance_current, balance_withdrawn, totp_enabled, password_changed_at FROM gophermart.users WHERE id = $1"
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&profile.Login, &profile.Role, &profile.Balance.Current, &profile.Balance.Withdrawn,
+		&profile.TOTPEnabled, &passwordChangedAt)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return profile, apperrors.ErrPgConnExc
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return profile, apperrors.ErrUserNotFound
+		}
+		return profile, err
+	}
+	if passwordChangedAt.Valid {
+		profile.PasswordChangedAt = &passwordChangedAt.Time
+	}
+	return profile, nil
+}
+
+// DeleteUser удаляет пользователя вместе со всеми его данными и счётчиками неудачных попыток.
+// Таблицы перечислены в порядке внешних ключей, users - последней.
+func (r *repository) DeleteUser(ctx context.Context, userID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	tables := []string{
+		"revoked_tokens",
+		"refresh_tokens",
+		"sessions",
+		"api_keys",
+		"totp_recovery_codes",
+		"mfa_challenges",
+		"user_identities",
+		"webhooks",
+		"withdrawals",
+		"orders",
+	}
+	for _, table := range tables {
+		if _, err = tx.ExecContext(ctx, "DELETE FROM gophermart."+table+" WHERE user_id = $1", userID); err != nil {
+			if r.isPgConnErr(err) {
+				return apperrors.ErrPgConnExc
+			}
+			return err
+		}
+	}
+
+	var login string
+	err = tx.QueryRowContext(ctx, "DELETE FROM gophermart.users WHERE id = $1 RETURNING login", userID).Scan(&login)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			err = apperrors.ErrUserNotFound
+		}
+		return err
+	}
+
+	// Счётчики неудач по логину и кодам второго фактора (ключи lockout.LoginKey и lockout.TOTPKey),
+	// иначе блокировка достанется тому, кто зарегистрирует освободившийся логин
+	keys := []string{"login:" + login, "totp:" + strconv.FormatInt(userID, 10)}
+	if _, err = tx.ExecContext(ctx, "DELETE FROM gophermart.login_attempts WHERE key = ANY($1)", pq.Array(keys)); err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+	return nil
+}
+
+// InsertOIDCState сохраняет начатый вход через провайдера и удаляет просроченные
+func (r *repository) InsertOIDCState(ctx context.Context, state models.OIDCState) error {
+	query := "DELETE FROM gophermart.oidc_states WHERE expires_at < now()"
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	query = "INSERT INTO gophermart.oidc_states(state_hash, code_verifier, nonce, expires_at) VALUES ($1,$2,$3,$4)"
+	_, err := r.db.ExecContext(ctx, query, state.StateHash, state.Verifier, state.Nonce, state.ExpiresAt)
+	if r.isPgConnErr(err) {
+		return apperrors.ErrPgConnExc
+	}
+	return err
+}
+
+// UseOIDCState удаляет state и возвращает его: повторный callback с тем же state недействителен
+func (r *repository) UseOIDCState(ctx context.Context, stateHash string, at time.Time) (models.OIDCState, error) {
+	state := models.OIDCState{StateHash: stateHash}
+	query := "DELETE FROM gophermart.oidc_states WHERE state_hash = $1 RETURNING code_verifier, nonce, expires_at"
+
+	err := r.db.QueryRowContext(ctx, query, stateHash).Scan(&state.Verifier, &state.Nonce, &state.ExpiresAt)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return state, apperrors.ErrPgConnExc
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return state, apperrors.ErrInvalidOIDCState
+		}
+		return state, err
+	}
+	if !at.Before(state.ExpiresAt) {
+		return state, apperrors.ErrInvalidOIDCState
+	}
+	return state, nil
+}
+
+func (r *repository) SelectIdentityAccount(ctx context.Context, issuer string, subject string) (models.Account, error) {
+	var account models.Account
+	query := "SELECT u.id, u.login, u.role FROM gophermart.user_identities i JOIN gophermart.users u ON u.id = i.user_id " +
+		"WHERE i.issuer = $1 AND i.subject = $2"
+
+	err := r.db.QueryRowContext(ctx, query, issuer, subject).Scan(&account.ID, &account.Login, &account.Role)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return account, apperrors.ErrPgConnExc
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return account, apperrors.ErrUserNotFound
+		}
+		return account, err
+	}
+	return account, nil
+}
+
+func (r *repository) SelectIdentities(ctx context.Context, userID int64) ([]models.OIDCIdentity, error) {
+	query := "SELECT issuer, subject, created_at FROM gophermart.user_identities WHERE user_id = $1 ORDER BY created_at"
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return nil, apperrors.ErrPgConnExc
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []models.OIDCIdentity
+	for rows.Next() {
+		var identity models.OIDCIdentity
+		if err = rows.Scan(&identity.Issuer, &identity.Subject, &identity.CreatedAt); err != nil {
+			return identities, err
+		}
+		identities = append(identities, identity)
+	}
+	if err = rows.Err(); err != nil {
+		return identities, err
+	}
+	return identities, nil
+}
+
+// InsertFederatedUser создаёт пользователя без пароля и привязывает к нему внешний аккаунт
+func (r *repository) InsertFederatedUser(ctx context.Context, userLogin string, identity models.OIDCIdentity) (int64, error) {
+	var userID int64
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return 0, apperrors.ErrPgConnExc
+		}
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query := "INSERT INTO gophermart.users(login,password,balance_current,balance_withdrawn) VALUES ($1,NULL,0,0) RETURNING id"
+	if err = tx.QueryRowContext(ctx, query, userLogin).Scan(&userID); err != nil {
+		if r.isPgConnErr(err) {
+			return 0, apperrors.ErrPgConnExc
+		}
+		if r.isPgUniqueViolationErr(err) {
+			return 0, apperrors.ErrLoginTaken
+		}
+		return 0, err
+	}
+
+	query = "INSERT INTO gophermart.user_identities(issuer, subject, user_id, created_at) VALUES ($1,$2,$3,$4)"
+	if _, err = tx.ExecContext(ctx, query, identity.Issuer, identity.Subject, userID, identity.CreatedAt); err != nil {
+		if r.isPgConnErr(err) {
+			return 0, apperrors.ErrPgConnExc
+		}
+		if r.isPgUniqueViolationErr(err) {
+			return 0, apperrors.ErrLoginTaken
+		}
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		if r.isPgConnErr(err) {
+			return 0, apperrors.ErrPgConnExc
+		}
+		return 0, err
+	}
+	return userID, nil
+}
+
+func (r *repository) InsertWebhook(ctx context.Context, userID int64, webhook models.Webhook, secret string) error {
+	query := "INSERT INTO gophermart.webhooks(id, user_id, url, secret, events, created_at) VALUES ($1,$2,$3,$4,$5,$6)"
+	_, err := r.db.ExecContext(ctx, query, webhook.ID, userID, webhook.URL, secret, pq.Array(webhook.Events), webhook.CreatedAt)
+	if r.isPgConnErr(err) {
+		return apperrors.ErrPgConnExc
+	}
+	return err
+}
+
+func (r *repository) SelectWebhooks(ctx context.Context, userID int64) ([]models.Webhook, error) {
+	query := "SELECT id, url, events, created_at FROM gophermart.webhooks WHERE user_id = $1 ORDER BY created_at DESC"
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return nil, apperrors.ErrPgConnExc
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []models.Webhook
+	for rows.Next() {
+		var webhook models.Webhook
+		if err = rows.Scan(&webhook.ID, &webhook.URL, pq.Array(&webhook.Events), &webhook.CreatedAt); err != nil {
+			return webhooks, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook удаляет вебхук вместе с журналом и недоставленными событиями
+func (r *repository) DeleteWebhook(ctx context.Context, userID int64, id string) error {
+	query := "DELETE FROM gophermart.webhooks WHERE id = $1 AND user_id = $2"
+	res, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return apperrors.ErrPgConnExc
+		}
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return apperrors.ErrWebhookNotFound
+	}
+	return nil
+}
+
+// SelectWebhookDeliveries - последние limit доставок вебхука, сначала новые
+func (r *repository) SelectWebhookDeliveries(ctx context.Context, userID int64, webhookID string, limit int) ([]models.WebhookDelivery, error) {
+	var exists bool
+	query := "SELECT EXISTS(SELECT 1 FROM gophermart.webhooks WHERE id = $1 AND user_id = $2)"
+	err := r.db.QueryRowContext(ctx, query, webhookID, userID).Scan(&exists)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return nil, apperrors.ErrPgConnExc
+		}
+		return nil, err
+	}
+	if !exists {
+		return nil, apperrors.ErrWebhookNotFound
+	}
+
+	query = "SELECT id, event, status, attempts, last_status_code, last_error, created_at, next_attempt_at, delivered_at " +
+		"FROM gophermart.webhook_deliveries WHERE webhook_id = $1 ORDER BY id DESC LIMIT $2"
+	rows, err := r.db.QueryContext(ctx, query, webhookID, limit)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return nil, apperrors.ErrPgConnExc
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		var statusCode sql.NullInt64
+		var lastError sql.NullString
+		var nextAttemptAt, deliveredAt sql.NullTime
+		err = rows.Scan(&delivery.ID, &delivery.Event, &delivery.Status, &delivery.Attempts, &statusCode, &lastError,
+			&delivery.CreatedAt, &nextAttemptAt, &deliveredAt)
+		if err != nil {
+			return nil, err
+		}
+		if statusCode.Valid {
+			code := int(statusCode.Int64)
+			delivery.LastStatusCode = &code
+		}
+		if lastError.Valid {
+			delivery.LastError = &lastError.String
+		}
+		if nextAttemptAt.Valid {
+			delivery.NextAttemptAt = &nextAttemptAt.Time
+		}
+		if deliveredAt.Valid {
+			delivery.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// ClaimWebhookDeliveries берёт в работу доставки, срок которых наступил, и откладывает их до leaseUntil.
+// Если инстанс упадёт во время отправки, доставку после leaseUntil подхватит другой.
+func (r *repository) ClaimWebhookDeliveries(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]models.WebhookTask, error) {
+	query := "UPDATE gophermart.webhook_deliveries d SET attempts = d.attempts + 1, next_attempt_at = $2 " +
+		"FROM gophermart.webhooks w WHERE w.id = d.webhook_id AND d.id IN (" +
+		"SELECT id FROM gophermart.webhook_deliveries WHERE status = 'PENDING' AND next_attempt_at <= $1 " +
+		"ORDER BY next_attempt_at LIMIT $3 FOR UPDATE SKIP LOCKED) " +
+		"RETURNING d.id, w.url, w.secret, d.event, d.payload, d.attempts"
+	rows, err := r.db.QueryContext(ctx, query, now, leaseUntil, limit)
+	if err != nil {
+		if r.isPgConnErr(err) {
+			return nil, apperrors.ErrPgConnExc
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []models.WebhookTask
+	for rows.Next() {
+		var task models.WebhookTask
+		var payload string
+		if err = rows.Scan(&task.ID, &task.URL, &task.Secret, &task.Event, &payload, &task.Attempts); err != nil {
+			return nil, err
+		}
+		task.Payload = []byte(payload)
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+func (r *repository) CompleteWebhookDelivery(ctx context.Context, id int64, statusCode int, at time.Time) error {
+	query := "UPDATE gophermart.webhook_deliveries SET status = 'DELIVERED', last_status_code = $2, last_error = NULL, " +
+		"next_attempt_at = NULL, delivered_at = $3 WHERE id = $1"
+	_, err := r.db.ExecContext(ctx, query, id, statusCode, at)
+	if r.isPgConnErr(err) {
+		return apperrors.ErrPgConnExc
+	}
+	return err
+}
+
+// FailWebhookDelivery записывает неудачную попытку. nextAttemptAt == nil переводит доставку в DEAD.
+// statusCode 0 - ответа не было (таймаут, отказ в соединении).
+func (r *repository) FailWebhookDelivery(ctx context.Context, id int64, statusCode int, reason string, nextAttemptAt *time.Time) error {
+	status := models.DeliveryPending
+	if nextAttemptAt == nil {
+		status = models.DeliveryDead
+	}
+	query := "UPDATE gophermart.webhook_deliveries SET status = $2, last_status_code = $3, last_error = $4, next_attempt_at = $5 WHERE id = $1"
+	_, err := r.db.ExecContext(ctx, query, id, status, sql.NullInt64{Int64: int64(statusCode), Valid: statusCode != 0}, reason, nextAttemptAt)
+	if r.isPgConnErr(err) {
+		return apperrors.ErrPgConnExc
+	}
+	return err
+}
+
+// enqueueWebhooks ставит event в очередь доставки всем вебхукам пользователя, подписанным на него.
+// Выполняется в транзакции события: при откате доставка не уходит, после коммита не теряется.
+func (r *repository) enqueueWebhooks(ctx context.Context, tx *sql.Tx, userID int64, event string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(models.WebhookPayload{Event: event, CreatedAt: time.Now().UTC(), Data: raw})
+	if err != nil {
+		return err
+	}
+
+	query := "INSERT INTO gophermart.webhook_deliveries(webhook_id, event, payload, next_attempt_at, created_at) " +
+		"SELECT id, $2, $3, now(), now() FROM gophermart.webhooks WHERE user_id = $1 AND (events = '{}' OR $2 = ANY(events))"
+	_, err = tx.ExecContext(ctx, query, userID, event, string(payload))
+	if r.isPgConnErr(err) {
+		return apperrors.ErrPgConnExc
+	}
+	return err
+}
+
+// pageQuery собирает WHERE ... ORDER BY ... LIMIT для keyset пагинации по паре (timeCol, keyCol)
+type pageQuery struct {
+	timeCol, keyCol string
+	conds           []string
+	args            []interface{}
+}
+
+func newPageQuery(timeCol, keyCol string, userID int64) *pageQuery {
+	return &pageQuery{timeCol: timeCol, keyCol: keyCol, conds: []string{"user_id = $1"}, args: []interface{}{userID}}
+}
+
+// where добавляет условие, каждый %s в cond заменяется плейсхолдером очередного аргумента
+func (q *pageQuery) where(cond string, args ...interface{}) {
+	placeholders := make([]interface{}, len(args))
+	for i, arg := range args {
+		q.args = append(q.args, arg)
+		placeholders[i] = fmt.Sprintf("$%d", len(q.args))
+	}
+	q.conds = append(q.conds, fmt.Sprintf(cond, placeholders...))
+}
+
+// timeRange ограничивает timeCol диапазоном [From, To)
+func (q *pageQuery) timeRange(filter models.PageFilter) {
+	if filter.From != nil {
+		q.where(q.timeCol+" >= %s", *filter.From)
+	}
+	if filter.To != nil {
+		q.where(q.timeCol+" < %s", *filter.To)
+	}
+}
+
+func (q *pageQuery) conditions() string {
+	return strings.Join(q.conds, " AND ")
+}
+
+// build запрашивает Limit+1 строк, чтобы узнать, есть ли следующая страница. Limit 0 - все строки.
+func (q *pageQuery) build(filter models.PageFilter) string {
+	q.timeRange(filter)
+	cmp, dir := "<", "DESC"
+	if filter.Asc {
+		cmp, dir = ">", "ASC"
+	}
+	if filter.After != nil {
+		q.where("("+q.timeCol+", "+q.keyCol+") "+cmp+" (%s, %s)", filter.After.Time, filter.After.Key)
+	}
+	query := fmt.Sprintf("%s ORDER BY %s %s, %s %s", q.conditions(), q.timeCol, dir, q.keyCol, dir)
+	if filter.Limit > 0 {
+		q.args = append(q.args, filter.Limit+1)
+		query += fmt.Sprintf(" LIMIT $%d", len(q.args))
+	}
+	return query
+}
+
+// historyFrom - INSERT в историю статусов для заказов из CTE cte (колонка number), status - SQL выражение
+func historyFrom(cte string, status string) string {
+	return "INSERT INTO gophermart.order_status_history(order_number, status, changed_at) SELECT number, " +
+		status + "::gophermart.status, now() FROM " + cte
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"github.com/DATA-DOG/go-sqlmock"
@@ -34,21 +35,23 @@ func TestInsertUser(t *testing.T) {
 	tests := []struct {
 		name          string
 		mockBehavior  func()
+		expectedID    int64
 		expectedError error
 	}{
 		{
 			name: "Successful user insertion",
 			mockBehavior: func() {
-				mock.ExpectExec(`INSERT INTO gophermart\.users\(login,password,balance_current,balance_withdrawn\) VALUES \(\$1,\$2,\$3,\$4\)`).
+				mock.ExpectQuery(`INSERT INTO gophermart\.users\(login,password,balance_current,balance_withdrawn\) VALUES \(\$1,\$2,\$3,\$4\) RETURNING id`).
 					WithArgs(user.Login, user.Password, 0, 0).
-					WillReturnResult(sqlmock.NewResult(1, 1)) // ID = 1, затронуто 1 строка
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 			},
+			expectedID:    1,
 			expectedError: nil,
 		},
 		{
 			name: "Duplicate login error",
 			mockBehavior: func() {
-				mock.ExpectExec(`INSERT INTO gophermart\.users\(login,password,balance_current,balance_withdrawn\) VALUES \(\$1,\$2,\$3,\$4\)`).
+				mock.ExpectQuery(`INSERT INTO gophermart\.users\(login,password,balance_current,balance_withdrawn\) VALUES \(\$1,\$2,\$3,\$4\) RETURNING id`).
 					WithArgs(user.Login, user.Password, 0, 0).
 					WillReturnError(&pgconn.PgError{Code: "23505"}) // Симулируем ошибку уникальности
 			},
@@ -57,7 +60,7 @@ func TestInsertUser(t *testing.T) {
 		{
 			name: "Database connection error",
 			mockBehavior: func() {
-				mock.ExpectExec(`INSERT INTO gophermart\.users\(login,password,balance_current,balance_withdrawn\) VALUES \(\$1,\$2,\$3,\$4\)`).
+				mock.ExpectQuery(`INSERT INTO gophermart\.users\(login,password,balance_current,balance_withdrawn\) VALUES \(\$1,\$2,\$3,\$4\) RETURNING id`).
 					WithArgs(user.Login, user.Password, 0, 0).
 					WillReturnError(&pgconn.PgError{Code: "08006"}) // Симулируем ошибку соединения
 			},
@@ -66,7 +69,7 @@ func TestInsertUser(t *testing.T) {
 		{
 			name: "Unexpected database error",
 			mockBehavior: func() {
-				mock.ExpectExec(`INSERT INTO gophermart\.users\(login,password,balance_current,balance_withdrawn\) VALUES \(\$1,\$2,\$3,\$4\)`).
+				mock.ExpectQuery(`INSERT INTO gophermart\.users\(login,password,balance_current,balance_withdrawn\) VALUES \(\$1,\$2,\$3,\$4\) RETURNING id`).
 					WithArgs(user.Login, user.Password, 0, 0).
 					WillReturnError(errors.New("some unexpected error")) // Любая другая ошибка
 			},
@@ -79,10 +82,11 @@ func TestInsertUser(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			test.mockBehavior() // Настраиваем мок
 
-			err = repo.InsertUser(context.Background(), user)
+			userID, err := repo.InsertUser(context.Background(), user)
 
 			// Проверяем, что полученная ошибка соответствует ожидаемой
 			assert.Equal(t, test.expectedError, err)
+			assert.Equal(t, test.expectedID, userID)
 
 			// Проверяем, что все ожидания мока выполнены
 			assert.NoError(t, mock.ExpectationsWereMet())
@@ -90,6 +94,8 @@ func TestInsertUser(t *testing.T) {
 	}
 }
 
+const enqueueQuery = `INSERT INTO gophermart\.webhook_deliveries\(webhook_id, event, payload, next_attempt_at, created_at\) SELECT id, \$2, \$3, now\(\), now\(\) FROM gophermart\.webhooks WHERE user_id = \$1`
+
 func TestWithdrawBalance(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
@@ -98,7 +104,7 @@ func TestWithdrawBalance(t *testing.T) {
 	repo := repository{db: db}
 
 	withdrawal := models.Withdrawal{
-		Login:       "testuser",
+		UserID:      1,
 		Order:       "79927398713",
 		Sum:         50.00,
 		ProcessedAt: time.Now(),
@@ -114,14 +120,18 @@ func TestWithdrawBalance(t *testing.T) {
 			mockBehavior: func() {
 				mock.ExpectBegin()
 
-				mock.ExpectExec(`UPDATE gophermart\.users SET balance_current = balance_current - \$1, balance_withdrawn = balance_withdrawn \+ \$1 WHERE login = \$2 AND balance_current >= \$1`).
-					WithArgs(withdrawal.Sum, withdrawal.Login).
+				mock.ExpectExec(`UPDATE gophermart\.users SET balance_current = balance_current - \$1, balance_withdrawn = balance_withdrawn \+ \$1 WHERE id = \$2 AND balance_current >= \$1`).
+					WithArgs(withdrawal.Sum, withdrawal.UserID).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 
-				mock.ExpectExec(`INSERT INTO gophermart\.withdrawals \(order_id, login, sum, processed_at\) VALUES \(\$1, \$2, \$3, \$4\)`).
-					WithArgs(withdrawal.Order, withdrawal.Login, withdrawal.Sum, withdrawal.ProcessedAt).
+				mock.ExpectExec(`INSERT INTO gophermart\.withdrawals \(order_id, user_id, sum, processed_at\) VALUES \(\$1, \$2, \$3, \$4\)`).
+					WithArgs(withdrawal.Order, withdrawal.UserID, withdrawal.Sum, withdrawal.ProcessedAt).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 
+				mock.ExpectExec(enqueueQuery).
+					WithArgs(int64(1), models.EventWithdrawalCreated, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+
 				mock.ExpectCommit()
 			},
 			expectedError: nil,
@@ -131,8 +141,8 @@ func TestWithdrawBalance(t *testing.T) {
 			mockBehavior: func() {
 				mock.ExpectBegin()
 
-				mock.ExpectExec(`UPDATE gophermart\.users SET balance_current = balance_current - \$1, balance_withdrawn = balance_withdrawn \+ \$1 WHERE login = \$2 AND balance_current >= \$1`).
-					WithArgs(withdrawal.Sum, withdrawal.Login).
+				mock.ExpectExec(`UPDATE gophermart\.users SET balance_current = balance_current - \$1, balance_withdrawn = balance_withdrawn \+ \$1 WHERE id = \$2 AND balance_current >= \$1`).
+					WithArgs(withdrawal.Sum, withdrawal.UserID).
 					WillReturnResult(sqlmock.NewResult(0, 0))
 
 				mock.ExpectRollback()
@@ -144,8 +154,8 @@ func TestWithdrawBalance(t *testing.T) {
 			mockBehavior: func() {
 				mock.ExpectBegin()
 
-				mock.ExpectExec(`UPDATE gophermart\.users SET balance_current = balance_current - \$1, balance_withdrawn = balance_withdrawn \+ \$1 WHERE login = \$2 AND balance_current >= \$1`).
-					WithArgs(withdrawal.Sum, withdrawal.Login).
+				mock.ExpectExec(`UPDATE gophermart\.users SET balance_current = balance_current - \$1, balance_withdrawn = balance_withdrawn \+ \$1 WHERE id = \$2 AND balance_current >= \$1`).
+					WithArgs(withdrawal.Sum, withdrawal.UserID).
 					WillReturnError(&pgconn.PgError{Code: "08006"})
 
 				mock.ExpectRollback()
@@ -157,12 +167,33 @@ func TestWithdrawBalance(t *testing.T) {
 			mockBehavior: func() {
 				mock.ExpectBegin()
 
-				mock.ExpectExec(`UPDATE gophermart\.users SET balance_current = balance_current - \$1, balance_withdrawn = balance_withdrawn \+ \$1 WHERE login = \$2 AND balance_current >= \$1`).
-					WithArgs(withdrawal.Sum, withdrawal.Login).
+				mock.ExpectExec(`UPDATE gophermart\.users SET balance_current = balance_current - \$1, balance_withdrawn = balance_withdrawn \+ \$1 WHERE id = \$2 AND balance_current >= \$1`).
+					WithArgs(withdrawal.Sum, withdrawal.UserID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+
+				mock.ExpectExec(`INSERT INTO gophermart\.withdrawals \(order_id, user_id, sum, processed_at\) VALUES \(\$1, \$2, \$3, \$4\)`).
+					WithArgs(withdrawal.Order, withdrawal.UserID, withdrawal.Sum, withdrawal.ProcessedAt).
+					WillReturnError(&pgconn.PgError{Code: "08006"})
+
+				mock.ExpectRollback()
+			},
+			expectedError: apperrors.ErrPgConnExc,
+		},
+		{
+			name: "Database connection error during webhook enqueue",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+
+				mock.ExpectExec(`UPDATE gophermart\.users SET balance_current = balance_current - \$1, balance_withdrawn = balance_withdrawn \+ \$1 WHERE id = \$2 AND balance_current >= \$1`).
+					WithArgs(withdrawal.Sum, withdrawal.UserID).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 
-				mock.ExpectExec(`INSERT INTO gophermart\.withdrawals \(order_id, login, sum, processed_at\) VALUES \(\$1, \$2, \$3, \$4\)`).
-					WithArgs(withdrawal.Order, withdrawal.Login, withdrawal.Sum, withdrawal.ProcessedAt).
+				mock.ExpectExec(`INSERT INTO gophermart\.withdrawals \(order_id, user_id, sum, processed_at\) VALUES \(\$1, \$2, \$3, \$4\)`).
+					WithArgs(withdrawal.Order, withdrawal.UserID, withdrawal.Sum, withdrawal.ProcessedAt).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+
+				mock.ExpectExec(enqueueQuery).
+					WithArgs(int64(1), models.EventWithdrawalCreated, sqlmock.AnyArg()).
 					WillReturnError(&pgconn.PgError{Code: "08006"})
 
 				mock.ExpectRollback()
@@ -174,14 +205,18 @@ func TestWithdrawBalance(t *testing.T) {
 			mockBehavior: func() {
 				mock.ExpectBegin()
 
-				mock.ExpectExec(`UPDATE gophermart\.users SET balance_current = balance_current - \$1, balance_withdrawn = balance_withdrawn \+ \$1 WHERE login = \$2 AND balance_current >= \$1`).
-					WithArgs(withdrawal.Sum, withdrawal.Login).
+				mock.ExpectExec(`UPDATE gophermart\.users SET balance_current = balance_current - \$1, balance_withdrawn = balance_withdrawn \+ \$1 WHERE id = \$2 AND balance_current >= \$1`).
+					WithArgs(withdrawal.Sum, withdrawal.UserID).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 
-				mock.ExpectExec(`INSERT INTO gophermart\.withdrawals \(order_id, login, sum, processed_at\) VALUES \(\$1, \$2, \$3, \$4\)`).
-					WithArgs(withdrawal.Order, withdrawal.Login, withdrawal.Sum, withdrawal.ProcessedAt).
+				mock.ExpectExec(`INSERT INTO gophermart\.withdrawals \(order_id, user_id, sum, processed_at\) VALUES \(\$1, \$2, \$3, \$4\)`).
+					WithArgs(withdrawal.Order, withdrawal.UserID, withdrawal.Sum, withdrawal.ProcessedAt).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 
+				mock.ExpectExec(enqueueQuery).
+					WithArgs(int64(1), models.EventWithdrawalCreated, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+
 				mock.ExpectCommit().WillReturnError(&pgconn.PgError{Code: "08006"})
 			},
 			expectedError: apperrors.ErrPgConnExc,
@@ -211,8 +246,8 @@ func TestSelectNewOrders(t *testing.T) {
 	acr := 10.0
 
 	testOrders := []models.Order{
-		{Number: "12345", Login: "user1", Status: "NEW", Accrual: &acr},
-		{Number: "67890", Login: "user2", Status: "NEW", Accrual: &acr},
+		{Number: "12345", UserID: 1, Status: "NEW", Accrual: &acr},
+		{Number: "67890", UserID: 2, Status: "NEW", Accrual: &acr},
 	}
 
 	tests := []struct {
@@ -226,13 +261,13 @@ func TestSelectNewOrders(t *testing.T) {
 			mockBehavior: func() {
 				mock.ExpectBegin()
 
-				rows := sqlmock.NewRows([]string{"number", "login", "status", "accrual"}).
-					AddRow(testOrders[0].Number, testOrders[0].Login, testOrders[0].Status, *(testOrders[0].Accrual)).
-					AddRow(testOrders[1].Number, testOrders[1].Login, testOrders[1].Status, *(testOrders[1].Accrual))
-				mock.ExpectQuery(`SELECT number,login, status, accrual FROM gophermart\.orders WHERE status = 'NEW' ORDER BY uploaded_at FOR UPDATE SKIP LOCKED`).
+				rows := sqlmock.NewRows([]string{"number", "user_id", "status", "accrual"}).
+					AddRow(testOrders[0].Number, testOrders[0].UserID, testOrders[0].Status, *(testOrders[0].Accrual)).
+					AddRow(testOrders[1].Number, testOrders[1].UserID, testOrders[1].Status, *(testOrders[1].Accrual))
+				mock.ExpectQuery(`SELECT number,user_id, status, accrual FROM gophermart\.orders WHERE status = 'NEW' ORDER BY uploaded_at FOR UPDATE SKIP LOCKED`).
 					WillReturnRows(rows)
 
-				mock.ExpectExec(`UPDATE gophermart\.orders SET status = 'PROCESSING' where number = ANY\(\$1\)`).
+				mock.ExpectExec(`UPDATE gophermart\.orders SET status = 'PROCESSING' where number = ANY\(\$1\) RETURNING number\) INSERT INTO gophermart\.order_status_history`).
 					WithArgs(pq.Array([]string{testOrders[0].Number, testOrders[1].Number})).
 					WillReturnResult(sqlmock.NewResult(0, 2))
 
@@ -246,8 +281,8 @@ func TestSelectNewOrders(t *testing.T) {
 			mockBehavior: func() {
 				mock.ExpectBegin()
 
-				rows := sqlmock.NewRows([]string{"number", "login", "status", "accrual"})
-				mock.ExpectQuery(`SELECT number,login, status, accrual FROM gophermart\.orders WHERE status = 'NEW' ORDER BY uploaded_at FOR UPDATE SKIP LOCKED`).
+				rows := sqlmock.NewRows([]string{"number", "user_id", "status", "accrual"})
+				mock.ExpectQuery(`SELECT number,user_id, status, accrual FROM gophermart\.orders WHERE status = 'NEW' ORDER BY uploaded_at FOR UPDATE SKIP LOCKED`).
 					WillReturnRows(rows)
 
 				mock.ExpectCommit()
@@ -268,7 +303,7 @@ func TestSelectNewOrders(t *testing.T) {
 			mockBehavior: func() {
 				mock.ExpectBegin()
 
-				mock.ExpectQuery(`SELECT number,login, status, accrual FROM gophermart\.orders WHERE status = 'NEW' ORDER BY uploaded_at FOR UPDATE SKIP LOCKED`).
+				mock.ExpectQuery(`SELECT number,user_id, status, accrual FROM gophermart\.orders WHERE status = 'NEW' ORDER BY uploaded_at FOR UPDATE SKIP LOCKED`).
 					WillReturnError(&pgconn.PgError{Code: "08006"})
 			},
 			expectedError: apperrors.ErrPgConnExc,
@@ -280,10 +315,10 @@ func TestSelectNewOrders(t *testing.T) {
 				mock.ExpectBegin() // ✅ Начало транзакции
 
 				// ❌ Ошибка при `Scan`
-				rows := sqlmock.NewRows([]string{"number", "login", "status", "accrual"}).
-					AddRow("12345", "testuser", "NEW", "invalid_number") // Передаём некорректный `accrual`
+				rows := sqlmock.NewRows([]string{"number", "user_id", "status", "accrual"}).
+					AddRow("12345", 1, "NEW", "invalid_number") // Передаём некорректный `accrual`
 
-				mock.ExpectQuery(`SELECT number,login, status, accrual FROM gophermart\.orders WHERE status = 'NEW' ORDER BY uploaded_at FOR UPDATE SKIP LOCKED`).
+				mock.ExpectQuery(`SELECT number,user_id, status, accrual FROM gophermart\.orders WHERE status = 'NEW' ORDER BY uploaded_at FOR UPDATE SKIP LOCKED`).
 					WillReturnRows(rows)
 			},
 			expectedError: fmt.Errorf("sql: Scan error on column index 3, name \"accrual\": converting driver.Value type string (\"invalid_number\") to a float64: invalid syntax"),
@@ -294,9 +329,9 @@ func TestSelectNewOrders(t *testing.T) {
 			mockBehavior: func() {
 				mock.ExpectBegin()
 
-				rows := sqlmock.NewRows([]string{"number", "login", "status", "accrual"}).
-					AddRow(testOrders[0].Number, testOrders[0].Login, testOrders[0].Status, testOrders[0].Accrual)
-				mock.ExpectQuery(`SELECT number,login, status, accrual FROM gophermart\.orders WHERE status = 'NEW' ORDER BY uploaded_at FOR UPDATE SKIP LOCKED`).
+				rows := sqlmock.NewRows([]string{"number", "user_id", "status", "accrual"}).
+					AddRow(testOrders[0].Number, testOrders[0].UserID, testOrders[0].Status, testOrders[0].Accrual)
+				mock.ExpectQuery(`SELECT number,user_id, status, accrual FROM gophermart\.orders WHERE status = 'NEW' ORDER BY uploaded_at FOR UPDATE SKIP LOCKED`).
 					WillReturnRows(rows)
 
 				mock.ExpectExec(`UPDATE gophermart\.orders SET status = 'PROCESSING' where number = ANY\(\$1\)`).
@@ -311,9 +346,9 @@ func TestSelectNewOrders(t *testing.T) {
 			mockBehavior: func() {
 				mock.ExpectBegin()
 
-				rows := sqlmock.NewRows([]string{"number", "login", "status", "accrual"}).
-					AddRow(testOrders[0].Number, testOrders[0].Login, testOrders[0].Status, testOrders[0].Accrual)
-				mock.ExpectQuery(`SELECT number,login, status, accrual FROM gophermart\.orders WHERE status = 'NEW' ORDER BY uploaded_at FOR UPDATE SKIP LOCKED`).
+				rows := sqlmock.NewRows([]string{"number", "user_id", "status", "accrual"}).
+					AddRow(testOrders[0].Number, testOrders[0].UserID, testOrders[0].Status, testOrders[0].Accrual)
+				mock.ExpectQuery(`SELECT number,user_id, status, accrual FROM gophermart\.orders WHERE status = 'NEW' ORDER BY uploaded_at FOR UPDATE SKIP LOCKED`).
 					WillReturnRows(rows)
 
 				mock.ExpectExec(`UPDATE gophermart\.orders SET status = 'PROCESSING' where number = ANY\(\$1\)`).
@@ -373,19 +408,23 @@ func TestUpdateOrder(t *testing.T) {
 			name: "Successful order update",
 			order: models.Order{
 				Number:  "12345",
-				Login:   "testuser",
+				UserID:  1,
 				Status:  "PROCESSED",
 				Accrual: &accrual,
 			},
 			mockBehavior: func() {
 				mock.ExpectBegin()
 
-				mock.ExpectExec(`UPDATE gophermart\.orders SET status = \$1, accrual = \$2 WHERE number = \$3`).
+				mock.ExpectExec(`UPDATE gophermart\.orders SET status = \$1, accrual = \$2, checked_at = now\(\) WHERE number = \$3`).
 					WithArgs("PROCESSED", &accrual, "12345").
 					WillReturnResult(sqlmock.NewResult(0, 1))
 
-				mock.ExpectExec(`UPDATE gophermart\.users SET balance_current = balance_current \+ \$1 WHERE login = \$2 RETURNING balance_current`).
-					WithArgs(&accrual, "testuser").
+				mock.ExpectExec(`UPDATE gophermart\.users SET balance_current = balance_current \+ \$1 WHERE id = \$2 RETURNING balance_current`).
+					WithArgs(&accrual, int64(1)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+
+				mock.ExpectExec(enqueueQuery).
+					WithArgs(int64(1), models.EventOrderProcessed, sqlmock.AnyArg()).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 
 				mock.ExpectCommit()
@@ -396,14 +435,14 @@ func TestUpdateOrder(t *testing.T) {
 			name: "Successful order update without balance update",
 			order: models.Order{
 				Number:  "12345",
-				Login:   "testuser",
+				UserID:  1,
 				Status:  "NEW",
 				Accrual: &accrual,
 			},
 			mockBehavior: func() {
 				mock.ExpectBegin()
 
-				mock.ExpectExec(`UPDATE gophermart\.orders SET status = \$1, accrual = \$2 WHERE number = \$3`).
+				mock.ExpectExec(`UPDATE gophermart\.orders SET status = \$1, accrual = \$2, checked_at = now\(\) WHERE number = \$3`).
 					WithArgs("NEW", &accrual, "12345").
 					WillReturnResult(sqlmock.NewResult(0, 1))
 
@@ -411,6 +450,28 @@ func TestUpdateOrder(t *testing.T) {
 			},
 			expectedError: nil,
 		},
+		{
+			name: "Invalid order enqueues webhook without balance update",
+			order: models.Order{
+				Number: "12345",
+				UserID: 1,
+				Status: "INVALID",
+			},
+			mockBehavior: func() {
+				mock.ExpectBegin()
+
+				mock.ExpectExec(`UPDATE gophermart\.orders SET status = \$1, accrual = \$2, checked_at = now\(\) WHERE number = \$3`).
+					WithArgs("INVALID", nil, "12345").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+
+				mock.ExpectExec(enqueueQuery).
+					WithArgs(int64(1), models.EventOrderInvalid, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+
+				mock.ExpectCommit()
+			},
+			expectedError: nil,
+		},
 		{
 			name:  "Database connection error on Begin",
 			order: models.Order{},
@@ -429,7 +490,7 @@ func TestUpdateOrder(t *testing.T) {
 			mockBehavior: func() {
 				mock.ExpectBegin()
 
-				mock.ExpectExec(`UPDATE gophermart\.orders SET status = \$1, accrual = \$2 WHERE number = \$3`).
+				mock.ExpectExec(`UPDATE gophermart\.orders SET status = \$1, accrual = \$2, checked_at = now\(\) WHERE number = \$3`).
 					WithArgs("NEW", &accrual, "12345").
 					WillReturnError(&pgconn.PgError{Code: "08006"})
 			},
@@ -439,19 +500,19 @@ func TestUpdateOrder(t *testing.T) {
 			name: "Database error during user balance update",
 			order: models.Order{
 				Number:  "12345",
-				Login:   "testuser",
+				UserID:  1,
 				Status:  "PROCESSED",
 				Accrual: &accrual,
 			},
 			mockBehavior: func() {
 				mock.ExpectBegin()
 
-				mock.ExpectExec(`UPDATE gophermart\.orders SET status = \$1, accrual = \$2 WHERE number = \$3`).
+				mock.ExpectExec(`UPDATE gophermart\.orders SET status = \$1, accrual = \$2, checked_at = now\(\) WHERE number = \$3`).
 					WithArgs("PROCESSED", &accrual, "12345").
 					WillReturnResult(sqlmock.NewResult(0, 1))
 
-				mock.ExpectExec(`UPDATE gophermart\.users SET balance_current = balance_current \+ \$1 WHERE login = \$2 RETURNING balance_current`).
-					WithArgs(&accrual, "testuser").
+				mock.ExpectExec(`UPDATE gophermart\.users SET balance_current = balance_current \+ \$1 WHERE id = \$2 RETURNING balance_current`).
+					WithArgs(&accrual, int64(1)).
 					WillReturnError(&pgconn.PgError{Code: "08006"})
 			},
 			expectedError: apperrors.ErrPgConnExc,
@@ -460,19 +521,23 @@ func TestUpdateOrder(t *testing.T) {
 			name: "Database error during COMMIT",
 			order: models.Order{
 				Number:  "12345",
-				Login:   "testuser",
+				UserID:  1,
 				Status:  "PROCESSED",
 				Accrual: &accrual,
 			},
 			mockBehavior: func() {
 				mock.ExpectBegin()
 
-				mock.ExpectExec(`UPDATE gophermart\.orders SET status = \$1, accrual = \$2 WHERE number = \$3`).
+				mock.ExpectExec(`UPDATE gophermart\.orders SET status = \$1, accrual = \$2, checked_at = now\(\) WHERE number = \$3`).
 					WithArgs("PROCESSED", &accrual, "12345").
 					WillReturnResult(sqlmock.NewResult(0, 1))
 
-				mock.ExpectExec(`UPDATE gophermart\.users SET balance_current = balance_current \+ \$1 WHERE login = \$2 RETURNING balance_current`).
-					WithArgs(&accrual, "testuser").
+				mock.ExpectExec(`UPDATE gophermart\.users SET balance_current = balance_current \+ \$1 WHERE id = \$2 RETURNING balance_current`).
+					WithArgs(&accrual, int64(1)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+
+				mock.ExpectExec(enqueueQuery).
+					WithArgs(int64(1), models.EventOrderProcessed, sqlmock.AnyArg()).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 
 				mock.ExpectCommit().WillReturnError(&pgconn.PgError{Code: "08006"})
@@ -498,3 +563,632 @@ func TestUpdateOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestUseRefreshToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := repository{db: db}
+
+	hash := "token_hash"
+	selectQuery := `SELECT user_id, family_id, expires_at, used_at, revoked FROM gophermart\.refresh_tokens WHERE token_hash = \$1 FOR UPDATE`
+	columns := []string{"user_id", "family_id", "expires_at", "used_at", "revoked"}
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name          string
+		mockBehavior  func()
+		expectedError error
+	}{
+		{
+			name: "Successful use",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).WithArgs(hash).
+					WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "family", future, nil, false))
+				mock.ExpectExec(`UPDATE gophermart\.refresh_tokens SET used_at = \$1 WHERE token_hash = \$2`).
+					WithArgs(sqlmock.AnyArg(), hash).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			expectedError: nil,
+		},
+		{
+			name: "Unknown token",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).WithArgs(hash).
+					WillReturnRows(sqlmock.NewRows(columns))
+				mock.ExpectRollback()
+			},
+			expectedError: apperrors.ErrInvalidRefresh,
+		},
+		{
+			name: "Expired token",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).WithArgs(hash).
+					WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "family", time.Now().Add(-time.Hour), nil, false))
+				mock.ExpectRollback()
+			},
+			expectedError: apperrors.ErrInvalidRefresh,
+		},
+		{
+			name: "Reused token revokes family",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).WithArgs(hash).
+					WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "family", future, time.Now(), false))
+				mock.ExpectExec(`UPDATE gophermart\.refresh_tokens SET revoked = TRUE WHERE family_id = \$1`).
+					WithArgs("family").
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+			},
+			expectedError: apperrors.ErrRefreshReused,
+		},
+		{
+			name: "Database connection error",
+			mockBehavior: func() {
+				mock.ExpectBegin().WillReturnError(&pgconn.PgError{Code: "08006"})
+			},
+			expectedError: apperrors.ErrPgConnExc,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.mockBehavior()
+
+			_, err := repo.UseRefreshToken(context.Background(), hash)
+
+			assert.Equal(t, test.expectedError, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestDeleteExpiredTokens(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := repository{db: db}
+	before := time.Now()
+
+	tests := []struct {
+		name          string
+		mockBehavior  func()
+		expectedError error
+	}{
+		{
+			name: "Successful cleanup",
+			mockBehavior: func() {
+				mock.ExpectExec(`DELETE FROM gophermart\.revoked_tokens WHERE expires_at < \$1`).
+					WithArgs(before).WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectExec(`DELETE FROM gophermart\.refresh_tokens WHERE expires_at < \$1`).
+					WithArgs(before).WillReturnResult(sqlmock.NewResult(0, 2))
+			},
+			expectedError: nil,
+		},
+		{
+			name: "Database connection error",
+			mockBehavior: func() {
+				mock.ExpectExec(`DELETE FROM gophermart\.revoked_tokens WHERE expires_at < \$1`).
+					WithArgs(before).WillReturnError(&pgconn.PgError{Code: "08006"})
+			},
+			expectedError: apperrors.ErrPgConnExc,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.mockBehavior()
+
+			err := repo.DeleteExpiredTokens(context.Background(), before)
+
+			assert.Equal(t, test.expectedError, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestDeleteStaleLoginAttempts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := repository{db: db}
+	now := time.Now()
+	windowStart := now.Add(-time.Hour)
+
+	mock.ExpectExec(`DELETE FROM gophermart\.login_attempts WHERE last_failure_at < \$1 AND \(locked_until IS NULL OR locked_until < \$2\)`).
+		WithArgs(windowStart, now).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+
+	err = repo.DeleteStaleLoginAttempts(context.Background(), windowStart, now)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := repository{db: db}
+
+	tables := []string{"revoked_tokens", "refresh_tokens", "sessions", "api_keys", "totp_recovery_codes", "mfa_challenges", "user_identities", "webhooks", "withdrawals", "orders"}
+	expectDeletes := func() {
+		for _, table := range tables {
+			mock.ExpectExec(`DELETE FROM gophermart\.` + table + ` WHERE user_id = \$1`).
+				WithArgs(1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+	}
+
+	tests := []struct {
+		name          string
+		mockBehavior  func()
+		expectedError error
+	}{
+		{
+			name: "User deleted",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				expectDeletes()
+				mock.ExpectQuery(`DELETE FROM gophermart\.users WHERE id = \$1 RETURNING login`).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"login"}).AddRow("alice"))
+				mock.ExpectExec(`DELETE FROM gophermart\.login_attempts WHERE key = ANY\(\$1\)`).
+					WithArgs(pq.Array([]string{"login:alice", "totp:1"})).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+			},
+			expectedError: nil,
+		},
+		{
+			name: "Unknown user",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				expectDeletes()
+				mock.ExpectQuery(`DELETE FROM gophermart\.users WHERE id = \$1 RETURNING login`).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"login"}))
+				mock.ExpectRollback()
+			},
+			expectedError: apperrors.ErrUserNotFound,
+		},
+		{
+			name: "Database connection error",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM gophermart\.revoked_tokens WHERE user_id = \$1`).
+					WithArgs(1).
+					WillReturnError(&pgconn.PgError{Code: "08006"})
+				mock.ExpectRollback()
+			},
+			expectedError: apperrors.ErrPgConnExc,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.mockBehavior()
+
+			err := repo.DeleteUser(context.Background(), 1)
+
+			assert.Equal(t, test.expectedError, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUseOIDCState(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := repository{db: db}
+
+	query := `DELETE FROM gophermart\.oidc_states WHERE state_hash = \$1 RETURNING code_verifier, nonce, expires_at`
+	columns := []string{"code_verifier", "nonce", "expires_at"}
+	now := time.Now()
+
+	tests := []struct {
+		name          string
+		mockBehavior  func()
+		expectedError error
+	}{
+		{
+			name: "Valid state",
+			mockBehavior: func() {
+				mock.ExpectQuery(query).WithArgs("state_hash").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("verifier", "nonce", now.Add(time.Minute)))
+			},
+			expectedError: nil,
+		},
+		{
+			name: "Expired state",
+			mockBehavior: func() {
+				mock.ExpectQuery(query).WithArgs("state_hash").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("verifier", "nonce", now.Add(-time.Minute)))
+			},
+			expectedError: apperrors.ErrInvalidOIDCState,
+		},
+		{
+			name: "Unknown or already used state",
+			mockBehavior: func() {
+				mock.ExpectQuery(query).WithArgs("state_hash").
+					WillReturnRows(sqlmock.NewRows(columns))
+			},
+			expectedError: apperrors.ErrInvalidOIDCState,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.mockBehavior()
+
+			state, err := repo.UseOIDCState(context.Background(), "state_hash", now)
+
+			assert.Equal(t, test.expectedError, err)
+			if test.expectedError == nil {
+				assert.Equal(t, "verifier", state.Verifier)
+				assert.Equal(t, "nonce", state.Nonce)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUpdateLogin(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := repository{db: db}
+	query := `UPDATE gophermart\.users SET login = \$1 WHERE id = \$2`
+
+	tests := []struct {
+		name          string
+		mockBehavior  func()
+		expectedError error
+	}{
+		{
+			name: "Login changed",
+			mockBehavior: func() {
+				mock.ExpectExec(query).WithArgs("newname", 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expectedError: nil,
+		},
+		{
+			name: "Login taken",
+			mockBehavior: func() {
+				mock.ExpectExec(query).WithArgs("newname", 1).
+					WillReturnError(&pgconn.PgError{Code: "23505"})
+			},
+			expectedError: apperrors.ErrLoginTaken,
+		},
+		{
+			name: "Unknown user",
+			mockBehavior: func() {
+				mock.ExpectExec(query).WithArgs("newname", 1).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			expectedError: apperrors.ErrUserNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.mockBehavior()
+
+			err := repo.UpdateLogin(context.Background(), 1, "newname")
+
+			assert.Equal(t, test.expectedError, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestSelectOrdersPage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := repository{db: db}
+
+	first := time.Date(2024, 5, 3, 10, 0, 0, 0, time.UTC)
+	second := time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)
+	third := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	columns := []string{"number", "status", "accrual", "uploaded_at"}
+
+	tests := []struct {
+		name           string
+		filter         models.OrderFilter
+		mockBehavior   func()
+		expectedOrders []string
+		expectedNext   *models.Cursor
+	}{
+		{
+			name:   "First page has next",
+			filter: models.OrderFilter{PageFilter: models.PageFilter{Limit: 2}},
+			mockBehavior: func() {
+				mock.ExpectQuery(`SELECT number,status,accrual,uploaded_at FROM gophermart\.orders WHERE user_id = \$1 ORDER BY uploaded_at DESC, number DESC LIMIT \$2`).
+					WithArgs(1, 3).
+					WillReturnRows(sqlmock.NewRows(columns).
+						AddRow("111", "NEW", nil, first).
+						AddRow("222", "PROCESSED", 100.0, second).
+						AddRow("333", "NEW", nil, third))
+			},
+			expectedOrders: []string{"111", "222"},
+			expectedNext:   &models.Cursor{Time: second, Key: "222"},
+		},
+		{
+			name:   "Whole list without limit",
+			filter: models.OrderFilter{},
+			mockBehavior: func() {
+				mock.ExpectQuery(`SELECT number,status,accrual,uploaded_at FROM gophermart\.orders WHERE user_id = \$1 ORDER BY uploaded_at DESC, number DESC$`).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(columns).
+						AddRow("111", "NEW", nil, first).
+						AddRow("222", "PROCESSED", 100.0, second).
+						AddRow("333", "NEW", nil, third))
+			},
+			expectedOrders: []string{"111", "222", "333"},
+		},
+		{
+			name: "Filtered last page",
+			filter: models.OrderFilter{
+				PageFilter: models.PageFilter{Limit: 2, After: &models.Cursor{Time: first, Key: "111"}, From: &from, Asc: true},
+				Statuses:   []string{"NEW"},
+			},
+			mockBehavior: func() {
+				mock.ExpectQuery(`SELECT number,status,accrual,uploaded_at FROM gophermart\.orders WHERE user_id = \$1 AND status = ANY\(\$2::gophermart\.status\[\]\) AND uploaded_at >= \$3 AND \(uploaded_at, number\) > \(\$4, \$5\) ORDER BY uploaded_at ASC, number ASC LIMIT \$6`).
+					WithArgs(1, pq.Array([]string{"NEW"}), from, first, "111", 3).
+					WillReturnRows(sqlmock.NewRows(columns).
+						AddRow("333", "NEW", nil, third))
+			},
+			expectedOrders: []string{"333"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.mockBehavior()
+
+			orders, next, err := repo.SelectOrdersPage(context.Background(), 1, test.filter)
+
+			assert.NoError(t, err)
+			var numbers []string
+			for _, order := range orders {
+				numbers = append(numbers, order.Number)
+			}
+			assert.Equal(t, test.expectedOrders, numbers)
+			assert.Equal(t, test.expectedNext, next)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestSelectWithdrawalsPage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := repository{db: db}
+
+	first := time.Date(2024, 5, 3, 10, 0, 0, 0, time.UTC)
+	second := time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	after := models.Cursor{Time: time.Date(2024, 5, 4, 0, 0, 0, 0, time.UTC), Key: "000"}
+	filter := models.WithdrawalFilter{PageFilter: models.PageFilter{Limit: 1, After: &after, To: &to}, MinSum: 10}
+
+	mock.ExpectQuery(`SELECT order_id,sum,processed_at FROM gophermart\.withdrawals WHERE user_id = \$1 AND sum >= \$2 AND processed_at < \$3 AND \(processed_at, order_id\) < \(\$4, \$5\) ORDER BY processed_at DESC, order_id DESC LIMIT \$6`).
+		WithArgs(1, 10.0, to, after.Time, after.Key, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"order_id", "sum", "processed_at"}).
+			AddRow("111", 50.0, first).
+			AddRow("222", 25.0, second))
+
+	withdrawals, next, err := repo.SelectWithdrawalsPage(context.Background(), 1, filter)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.WithdrawalResponse{{Order: "111", Sum: 50, ProcessedAt: first.Format(time.RFC3339)}}, withdrawals)
+	assert.Equal(t, &models.Cursor{Time: first, Key: "111"}, next)
+
+	// Итоги считаются по тому же фильтру, но без курсора и лимита
+	mock.ExpectQuery(`SELECT COUNT\(\*\), COALESCE\(SUM\(sum\), 0\) FROM gophermart\.withdrawals WHERE user_id = \$1 AND sum >= \$2 AND processed_at < \$3$`).
+		WithArgs(1, 10.0, to).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "sum"}).AddRow(2, 75.0))
+
+	totals, err := repo.SelectWithdrawalTotals(context.Background(), 1, filter)
+	assert.NoError(t, err)
+	assert.Equal(t, models.WithdrawalTotals{Count: 2, Sum: 75}, totals)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSelectOrder(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := repository{db: db}
+
+	uploadedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	checkedAt := time.Date(2024, 5, 1, 10, 5, 0, 0, time.UTC)
+	orderQuery := `SELECT number,status,accrual,uploaded_at,checked_at FROM gophermart\.orders WHERE number = \$1 AND user_id = \$2`
+	historyQuery := `SELECT status, changed_at FROM gophermart\.order_status_history WHERE order_number = \$1 ORDER BY changed_at, id`
+
+	t.Run("Order with history", func(t *testing.T) {
+		mock.ExpectQuery(orderQuery).WithArgs("79927398713", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"number", "status", "accrual", "uploaded_at", "checked_at"}).
+				AddRow("79927398713", "PROCESSED", 500.0, uploadedAt, checkedAt))
+		mock.ExpectQuery(historyQuery).WithArgs("79927398713").
+			WillReturnRows(sqlmock.NewRows([]string{"status", "changed_at"}).
+				AddRow("NEW", uploadedAt).
+				AddRow("PROCESSING", uploadedAt.Add(time.Minute)).
+				AddRow("PROCESSED", checkedAt))
+
+		order, err := repo.SelectOrder(context.Background(), 1, "79927398713")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "PROCESSED", order.Status)
+		assert.Equal(t, 500.0, *order.Accrual)
+		assert.Equal(t, checkedAt.Format(time.RFC3339), *order.CheckedAt)
+		assert.Equal(t, []models.OrderStatusChange{
+			{Status: "NEW", ChangedAt: uploadedAt.Format(time.RFC3339)},
+			{Status: "PROCESSING", ChangedAt: uploadedAt.Add(time.Minute).Format(time.RFC3339)},
+			{Status: "PROCESSED", ChangedAt: checkedAt.Format(time.RFC3339)},
+		}, order.History)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Unknown or foreign order", func(t *testing.T) {
+		mock.ExpectQuery(orderQuery).WithArgs("79927398713", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"number", "status", "accrual", "uploaded_at", "checked_at"}))
+
+		_, err := repo.SelectOrder(context.Background(), 1, "79927398713")
+
+		assert.Equal(t, apperrors.ErrOrderNotFound, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestInsertOrders(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := repository{db: db}
+
+	uploadedAt := time.Now()
+	numbers := []string{"111", "222", "333", "444"}
+
+	mock.ExpectQuery(`WITH ins AS \(INSERT INTO gophermart\.orders\(number, user_id, status, uploaded_at\) SELECT unnest\(\$1::varchar\[\]\), \$2, 'NEW', \$3 ON CONFLICT \(number\) DO NOTHING`).
+		WithArgs(pq.Array(numbers), 1, uploadedAt).
+		WillReturnRows(sqlmock.NewRows([]string{"number", "user_id", "inserted"}).
+			AddRow("111", 1, true).
+			AddRow("222", 1, false).
+			AddRow("333", 2, false))
+	// 444 вставлен параллельной транзакцией, владелец перечитывается отдельно
+	mock.ExpectQuery(`SELECT number, user_id, FALSE FROM gophermart\.orders WHERE number = ANY\(\$1\)`).
+		WithArgs(pq.Array([]string{"444"})).
+		WillReturnRows(sqlmock.NewRows([]string{"number", "user_id", "inserted"}).AddRow("444", 2, false))
+
+	results, err := repo.InsertOrders(context.Background(), 1, numbers, uploadedAt)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"111": models.BatchAccepted,
+		"222": models.BatchDuplicateOwn,
+		"333": models.BatchOwnedByOther,
+		"444": models.BatchOwnedByOther,
+	}, results)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSelectWebhookDeliveries(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := repository{db: db}
+
+	existsQuery := `SELECT EXISTS\(SELECT 1 FROM gophermart\.webhooks WHERE id = \$1 AND user_id = \$2\)`
+	deliveriesQuery := `SELECT id, event, status, attempts, last_status_code, last_error, created_at, next_attempt_at, delivered_at FROM gophermart\.webhook_deliveries WHERE webhook_id = \$1 ORDER BY id DESC LIMIT \$2`
+	createdAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("Delivered and dead deliveries", func(t *testing.T) {
+		mock.ExpectQuery(existsQuery).WithArgs("hook", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(deliveriesQuery).WithArgs("hook", 10).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "event", "status", "attempts", "last_status_code", "last_error", "created_at", "next_attempt_at", "delivered_at"}).
+				AddRow(2, models.EventOrderProcessed, models.DeliveryDelivered, 1, 200, nil, createdAt, nil, createdAt.Add(time.Second)).
+				AddRow(1, models.EventOrderInvalid, models.DeliveryDead, 8, nil, "connection refused", createdAt, nil, nil))
+
+		deliveries, err := repo.SelectWebhookDeliveries(context.Background(), 1, "hook", 10)
+
+		assert.NoError(t, err)
+		assert.Len(t, deliveries, 2)
+		assert.Equal(t, 200, *deliveries[0].LastStatusCode)
+		assert.Equal(t, createdAt.Add(time.Second), *deliveries[0].DeliveredAt)
+		assert.Nil(t, deliveries[1].LastStatusCode)
+		assert.Equal(t, "connection refused", *deliveries[1].LastError)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Unknown or foreign webhook", func(t *testing.T) {
+		mock.ExpectQuery(existsQuery).WithArgs("hook", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+		_, err := repo.SelectWebhookDeliveries(context.Background(), 1, "hook", 10)
+
+		assert.Equal(t, apperrors.ErrWebhookNotFound, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestClaimWebhookDeliveries(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := repository{db: db}
+
+	now := time.Now()
+	leaseUntil := now.Add(time.Minute)
+
+	mock.ExpectQuery(`UPDATE gophermart\.webhook_deliveries d SET attempts = d\.attempts \+ 1, next_attempt_at = \$2 .* FOR UPDATE SKIP LOCKED\) RETURNING d\.id, w\.url, w\.secret, d\.event, d\.payload, d\.attempts`).
+		WithArgs(now, leaseUntil, 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "url", "secret", "event", "payload", "attempts"}).
+			AddRow(7, "https://example.com/hook", "secret", models.EventOrderProcessed, `{"event":"order.processed"}`, 3))
+
+	tasks, err := repo.ClaimWebhookDeliveries(context.Background(), now, leaseUntil, 20)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []models.WebhookTask{{
+		ID:       7,
+		URL:      "https://example.com/hook",
+		Secret:   "secret",
+		Event:    models.EventOrderProcessed,
+		Payload:  []byte(`{"event":"order.processed"}`),
+		Attempts: 3,
+	}}, tasks)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFailWebhookDelivery(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := repository{db: db}
+
+	query := `UPDATE gophermart\.webhook_deliveries SET status = \$2, last_status_code = \$3, last_error = \$4, next_attempt_at = \$5 WHERE id = \$1`
+	next := time.Now().Add(time.Minute)
+
+	tests := []struct {
+		name          string
+		statusCode    int
+		nextAttemptAt *time.Time
+		expectedArgs  []driver.Value
+	}{
+		{"Retry later", 500, &next, []driver.Value{int64(7), models.DeliveryPending, int64(500), "unexpected status", next}},
+		{"No response, attempts exhausted", 0, nil, []driver.Value{int64(7), models.DeliveryDead, nil, "unexpected status", nil}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock.ExpectExec(query).WithArgs(test.expectedArgs...).WillReturnResult(sqlmock.NewResult(0, 1))
+
+			err := repo.FailWebhookDelivery(context.Background(), 7, test.statusCode, "unexpected status", test.nextAttemptAt)
+
+			assert.NoError(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package revocation
+
+import (
+	"context"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/gophermart/internal/repository"
+	"sync"
+	"time"
+)
+
+// Checker - список отозванных JWT. Отозванные jti и момент "выйти отовсюду" хранятся в Postgres,
+// результаты проверок кешируются в памяти, чтобы не ходить в БД на каждый запрос.
+type Checker interface {
+	IsRevoked(ctx context.Context, claims *models.UserClaims) (bool, error)
+	Revoke(ctx context.Context, claims *models.UserClaims) error
+	RevokeAll(ctx context.Context, userID int64) error
+	// RevokeSession завершает сессию, её токены перестают приниматься
+	RevokeSession(ctx context.Context, userID int64, sessionID string) error
+	Invalidate(userID int64, before time.Time)
+}
+
+// NewChecker - ttl задаёт, как долго кешируется ответ БД о том, что токен не отозван.
+// Столько же может пройти, пока отзыв с другого инстанса дойдёт до этого.
+func NewChecker(repo repository.Repository, ttl time.Duration) Checker {
+	return &checker{
+		repo:       repo,
+		ttl:        ttl,
+		revoked:    make(map[string]time.Time),
+		checked:    make(map[string]cacheEntry),
+		revokedAll: make(map[int64]time.Time),
+		sessions:   make(map[string]time.Time),
+	}
+}
+
+type checker struct {
+	repo       repository.Repository
+	ttl        time.Duration
+	mu         sync.RWMutex
+	revoked    map[string]time.Time  // jti -> exp, отозванный токен не может "ожить", храним до истечения
+	checked    map[string]cacheEntry // jti -> последний ответ БД
+	revokedAll map[int64]time.Time   // user id -> момент отзыва всех токенов этим инстансом
+	sessions   map[string]time.Time  // sid -> момент завершения сессии этим инстансом
+	lastSweep  time.Time
+}
+
+type cacheEntry struct {
+	revocation models.TokenRevocation
+	validUntil time.Time
+}
+
+func (c *checker) IsRevoked(ctx context.Context, claims *models.UserClaims) (bool, error) {
+	now := time.Now()
+	issuedAt := issuedAt(claims)
+
+	c.mu.RLock()
+	_, revoked := c.revoked[claims.ID]
+	revokedAll, hasRevokedAll := c.revokedAll[claims.UserID]
+	_, sessionRevoked := c.sessions[claims.SessionID]
+	entry, cached := c.checked[claims.ID]
+	c.mu.RUnlock()
+
+	if revoked || sessionRevoked || (hasRevokedAll && issuedAt.Before(revokedAll)) {
+		return true, nil
+	}
+	if cached && now.Before(entry.validUntil) {
+		return entry.revocation.IsRevoked(issuedAt), nil
+	}
+
+	revocation, err := c.repo.SelectTokenRevocation(ctx, claims.ID, claims.UserID, claims.SessionID)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	c.sweep(now)
+	if revocation.Revoked {
+		c.revoked[claims.ID] = expiresAt(claims, now, c.ttl)
+	} else {
+		c.checked[claims.ID] = cacheEntry{revocation, now.Add(c.ttl)}
+	}
+	c.mu.Unlock()
+
+	return revocation.IsRevoked(issuedAt), nil
+}
+
+func (c *checker) Revoke(ctx context.Context, claims *models.UserClaims) error {
+	exp := expiresAt(claims, time.Now(), c.ttl)
+	if err := c.repo.RevokeToken(ctx, claims.ID, claims.UserID, exp); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.revoked[claims.ID] = exp
+	delete(c.checked, claims.ID)
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *checker) RevokeAll(ctx context.Context, userID int64) error {
+	// Точность iat - секунда, поэтому токены, выпущенные в ту же секунду после отзыва, остаются валидными
+	at := time.Now().Truncate(time.Second)
+	if err := c.repo.RevokeAllTokens(ctx, userID, at); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.revokedAll[userID] = at
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *checker) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	now := time.Now()
+	if err := c.repo.RevokeSession(ctx, userID, sessionID, now); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.sessions[sessionID] = now
+	c.mu.Unlock()
+	return nil
+}
+
+// Invalidate учитывает в кеше отзыв, уже записанный в БД (например, сменой пароля)
+func (c *checker) Invalidate(userID int64, before time.Time) {
+	c.mu.Lock()
+	c.revokedAll[userID] = before
+	c.mu.Unlock()
+}
+
+// internal
+
+// sweep удаляет устаревшие записи не чаще раза в ttl. Вызывается под c.mu.Lock().
+func (c *checker) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+	c.lastSweep = now
+	for jti, exp := range c.revoked {
+		if now.After(exp) {
+			delete(c.revoked, jti)
+		}
+	}
+	for jti, entry := range c.checked {
+		if now.After(entry.validUntil) {
+			delete(c.checked, jti)
+		}
+	}
+	for userID, at := range c.revokedAll {
+		// Через ttl это значение уже видно в БД любому инстансу
+		if now.Sub(at) > c.ttl {
+			delete(c.revokedAll, userID)
+		}
+	}
+	for sid, at := range c.sessions {
+		if now.Sub(at) > c.ttl {
+			delete(c.sessions, sid)
+		}
+	}
+}
+
+func issuedAt(claims *models.UserClaims) time.Time {
+	if claims.IssuedAt == nil {
+		return time.Time{}
+	}
+	return claims.IssuedAt.Time
+}
+
+func expiresAt(claims *models.UserClaims, now time.Time, fallback time.Duration) time.Time {
+	if claims.ExpiresAt == nil {
+		return now.Add(fallback)
+	}
+	return claims.ExpiresAt.Time
+}
@@ -0,0 +1,183 @@
+package revocation
+
+import (
+	"context"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/golang/mock/gomock"
+	"github.com/llaxzi/gophermart/internal/apperrors"
+	"github.com/llaxzi/gophermart/internal/mocks"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newClaims(jti string, issuedAt time.Time) *models.UserClaims {
+	return &models.UserClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(time.Minute)),
+		},
+		UserID:    1,
+		UserLogin: "testuser",
+	}
+}
+
+func TestChecker_IsRevokedCachesResult(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	c := NewChecker(repo, time.Minute)
+	claims := newClaims("jti1", time.Now())
+
+	// Второй вызов должен попасть в кеш
+	repo.EXPECT().SelectTokenRevocation(gomock.Any(), "jti1", int64(1), "").
+		Return(models.TokenRevocation{}, nil).Times(1)
+
+	for i := 0; i < 2; i++ {
+		revoked, err := c.IsRevoked(context.Background(), claims)
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+	}
+}
+
+func TestChecker_IsRevoked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	now := time.Now()
+
+	tests := []struct {
+		name          string
+		revocation    models.TokenRevocation
+		repoError     error
+		expected      bool
+		expectedError error
+	}{
+		{"Not revoked", models.TokenRevocation{}, nil, false, nil},
+		{"Revoked jti", models.TokenRevocation{Revoked: true}, nil, true, nil},
+		{"Issued before revoke all", models.TokenRevocation{RevokedBefore: now.Add(time.Second)}, nil, true, nil},
+		{"Issued after revoke all", models.TokenRevocation{RevokedBefore: now.Add(-time.Hour)}, nil, false, nil},
+		{"Database error", models.TokenRevocation{}, apperrors.ErrPgConnExc, false, apperrors.ErrPgConnExc},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewChecker(repo, time.Minute)
+			repo.EXPECT().SelectTokenRevocation(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(test.revocation, test.repoError).Times(1)
+
+			revoked, err := c.IsRevoked(context.Background(), newClaims("jti", now))
+			assert.Equal(t, test.expectedError, err)
+			assert.Equal(t, test.expected, revoked)
+		})
+	}
+}
+
+func TestChecker_Revoke(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	c := NewChecker(repo, time.Minute)
+	claims := newClaims("jti1", time.Now())
+
+	repo.EXPECT().SelectTokenRevocation(gomock.Any(), "jti1", int64(1), "").
+		Return(models.TokenRevocation{}, nil).Times(1)
+	repo.EXPECT().RevokeToken(gomock.Any(), "jti1", int64(1), claims.ExpiresAt.Time).
+		Return(nil).Times(1)
+
+	revoked, err := c.IsRevoked(context.Background(), claims)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	// Отзыв сбрасывает закешированный "не отозван" без обращения к БД
+	assert.NoError(t, c.Revoke(context.Background(), claims))
+	revoked, err = c.IsRevoked(context.Background(), claims)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestChecker_RevokeAll(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	c := NewChecker(repo, time.Minute)
+	old := newClaims("old", time.Now().Add(-time.Hour))
+
+	repo.EXPECT().RevokeAllTokens(gomock.Any(), int64(1), gomock.Any()).Return(nil).Times(1)
+	assert.NoError(t, c.RevokeAll(context.Background(), int64(1)))
+
+	revoked, err := c.IsRevoked(context.Background(), old)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	// Токен, выпущенный после отзыва, проверяется в БД как обычно
+	repo.EXPECT().SelectTokenRevocation(gomock.Any(), "fresh", int64(1), "").
+		Return(models.TokenRevocation{RevokedBefore: time.Now().Truncate(time.Second)}, nil).Times(1)
+	revoked, err = c.IsRevoked(context.Background(), newClaims("fresh", time.Now()))
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+}
+
+func TestChecker_Invalidate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	c := NewChecker(repo, time.Minute)
+	claims := newClaims("jti1", time.Now().Add(-time.Minute))
+
+	repo.EXPECT().SelectTokenRevocation(gomock.Any(), "jti1", int64(1), "").
+		Return(models.TokenRevocation{}, nil).Times(1)
+
+	revoked, err := c.IsRevoked(context.Background(), claims)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	// Закешированный результат не должен пережить смену пароля
+	c.Invalidate(int64(1), time.Now())
+	revoked, err = c.IsRevoked(context.Background(), claims)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestChecker_RevokeSession(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	c := NewChecker(repo, time.Minute)
+
+	claims := newClaims("jti1", time.Now())
+	claims.SessionID = "session"
+	other := newClaims("jti2", time.Now())
+	other.SessionID = "other"
+
+	repo.EXPECT().SelectTokenRevocation(gomock.Any(), "jti1", int64(1), "session").
+		Return(models.TokenRevocation{}, nil).Times(1)
+	revoked, err := c.IsRevoked(context.Background(), claims)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	repo.EXPECT().RevokeSession(gomock.Any(), int64(1), "session", gomock.Any()).Return(nil).Times(1)
+	assert.NoError(t, c.RevokeSession(context.Background(), int64(1), "session"))
+
+	// Закэшированный ответ БД не должен пропустить токен завершённой сессии
+	revoked, err = c.IsRevoked(context.Background(), claims)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	repo.EXPECT().SelectTokenRevocation(gomock.Any(), "jti2", int64(1), "other").
+		Return(models.TokenRevocation{}, nil).Times(1)
+	revoked, err = c.IsRevoked(context.Background(), other)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	repo.EXPECT().RevokeSession(gomock.Any(), int64(1), "missing", gomock.Any()).Return(apperrors.ErrSessionNotFound).Times(1)
+	assert.ErrorIs(t, c.RevokeSession(context.Background(), int64(1), "missing"), apperrors.ErrSessionNotFound)
+}
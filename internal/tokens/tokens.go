@@ -1,36 +1,108 @@
 package tokens
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/llaxzi/gophermart/internal/keyring"
 	"github.com/llaxzi/gophermart/internal/models"
 	"time"
 )
 
 type TokenBuilder interface {
-	BuildJWTString(userLogin string) (string, error)
+	BuildJWTString(subject models.TokenSubject) (string, error)
+	BuildRefreshToken() (string, time.Time, error)
+	AccessTokenExp() time.Duration
 }
 
-func NewTokenBuilder(secretKey []byte, tokenExp time.Duration) TokenBuilder {
-	return &tokenBuilder{secretKey, tokenExp}
+func NewTokenBuilder(keys keyring.Keyring, tokenExp time.Duration, refreshExp time.Duration) TokenBuilder {
+	return &tokenBuilder{keys, tokenExp, refreshExp}
 }
 
 type tokenBuilder struct {
-	secretKey []byte
-	tokenExp  time.Duration
+	keys       keyring.Keyring
+	tokenExp   time.Duration
+	refreshExp time.Duration
 }
 
-func (b *tokenBuilder) BuildJWTString(userLogin string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, models.UserClaims{
+func (b *tokenBuilder) BuildJWTString(subject models.TokenSubject) (string, error) {
+	jti, err := NewID()
+	if err != nil {
+		return "", err
+	}
+
+	// Подписываем текущим ключом, kid позволяет проверить токен после ротации
+	key, err := b.keys.SigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.Method, models.UserClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(b.tokenExp)),
 		},
-		UserLogin: userLogin,
+		UserID:    subject.UserID,
+		UserLogin: subject.Login,
+		Role:      subject.Role,
+		SessionID: subject.SessionID,
 	})
 
-	tokenString, err := token.SignedString(b.secretKey)
+	token.Header["kid"] = key.ID
+
+	tokenString, err := token.SignedString(key.SignKey())
 	if err != nil {
 		return "", err
 	}
 	return tokenString, nil
 }
+
+// BuildRefreshToken возвращает непрозрачный refresh токен и время его истечения.
+// На сервере хранится только HashToken(token).
+func (b *tokenBuilder) BuildRefreshToken() (string, time.Time, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), time.Now().Add(b.refreshExp), nil
+}
+
+func (b *tokenBuilder) AccessTokenExp() time.Duration {
+	return b.tokenExp
+}
+
+// HashToken - sha256 от токена в hex, используется как ключ в БД
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewAPIKey генерирует API ключ, префикс позволяет узнать ключ в логах и сканерах секретов
+func NewAPIKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "gm_" + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// NewID генерирует случайный идентификатор (семейство refresh токенов, jti и т.п.)
+func NewID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// NewWebhookSecret генерирует секрет подписи вебхука
+func NewWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(buf), nil
+}
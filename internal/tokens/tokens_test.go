@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/llaxzi/gophermart/internal/keyring"
 	"github.com/llaxzi/gophermart/internal/models"
 	"github.com/stretchr/testify/assert"
 )
@@ -12,10 +13,10 @@ import (
 func TestBuildJWTString(t *testing.T) {
 	secretKey := []byte("test_secret")
 	tokenExp := time.Minute * 1
-	builder := NewTokenBuilder(secretKey, tokenExp)
+	builder := NewTokenBuilder(keyring.NewStatic(keyring.Key{ID: "test", Secret: secretKey}), tokenExp, time.Hour)
 
 	userLogin := "test_user"
-	tokenString, err := builder.BuildJWTString(userLogin)
+	tokenString, err := builder.BuildJWTString(models.TokenSubject{Login: userLogin, Role: models.RoleSupport, SessionID: "session"})
 
 	assert.NoError(t, err)
 	assert.NotEmpty(t, tokenString)
@@ -27,10 +28,31 @@ func TestBuildJWTString(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, token)
 	assert.True(t, token.Valid)
+	assert.Equal(t, "test", token.Header["kid"])
 
 	claims, ok := token.Claims.(*models.UserClaims)
 	assert.True(t, ok)
 	assert.Equal(t, userLogin, claims.UserLogin)
+	assert.Equal(t, models.RoleSupport, claims.Role)
+	assert.Equal(t, "session", claims.SessionID)
 
 	assert.WithinDuration(t, time.Now().Add(tokenExp), claims.ExpiresAt.Time, time.Second*2)
 }
+
+func TestBuildRefreshToken(t *testing.T) {
+	refreshExp := time.Hour * 24
+	builder := NewTokenBuilder(keyring.NewStatic(keyring.Key{ID: "test", Secret: []byte("test_secret")}), time.Minute, refreshExp)
+
+	first, expiresAt, err := builder.BuildRefreshToken()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, first)
+	assert.WithinDuration(t, time.Now().Add(refreshExp), expiresAt, time.Second*2)
+
+	second, _, err := builder.BuildRefreshToken()
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+
+	assert.Equal(t, HashToken(first), HashToken(first))
+	assert.NotEqual(t, HashToken(first), HashToken(second))
+	assert.Len(t, HashToken(first), 64)
+}
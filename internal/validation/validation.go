@@ -0,0 +1,137 @@
+package validation
+
+import (
+	_ "embed"
+	"fmt"
+	"github.com/llaxzi/gophermart/internal/models"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// FederatedLoginPrefix - префикс логинов, которые создаются при первом входе через OIDC.
+// Зарезервирован всегда, независимо от Config: иначе такой логин можно занять заранее.
+const FederatedLoginPrefix = "oidc-"
+
+// Validator проверяет логин и пароль при регистрации и смене пароля.
+// Возвращает все нарушенные правила, а не только первое.
+type Validator interface {
+	ValidateLogin(login string) []models.Violation
+	ValidatePassword(login string, password string) []models.Violation
+}
+
+type Config struct {
+	MinLoginLength    int
+	MaxLoginLength    int
+	LoginPattern      *regexp.Regexp // допустимые символы логина
+	MinPasswordLength int
+	MaxPasswordLength int // bcrypt учитывает только первые 72 байта
+	RequireLower      bool
+	RequireUpper      bool
+	RequireDigit      bool
+	RequireSymbol     bool
+	Denylist          []string // сравнивается без учёта регистра
+}
+
+// DefaultConfig - длина логина ограничена колонкой users.login, словарь - распространённые пароли
+func DefaultConfig() Config {
+	return Config{
+		MinLoginLength:    3,
+		MaxLoginLength:    50,
+		LoginPattern:      regexp.MustCompile(`^[A-Za-z0-9_.@+-]+$`),
+		MinPasswordLength: 8,
+		MaxPasswordLength: 72,
+		Denylist:          strings.Fields(commonPasswords),
+	}
+}
+
+func NewValidator(config Config) Validator {
+	denylist := make(map[string]struct{}, len(config.Denylist))
+	for _, p := range config.Denylist {
+		denylist[strings.ToLower(p)] = struct{}{}
+	}
+	return &validator{config, denylist}
+}
+
+type validator struct {
+	config   Config
+	denylist map[string]struct{}
+}
+
+func (v *validator) ValidateLogin(login string) []models.Violation {
+	var violations []models.Violation
+	length := utf8.RuneCountInString(login)
+
+	if length < v.config.MinLoginLength {
+		violations = append(violations, violation("login", "min_length",
+			fmt.Sprintf("login must be at least %d characters", v.config.MinLoginLength)))
+	}
+	if v.config.MaxLoginLength > 0 && length > v.config.MaxLoginLength {
+		violations = append(violations, violation("login", "max_length",
+			fmt.Sprintf("login must be at most %d characters", v.config.MaxLoginLength)))
+	}
+	if length > 0 && v.config.LoginPattern != nil && !v.config.LoginPattern.MatchString(login) {
+		violations = append(violations, violation("login", "charset",
+			"login contains characters that are not allowed"))
+	}
+	if strings.HasPrefix(strings.ToLower(login), FederatedLoginPrefix) {
+		violations = append(violations, violation("login", "reserved",
+			fmt.Sprintf("login must not start with %q", FederatedLoginPrefix)))
+	}
+	return violations
+}
+
+func (v *validator) ValidatePassword(login string, password string) []models.Violation {
+	var violations []models.Violation
+
+	if utf8.RuneCountInString(password) < v.config.MinPasswordLength {
+		violations = append(violations, violation("password", "min_length",
+			fmt.Sprintf("password must be at least %d characters", v.config.MinPasswordLength)))
+	}
+	if v.config.MaxPasswordLength > 0 && len(password) > v.config.MaxPasswordLength {
+		violations = append(violations, violation("password", "max_length",
+			fmt.Sprintf("password must be at most %d bytes", v.config.MaxPasswordLength)))
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	if v.config.RequireLower && !lower {
+		violations = append(violations, violation("password", "lower", "password must contain a lowercase letter"))
+	}
+	if v.config.RequireUpper && !upper {
+		violations = append(violations, violation("password", "upper", "password must contain an uppercase letter"))
+	}
+	if v.config.RequireDigit && !digit {
+		violations = append(violations, violation("password", "digit", "password must contain a digit"))
+	}
+	if v.config.RequireSymbol && !symbol {
+		violations = append(violations, violation("password", "symbol", "password must contain a symbol"))
+	}
+
+	if _, ok := v.denylist[strings.ToLower(password)]; ok {
+		violations = append(violations, violation("password", "common", "password is too common"))
+	}
+	if login != "" && strings.EqualFold(password, login) {
+		violations = append(violations, violation("password", "same_as_login", "password must not match login"))
+	}
+	return violations
+}
+
+func violation(field, rule, message string) models.Violation {
+	return models.Violation{Field: field, Rule: rule, Message: message}
+}
@@ -0,0 +1,58 @@
+package validation
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func rules(v Validator, login, password string) []string {
+	var result []string
+	for _, violation := range v.ValidateLogin(login) {
+		result = append(result, violation.Field+":"+violation.Rule)
+	}
+	for _, violation := range v.ValidatePassword(login, password) {
+		result = append(result, violation.Field+":"+violation.Rule)
+	}
+	return result
+}
+
+func TestValidator_Default(t *testing.T) {
+	v := NewValidator(DefaultConfig())
+
+	tests := []struct {
+		name     string
+		login    string
+		password string
+		expected []string
+	}{
+		{"Valid", "alice.smith", "correct-horse-battery", nil},
+		{"Empty login and password", "", "", []string{"login:min_length", "password:min_length"}},
+		{"Login too long", strings.Repeat("a", 51), "correct-horse-battery", []string{"login:max_length"}},
+		{"Login with spaces", "alice smith", "correct-horse-battery", []string{"login:charset"}},
+		{"Federated login prefix", "OIDC-0123456789abcdef", "correct-horse-battery", []string{"login:reserved"}},
+		{"Common password", "alice", "Password123", []string{"password:common"}},
+		{"Password equals login", "alice_the_great", "ALICE_THE_GREAT", []string{"password:same_as_login"}},
+		{"Password over bcrypt limit", "alice", strings.Repeat("x", 73), []string{"password:max_length"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.ElementsMatch(t, test.expected, rules(v, test.login, test.password))
+		})
+	}
+}
+
+func TestValidator_CharacterClasses(t *testing.T) {
+	config := DefaultConfig()
+	config.RequireLower = true
+	config.RequireUpper = true
+	config.RequireDigit = true
+	config.RequireSymbol = true
+	config.Denylist = []string{"Sup3r-Secret"}
+	v := NewValidator(config)
+
+	assert.ElementsMatch(t, []string{"password:upper", "password:digit", "password:symbol"}, rules(v, "alice", "lowercaseonly"))
+	assert.Empty(t, rules(v, "alice", "Str0ng-Passw0rd"))
+	assert.ElementsMatch(t, []string{"password:upper", "password:common"}, rules(v, "alice", "sup3r-secret"))
+}
@@ -0,0 +1,221 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/llaxzi/gophermart/internal/repository"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Заголовки запроса к вебхуку
+const (
+	HeaderEvent     = "X-Gophermart-Event"
+	HeaderDelivery  = "X-Gophermart-Delivery"
+	HeaderTimestamp = "X-Gophermart-Timestamp"
+	HeaderSignature = "X-Gophermart-Signature"
+)
+
+// reasonNoResponse - причина для любой ошибки транспорта. Текст ошибки виден пользователю в журнале доставок,
+// по нему можно было бы отличать закрытые порты от фильтруемых, поэтому он только логируется.
+const reasonNoResponse = "no response"
+
+var ErrForbiddenAddress = errors.New("webhook address is not public")
+
+// Dispatcher доставляет события из очереди webhook_deliveries.
+// Очередь общая для всех инстансов: доставка берётся в работу через FOR UPDATE SKIP LOCKED.
+type Dispatcher interface {
+	Run(ctx context.Context)
+}
+
+type Config struct {
+	Interval    time.Duration // как часто проверять очередь
+	Timeout     time.Duration // таймаут одного запроса к получателю
+	BatchSize   int
+	MaxAttempts int           // после MaxAttempts неудач доставка переходит в DEAD
+	BaseDelay   time.Duration // пауза после первой неудачи, далее удваивается
+	MaxDelay    time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Interval:    time.Second * 2,
+		Timeout:     time.Second * 10,
+		BatchSize:   20,
+		MaxAttempts: 8,
+		BaseDelay:   time.Second * 30,
+		MaxDelay:    time.Hour * 6,
+	}
+}
+
+func NewDispatcher(repo repository.Repository, client *http.Client, config Config) Dispatcher {
+	return &dispatcher{repo, client, config}
+}
+
+type dispatcher struct {
+	repo   repository.Repository
+	client *http.Client
+	config Config
+}
+
+func (d *dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.dispatch(ctx)
+		}
+	}
+}
+
+// dispatch отправляет одну пачку доставок, срок которых наступил
+func (d *dispatcher) dispatch(ctx context.Context) {
+	now := time.Now()
+	// Аренда дольше таймаута запроса, чтобы доставку не подхватил другой инстанс, пока мы ждём ответа
+	tasks, err := d.repo.ClaimWebhookDeliveries(ctx, now, now.Add(d.config.Timeout*2), d.config.BatchSize)
+	if err != nil {
+		log.Printf("Failed to claim webhook deliveries: %v", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		wg.Add(1)
+		go func(task models.WebhookTask) {
+			defer wg.Done()
+			d.deliver(ctx, task)
+		}(task)
+	}
+	wg.Wait()
+}
+
+func (d *dispatcher) deliver(ctx context.Context, task models.WebhookTask) {
+	statusCode, err := d.send(ctx, task)
+	if err == nil {
+		if err = d.repo.CompleteWebhookDelivery(ctx, task.ID, statusCode, time.Now()); err != nil {
+			log.Printf("Failed to complete webhook delivery %d: %v", task.ID, err)
+		}
+		return
+	}
+
+	reason := err.Error()
+	if statusCode == 0 {
+		log.Printf("Webhook delivery %d failed: %v", task.ID, err)
+		reason = reasonNoResponse
+	}
+	var nextAttemptAt *time.Time
+	if task.Attempts < d.config.MaxAttempts {
+		next := time.Now().Add(d.backoff(task.Attempts))
+		nextAttemptAt = &next
+	}
+	if err = d.repo.FailWebhookDelivery(ctx, task.ID, statusCode, reason, nextAttemptAt); err != nil {
+		log.Printf("Failed to record webhook delivery %d failure: %v", task.ID, err)
+	}
+}
+
+// send возвращает код ответа получателя, 0 - ответа не было
+func (d *dispatcher) send(ctx context.Context, task models.WebhookTask) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, task.URL, bytes.NewReader(task.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, task.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(task.ID, 10))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(task.Secret, timestamp, task.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Дочитываем тело, чтобы соединение вернулось в пул
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff - пауза перед следующей попыткой после attempts неудачных
+func (d *dispatcher) backoff(attempts int) time.Duration {
+	delay := d.config.BaseDelay
+	for i := 1; i < attempts && delay < d.config.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.config.MaxDelay {
+		delay = d.config.MaxDelay
+	}
+	return delay
+}
+
+// NewClient - HTTP клиент для доставок. Адрес проверяется после разрешения DNS,
+// поэтому вебхук не может указать на внутреннюю сеть ни напрямую, ни через DNS или редирект.
+func NewClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: time.Second * 10,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+				return ErrForbiddenAddress
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: transport,
+		// Редирект засчитывается как ответ получателя (не 2xx), по нему не переходим
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// IsPublicIP - адрес не из loopback, link-local, частных, multicast и unspecified диапазонов
+func IsPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || ip.IsPrivate() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip))
+}
+
+// sharedAddressSpace - 100.64.0.0/10 (CGNAT), не попадает в IsPrivate
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// Sign - подпись доставки: "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)).
+// Метка времени входит в подпись, чтобы получатель мог отвергать повторы старых запросов.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,159 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"github.com/golang/mock/gomock"
+	"github.com/llaxzi/gophermart/internal/mocks"
+	"github.com/llaxzi/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testConfig = Config{
+	Interval:    time.Millisecond * 10,
+	Timeout:     time.Second,
+	BatchSize:   10,
+	MaxAttempts: 3,
+	BaseDelay:   time.Second,
+	MaxDelay:    time.Minute,
+}
+
+// receiver - получатель вебхуков, проверяет подпись как это сделал бы партнёр
+func receiver(t *testing.T, secret string, status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		expected := Sign(secret, r.Header.Get(HeaderTimestamp), body)
+		if !hmac.Equal([]byte(expected), []byte(r.Header.Get(HeaderSignature))) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, models.EventOrderProcessed, r.Header.Get(HeaderEvent))
+		assert.Equal(t, "7", r.Header.Get(HeaderDelivery))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		w.WriteHeader(status)
+	}))
+}
+
+func TestDispatcher_Dispatch(t *testing.T) {
+	payload := []byte(`{"event":"order.processed","data":{"number":"79927398713"}}`)
+
+	tests := []struct {
+		name         string
+		status       int
+		secret       string
+		attempts     int
+		closed       bool
+		mockBehavior func(repo *mocks.MockRepository)
+	}{
+		{
+			name:     "Delivered",
+			status:   http.StatusNoContent,
+			secret:   "secret",
+			attempts: 1,
+			mockBehavior: func(repo *mocks.MockRepository) {
+				repo.EXPECT().CompleteWebhookDelivery(gomock.Any(), int64(7), http.StatusNoContent, gomock.Any()).Return(nil).Times(1)
+			},
+		},
+		{
+			name:     "Wrong secret is rejected and retried",
+			status:   http.StatusOK,
+			secret:   "other",
+			attempts: 1,
+			mockBehavior: func(repo *mocks.MockRepository) {
+				repo.EXPECT().FailWebhookDelivery(gomock.Any(), int64(7), http.StatusUnauthorized, "unexpected status 401 Unauthorized", gomock.Not(gomock.Nil())).
+					DoAndReturn(func(_ context.Context, _ int64, _ int, _ string, next *time.Time) error {
+						assert.WithinDuration(t, time.Now().Add(testConfig.BaseDelay), *next, time.Second)
+						return nil
+					}).Times(1)
+			},
+		},
+		{
+			name:     "Server error on last attempt goes dead",
+			status:   http.StatusInternalServerError,
+			secret:   "secret",
+			attempts: 3,
+			mockBehavior: func(repo *mocks.MockRepository) {
+				repo.EXPECT().FailWebhookDelivery(gomock.Any(), int64(7), http.StatusInternalServerError, gomock.Any(), (*time.Time)(nil)).Return(nil).Times(1)
+			},
+		},
+		{
+			name:     "No response",
+			secret:   "secret",
+			attempts: 2,
+			closed:   true,
+			mockBehavior: func(repo *mocks.MockRepository) {
+				repo.EXPECT().FailWebhookDelivery(gomock.Any(), int64(7), 0, reasonNoResponse, gomock.Not(gomock.Nil())).Return(nil).Times(1)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockRepository(ctrl)
+			server := receiver(t, "secret", test.status)
+			defer server.Close()
+			if test.closed {
+				server.Close()
+			}
+
+			task := models.WebhookTask{ID: 7, URL: server.URL, Secret: test.secret, Event: models.EventOrderProcessed, Payload: payload, Attempts: test.attempts}
+			repo.EXPECT().ClaimWebhookDeliveries(gomock.Any(), gomock.Any(), gomock.Any(), testConfig.BatchSize).
+				Return([]models.WebhookTask{task}, nil).Times(1)
+			test.mockBehavior(repo)
+
+			d := &dispatcher{repo, server.Client(), testConfig}
+			d.dispatch(context.Background())
+		})
+	}
+}
+
+func TestDispatcher_Backoff(t *testing.T) {
+	d := &dispatcher{config: testConfig}
+
+	assert.Equal(t, time.Second, d.backoff(1))
+	assert.Equal(t, time.Second*2, d.backoff(2))
+	assert.Equal(t, time.Second*32, d.backoff(6))
+	assert.Equal(t, time.Minute, d.backoff(10))
+}
+
+func TestSign(t *testing.T) {
+	// Значение совпадает с: printf '1700000000.{}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163", Sign("secret", "1700000000", []byte("{}")))
+}
+
+func TestNewClient(t *testing.T) {
+	server := httptest.NewServer(http.RedirectHandler("http://169.254.169.254/latest/meta-data", http.StatusFound))
+	defer server.Close()
+
+	// Адрес получателя проверяется после разрешения имени
+	_, err := NewClient().Post(server.URL, "application/json", nil)
+	assert.ErrorIs(t, err, ErrForbiddenAddress)
+
+	// Редиректы не выполняются, ответ 302 остаётся ответом получателя
+	client := NewClient()
+	client.Transport = http.DefaultTransport
+	resp, err := client.Post(server.URL, "application/json", nil)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+}
+
+func TestIsPublicIP(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1", "::1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "fe80::1", "fd00::1", "0.0.0.0", "::", "100.64.0.1", "::ffff:127.0.0.1"} {
+		assert.False(t, IsPublicIP(net.ParseIP(addr)), addr)
+	}
+	for _, addr := range []string{"203.0.113.10", "8.8.8.8", "2001:4860:4860::8888"} {
+		assert.True(t, IsPublicIP(net.ParseIP(addr)), addr)
+	}
+}